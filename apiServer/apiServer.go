@@ -6,13 +6,24 @@ import (
 	"runtime"
 	"strconv"
 
+	"apiServer/buckets"
+	"apiServer/cluster"
 	"apiServer/heartbeat"
 	"apiServer/locate"
+	"apiServer/nodes"
 	"apiServer/objects"
+	"apiServer/placement"
+	"apiServer/rebalance"
+	"apiServer/s3"
 	"apiServer/temp"
+	"apiServer/uploads"
 	"apiServer/versions"
+	"common"
 	"common/apiFlag"
+	"config"
 	"hashRing"
+	"membership"
+	"meta"
 )
 
 // 程序初始化：设置线程数量
@@ -21,14 +32,46 @@ func init() {
 }
 
 func main() {
+	// 嵌入式存储：由本进程打开数据库文件并提供元数据服务
+	if *apiFlag.BoltOwner && config.GConfig.MetaBackend == meta.BackendBolt {
+		if err := meta.ServeBolt(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// 没有(bucket, name, version)唯一索引时，并发上传同名对象会产生重复的版本号，故索引创建失败时拒绝启动
+	if err := meta.EnsureIndexes(); err != nil {
+		log.Fatal(common.ErrEnsureIndexes, err)
+	}
+
 	go heartbeat.ListenHeartbeat()
 	go hashRing.CheckHashRing()
 	go objects.ListenObjectsRepair()
+	go objects.StartLostShardScan()
+	go rebalance.StartRebalance()
+	go nodes.StartDrainCheck()
+	go nodes.StartCapacityCheck()
 
+	http.HandleFunc("/buckets/", buckets.Handler)
 	http.HandleFunc("/objects/", objects.Handler)
 	http.HandleFunc("/temp/", temp.Handler)
+	http.HandleFunc("/uploads/", uploads.Handler)
 	http.HandleFunc("/locate/", locate.Handler)
 	http.HandleFunc("/versions/", versions.Handler)
+	http.HandleFunc("/rebalance/", rebalance.Handler)
+	http.HandleFunc("/nodes/", nodes.Handler)
+	http.HandleFunc("/placement/", placement.Handler)
+	http.HandleFunc("/repairs/", objects.RepairsHandler)
+	http.HandleFunc("/cluster/", cluster.Handler)
+	http.HandleFunc("/heartbeat/", membership.Handler)
+
+	// S3兼容接口使用独立的端口（端口为0时不启动）
+	if *apiFlag.S3ListenPort != 0 {
+		go func() {
+			log.Fatal(http.ListenAndServe(
+				*apiFlag.ListenIp+":"+strconv.Itoa(*apiFlag.S3ListenPort), http.HandlerFunc(s3.Handler),
+			))
+		}()
+	}
 
 	log.Fatal(http.ListenAndServe(*apiFlag.ListenIp+":"+strconv.Itoa(*apiFlag.ListenPort), nil))
 }
@@ -0,0 +1,195 @@
+package buckets
+
+import (
+	"common"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"config"
+	"meta"
+	"meta/funcParams"
+	"utils"
+)
+
+// 生成存储桶集合的数据库操作结构体
+func newBucketMongo() (meta.Store, error) {
+	return meta.NewStore(funcParams.MongoParamCollection(config.GConfig.BucketColName))
+}
+
+// 获取存储桶元数据（若不存在则返回的Name为空字符串）
+func GetBucket(bucket string) (bucketMeta *meta.BucketMeta, err error) {
+	var DMongo meta.Store
+
+	if DMongo, err = newBucketMongo(); err != nil {
+		return
+	}
+	return DMongo.GetBucketMeta(bucket)
+}
+
+// 判断存储桶是否存在
+func Exist(bucket string) (exist bool, err error) {
+	var bucketMeta *meta.BucketMeta
+
+	if bucketMeta, err = GetBucket(bucket); err != nil {
+		return
+	}
+	exist = bucketMeta.Name != ""
+	return
+}
+
+// 创建存储桶（若存储桶已存在则created为false），ec为桶内新写入对象的纠删码方案（为空则使用配置文件中的defaultEC）
+func CreateBucket(bucket string, ec common.ECScheme) (created bool, err error) {
+	var DMongo meta.Store
+
+	if DMongo, err = newBucketMongo(); err != nil {
+		return
+	}
+	return DMongo.CreateBucket(bucket, funcParams.MetaParamEC(ec))
+}
+
+// 获取所有存储桶的元数据
+func ListBuckets() (metas []*meta.BucketMeta, err error) {
+	var DMongo meta.Store
+
+	if DMongo, err = newBucketMongo(); err != nil {
+		return
+	}
+	return DMongo.ListBucketMetas()
+}
+
+// -------------------------------------------
+// 创建存储桶：PUT /buckets/<bucket>
+// NOTE: 可以通过请求头x-doss-ec: k+m指定桶内对象的纠删码方案；
+//       存储桶名或纠删码方案不合法返回400，存储桶已存在返回409
+// -------------------------------------------
+func put(w http.ResponseWriter, r *http.Request) {
+	var (
+		bucket  string
+		ec      common.ECScheme
+		created bool
+		err     error
+	)
+
+	if bucket, _ = utils.GetBucketObjectFromPath(r.URL.EscapedPath()); !utils.IsValidBucketName(bucket) {
+		log.Println(common.ErrBucketName, bucket)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if ec, err = utils.GetECFromHeader(r.Header); err != nil {
+		log.Println(err, bucket)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if created, err = CreateBucket(bucket, ec); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !created {
+		w.WriteHeader(http.StatusConflict)
+	}
+}
+
+// -------------------------------------------
+// 获取存储桶信息
+// 1) GET /buckets/：返回所有存储桶的元数据（每行一个）
+// 2) GET /buckets/<bucket>：返回该存储桶的元数据，不存在则返回404
+// -------------------------------------------
+func get(w http.ResponseWriter, r *http.Request) {
+	var (
+		bucket     string
+		bucketMeta *meta.BucketMeta
+		metas      []*meta.BucketMeta
+		resBytes   []byte
+		i          int
+		err        error
+	)
+
+	if bucket, _ = utils.GetBucketObjectFromPath(r.URL.EscapedPath()); bucket != "" {
+		if bucketMeta, err = GetBucket(bucket); err != nil {
+			log.Println(common.ErrGetBucketMeta, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if bucketMeta.Name == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resBytes, _ = json.Marshal(bucketMeta)
+		w.Write(resBytes)
+		return
+	}
+
+	// 返回所有存储桶的元数据
+	if metas, err = ListBuckets(); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	for i = range metas {
+		resBytes, _ = json.Marshal(metas[i])
+		w.Write(resBytes)
+		w.Write([]byte("\n"))
+	}
+}
+
+// -------------------------------------------
+// 删除存储桶：DELETE /buckets/<bucket>
+// NOTE: 存储桶不存在返回404，存储桶非空（存在未被删除的对象）返回409
+// -------------------------------------------
+func del(w http.ResponseWriter, r *http.Request) {
+	var (
+		bucket string
+		err    error
+	)
+
+	bucket, _ = utils.GetBucketObjectFromPath(r.URL.EscapedPath())
+	if err = DeleteBucket(bucket); err != nil {
+		log.Println(err)
+		switch err {
+		case common.ErrBucketNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case common.ErrBucketNotEmpty:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+// 删除存储桶：只有空的存储桶才可以删除，删除时一并清理桶内剩余的删除标记和历史版本元数据
+func DeleteBucket(bucket string) (err error) {
+	var (
+		DMongo      meta.Store
+		bucketMongo meta.Store
+		exist       bool
+		empty       bool
+	)
+
+	if exist, err = Exist(bucket); err != nil {
+		return
+	}
+	if !exist {
+		err = common.ErrBucketNotFound
+		return
+	}
+	if DMongo, err = meta.NewStore(); err != nil {
+		return
+	}
+	if empty, err = DMongo.IsBucketEmpty(bucket); err != nil {
+		return
+	}
+	if !empty {
+		err = common.ErrBucketNotEmpty
+		return
+	}
+	if bucketMongo, err = newBucketMongo(); err != nil {
+		return
+	}
+	if _, err = bucketMongo.DeleteBucketMeta(bucket); err != nil {
+		return
+	}
+	_, err = DMongo.DeleteBucketObjectMetas(bucket)
+	return
+}
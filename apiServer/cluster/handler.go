@@ -0,0 +1,169 @@
+package cluster
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"apiServer/heartbeat"
+	"common"
+	"config"
+	"hashRing"
+	"meta"
+	"meta/funcParams"
+)
+
+// 数据节点的心跳状态
+const (
+	NodeStatusOnline  = "online"  // 最近heartbeatOverTime秒内收到过心跳
+	NodeStatusOffline = "offline" // 收到过心跳但已超时
+	NodeStatusUnknown = "unknown" // 本apiServer没有收到过该节点的心跳（如apiServer刚启动或者节点长时间离线）
+)
+
+// -------------------------------------------
+// 集群中的数据节点：合并数据节点表、心跳和哈希环中的信息
+// Registered：是否已注册到数据节点表（未注册的节点只有心跳信息）；State、Weight、FixedWeight、Full、Zone、Rack：数据节点表中的信息；
+// Status：心跳状态；LastSeen：最近一次收到心跳的时间；InRing、RingWeight：是否在本apiServer的哈希环上及其在哈希环上的权重；
+// Heartbeat：最近一次的心跳消息
+// -------------------------------------------
+type Node struct {
+	Ip          string            `json:"ip"`
+	Addr        string            `json:"addr,omitempty"`
+	NodeId      string            `json:"nodeId,omitempty"`
+	Registered  bool              `json:"registered"`
+	State       string            `json:"state,omitempty"`
+	Weight      int               `json:"weight"`
+	FixedWeight bool              `json:"fixedWeight"`
+	Full        bool              `json:"full"`
+	Zone        string            `json:"zone,omitempty"`
+	Rack        string            `json:"rack,omitempty"`
+	Status      string            `json:"status"`
+	LastSeen    *time.Time        `json:"lastSeen,omitempty"`
+	InRing      bool              `json:"inRing"`
+	RingWeight  int               `json:"ringWeight,omitempty"`
+	Heartbeat   *common.Heartbeat `json:"heartbeat,omitempty"`
+}
+
+// -------------------------------------------
+// 集群成员接口：GET /cluster/nodes
+// 返回所有数据节点（按照ip排序）的状态、最近一次收到心跳的时间以及是否在哈希环上
+// NOTE: 心跳和哈希环为本apiServer内存中的信息，刚启动的apiServer在收到心跳前节点状态为unknown
+// -------------------------------------------
+func Handler(w http.ResponseWriter, r *http.Request) {
+	var (
+		resource = strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), "/cluster/"), "/")
+		nodes    []*Node
+		resBytes []byte
+		err      error
+	)
+
+	if resource != "nodes" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if nodes, err = clusterNodes(); err != nil {
+		log.Println(common.ErrGetAllNode, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resBytes, _ = json.Marshal(nodes)
+	w.Write(resBytes)
+}
+
+// 获取集群中的数据节点：数据节点表中的节点，以及只有心跳（尚未注册或者已从数据节点表中删除）的节点
+func clusterNodes() (nodes []*Node, err error) {
+	var (
+		DMongo   meta.Store
+		dsNodes  []*meta.DsNode
+		dsNode   *meta.DsNode
+		statuses = heartbeat.GetDataServers()
+		ring     = make(map[string]int)
+		ringNode *meta.RingNode
+		node     *Node
+		addr     string
+		status   heartbeat.Status
+	)
+
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.NodeColName)); err != nil {
+		return
+	}
+	if dsNodes, err = DMongo.GetAllNodes(); err != nil {
+		return
+	}
+	for _, ringNode = range hashRing.Snapshot() {
+		ring[ringNode.Ip] = ringNode.Weight
+	}
+
+	for _, dsNode = range dsNodes {
+		node = &Node{
+			Ip:          dsNode.Ip,
+			NodeId:      dsNode.OId.Hex(),
+			Registered:  true,
+			State:       dsNode.State,
+			Weight:      dsNode.Weight,
+			FixedWeight: dsNode.FixedWeight,
+			Full:        dsNode.Full,
+			Zone:        dsNode.Zone,
+			Rack:        dsNode.Rack,
+			Status:      NodeStatusUnknown,
+		}
+		if addr = matchHeartbeat(statuses, dsNode); addr != "" {
+			node.setHeartbeat(addr, statuses[addr])
+			delete(statuses, addr)
+		}
+		nodes = append(nodes, node)
+	}
+	for addr, status = range statuses {
+		node = &Node{}
+		node.Ip, _, _ = net.SplitHostPort(addr)
+		node.setHeartbeat(addr, status)
+		nodes = append(nodes, node)
+	}
+
+	for _, node = range nodes {
+		node.RingWeight, node.InRing = ring[node.Ip]
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Ip < nodes[j].Ip })
+	return
+}
+
+// 查找数据节点的心跳：优先按照心跳中的节点id匹配，旧版本的心跳按照监听地址匹配，没有心跳时返回空字符串
+func matchHeartbeat(statuses map[string]heartbeat.Status, dsNode *meta.DsNode) string {
+	var (
+		addr   string
+		status heartbeat.Status
+	)
+
+	for addr, status = range statuses {
+		if status.Heartbeat.NodeId == dsNode.OId.Hex() {
+			return addr
+		}
+	}
+	for addr, status = range statuses {
+		if status.Heartbeat.NodeId == "" && (addr == dsNode.Ip || strings.HasPrefix(addr, dsNode.Ip+":")) {
+			return addr
+		}
+	}
+	return ""
+}
+
+// 设置数据节点的心跳信息
+func (node *Node) setHeartbeat(addr string, status heartbeat.Status) {
+	node.Addr = addr
+	node.LastSeen = &status.LastSeen
+	node.Heartbeat = &status.Heartbeat
+	if node.NodeId == "" {
+		node.NodeId = status.Heartbeat.NodeId
+	}
+	if node.Status = NodeStatusOffline; status.Online() {
+		node.Status = NodeStatusOnline
+	}
+}
@@ -1,59 +1,91 @@
 package heartbeat
 
 import (
+	"encoding/json"
+	"log"
+	"net"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"common"
 	"config"
-	"github.com/streadway/amqp"
-	"rbmq"
-	"utils"
+	"membership"
 )
 
-var dataServers = make(map[string]time.Time)
+// 超过该时间没有收到心跳的数据节点不再保留其最近一次的心跳（离线的数据节点在此之前仍可查询）
+const offlineRetention = 24 * time.Hour
+
+// 数据节点最近一次的心跳：Heartbeat为心跳消息，LastSeen为收到该心跳的时间
+type Status struct {
+	Heartbeat common.Heartbeat
+	LastSeen  time.Time
+}
+
+// 数据节点是否在线：最近一次心跳距今不超过heartbeatOverTime秒
+func (status *Status) Online() bool {
+	return time.Since(status.LastSeen) <= config.GConfig.HeartbeatOverTime*time.Second
+}
+
+var dataServers = make(map[string]*Status) // key: 数据节点ip:port；value：最近一次的心跳
 var rwMutex sync.RWMutex
 
-// 监听数据节点发送的心跳
+// -------------------------------------------
+// 监听数据节点发送的心跳（传输方式见配置项heartbeatTransport）
+// NOTE: 兼容各版本的心跳消息（见common.HeartbeatVersion），无法解析的消息记录日志后丢弃
+// -------------------------------------------
 func ListenHeartbeat() {
 	var (
-		mq           *rbmq.Consumer
-		deliveryChan <-chan amqp.Delivery
-		dataServer   string
-		err          error
+		subscriber membership.Subscriber
+		body       []byte
+		heartbeat  common.Heartbeat
+		err        error
 	)
 
-	mq = rbmq.NewConsumer(utils.GetRabbitMqUrl())
-	defer mq.Close()
-	mq.DeclareExchange(config.GConfig.HeartbeatExchange)
-	mq.QueueBind(config.GConfig.HeartbeatExchange)
-	deliveryChan = mq.Consume()
+	if subscriber, err = membership.NewSubscriber(); err != nil {
+		log.Fatal(err)
+	}
+	defer subscriber.Close()
 
 	go checkDataServers()
 
-	for msg := range deliveryChan {
-		dataServer, err = strconv.Unquote(string(msg.Body))
-		if err != nil {
-			panic(err)
+	for body = range subscriber.Messages() {
+		if heartbeat, err = parseHeartbeat(body); err != nil {
+			log.Println(common.ErrInvalidHeartbeat, err, strconv.Quote(string(body)))
+			continue
 		}
 		rwMutex.Lock()
-		dataServers[dataServer] = time.Now()
+		dataServers[heartbeat.Addr] = &Status{Heartbeat: heartbeat, LastSeen: time.Now()}
 		rwMutex.Unlock()
 	}
 }
 
-// 定期检查数据节点发送的心跳情况：将超过阈值没有收到心跳的数据节点从map中移除
+// 解析心跳消息：旧版本为监听地址字符串，之后的版本为JSON格式的common.Heartbeat，监听地址须为ip:port
+func parseHeartbeat(body []byte) (heartbeat common.Heartbeat, err error) {
+	var addr string
+
+	if addr, err = strconv.Unquote(string(body)); err == nil {
+		heartbeat.Addr = addr
+	} else if err = json.Unmarshal(body, &heartbeat); err != nil {
+		return
+	}
+	_, _, err = net.SplitHostPort(heartbeat.Addr)
+	return
+}
+
+// 定期清理数据节点的心跳：移除超过offlineRetention没有收到心跳的数据节点
 func checkDataServers() {
 	var (
 		dataServer string
-		timestamp  time.Time
+		status     *Status
 	)
 
 	for {
 		time.Sleep(config.GConfig.HeartbeatInterval * time.Second)
 		rwMutex.Lock()
-		for dataServer, timestamp = range dataServers {
-			if timestamp.Add(config.GConfig.HeartbeatOverTime * time.Second).Before(time.Now()) {
+		for dataServer, status = range dataServers {
+			if time.Since(status.LastSeen) > offlineRetention {
 				delete(dataServers, dataServer)
 			}
 		}
@@ -65,14 +97,50 @@ func checkDataServers() {
 func GetOnlineDataServers() []string {
 	var (
 		ds           string
+		status       *Status
 		dsCollection []string
 	)
 
 	rwMutex.RLock()
 	defer rwMutex.RUnlock()
 	dsCollection = make([]string, 0)
-	for ds = range dataServers {
-		dsCollection = append(dsCollection, ds)
+	for ds, status = range dataServers {
+		if status.Online() {
+			dsCollection = append(dsCollection, ds)
+		}
 	}
 	return dsCollection
 }
+
+// 获取所有数据节点（包括offlineRetention内离线的节点）最近一次心跳的拷贝，key为数据节点ip:port
+func GetDataServers() (statuses map[string]Status) {
+	var (
+		ds     string
+		status *Status
+	)
+
+	rwMutex.RLock()
+	defer rwMutex.RUnlock()
+	statuses = make(map[string]Status, len(dataServers))
+	for ds, status = range dataServers {
+		statuses[ds] = *status
+	}
+	return
+}
+
+// 获取在线数据节点最近一次心跳中的容量信息（node为数据节点ip或者ip:port，没有容量信息时ok为false）
+func GetCapacity(node string) (heartbeat common.Heartbeat, ok bool) {
+	var (
+		ds     string
+		status *Status
+	)
+
+	rwMutex.RLock()
+	defer rwMutex.RUnlock()
+	for ds, status = range dataServers {
+		if (ds == node || strings.HasPrefix(ds, node+":")) && status.Online() && status.Heartbeat.Total > 0 {
+			return status.Heartbeat, true
+		}
+	}
+	return
+}
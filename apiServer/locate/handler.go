@@ -1,23 +1,60 @@
 package locate
 
 import (
+	"common"
 	"encoding/json"
+	"log"
 	"net/http"
-	"strings"
+
+	"meta"
+	"utils"
 )
 
+// 内联存储的对象的定位结果
+type inlineLocation struct {
+	Inline bool  `json:"inline"`
+	Size   int64 `json:"size"`
+}
+
+// 定位对象：GET /locate/<bucket>/<object_name>
+// NOTE: 先根据存储桶和对象名查询对象最新版本的hash值，再按照hash值定位各分片所在的数据节点；
+//       对象数据内联存储在元数据中时返回{"inline": true, "size"}
 func Handler(w http.ResponseWriter, r *http.Request) {
 	var (
+		bucket     string
+		name       string
+		DMongo     meta.Store
+		Meta       *meta.ObjectMeta
 		locateInfo map[int]string
-		elmName    string
 		resBytes   []byte
+		err        error
 	)
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	elmName = strings.Split(r.URL.EscapedPath(), "/")[2]
-	if locateInfo = Locate(elmName); len(locateInfo) == 0 {
+	if bucket, name = utils.GetBucketObjectFromPath(r.URL.EscapedPath()); name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if DMongo, err = meta.NewStore(); err == nil {
+		Meta, err = DMongo.GetLastVersionMeta(bucket, name)
+	}
+	if err != nil {
+		log.Println(common.ErrGetLastVersionMeta, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if Meta == nil || Meta.Hash == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if Meta.Inline {
+		resBytes, _ = json.Marshal(&inlineLocation{Inline: true, Size: Meta.Size})
+		w.Write(resBytes)
+		return
+	}
+	if locateInfo = Locate(Meta.Hash, Meta.Scheme()); len(locateInfo) == 0 {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
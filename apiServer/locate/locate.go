@@ -2,33 +2,36 @@ package locate
 
 import (
 	"common"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 
 	"apiServer/heartbeat"
 	"config"
 	"hashRing"
+	"meta"
+	"meta/funcParams"
 	"utils"
 )
 
-func Locate(elmName string) (locateInfo map[int]string) {
+// 定位对象数据的各分片（ec为该hash值数据的纠删码方案，返回key为分片下标、value为数据节点）
+func Locate(elmName string, ec common.ECScheme) (locateInfo map[int]string) {
 	var (
 		dataServers []string
 		nodes       []string
+		writeNodes  []string
 		node        string
 		index       int
-		request     *http.Request
-		response    *http.Response
-		resData     []byte
 		shardIndex  int
 		err         error
 	)
 
 	// 获取数据的定位节点
-	if nodes, err = hashRing.GetNodes(elmName, config.GConfig.AllShards); err != nil {
+	if nodes, err = hashRing.GetNodes(elmName, ec); err != nil {
 		log.Fatal(common.ErrDataLocate, err)
 		return
 	}
@@ -37,33 +40,130 @@ func Locate(elmName string) (locateInfo map[int]string) {
 	dataServers = heartbeat.GetOnlineDataServers()
 
 	// 返回定位信息
+	// NOTE: 下线中的数据节点已移出哈希环，但在分片迁移完成前其上的分片仍可读取，故同样向其发送定位请求；
+	//       定位到已满节点的分片写入了其他节点（见hashRing.GetWriteNodes），故同样向这些节点发送定位请求
 	locateInfo = make(map[int]string)
-	for _, node = range nodes {
+	writeNodes, _ = hashRing.GetWriteNodes(elmName, ec)
+	for _, node = range utils.SliceRemoveReplica(append(append(nodes, writeNodes...), hashRing.OffRingNodes()...)) {
 		if index = utils.SliceIndexOfMember(dataServers, node); index != -1 {
-			// 向数据节点发送GET数据定位请求
-			request, err = http.NewRequest("GET", "http://"+dataServers[index]+"/locate/"+elmName, nil)
-			if err != nil {
-				continue
+			// 向数据节点发送GET数据定位请求，解析各分片所在数据节点
+			if shardIndex = LocateShard(dataServers[index], elmName); shardIndex != -1 {
+				if _, ok := locateInfo[shardIndex]; !ok {
+					locateInfo[shardIndex] = node
+				}
 			}
-			client := http.Client{}
-			if response, err = client.Do(request); err != nil {
-				continue
-			}
-			if resData, err = ioutil.ReadAll(response.Body); err != nil || len(resData) == 0 {
-				continue
+		}
+	}
+	return
+}
+
+// 向数据节点（ip:port）查询其上存储的对象分片的index（不存在或请求失败时返回-1）
+func LocateShard(server string, elmName string) (shardIndex int) {
+	var (
+		request  *http.Request
+		response *http.Response
+		resData  []byte
+		err      error
+	)
+
+	shardIndex = -1
+	if request, err = http.NewRequest("GET", "http://"+server+"/locate/"+elmName, nil); err != nil {
+		return
+	}
+	client := http.Client{}
+	if response, err = client.Do(request); err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if resData, err = ioutil.ReadAll(response.Body); err != nil || len(resData) == 0 {
+		return
+	}
+	if shardIndex, err = strconv.Atoi(string(resData)); err != nil {
+		shardIndex = -1
+	}
+	return
+}
+
+// 数据节点server上是否存储了元素的第index个分片
+// NOTE: 数据节点上可能同时存储了同一元素的多个分片（如迁移中的旧分片和新分片），而LocateShard只返回其中一个，
+//       故确认某个分片是否存在时按照分片名（元素名.分片下标）定位
+func HasShard(server string, elmName string, index int) bool {
+	return LocateShard(server, fmt.Sprintf("%s.%d", elmName, index)) == index
+}
+
+// -------------------------------------------
+// 读取对象时定位各分片（返回key为分片下标、value为在线的数据节点ip:port）：
+// 1) targets为目标哈希环上的定位节点（第i个节点存储第i个分片），others为该对象的分片可能仍位于的其他节点
+//    （未完成的迁移任务的源哈希环上与目标节点不同的定位节点、代替已满节点写入的节点、哈希环外的节点），
+//    没有其他节点时直接从目标节点读取；
+// 2) 否则并发地向目标节点和其他节点查询其上存储的分片下标：每个分片优先从持有该分片的目标节点读取，
+//    其次从报告持有该分片的其他节点读取（分片尚未迁移至目标节点）；
+// 3) 没有节点报告持有的分片仍从目标节点读取（读取时由纠删码恢复后写入目标节点）
+// NOTE: dataServers为在线的数据节点，离线的节点略过
+// -------------------------------------------
+func ReadLocate(elmName string, targets []string, others []string, dataServers []string) (locateInfo map[int]string) {
+	var (
+		servers  []string
+		reported []int
+		wg       sync.WaitGroup
+		index    int
+		i        int
+	)
+
+	locateInfo = make(map[int]string)
+	if len(others) == 0 {
+		for i = range targets {
+			if index = utils.SliceIndexOfMember(dataServers, targets[i]); index != -1 {
+				locateInfo[i] = dataServers[index]
 			}
-			// 解析各分片所在数据节点
-			if shardIndex, err = strconv.Atoi(string(resData)); err != nil || shardIndex == -1 {
-				continue
+		}
+		return
+	}
+
+	// 并发查询在线节点上存储的分片下标
+	for _, node := range utils.SliceRemoveReplica(append(append([]string{}, targets...), others...)) {
+		if index = utils.SliceIndexOfMember(dataServers, node); index != -1 {
+			servers = append(servers, dataServers[index])
+		}
+	}
+	servers = utils.SliceRemoveReplica(servers)
+	reported = make([]int, len(servers))
+	for i = range servers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reported[i] = LocateShard(servers[i], elmName)
+		}(i)
+	}
+	wg.Wait()
+
+	// 已位于目标节点上的分片
+	for i = range targets {
+		if index = utils.SliceIndexOfMember(servers, targets[i]); index != -1 && reported[index] == i {
+			locateInfo[i] = servers[index]
+		}
+	}
+
+	// 尚未迁移至目标节点的分片
+	for i = range servers {
+		if _, ok := locateInfo[reported[i]]; !ok && reported[i] != -1 {
+			locateInfo[reported[i]] = servers[i]
+		}
+	}
+
+	// 没有节点报告持有的分片
+	for i = range targets {
+		if _, ok := locateInfo[i]; !ok {
+			if index = utils.SliceIndexOfMember(servers, targets[i]); index != -1 {
+				locateInfo[i] = servers[index]
 			}
-			locateInfo[shardIndex] = node
 		}
 	}
 	return
 }
 
-// 获取元素定位的节点集合（只获取在线的节点）
-func GetLocateNodes(name string) (Nodes []string, err error) {
+// 获取写入元素时定位的节点集合（只获取在线的节点，按照纠删码方案ec获取ec.AllShards()个节点，已满的节点略过）
+func GetLocateNodes(name string, ec common.ECScheme) (Nodes []string, err error) {
 	var (
 		Node        string
 		OnlineNodes []string
@@ -73,9 +173,16 @@ func GetLocateNodes(name string) (Nodes []string, err error) {
 	)
 
 	// 获取对象定位的数据节点集合
-	Nodes, _ = hashRing.GetNodes(name, config.GConfig.AllShards)
-	if len(Nodes) != config.GConfig.AllShards {
+	// NOTE: 哈希环上的节点足够，但故障域不足以使每个故障域最多放置修复分片数个分片，
+	//       或者没有可以代替已满节点的节点时，同样无法写入
+	Nodes, _ = hashRing.GetWriteNodes(name, ec)
+	if len(Nodes) != ec.AllShards() {
 		err = common.ErrNotEnoughDS
+		if nodes, _ := hashRing.GetNodes(name, ec); len(nodes) == ec.AllShards() {
+			err = common.ErrNodesFull
+		} else if len(hashRing.Members()) >= ec.AllShards() {
+			err = common.ErrFailureDomains
+		}
 		return
 	}
 
@@ -97,6 +204,44 @@ func GetLocateNodes(name string) (Nodes []string, err error) {
 	return
 }
 
-func FileExist(elmName string) bool {
-	return len(Locate(elmName)) >= config.GConfig.DataShards
+// 判断数据是否存在：可访问到的分片数不小于纠删码方案的数据分片数
+func FileExist(elmName string, ec common.ECScheme) bool {
+	return len(Locate(elmName, ec)) >= ec.DataShards
+}
+
+// -------------------------------------------
+// 获取该hash值的数据已有的纠删码方案：
+// 1) 相同hash值的数据只存储一份，其纠删码方案由第一次写入时决定，之后写入相同数据的对象沿用该方案；
+// 2) 依次查找引用该hash值的对象元数据和part元数据，均不存在时返回ec（即本次写入指定的方案）；
+// 3) 内联存储的对象数据不在数据节点上，不影响写入数据节点的方案
+// -------------------------------------------
+func StoredScheme(hash string, ec common.ECScheme) (scheme common.ECScheme, err error) {
+	var (
+		DMongo  meta.Store
+		objMeta *meta.ObjectMeta
+		parts   []*meta.UploadPartMeta
+	)
+
+	if DMongo, err = meta.NewStore(); err != nil {
+		return
+	}
+	if objMeta, err = DMongo.GetMetaByHash(hash); err != nil {
+		return
+	}
+	if objMeta != nil && !objMeta.Inline {
+		scheme = objMeta.Scheme()
+		return
+	}
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.UploadColName)); err != nil {
+		return
+	}
+	if parts, err = DMongo.GetUploadPartsByHash(hash); err != nil {
+		return
+	}
+	if len(parts) > 0 {
+		scheme = parts[0].Scheme()
+		return
+	}
+	scheme = ec
+	return
 }
@@ -0,0 +1,123 @@
+package locate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"common"
+	"hashRing"
+	"meta"
+)
+
+// 模拟数据节点的定位接口：返回该节点上存储的对象分片下标
+func newLocateServer(shards map[string]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if index, ok := shards[strings.TrimPrefix(r.URL.Path, "/locate/")]; ok {
+			_, _ = w.Write([]byte(strconv.Itoa(index)))
+		}
+	}))
+}
+
+func TestReadLocate(t *testing.T) {
+	var (
+		ec          = common.ECScheme{DataShards: 2, ParityShards: 1}
+		shards      = make([]map[string]int, 4)
+		dataServers = make([]string, 4)
+		before      []*meta.RingNode
+		after       []*meta.RingNode
+		source      *hashRing.HashRing
+		target      *hashRing.HashRing
+		sources     []string
+		targets     []string
+		locateInfo  map[int]string
+		hash        string
+		moved       bool
+		i           int
+	)
+
+	for i = range dataServers {
+		shards[i] = make(map[string]int)
+		server := newLocateServer(shards[i])
+		defer server.Close()
+		dataServers[i] = strings.TrimPrefix(server.URL, "http://")
+		after = append(after, &meta.RingNode{Ip: dataServers[i], Weight: 1})
+	}
+
+	// 哈希环由3个节点变为4个节点，查找分片位置发生变化的对象（2+1纠删码方案）
+	before = after[:3]
+	source, target = hashRing.NewHashRing(before), hashRing.NewHashRing(after)
+	for i = 0; !moved; i++ {
+		hash = fmt.Sprintf("object-%d", i)
+		sources, targets = source.GetNodes(hash, ec), target.GetNodes(hash, ec)
+		for j := range sources {
+			moved = moved || sources[j] != targets[j]
+		}
+	}
+
+	// 分片尚未迁移：位于源哈希环上的定位节点
+	for i = range sources {
+		for j := range dataServers {
+			if dataServers[j] == sources[i] {
+				shards[j][hash] = i
+			}
+		}
+	}
+
+	// 只按照目标哈希环读取时，部分分片的定位节点上没有该分片
+	locateInfo = ReadLocate(hash, targets, nil, dataServers)
+	moved = false
+	for i = range targets {
+		moved = moved || locateInfo[i] != sources[i]
+	}
+	if !moved {
+		t.Error("expected target ring to miss shards before migration")
+	}
+
+	// 从源哈希环上的节点读取尚未迁移的分片
+	locateInfo = ReadLocate(hash, targets, sources, dataServers)
+	for i = range sources {
+		if locateInfo[i] != sources[i] {
+			t.Errorf("shard %d located at %s, expected %s", i, locateInfo[i], sources[i])
+		}
+	}
+
+	// 持有分片的节点离线时，该分片从目标节点读取（由纠删码恢复）
+	for i = range sources {
+		if sources[i] != targets[i] {
+			break
+		}
+	}
+	locateInfo = ReadLocate(hash, targets, sources, removeServer(dataServers, sources[i]))
+	if locateInfo[i] != targets[i] {
+		t.Errorf("shard %d located at %s, expected target %s", i, locateInfo[i], targets[i])
+	}
+
+	// 分片迁移完成后按照目标哈希环读取
+	for j := range shards {
+		delete(shards[j], hash)
+		for i = range targets {
+			if dataServers[j] == targets[i] {
+				shards[j][hash] = i
+			}
+		}
+	}
+	locateInfo = ReadLocate(hash, targets, sources, dataServers)
+	for i = range targets {
+		if locateInfo[i] != targets[i] {
+			t.Errorf("shard %d located at %s, expected %s", i, locateInfo[i], targets[i])
+		}
+	}
+}
+
+func removeServer(servers []string, server string) (result []string) {
+	for _, s := range servers {
+		if s != server {
+			result = append(result, s)
+		}
+	}
+	return
+}
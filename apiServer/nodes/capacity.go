@@ -0,0 +1,96 @@
+package nodes
+
+import (
+	"log"
+	"time"
+
+	"apiServer/heartbeat"
+	"common"
+	"config"
+	"meta"
+	"meta/funcParams"
+)
+
+// 按照心跳中的容量检查数据节点权重和磁盘使用率的间隔
+const capacityCheckInterval = time.Minute
+
+// 已满的数据节点磁盘使用率低于水位线减去该值后才恢复写入（避免使用率在水位线附近波动时频繁切换）
+const fullRecoverMargin = 0.05
+
+// -------------------------------------------
+// 定期按照数据节点心跳中的容量调整数据节点：
+// 1) 权重未由weight参数指定的节点，按照在线磁盘的总容量计算权重（每TB为1），只在容量变化明显
+//    （见common.CapacityWeightChanged）且所有磁盘都在线时调整，避免容量的微小变化或者磁盘暂时离线导致分片迁移；
+// 2) 磁盘使用率超过nodeFullWatermark的节点标记为已满：仍在哈希环上，其上已有的分片不迁移，只是不再写入新的分片，
+//    使用率低于nodeFullWatermark-fullRecoverMargin后恢复写入
+// NOTE: 只修改数据节点表，各apiServer监听到节点变化后更新哈希环，由数据迁移任务迁移受影响的分片；
+//       多个apiServer同时检查时按照相同的容量得到相同的结果，数据没有变化时不产生节点变化事件
+// -------------------------------------------
+func StartCapacityCheck() {
+	for {
+		time.Sleep(capacityCheckInterval)
+		checkCapacities()
+	}
+}
+
+func checkCapacities() {
+	var (
+		DMongo   meta.Store
+		nodes    []*meta.DsNode
+		node     *meta.DsNode
+		capacity common.Heartbeat
+		weight   int
+		full     bool
+		ok       bool
+		err      error
+	)
+
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.NodeColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	if nodes, err = DMongo.GetAllNodes(); err != nil {
+		log.Println(common.ErrGetAllNode, err)
+		return
+	}
+	for _, node = range nodes {
+		// 下线中的节点不再调整；离线或者没有汇报容量（旧版本dataServer）的节点保持不变
+		if node.State == meta.NodeStateDraining {
+			continue
+		}
+		if capacity, ok = heartbeat.GetCapacity(node.Ip); !ok {
+			continue
+		}
+
+		weight = common.CapacityWeight(capacity.Total)
+		if !node.FixedWeight && capacity.AllDisksOnline() && common.CapacityWeightChanged(node.Weight, capacity.Total) {
+			if _, err = DMongo.SetDsNodeWeight(node.Ip, weight, false); err != nil {
+				log.Println(common.ErrSetNodeWeight, node.Ip, err)
+				continue
+			}
+			log.Println("dataServer", node.Ip, "weight changed from", node.Weight, "to", weight,
+				"by capacity", capacity.Total)
+		}
+
+		if full = nodeFull(node, &capacity); full != node.Full {
+			if _, err = DMongo.SetDsNodeFull(node.Ip, full); err != nil {
+				log.Println(common.ErrSetNodeFull, node.Ip, err)
+				continue
+			}
+			log.Println("dataServer", node.Ip, "full:", full, "usage:", capacity.Usage())
+		}
+	}
+}
+
+// 判断数据节点是否已满（已满的节点使用率低于水位线减去fullRecoverMargin后才恢复）
+func nodeFull(node *meta.DsNode, capacity *common.Heartbeat) bool {
+	var watermark = config.GConfig.NodeFullWatermark
+
+	if watermark <= 0 {
+		return false
+	}
+	if node.Full {
+		watermark -= fullRecoverMargin
+	}
+	return capacity.Usage() >= watermark
+}
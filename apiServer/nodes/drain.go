@@ -0,0 +1,162 @@
+package nodes
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"apiServer/heartbeat"
+	"common"
+	"config"
+	"meta"
+	"meta/funcParams"
+)
+
+// 检查下线中的数据节点是否已完成分片迁移的间隔
+const drainCheckInterval = 30 * time.Second
+
+// 数据节点上存储的分片数量（dataServer的GET /stat/接口）
+type shardStat struct {
+	Objects    int `json:"objects"`
+	MiniShards int `json:"miniShards"`
+}
+
+// 数据节点的下线进度
+// Node：数据节点元数据；Online：节点是否在线；Shards：节点上剩余的分片数量（节点离线时为nil）；
+// Rebalance：当前的数据迁移任务
+type drainStatus struct {
+	Node      *meta.DsNode
+	Online    bool
+	Shards    *shardStat
+	Rebalance *meta.RebalanceJob
+}
+
+// -------------------------------------------
+// 定期检查下线中的数据节点：
+// 1) 数据节点置为下线中后，各apiServer将其移出哈希环，由数据迁移任务将其上的分片迁移至新哈希环上的定位节点；
+// 2) 目标哈希环不包含该节点的迁移任务完成后，若有迁移失败的对象则重新执行迁移任务，否则从数据节点表中删除该节点
+// NOTE: 多个apiServer同时检查时，重新执行迁移任务和删除节点都是幂等的
+// -------------------------------------------
+func StartDrainCheck() {
+	for {
+		time.Sleep(drainCheckInterval)
+		checkDrainingNodes()
+	}
+}
+
+func checkDrainingNodes() {
+	var (
+		DMongo  meta.Store
+		DMongo2 meta.Store
+		nodes   []*meta.DsNode
+		node    *meta.DsNode
+		job     *meta.RebalanceJob
+		err     error
+	)
+
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.NodeColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	if DMongo2, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RebalanceColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	if nodes, err = DMongo.GetAllNodes(); err != nil {
+		log.Println(common.ErrGetAllNode, err)
+		return
+	}
+	for _, node = range nodes {
+		if node.State != meta.NodeStateDraining {
+			continue
+		}
+		if job, err = DMongo2.GetRebalanceJob(); err != nil {
+			log.Println(err)
+			return
+		}
+		if job == nil || job.State != meta.RebalanceStateFinished || inRing(job.Target, node.Ip) {
+			continue
+		}
+		if job.Failed > 0 {
+			log.Println("retry rebalance job for draining node", node.Ip, "failed objects:", job.Failed)
+			if _, err = DMongo2.RetryRebalanceJob(); err != nil {
+				log.Println(err)
+			}
+			return
+		}
+		if _, err = DMongo.DeleteDsNodeByIp(node.Ip); err != nil {
+			log.Println(common.ErrDrainNode, node.Ip, err)
+			continue
+		}
+		log.Println("dataServer", node.Ip, "drained and removed")
+	}
+}
+
+// 获取数据节点的下线进度（节点不存在时返回nil）
+func getDrainStatus(ip string) (nodeStatus *drainStatus, err error) {
+	var (
+		DMongo meta.Store
+		node   *meta.DsNode
+		server string
+	)
+
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.NodeColName)); err != nil {
+		return
+	}
+	if node, err = DMongo.GetNodeByIp(ip); err != nil {
+		if err == common.ErrNodeNotFound {
+			err = nil
+		}
+		return
+	}
+	nodeStatus = &drainStatus{Node: node}
+
+	for _, dataServer := range heartbeat.GetOnlineDataServers() {
+		if strings.Contains(dataServer, ip) {
+			server = dataServer
+			break
+		}
+	}
+	if nodeStatus.Online = server != ""; nodeStatus.Online {
+		nodeStatus.Shards = getShardStat(server)
+	}
+
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RebalanceColName)); err != nil {
+		return
+	}
+	nodeStatus.Rebalance, err = DMongo.GetRebalanceJob()
+	return
+}
+
+// 向数据节点（ip:port）查询其上存储的分片数量（请求失败时返回nil）
+func getShardStat(server string) (stat *shardStat) {
+	var (
+		response *http.Response
+		err      error
+	)
+
+	if response, err = http.Get("http://" + server + "/stat/"); err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return
+	}
+	stat = &shardStat{}
+	if err = json.NewDecoder(response.Body).Decode(stat); err != nil {
+		stat = nil
+	}
+	return
+}
+
+// 判断节点是否位于哈希环上
+func inRing(ring []*meta.RingNode, ip string) bool {
+	for _, node := range ring {
+		if node.Ip == ip {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package nodes
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"common"
+	"config"
+	"meta"
+	"meta/funcParams"
+)
+
+// -------------------------------------------
+// 数据节点管理接口：
+// 1) GET /nodes/：列举所有数据节点；
+// 2) GET /nodes/<ip>：查询数据节点及其下线进度（节点上剩余的分片数量、数据迁移任务）；
+// 3) DELETE /nodes/<ip>：下线数据节点（将节点置为下线中，分片迁移完成后从数据节点表中删除）
+// -------------------------------------------
+func Handler(w http.ResponseWriter, r *http.Request) {
+	var ip = strings.TrimPrefix(r.URL.EscapedPath(), "/nodes/")
+
+	switch {
+	case r.Method == http.MethodGet && ip == "":
+		list(w)
+	case r.Method == http.MethodGet:
+		status(w, ip)
+	case r.Method == http.MethodDelete && ip != "":
+		drain(w, ip)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// 列举所有数据节点
+func list(w http.ResponseWriter) {
+	var (
+		DMongo   meta.Store
+		nodes    []*meta.DsNode
+		resBytes []byte
+		err      error
+	)
+
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.NodeColName)); err == nil {
+		nodes, err = DMongo.GetAllNodes()
+	}
+	if err != nil {
+		log.Println(common.ErrGetAllNode, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	for _, node := range nodes {
+		resBytes, _ = json.Marshal(node)
+		w.Write(resBytes)
+		w.Write([]byte("\n"))
+	}
+}
+
+// 查询数据节点的下线进度
+func status(w http.ResponseWriter, ip string) {
+	var (
+		nodeStatus *drainStatus
+		resBytes   []byte
+		err        error
+	)
+
+	if nodeStatus, err = getDrainStatus(ip); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if nodeStatus == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	resBytes, _ = json.Marshal(nodeStatus)
+	w.Write(resBytes)
+}
+
+// 下线数据节点：将节点置为下线中（重复请求同样返回202）
+func drain(w http.ResponseWriter, ip string) {
+	var (
+		DMongo  meta.Store
+		matched bool
+		err     error
+	)
+
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.NodeColName)); err == nil {
+		matched, err = DMongo.SetDsNodeState(ip, meta.NodeStateDraining)
+	}
+	if err != nil {
+		log.Println(common.ErrDrainNode, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !matched {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
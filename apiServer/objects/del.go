@@ -4,31 +4,51 @@ import (
 	"config"
 	"meta"
 	"meta/funcParams"
+	"utils"
 
 	"log"
 	"net/http"
-	"strings"
 )
 
 func del(w http.ResponseWriter, r *http.Request) {
 	var (
-		DMongo  *meta.DossMongo
-		objMeta *meta.ObjectMeta
-		objName string
-		err     error
+		bucket string
+		name   string
+		err    error
 	)
 
-	// 删除对象时，只是将元数据中该对象的hash设置为空字符串（此为删除标记的约定）
-	DMongo = meta.NewDossMongo()
-	objName = strings.Split(r.URL.EscapedPath(), "/")[2]
-	objMeta, err = DMongo.GetObjectMeta(objName)
-	if _, err = DMongo.PutObjectMeta(objName, 0, ""); err != nil {
+	if bucket, name = utils.GetBucketObjectFromPath(r.URL.EscapedPath()); name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err = DeleteObject(bucket, name); err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+}
+
+// 删除对象：只是将元数据中该对象的hash设置为空字符串（此为删除标记的约定）
+func DeleteObject(bucket string, name string) (err error) {
+	var (
+		DMongo  meta.Store
+		objMeta *meta.ObjectMeta
+	)
+
+	if DMongo, err = meta.NewStore(); err != nil {
+		return
+	}
+	objMeta, _ = DMongo.GetObjectMeta(bucket, name)
+	if _, err = DMongo.PutObjectMeta(bucket, name, 0, ""); err != nil {
+		return
+	}
 
 	// 若该对象为小文件，则将其分片的hash也标记为空字符串
-	DMongo = meta.NewDossMongo(funcParams.MongoParamCollection(config.GConfig.ObjShardColName))
-	_, _ = DMongo.DeleteShardMetaByObjHash(objMeta.Hash)
+	if objMeta != nil && objMeta.Hash != "" {
+		if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.ObjShardColName)); err != nil {
+			return
+		}
+		_, _ = DMongo.DeleteShardMetaByObjHash(objMeta.Hash)
+	}
+	return
 }
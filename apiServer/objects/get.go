@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"strconv"
-	"strings"
 
 	"apiServer/heartbeat"
-	"config"
+	"apiServer/locate"
+	"apiServer/rebalance"
 	"hashRing"
 	"meta"
 	"meta/funcParams"
@@ -20,94 +22,298 @@ import (
 
 func get(w http.ResponseWriter, r *http.Request) {
 	var (
-		Meta      *meta.ObjectMeta
-		name      string
-		qVersion  []string
-		version   int
-		getStream *stream.RSGetStream
-		offset    int64
-		err       error
+		Meta       *meta.ObjectMeta
+		bucket     string
+		name       string
+		statusCode int
+		ranges     []utils.ByteRange
+		err        error
 	)
 
-	// 提交参数检查（name、version）
-	name = strings.Split(r.URL.EscapedPath(), "/")[2]
-	qVersion = r.URL.Query()["version"]
-	version = 0
-	if len(qVersion) != 0 {
-		if version, err = strconv.Atoi(qVersion[0]); err != nil {
-			log.Println(err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	// 提交参数检查（bucket、name），未指定对象名时列举存储桶中的对象
+	if bucket, name = utils.GetBucketObjectFromPath(r.URL.EscapedPath()); bucket == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if name == "" {
+		list(w, r, bucket)
+		return
 	}
 
 	// 获取相应版本的对象元数据
-	// 1) 若url中未加version查询参数，则返回最新的版本；
-	// 2) 若url中存在version查询参数，则返回对应的版本；若不存在该版本，返回http.StatusNotFound
-	if version == 0 {
-		Meta, err = meta.NewDossMongo().GetObjectMeta(name)
-	} else {
-		Meta, err = meta.NewDossMongo().GetObjectMeta(name, funcParams.MetaParamVersion(version))
-	}
-	if err != nil {
-		log.Println("Get object meta error: ", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+	if Meta, statusCode = getRequestMeta(r, bucket, name); statusCode != http.StatusOK {
+		w.WriteHeader(statusCode)
 		return
 	}
-	if Meta.Hash == "" {
-		w.WriteHeader(http.StatusNotFound)
+	setObjectHeaders(w, Meta)
+
+	// 解析Range请求头：区间不可满足时返回416，格式错误时忽略该请求头（返回整个对象）
+	if ranges, err = utils.ParseRangeHeader(r.Header.Get("range"), Meta.Size); err == common.ErrRangeNotSatisfiable {
+		w.Header().Set("content-range", fmt.Sprintf("bytes */%d", Meta.Size))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
 		return
+	} else if err != nil {
+		ranges = nil
 	}
 
-	// 生成对象下载流
-	if getStream, err = GetStream(Meta); err != nil {
+	// 将对象数据（或请求的区间）写入响应
+	if err = ServeObject(w, Meta, ranges); err != nil {
 		log.Println("GetRSStream error:", err)
 		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// -------------------------------------------
+// 将对象数据写入响应（调用前须已设置好其他响应头）
+// 1) ranges为空：返回200和整个对象；
+// 2) 只有一个区间：返回206和该区间的数据，Content-Range为该区间；
+// 3) 多个区间：返回206，响应体为multipart/byteranges，每个part带有各自的Content-Range
+// NOTE: 区间读取时下载流直接从区间所在的条带开始读取分片；
+//       只有在生成第一个下载流失败时才返回err（此时尚未写入响应头），调用者可据此返回错误状态码；
+//       响应头发出后读取失败时中断连接（见abortResponse），不再向不完整的响应体后追加错误信息
+// -------------------------------------------
+func ServeObject(w http.ResponseWriter, Meta *meta.ObjectMeta, ranges []utils.ByteRange) (err error) {
+	var (
+		getStream stream.ObjectGetStream
+		byteRange utils.ByteRange
+		mWriter   *multipart.Writer
+		part      io.Writer
+		position  int64
+		written   int64
+		i         int
+	)
+
+	// 生成对象下载流
+	if len(ranges) == 0 {
+		getStream, err = GetStream(Meta)
+	} else {
+		getStream, err = GetRangeStream(Meta, ranges[0].Start)
+	}
+	if err != nil {
+		return
+	}
+
+	// 调用Close方法将GetStream中分片修复的数据流提交转正，dataServer将临时对象转为正式对象
+	defer func() {
+		if getStream != nil {
+			getStream.Close()
+		}
+	}()
+	w.Header().Set("accept-ranges", "bytes")
+
+	// 返回整个对象
+	if len(ranges) == 0 {
+		w.Header().Set("content-length", strconv.FormatInt(Meta.Size, 10))
+		if written, err = io.Copy(w, getStream); err == nil && written != Meta.Size {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			abortResponse(err)
+		}
 		return
 	}
 
-	// 从请求头获取对象读取偏移量，并移动对象下载流的seek指针
-	if offset = utils.GetOffsetFromHeader(r.Header); offset != 0 {
-		_ = getStream.Seek(offset, io.SeekCurrent)
-		w.Header().Set("content-range", fmt.Sprintf("bytes %d-%d/%d", offset, Meta.Size-1, Meta.Size))
+	// 返回单个区间
+	if len(ranges) == 1 {
+		byteRange = ranges[0]
+		w.Header().Set("content-range", byteRange.ContentRange(Meta.Size))
+		w.Header().Set("content-length", strconv.FormatInt(byteRange.Length, 10))
 		w.WriteHeader(http.StatusPartialContent)
+		if _, err = io.CopyN(w, getStream, byteRange.Length); err != nil {
+			abortResponse(err)
+		}
+		return
 	}
 
-	// 将对象数据流式拷贝到http.ResponseWriter
-	io.Copy(w, getStream)
+	// 返回多个区间：下载流只能向后移动，若区间起始位置在当前读取位置之前，则重新生成下载流
+	mWriter = multipart.NewWriter(w)
+	w.Header().Set("content-type", "multipart/byteranges; boundary="+mWriter.Boundary())
+	w.WriteHeader(http.StatusPartialContent)
+	position = ranges[0].Start
+	for i, byteRange = range ranges {
+		if i > 0 && byteRange.Start < position {
+			getStream.Close()
+			if getStream, err = GetRangeStream(Meta, byteRange.Start); err != nil {
+				abortResponse(err)
+			}
+		} else if byteRange.Start > position {
+			if _, err = getStream.Seek(byteRange.Start-position, io.SeekCurrent); err != nil {
+				abortResponse(err)
+			}
+		}
+		part, err = mWriter.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {"application/octet-stream"},
+			"Content-Range": {byteRange.ContentRange(Meta.Size)},
+		})
+		if err == nil {
+			_, err = io.CopyN(part, getStream, byteRange.Length)
+		}
+		if err != nil {
+			abortResponse(err)
+		}
+		position = byteRange.Start + byteRange.Length
+	}
+	if err = mWriter.Close(); err != nil {
+		abortResponse(err)
+	}
+	return
+}
 
-	// 调用Close方法将GetStream中分片修复的数据流提交转正，dataServer将临时对象转为正式对象
-	getStream.Close()
+// -------------------------------------------
+// 响应头发出后读取对象数据失败：记录日志并中断连接
+// NOTE: 此时状态码已发出，无法再返回错误；panic(http.ErrAbortHandler)由net/http捕获并直接关闭连接
+//       （不打印堆栈），客户端据此得知响应体不完整，而不是收到截断的数据或者追加在数据之后的错误信息
+// -------------------------------------------
+func abortResponse(err error) {
+	log.Println(common.ErrResponseAborted, err)
+	panic(http.ErrAbortHandler)
 }
 
-// 生成数据下载流
-func GetStream(Meta *meta.ObjectMeta) (getStream *stream.RSGetStream, err error) {
+// -------------------------------------------
+// 根据请求获取相应版本的对象元数据
+// 1) 若url中未加version查询参数，则返回最新的版本；
+// 2) 若url中存在version查询参数，则返回对应的版本；若不存在该版本或该版本为删除标记，返回http.StatusNotFound
+// -------------------------------------------
+func getRequestMeta(r *http.Request, bucket string, name string) (Meta *meta.ObjectMeta, statusCode int) {
 	var (
-		locateInfo  map[int]string
-		dataServers []string
-		nodes       []string
-		node        string
-		index       int
-		i           int
+		DMongo   meta.Store
+		qVersion []string
+		version  int
+		err      error
+	)
+
+	qVersion = r.URL.Query()["version"]
+	if len(qVersion) != 0 {
+		if version, err = strconv.Atoi(qVersion[0]); err != nil {
+			log.Println(err)
+			statusCode = http.StatusBadRequest
+			return
+		}
+	}
+	if DMongo, err = meta.NewStore(); err == nil {
+		if version == 0 {
+			Meta, err = DMongo.GetObjectMeta(bucket, name)
+		} else {
+			Meta, err = DMongo.GetObjectMeta(bucket, name, funcParams.MetaParamVersion(version))
+		}
+	}
+	if err != nil {
+		log.Println("Get object meta error: ", err.Error())
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	if Meta == nil || Meta.Hash == "" {
+		statusCode = http.StatusNotFound
+		return
+	}
+	statusCode = http.StatusOK
+	return
+}
+
+// 设置对象元数据相关的响应头（ETag、版本号、纠删码方案、最后修改时间）
+func setObjectHeaders(w http.ResponseWriter, Meta *meta.ObjectMeta) {
+	w.Header().Set("etag", "\""+Meta.Hash+"\"")
+	w.Header().Set("x-doss-version", strconv.Itoa(Meta.Version))
+	if Meta.Inline {
+		w.Header().Set("x-doss-ec", "inline")
+	} else {
+		w.Header().Set("x-doss-ec", Meta.Scheme().String())
+	}
+	w.Header().Set("last-modified", Meta.Modified.UTC().Format(http.TimeFormat))
+}
+
+// 获取对象各分片所在的在线数据节点（key：分片下标，宕机节点略过）
+// NOTE: 哈希环变化后、分片迁移完成前，尚未迁移的分片从源哈希环或者哈希环外的节点上读取；
+//       定位到已满节点的分片可能写入了代替该节点的节点（见hashRing.GetWriteNodes）
+func getLocateInfo(Meta *meta.ObjectMeta) (locateInfo map[int]string, err error) {
+	var (
+		nodes      []string
+		writeNodes []string
+		others     []string
 	)
 
 	// 获取数据的定位节点
-	if nodes, err = hashRing.GetNodes(Meta.Hash, config.GConfig.AllShards); err != nil {
+	if nodes, err = hashRing.GetNodes(Meta.Hash, Meta.Scheme()); err != nil {
 		log.Println(common.ErrDataLocate, err)
 		return
 	}
 
-	// 获取在线的数据节点集合
-	dataServers = heartbeat.GetOnlineDataServers()
+	// 分片可能位于的其他节点（未完成的迁移任务的源哈希环上的定位节点、代替已满节点写入的节点、哈希环外的节点）
+	others = append(rebalance.SourceNodes(Meta.Hash, Meta.Scheme(), nodes), hashRing.OffRingNodes()...)
+	if writeNodes, _ = hashRing.GetWriteNodes(Meta.Hash, Meta.Scheme()); !utils.SliceEqual(writeNodes, nodes) {
+		others = append(others, writeNodes...)
+	}
 
 	// 处理定位节点（只获取当前在线的节点，宕机节点略过）
-	locateInfo = make(map[int]string)
-	for i, node = range nodes {
-		if index = utils.SliceIndexOfMember(dataServers, node); index != -1 {
-			locateInfo[i] = dataServers[index]
+	locateInfo = locate.ReadLocate(Meta.Hash, nodes, others, heartbeat.GetOnlineDataServers())
+	return
+}
+
+// 生成数据下载流（多副本对象读取可用的副本，纠删码对象按照写入时的纠删码方案解码）
+// NOTE: 出错时返回的getStream为nil（而不是值为nil的具体类型），调用方可据此判断是否需要Close
+func GetStream(Meta *meta.ObjectMeta) (getStream stream.ObjectGetStream, err error) {
+	var (
+		locateInfo    map[int]string
+		replicaStream *stream.ReplicaGetStream
+		rsStream      *stream.RSGetStream
+	)
+
+	if Meta.Inline {
+		return newInlineGetStream(Meta, 0)
+	}
+	if locateInfo, err = getLocateInfo(Meta); err != nil {
+		return
+	}
+	if Meta.Scheme().IsReplica() {
+		if replicaStream, err = stream.NewReplicaGetStream(
+			locateInfo, Meta.Hash, Meta.Size, Meta.Scheme(),
+		); err == nil {
+			getStream = replicaStream
 		}
+		return
+	}
+	if rsStream, err = stream.NewRSGetStream(locateInfo, Meta.Hash, Meta.Size, Meta.Scheme()); err == nil {
+		getStream = rsStream
 	}
+	return
+}
+
+// 生成从对象offset处开始读取的数据下载流（只读取offset所在条带及之后的分片数据）
+func GetRangeStream(Meta *meta.ObjectMeta, offset int64) (getStream stream.ObjectGetStream, err error) {
+	var (
+		locateInfo    map[int]string
+		replicaStream *stream.ReplicaGetStream
+		rsStream      *stream.RSGetStream
+	)
 
-	// 返回用于纠删码读取的下载数据流
-	return stream.NewRSGetStream(locateInfo, Meta.Hash, Meta.Size)
+	if Meta.Inline {
+		return newInlineGetStream(Meta, offset)
+	}
+	if locateInfo, err = getLocateInfo(Meta); err != nil {
+		return
+	}
+	if Meta.Scheme().IsReplica() {
+		if replicaStream, err = stream.NewReplicaRangeGetStream(
+			locateInfo, Meta.Hash, Meta.Size, offset, Meta.Scheme(),
+		); err == nil {
+			getStream = replicaStream
+		}
+		return
+	}
+	if rsStream, err = stream.NewRSRangeGetStream(
+		locateInfo, Meta.Hash, Meta.Size, offset, Meta.Scheme(),
+	); err == nil {
+		getStream = rsStream
+	}
+	return
+}
+
+// 生成内联对象的下载流（对象数据保存在元数据中）
+func newInlineGetStream(Meta *meta.ObjectMeta, offset int64) (getStream stream.ObjectGetStream, err error) {
+	var inlineStream *stream.InlineGetStream
+
+	if inlineStream, err = stream.NewInlineGetStream(Meta.Data, offset); err == nil {
+		getStream = inlineStream
+	}
+	return
 }
@@ -16,6 +16,10 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		get(w, r)
 		return
 	}
+	if m == http.MethodHead {
+		head(w, r)
+		return
+	}
 	if m == http.MethodDelete {
 		del(w, r)
 		return
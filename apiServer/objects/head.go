@@ -0,0 +1,34 @@
+package objects
+
+import (
+	"net/http"
+	"strconv"
+
+	"meta"
+	"utils"
+)
+
+// -------------------------------------------
+// HEAD方法：返回对象的元数据信息而不返回对象数据（支持version查询参数）
+// 响应头：Content-Length、ETag（对象hash值）、X-Doss-Version、Last-Modified
+// -------------------------------------------
+func head(w http.ResponseWriter, r *http.Request) {
+	var (
+		Meta       *meta.ObjectMeta
+		bucket     string
+		name       string
+		statusCode int
+	)
+
+	if bucket, name = utils.GetBucketObjectFromPath(r.URL.EscapedPath()); name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if Meta, statusCode = getRequestMeta(r, bucket, name); statusCode != http.StatusOK {
+		w.WriteHeader(statusCode)
+		return
+	}
+	setObjectHeaders(w, Meta)
+	w.Header().Set("accept-ranges", "bytes")
+	w.Header().Set("content-length", strconv.FormatInt(Meta.Size, 10))
+}
@@ -0,0 +1,69 @@
+package objects
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"apiServer/locate"
+	"config"
+	"meta"
+	"utils"
+)
+
+// -------------------------------------------
+// 判断上传的对象是否内联存储（对象数据直接保存在元数据中，不写入数据节点）：
+// 对象大小小于配置文件中的inlineThreshold（字节），且没有通过请求头x-doss-ec指定存储方案
+// NOTE: size为-1表示对象大小未知（如断点续传、分段上传），此时不内联存储
+// -------------------------------------------
+func InlineUpload(header http.Header, size int64) bool {
+	return config.GConfig.InlineThreshold > 0 && size >= 0 && size < config.GConfig.InlineThreshold &&
+		header.Get("x-doss-ec") == ""
+}
+
+// -------------------------------------------
+// 读取内联存储的对象数据并校验hash（hash为url转义后的值）：
+// 1) 该hash值的数据已内联存储：沿用已有的数据，不读取r；
+// 2) 该hash值的数据已存储在数据节点：inline返回false，由调用方按照PutObject去重（只添加元数据）；
+// 3) 否则读取r中的数据，数据长度或hash值与请求不一致时返回400
+// -------------------------------------------
+func PutInlineObject(r io.Reader, hash string, size int64) (data []byte, inline bool, resCode int, err error) {
+	var (
+		DMongo   meta.Store
+		objMeta  *meta.ObjectMeta
+		calcHash string
+	)
+
+	if DMongo, err = meta.NewStore(); err == nil {
+		objMeta, err = DMongo.GetMetaByHash(hash)
+	}
+	if err != nil {
+		resCode = http.StatusInternalServerError
+		return
+	}
+	if objMeta != nil && objMeta.Inline {
+		return objMeta.Data, true, http.StatusOK, nil
+	}
+	if objMeta != nil && locate.FileExist(hash, objMeta.Scheme()) {
+		return nil, false, http.StatusOK, nil
+	}
+
+	// 多读取一个字节，用于判断数据是否超过请求的长度
+	if data, err = ioutil.ReadAll(io.LimitReader(r, size+1)); err != nil {
+		resCode = http.StatusInternalServerError
+		return
+	}
+	if int64(len(data)) != size {
+		resCode = http.StatusBadRequest
+		err = fmt.Errorf("object size mismatch, received=%d, requested=%d", len(data), size)
+		return
+	}
+	if calcHash = utils.CalculateHash(bytes.NewReader(data)); calcHash != hash {
+		resCode = http.StatusBadRequest
+		err = fmt.Errorf("url pathEscaped object hash mismatch, calculated=%s, requested=%s", calcHash, hash)
+		return
+	}
+	return data, true, http.StatusOK, nil
+}
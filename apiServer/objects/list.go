@@ -0,0 +1,84 @@
+package objects
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"meta"
+	"utils"
+)
+
+// 单次列举最多返回的对象数与公共前缀数之和
+const maxListLimit = 1000
+
+// 对象列举的响应体
+type listResult struct {
+	Objects    []*meta.ObjectMeta `json:"objects"`
+	Prefixes   []string           `json:"prefixes"`
+	Truncated  bool               `json:"truncated"`
+	NextMarker string             `json:"nextMarker,omitempty"`
+}
+
+// -------------------------------------------
+// 列举存储桶中的对象：GET /objects/<bucket>?prefix=&delimiter=&marker=&limit=
+// NOTE:
+//   1) 只返回每个对象未被删除的最新版本，delimiter不为空时将对象名中prefix之后、delimiter之前相同的对象汇总为公共前缀；
+//   2) marker为上一次列举响应中的nextMarker（不透明的续传token），limit默认且最大为1000；
+//   3) prefix、delimiter按照与对象名相同的URL路径形式转义后进行匹配，返回的对象名和公共前缀也为转义形式
+// -------------------------------------------
+func list(w http.ResponseWriter, r *http.Request, bucket string) {
+	var (
+		query       = r.URL.Query()
+		prefix      string
+		delimiter   string
+		marker      string
+		markerBytes []byte
+		limit       int
+		result      listResult
+		resBytes    []byte
+		DMongo      meta.Store
+		err         error
+	)
+
+	// 参数检查
+	prefix = utils.EscapeObjectName(query.Get("prefix"))
+	delimiter = utils.EscapeObjectName(query.Get("delimiter"))
+	if markerBytes, err = base64.URLEncoding.DecodeString(query.Get("marker")); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	marker = string(markerBytes)
+	limit = maxListLimit
+	if query.Get("limit") != "" {
+		if limit, err = strconv.Atoi(query.Get("limit")); err != nil || limit <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if limit > maxListLimit {
+			limit = maxListLimit
+		}
+	}
+
+	// 查询数据库，列举对象元数据
+	if DMongo, err = meta.NewStore(); err == nil {
+		result.Objects, result.Prefixes, marker, result.Truncated, err = DMongo.ListObjects(
+			bucket, prefix, delimiter, marker, limit,
+		)
+	}
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if result.Truncated {
+		result.NextMarker = base64.URLEncoding.EncodeToString([]byte(marker))
+	}
+
+	// 返回列举结果
+	resBytes, _ = json.Marshal(&result)
+	w.Header().Set("content-type", "application/json")
+	w.Write(resBytes)
+}
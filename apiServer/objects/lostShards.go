@@ -0,0 +1,305 @@
+package objects
+
+import (
+	"common"
+	"log"
+	"sort"
+	"time"
+
+	"apiServer/heartbeat"
+	"apiServer/locate"
+	"config"
+	"hashRing"
+	"meta"
+	"meta/funcParams"
+	"stream"
+	"utils"
+)
+
+// 每批检测的对象数（每检测完一批保存一次进度）
+const lostShardScanBatch = 100
+
+// 检测任务锁的过期时间（须大于检测一批对象所需的时间）
+const lostShardScanLockExpire = 5 * time.Minute
+
+// 检查是否需要执行检测任务的间隔（用于接管其他apiServer异常退出后未完成的任务）
+const lostShardScanCheckInterval = time.Minute
+
+// 有分片丢失的对象及其丢失的分片下标
+type lostObject struct {
+	meta   *meta.ObjectMeta
+	shards []int
+}
+
+// -------------------------------------------
+// 启动丢失分片检测：按照哈希环计算对象各分片应在的数据节点，向数据节点查询分片是否存在，
+// 将有分片丢失的对象加入待修复集合，由修复流程（repairObject）重建丢失的分片
+// NOTE:
+//   1) 分片损坏由dataServer的目录监听和巡检发现，此处用于发现数据节点磁盘被清空等原因造成的分片丢失；
+//   2) 检测任务在集群中只有一个，由加锁成功的apiServer执行，每隔lostShardScanInterval小时遍历一次所有对象，
+//      锁过期后（如apiServer异常退出）由其他apiServer接管，并从保存的进度（marker）处继续检测；
+//   3) 数据迁移期间分片不在目标哈希环的定位节点上，暂停检测
+// -------------------------------------------
+func StartLostShardScan() {
+	if config.GConfig.LostShardScanInterval <= 0 {
+		return
+	}
+	waitForDataServers()
+	for {
+		scanLostShards()
+		time.Sleep(lostShardScanCheckInterval)
+	}
+}
+
+// 执行检测任务：对检测任务加锁，按照对象hash值的顺序分批检测，每批检测完成后保存进度并续期锁
+func scanLostShards() {
+	var (
+		interval     = config.GConfig.LostShardScanInterval * time.Hour
+		DMongo       meta.Store
+		DMongoMeta   meta.Store
+		DMongoRepair meta.Store
+		job          *meta.ScanJob
+		rebalanceJob *meta.RebalanceJob
+		metas        []*meta.ObjectMeta
+		objMeta      *meta.ObjectMeta
+		degraded     []*lostObject
+		object       *lostObject
+		shards       []int
+		updated      bool
+		err          error
+	)
+
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RebalanceColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	if rebalanceJob, err = DMongo.GetRebalanceJob(); err != nil ||
+		(rebalanceJob != nil && rebalanceJob.State == meta.RebalanceStateRunning) {
+		return
+	}
+	if job, err = DMongo.LockScanJob(meta.LostShardScanName, repairLocker(), lostShardScanLockExpire); err != nil || job == nil {
+		if err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	// 上一轮检测已完成：未到下一轮检测的时间则不检测，否则开始新一轮检测
+	if job.Marker == "" && !job.Finished.IsZero() {
+		if time.Since(job.Finished) < interval {
+			return
+		}
+		job.Round++
+		job.Objects, job.Degraded = 0, 0
+		job.Started = time.Now().UTC()
+		job.Finished = time.Time{}
+	}
+
+	if DMongoMeta, err = meta.NewStore(); err != nil {
+		log.Println(err)
+		return
+	}
+	if DMongoRepair, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RepairObjColName)); err != nil {
+		log.Println(err)
+		return
+	}
+
+	for {
+		if metas, err = DMongoMeta.ListHashMetas(job.Marker, lostShardScanBatch); err != nil {
+			log.Println(err)
+			return
+		}
+
+		// 检测每个对象（同一个hash值只检测一次，内联存储的对象没有分片）
+		degraded = nil
+		for _, objMeta = range metas {
+			if objMeta.Hash == job.Marker {
+				continue
+			}
+			job.Marker = objMeta.Hash
+			if objMeta.Hash == "" || objMeta.Inline {
+				continue
+			}
+			if shards = lostShards(objMeta); len(shards) > 0 {
+				degraded = append(degraded, &lostObject{meta: objMeta, shards: shards})
+			}
+			job.Objects++
+		}
+
+		// 丢失分片越多的对象越优先加入待修复集合
+		sort.SliceStable(degraded, func(i, j int) bool {
+			return len(degraded[i].shards) > len(degraded[j].shards)
+		})
+		for _, object = range degraded {
+			if enqueueLostShards(DMongoRepair, object) {
+				job.Degraded++
+			}
+		}
+
+		// 保存进度并续期锁：遍历完所有对象时本轮检测完成
+		if len(metas) < lostShardScanBatch {
+			job.Marker = ""
+			job.Finished = time.Now().UTC()
+			log.Println("lost shard scan round", job.Round, "finished, objects:", job.Objects,
+				"degraded:", job.Degraded)
+		}
+		job.Updated = time.Now().UTC()
+		job.LockExpire = job.Updated.Add(lostShardScanLockExpire)
+		if updated, err = DMongo.UpdateScanJob(job); err != nil || !updated || job.Marker == "" {
+			if err != nil {
+				log.Println(err)
+			}
+			return
+		}
+	}
+}
+
+// -------------------------------------------
+// 获取对象丢失的分片下标：哈希环上第i个定位节点应存储第i个分片（多副本对象为第i个副本），
+// 定位节点在线但查询不到该分片，或者定位节点不在线时，认为该分片丢失
+// NOTE: 离线节点上的分片无法就地修复，只用于计算修复的优先级；
+//       节点被移出哈希环（下线或删除）后，迁移失败的分片由新的定位节点在之后的检测中修复；
+//       定位节点已满时，分片位于代替该节点写入的节点（见hashRing.GetWriteNodes）上同样视为未丢失
+// -------------------------------------------
+func lostShards(objMeta *meta.ObjectMeta) (shards []int) {
+	var (
+		dataServers = heartbeat.GetOnlineDataServers()
+		nodes       []string
+		writeNodes  []string
+		i           int
+		err         error
+	)
+
+	if nodes, err = hashRing.GetNodes(objMeta.Hash, objMeta.Scheme()); err != nil {
+		return
+	}
+	if writeNodes, _ = hashRing.GetWriteNodes(objMeta.Hash, objMeta.Scheme()); len(writeNodes) != len(nodes) {
+		writeNodes = nodes
+	}
+	for i = range nodes {
+		if !hasShard(dataServers, nodes[i], objMeta.Hash, i) &&
+			(writeNodes[i] == nodes[i] || !hasShard(dataServers, writeNodes[i], objMeta.Hash, i)) {
+			shards = append(shards, i)
+		}
+	}
+	return
+}
+
+// 在线的数据节点（哈希环节点node）上是否存储了对象的第i个分片（节点上可能同时存储了该对象的其他分片，故按照分片名确认）
+func hasShard(dataServers []string, node string, hash string, i int) bool {
+	var index = utils.SliceIndexOfMember(dataServers, node)
+
+	return index != -1 && locate.HasShard(dataServers[index], hash, i)
+}
+
+// 丢失的分片中是否有可以修复的分片（修复后写入的定位节点在线）
+func repairableShards(objMeta *meta.ObjectMeta, shards []int) bool {
+	var (
+		dataServers = heartbeat.GetOnlineDataServers()
+		nodes       []string
+		index       int
+		err         error
+	)
+
+	if nodes, err = hashRing.GetWriteNodes(objMeta.Hash, objMeta.Scheme()); err != nil {
+		return false
+	}
+	for _, index = range shards {
+		if index < len(nodes) && utils.SliceIndexOfMember(dataServers, nodes[index]) != -1 {
+			return true
+		}
+	}
+	return false
+}
+
+// 生成丢失分片的重建流：从在线的定位节点读取其他分片，将丢失的分片重建至其在线的定位节点（定位节点已满时为代替的节点）
+func getLostShardRebuildStream(Meta *meta.ObjectMeta) (getStream stream.ObjectGetStream, err error) {
+	var (
+		dataServers   = heartbeat.GetOnlineDataServers()
+		locateInfo    map[int]string
+		writeNodes    []string
+		targets       = make(map[int]string)
+		index         int
+		server        int
+		replicaStream *stream.ReplicaGetStream
+		rsStream      *stream.RSGetStream
+	)
+
+	if locateInfo, err = getLocateInfo(Meta); err != nil {
+		return
+	}
+	if writeNodes, err = hashRing.GetWriteNodes(Meta.Hash, Meta.Scheme()); err != nil {
+		return
+	}
+	for _, index = range lostShards(Meta) {
+		if index >= len(writeNodes) {
+			continue
+		}
+		if server = utils.SliceIndexOfMember(dataServers, writeNodes[index]); server != -1 {
+			targets[index] = dataServers[server]
+		}
+	}
+	if len(targets) == 0 {
+		err = common.ErrNoLostShard
+		return
+	}
+	if Meta.Scheme().IsReplica() {
+		if replicaStream, err = stream.NewReplicaRebuildStream(
+			locateInfo, targets, Meta.Hash, Meta.Size, Meta.Scheme(),
+		); err == nil {
+			getStream = replicaStream
+		}
+		return
+	}
+	if rsStream, err = stream.NewRSRebuildStream(locateInfo, targets, Meta.Hash, Meta.Size, Meta.Scheme()); err == nil {
+		getStream = rsStream
+	}
+	return
+}
+
+// 将有分片丢失的对象加入待修复集合（已存在该对象的丢失分片修复任务时不重复加入）
+// NOTE: 只有离线节点上的分片丢失时无法修复，不加入待修复集合
+func enqueueLostShards(DMongoRepair meta.Store, object *lostObject) (enqueued bool) {
+	var (
+		repairMeta *meta.RepairShard
+		err        error
+	)
+
+	if !repairableShards(object.meta, object.shards) {
+		return
+	}
+	repairMeta, err = DMongoRepair.GetRepairShardMeta(meta.LostShardKey(object.meta.Hash))
+	if err == nil && repairMeta.ShardHash != "" {
+		return
+	}
+	if _, err = DMongoRepair.PutLostShardMeta(object.meta.Hash, object.shards); err != nil {
+		log.Println(err)
+		return
+	}
+	return true
+}
+
+// -------------------------------------------
+// 确认丢失分片已修复：重新检测对象的分片，不再有可以修复的丢失分片（或者对象已被删除）时删除修复任务，
+// 否则返回ErrLostShardRemain（由修复队列稍后重试）
+// NOTE: 分片文件已不存在，dataServer无法感知丢失分片的修复完成，故由修复的apiServer确认
+// -------------------------------------------
+func confirmLostShards(DMongoRepair meta.Store, repairMeta *meta.RepairShard) (err error) {
+	var (
+		DMongo  meta.Store
+		objMeta *meta.ObjectMeta
+	)
+
+	if DMongo, err = meta.NewStore(); err != nil {
+		return
+	}
+	if objMeta, err = DMongo.GetMetaByHash(repairMeta.ObjHash); err != nil {
+		return
+	}
+	if objMeta != nil && objMeta.Name != "" && repairableShards(objMeta, lostShards(objMeta)) {
+		err = common.ErrLostShardRemain
+		return
+	}
+	_, err = DMongoRepair.DeleteRepairObjectMeta(repairMeta.ShardHash)
+	return
+}
@@ -6,10 +6,11 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
 
+	"apiServer/buckets"
 	"apiServer/locate"
 	"meta"
+	"meta/funcParams"
 	"stream"
 	"utils"
 )
@@ -17,17 +18,39 @@ import (
 // POST方法：用于创建token
 func post(w http.ResponseWriter, r *http.Request) {
 	var (
-		name      string
-		size      int64
-		hash      string
-		nodes     []string
-		putStream *stream.RSRecoverablePutStream
-		tokenStr  string
-		err       error
+		bucket     string
+		name       string
+		bucketMeta *meta.BucketMeta
+		ec         common.ECScheme
+		size       int64
+		hash       string
+		nodes      []string
+		putStream  *stream.RSRecoverablePutStream
+		tokenStr   string
+		DMongo     meta.Store
+		err        error
 	)
 
-	// 获取对象name、size、hash
-	name = strings.Split(r.URL.EscapedPath(), "/")[2]
+	// 获取对象bucket、name、size、hash，并检查存储桶是否存在
+	if bucket, name = utils.GetBucketObjectFromPath(r.URL.EscapedPath()); name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(common.ErrMissObjectName.Error()))
+		return
+	}
+	if bucketMeta, err = buckets.GetBucket(bucket); err != nil {
+		log.Println(common.ErrGetBucketMeta, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if bucketMeta.Name == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if ec, err = UploadScheme(bucketMeta, r.Header, -1); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
 	if size, err = strconv.ParseInt(r.Header.Get("size"), 0, 64); err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusForbidden)
@@ -40,9 +63,16 @@ func post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 如果该散列值已经存在，则直接往元数据服务addVersion并返回200 OK；
-	if locate.FileExist(url.PathEscape(hash)) {
-		_, err = meta.NewDossMongo().PutObjectMeta(name, size, url.PathEscape(hash))
+	// 如果该散列值已经存在（沿用其已有的纠删码方案），则直接往元数据服务addVersion并返回200 OK；
+	if ec, err = locate.StoredScheme(url.PathEscape(hash), ec); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if locate.FileExist(url.PathEscape(hash), ec) {
+		if DMongo, err = meta.NewStore(); err == nil {
+			_, err = DMongo.PutObjectMeta(bucket, name, size, url.PathEscape(hash), funcParams.MetaParamEC(ec))
+		}
 		if err != nil {
 			log.Println(err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -52,13 +82,20 @@ func post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 多副本对象不支持断点续传（只有小对象自动使用多副本存储，可直接使用PUT上传）
+	if ec.IsReplica() {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(common.ErrRecoverPutReplica.Error()))
+		return
+	}
+
 	// 获取数据定位节点，并生成经过纠删码编码的可恢复的上传数据流，用于将数据断点续传
-	if nodes, err = locate.GetLocateNodes(url.PathEscape(hash)); err != nil {
+	if nodes, err = locate.GetLocateNodes(url.PathEscape(hash), ec); err != nil {
 		log.Println(common.ErrDataLocate, err)
 		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
-	putStream, err = stream.NewRSRecoverablePutStream(nodes, name, url.PathEscape(hash), size)
+	putStream, err = stream.NewRSRecoverablePutStream(nodes, bucket, name, url.PathEscape(hash), size, ec)
 	if err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -7,23 +7,52 @@ import (
 	"log"
 	"net/http"
 	"net/url"
-	"strings"
 
+	"apiServer/buckets"
 	"apiServer/locate"
 	"meta"
+	"meta/funcParams"
 	"stream"
 	"utils"
 )
 
 func put(w http.ResponseWriter, r *http.Request) {
 	var (
-		hash    string
-		size    int64
-		resCode int
-		name    string
-		err     error
+		bucket     string
+		name       string
+		bucketMeta *meta.BucketMeta
+		ec         common.ECScheme
+		hash       string
+		size       int64
+		data       []byte
+		inline     bool
+		metaParam  funcParams.MetaParamFunc
+		resCode    int
+		DMongo     meta.Store
+		err        error
 	)
 
+	// 解析存储桶名和对象名，并检查存储桶是否存在
+	if bucket, name = utils.GetBucketObjectFromPath(r.URL.EscapedPath()); name == "" {
+		log.Println(common.ErrMissObjectName)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if bucketMeta, err = buckets.GetBucket(bucket); err != nil {
+		log.Println(common.ErrGetBucketMeta, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if bucketMeta.Name == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if ec, err = UploadScheme(bucketMeta, r.Header, utils.GetSizeFromHeader(r.Header)); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	// 获取请求头中的hash、size信息
 	if hash = utils.GetHashFromHeader(r.Header); hash == "" {
 		log.Println(common.ErrMissObjectHash)
@@ -32,41 +61,67 @@ func put(w http.ResponseWriter, r *http.Request) {
 	}
 	size = utils.GetSizeFromHeader(r.Header)
 
-	// 上传对象
-	if resCode, err = putObject(r.Body, hash, size); err != nil {
-		log.Println(err)
-		w.WriteHeader(resCode)
-		return
+	// 很小的对象内联存储在元数据中（inline为false说明该数据已存储在数据节点，按照正常流程去重）
+	if InlineUpload(r.Header, size) {
+		if data, inline, resCode, err = PutInlineObject(r.Body, url.PathEscape(hash), size); err != nil {
+			log.Println(err)
+			w.WriteHeader(resCode)
+			return
+		}
 	}
-	if resCode != http.StatusOK {
-		w.WriteHeader(resCode)
-		return
+
+	// 上传对象（ec更新为数据实际使用的纠删码方案）
+	if inline {
+		metaParam = funcParams.MetaParamInline(data)
+	} else {
+		if ec, resCode, err = PutObject(r.Body, hash, size, ec); err != nil {
+			log.Println(err)
+			w.WriteHeader(resCode)
+			return
+		}
+		if resCode != http.StatusOK {
+			w.WriteHeader(resCode)
+			return
+		}
+		metaParam = funcParams.MetaParamEC(ec)
 	}
 
-	// 添加对象元数据（name、size、hash、version）
-	name = strings.Split(r.URL.EscapedPath(), "/")[2]
-	if _, err = meta.NewDossMongo().PutObjectMeta(name, size, url.PathEscape(hash)); err != nil {
+	// 添加对象元数据（bucket、name、size、hash、version、ec或内联数据）
+	if DMongo, err = meta.NewStore(); err == nil {
+		_, err = DMongo.PutObjectMeta(bucket, name, size, url.PathEscape(hash), metaParam)
+	}
+	if err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+// -------------------------------------------
 // 上传对象并实时验证上传数据的正确性
-func putObject(r io.Reader, hash string, size int64) (resCode int, err error) {
+// NOTE: ec为本次上传指定的纠删码方案，若该hash值的数据已存在则沿用其已有的方案，
+//       返回的scheme为数据实际使用的方案，调用方须将其记录在对象元数据中
+// -------------------------------------------
+func PutObject(r io.Reader, hash string, size int64, ec common.ECScheme) (
+	scheme common.ECScheme, resCode int, err error) {
+
 	var (
-		putStream *stream.RSPutStream
+		putStream stream.ObjectPutStream
 		reader    io.Reader
 		calcHash  string
 	)
 
-	// 检查当前可访问到的总的分片数量是否>=数据分片数量
-	if locate.FileExist(url.PathEscape(hash)) {
+	// 获取该hash值的数据已有的纠删码方案，并检查当前可访问到的总的分片数量是否>=数据分片数量
+	if scheme, err = locate.StoredScheme(url.PathEscape(hash), ec); err != nil {
+		resCode = http.StatusInternalServerError
+		return
+	}
+	if locate.FileExist(url.PathEscape(hash), scheme) {
 		resCode = http.StatusOK
 		return
 	}
 
 	// 生成对象上传数据流（带有纠删码编码器的数据流）
-	if putStream, err = newPutStream(url.PathEscape(hash), size); err != nil {
+	if putStream, err = newPutStream(url.PathEscape(hash), size, scheme); err != nil {
 		resCode = http.StatusInternalServerError
 		return
 	}
@@ -89,14 +144,55 @@ func putObject(r io.Reader, hash string, size int64) (resCode int, err error) {
 	return
 }
 
-// 创建上传数据流（经过纠删码编码器处理的流）
-func newPutStream(hash string, size int64) (putStream *stream.RSPutStream, err error) {
-	var Nodes []string
+// -------------------------------------------
+// 上传由其他数据组合而成的对象（如分片上传合并后的对象）：对象hash不是数据的散列值，不进行整体校验
+// NOTE: 数据的正确性由r在读取时自行校验，读取出错或者数据长度与size不一致时放弃上传；
+//       若该hash值的数据已存在则不重复上传，返回的scheme与PutObject一致
+// -------------------------------------------
+func PutComposedObject(r io.Reader, hash string, size int64, ec common.ECScheme) (
+	scheme common.ECScheme, err error) {
+
+	var (
+		putStream stream.ObjectPutStream
+		written   int64
+	)
+
+	if scheme, err = locate.StoredScheme(url.PathEscape(hash), ec); err != nil {
+		return
+	}
+	if locate.FileExist(url.PathEscape(hash), scheme) {
+		return
+	}
+	if putStream, err = newPutStream(url.PathEscape(hash), size, scheme); err != nil {
+		return
+	}
+	if written, err = io.Copy(putStream, r); err == nil && written != size {
+		err = common.ErrSizeMismatch
+	}
+	putStream.Commit(err == nil)
+	return
+}
+
+// 创建上传数据流（多副本对象为多副本上传流，否则为经过纠删码编码器处理的流）
+func newPutStream(hash string, size int64, ec common.ECScheme) (putStream stream.ObjectPutStream, err error) {
+	var (
+		Nodes         []string
+		replicaStream *stream.ReplicaPutStream
+		rsStream      *stream.RSPutStream
+	)
 
 	// 获取对象定位的数据节点集合
-	if Nodes, err = locate.GetLocateNodes(hash); err != nil {
+	if Nodes, err = locate.GetLocateNodes(hash, ec); err != nil {
 		return
 	}
-	putStream, err = stream.NewRSPutStream(Nodes, hash, size)
+	if ec.IsReplica() {
+		if replicaStream, err = stream.NewReplicaPutStream(Nodes, hash, size, ec); err == nil {
+			putStream = replicaStream
+		}
+		return
+	}
+	if rsStream, err = stream.NewRSPutStream(Nodes, hash, size, ec); err == nil {
+		putStream = rsStream
+	}
 	return
 }
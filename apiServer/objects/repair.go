@@ -2,7 +2,6 @@ package objects
 
 import (
 	"common"
-	"context"
 	"io"
 	"log"
 	"strconv"
@@ -11,7 +10,6 @@ import (
 	"apiServer/heartbeat"
 	"common/apiFlag"
 	"config"
-	"github.com/mongodb/mongo-go-driver/mongo"
 	"meta"
 	"meta/funcParams"
 	"stream"
@@ -21,122 +19,199 @@ import (
 // 监听对象损坏并进行修复
 func ListenObjectsRepair() {
 	var (
-		DMongo       *meta.DossMongo
-		CStream      *mongo.ChangeStream
-		repairStream meta.RepairStream
-		repairMeta   *meta.RepairShard
-		err          error
+		DMongo     meta.Store
+		events     <-chan *meta.ChangeEvent
+		event      *meta.ChangeEvent
+		repairMeta *meta.RepairShard
+		err        error
 	)
 
-	DMongo = meta.NewDossMongo(
+	if DMongo, err = meta.NewStore(
 		funcParams.MongoParamCollection(config.GConfig.RepairObjColName),
-	)
-	if CStream, err = DMongo.Collection.Watch(context.TODO(), mongo.Pipeline{}); err != nil {
+	); err != nil {
+		log.Fatal(common.ErrNewChangeStream, err)
+		return
+	}
+	if events, err = DMongo.Watch(); err != nil {
 		log.Fatal(common.ErrNewChangeStream, err)
 		return
 	}
-	defer CStream.Close(context.TODO())
 
-	// 检查是否有上次宕机前未修复成功的任务（属于自己的任务）
-	checkSelfRepairJob()
+	// 启动修复工作协程，检查是否有上次宕机前未修复成功的任务（属于自己的任务），并定期接管租约过期的任务
+	startRepairWorkers(DMongo)
+	go reclaimRepairJobs(DMongo)
 
 	// 持续监听待修复对象分片元数据表的变化
-	for {
-		if CStream.Next(context.TODO()) {
-			if err = CStream.Decode(&repairStream); err != nil {
-				continue
-			}
-
-			// 若改变类型不为insert，则跳过此次修复
-			if repairStream.Type != "insert" {
-				continue
-			}
-
-			// 获取发生改变的document
-			DMongo = meta.NewDossMongo(
-				funcParams.MongoParamCollection(config.GConfig.RepairObjColName),
-			)
-			repairMeta, err = DMongo.GetRepairShardMetaByOId(repairStream.DocKey.ObjectId)
-			if err != nil || repairMeta.ShardHash == "" {
-				continue
-			}
-
-			// 抢分布式乐观锁
-			// 1) 若Locker属性不为空，说明被其他apiServer捷足先登了，则跳过此次修复；
-			// 2) 若Locker为空，说明当前修复任务未被其他apiServer抢占，则自己加锁抢占，并启动修复
-			if repairMeta.Locker != "" {
-				continue
-			} else {
-				err = DMongo.UpdateRepairShardMeta(
-					repairMeta.ShardHash,
-					*apiFlag.ListenIp+":"+strconv.Itoa(*apiFlag.ListenPort),
-				)
-				// 如果抢锁失败，说明多个apiServer同时在抢且被别人抢到了，则跳过此次修复
-				if err != nil {
-					continue
-				}
-				go repairObject(repairMeta.ObjHash)
-			}
+	for event = range events {
+		// 若改变类型不为insert，则跳过此次修复
+		if event.Type != "insert" {
+			continue
+		}
+
+		// 获取发生改变的document
+		repairMeta, err = DMongo.GetRepairShardMetaByOId(event.DocKey.ObjectId)
+		if err != nil || repairMeta.ShardHash == "" {
+			continue
 		}
-		time.Sleep(time.Second * 1)
+
+		// 加入修复队列：由修复工作协程按照优先级抢修复租约，若租约被其他apiServer持有且未过期，则跳过此次修复
+		repairs.add(repairMeta)
 	}
+	log.Println(common.ErrNewChangeStream, "repair change stream closed")
+}
+
+// -------------------------------------------
+// 获取修复租约并修复：
+// 1) 租约未被加锁、已被自己加锁或者已过期时才能获取成功（FindOneAndUpdate保证只有一个apiServer获取成功），
+//    获取失败（其他apiServer正在修复）时从修复队列中移除；
+// 2) 修复期间定期续期租约，修复完成后停止续期，租约保留至过期（由dataServer确认修复成功后删除待修复分片元数据）；
+// 3) 修复失败时按照退避时间重试，租约被其他apiServer接管时放弃
+// -------------------------------------------
+func runRepairJob(DMongo meta.Store, job *repairJob) {
+	var (
+		lease *meta.RepairLease
+		err   error
+	)
+
+	if lease, err = meta.AcquireRepairLease(
+		DMongo, job.repairMeta.ShardHash, repairLocker(), repairLeaseExpire(),
+	); err != nil {
+		repairs.fail(job, err)
+		return
+	}
+	if lease == nil {
+		repairs.remove(job)
+		return
+	}
+
+	if err = repairObject(job.repairMeta, lease); err == nil && job.repairMeta.Lost > 0 {
+		err = confirmLostShards(DMongo, job.repairMeta)
+	}
+	lease.Stop()
+	switch err {
+	case nil:
+		repairs.done(job)
+	case common.ErrRepairLeaseLost:
+		repairs.remove(job)
+	default:
+		repairs.fail(job, err)
+	}
+}
+
+// 修复租约的持有者：本apiServer的ip:port
+func repairLocker() string {
+	return *apiFlag.ListenIp + ":" + strconv.Itoa(*apiFlag.ListenPort)
+}
+
+// 修复租约的过期时间
+func repairLeaseExpire() time.Duration {
+	return config.GConfig.RepairLockExpire * time.Second
 }
 
 // 该函数不对外提供，限制由apiServer的objects包来进行修复
-func repairObject(objHash string) {
+// NOTE: 1) 修复过程中租约被其他apiServer接管（如续期超时）时放弃修复的数据，由接管者重新修复；
+//       2) 读取分片时按照每个数据节点的修复带宽限速，避免修复流量挤占业务IO
+func repairObject(repairMeta *meta.RepairShard, lease *meta.RepairLease) (err error) {
 	var (
-		Meta      *meta.ObjectMeta
-		getStream *stream.RSGetStream
-		err       error
+		DMongo     meta.Store
+		Meta       *meta.ObjectMeta
+		locateInfo map[int]string
+		getStream  stream.ObjectGetStream
 	)
 
-	// 请求对象元数据
-	if Meta, err = meta.NewDossMongo().GetMetaByHash(objHash); err != nil || Meta.Name == "" {
+	// 请求对象元数据（对象已被删除时无需修复）
+	if DMongo, err = meta.NewStore(); err != nil {
+		return
+	}
+	if Meta, err = DMongo.GetMetaByHash(repairMeta.ObjHash); err != nil || Meta == nil || Meta.Name == "" {
 		return
 	}
 
-	// 生成对象下载流
-	if getStream, err = GetStream(Meta); err != nil {
+	// 生成对象下载流（丢失的分片重建至哈希环上的定位节点；多副本对象检查所有副本，修复其中丢失或损坏的副本）
+	if repairMeta.Lost > 0 {
+		getStream, err = getLostShardRebuildStream(Meta)
+	} else if Meta.Scheme().IsReplica() {
+		getStream, err = getReplicaRepairStream(Meta)
+	} else {
+		getStream, err = GetStream(Meta)
+	}
+	if err != nil {
 		return
 	}
 
 	// 读取分片数据（读取过程中会进行修复），读取到的数据丢到生成的黑洞io.Writer中
-	var writer = utils.NewNullWriter()
-	io.Copy(writer, getStream)
+	locateInfo, _ = getLocateInfo(Meta)
+	if _, err = io.Copy(utils.NewNullWriter(), newRepairReader(getStream, locateInfo, Meta.Scheme())); err != nil {
+		getStream.Abort()
+		return
+	}
 
 	// 调用Close方法将GetStream中分片修复的数据流提交转正，dataServer将临时对象转为正式对象
+	if !lease.Held() {
+		log.Println(common.ErrRepairLeaseLost, repairMeta.ObjHash)
+		getStream.Abort()
+		err = common.ErrRepairLeaseLost
+		return
+	}
 	getStream.Close()
+	return
+}
+
+// 生成多副本对象的修复流：读取对象的同时修复所有无法读取的副本（下载时只修复可读副本之前的副本）
+func getReplicaRepairStream(Meta *meta.ObjectMeta) (getStream stream.ObjectGetStream, err error) {
+	var (
+		locateInfo    map[int]string
+		replicaStream *stream.ReplicaGetStream
+	)
+
+	if locateInfo, err = getLocateInfo(Meta); err != nil {
+		return
+	}
+	if replicaStream, err = stream.NewReplicaRepairStream(
+		locateInfo, Meta.Hash, Meta.Size, Meta.Scheme(),
+	); err == nil {
+		getStream = replicaStream
+	}
+	return
 }
 
-// 检查是否有上次宕机前未修复成功的任务（属于自己的任务）
-func checkSelfRepairJob() {
+// -------------------------------------------
+// 接管修复任务：
+// 1) 启动时接管上次宕机前未修复成功的任务（租约属于自己的任务）；
+// 2) 之后每隔一个租约时长检查一次租约未被加锁或者已过期的任务（持有租约的apiServer宕机），并接管修复
+// -------------------------------------------
+func reclaimRepairJobs(DMongo meta.Store) {
 	var (
-		DMongo     *meta.DossMongo
-		locker     string
 		shardMetas []*meta.RepairShard
 		shardMeta  *meta.RepairShard
 		err        error
 	)
 
 	// 收到数据节点心跳后才开始进行修复工作
+	waitForDataServers()
+
+	// 检查数据表中是否存在locker设置为自己的待修复对象（即上次宕机前未完成的任务）
+	if shardMetas, err = DMongo.GetRepairShardMetaByLocker(repairLocker()); err != nil {
+		log.Println(err)
+	}
+	for {
+		for _, shardMeta = range shardMetas {
+			repairs.add(shardMeta)
+		}
+		time.Sleep(repairLeaseExpire())
+		if shardMetas, err = DMongo.GetExpiredRepairShardMetas(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// 等待收到数据节点的心跳（再等待一个心跳间隔，使得各数据节点的心跳都已收到）
+func waitForDataServers() {
 	for {
 		if len(heartbeat.GetOnlineDataServers()) > 0 {
 			time.Sleep(config.GConfig.HeartbeatInterval * time.Second)
-			break
+			return
 		}
 		time.Sleep(config.GConfig.HeartbeatInterval * time.Second)
 	}
-
-	// 检查数据表中是否存在locker设置为自己的待修复对象（即上次宕机前未完成的任务）
-	DMongo = meta.NewDossMongo(funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
-	locker = *apiFlag.ListenIp + ":" + strconv.Itoa(*apiFlag.ListenPort)
-	shardMetas, err = DMongo.GetRepairShardMetaByLocker(locker)
-	if err != nil {
-		return
-	}
-
-	// 每个任务起一个协程修复
-	for _, shardMeta = range shardMetas {
-		go repairObject(shardMeta.ObjHash)
-	}
 }
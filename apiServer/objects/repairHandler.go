@@ -0,0 +1,35 @@
+package objects
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// -------------------------------------------
+// 修复队列管理接口：
+// 1) GET /repairs/：查询本apiServer的修复队列（是否暂停、工作协程数、累计修复成功和失败的次数，以及按照优先级排序的任务）；
+// 2) POST /repairs/pause：暂停修复（正在修复的任务继续执行，不再开始新的任务）；
+// 3) POST /repairs/resume：恢复修复
+// NOTE: 修复队列和暂停状态只属于本apiServer，暂停整个集群的修复须对每个apiServer分别请求
+// -------------------------------------------
+func RepairsHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		action   = strings.TrimPrefix(r.URL.EscapedPath(), "/repairs/")
+		resBytes []byte
+	)
+
+	switch {
+	case r.Method == http.MethodGet && action == "":
+		resBytes, _ = json.Marshal(repairs.status())
+		w.Write(resBytes)
+	case r.Method == http.MethodPost && action == "pause":
+		repairs.pause(true)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && action == "resume":
+		repairs.pause(false)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
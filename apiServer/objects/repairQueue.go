@@ -0,0 +1,382 @@
+package objects
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"common"
+	"config"
+	"meta"
+	"stream"
+)
+
+// 修复失败后的重试间隔：首次失败后等待repairRetryMin，之后每次失败翻倍，最长为repairRetryMax
+const (
+	repairRetryMin = 10 * time.Second
+	repairRetryMax = 10 * time.Minute
+)
+
+// 修复队列中没有可执行的任务时，工作协程检查队列的间隔（等待重试时间到达）
+const repairPollInterval = time.Second
+
+// -------------------------------------------
+// 修复任务：待修复集合中的一个文档（一个损坏的分片，或者一个对象的丢失分片）
+// Surviving：对象存活的分片数（分片总数减去丢失的分片数和队列中同一对象损坏的分片数），越少越优先修复
+// -------------------------------------------
+type repairJob struct {
+	repairMeta *meta.RepairShard
+	allShards  int
+	ObjHash    string    `json:"objHash"`
+	ShardHash  string    `json:"shardHash"`
+	ShardIndex string    `json:"shardIndex"`
+	Surviving  int       `json:"surviving"`
+	Running    bool      `json:"running"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"lastError,omitempty"`
+	NextRetry  time.Time `json:"nextRetry"`
+	Queued     time.Time `json:"queued"`
+}
+
+// 修复队列的状态（GET /repairs/的响应体）
+type repairStatus struct {
+	Paused   bool         `json:"paused"`
+	Workers  int          `json:"workers"`
+	Repaired int64        `json:"repaired"`
+	Failed   int64        `json:"failed"`
+	Jobs     []*repairJob `json:"jobs"`
+}
+
+// -------------------------------------------
+// 本apiServer的修复队列：
+// 1) 待修复集合中新插入的文档以及接管的任务加入队列（同一分片只加入一次），由repairWorkers个工作协程按照优先级修复；
+// 2) 同一对象同时只修复一次（修复流会读取并修复对象的所有分片），其他任务等待该对象修复完成；
+// 3) 暂停后工作协程不再获取新的任务，正在修复的任务继续执行
+// -------------------------------------------
+type repairQueue struct {
+	mutex    sync.Mutex
+	jobs     map[string]*repairJob // key为分片hash值
+	objects  map[string]bool       // 正在修复的对象hash值
+	paused   bool
+	repaired int64
+	failed   int64
+	wakeUp   chan struct{}
+}
+
+var repairs = &repairQueue{
+	jobs:    make(map[string]*repairJob),
+	objects: make(map[string]bool),
+	wakeUp:  make(chan struct{}, 1),
+}
+
+// 启动修复工作协程（收到数据节点心跳后才开始修复）
+func startRepairWorkers(DMongo meta.Store) {
+	var i int
+
+	for i = 0; i < repairWorkers(); i++ {
+		go func() {
+			waitForDataServers()
+			for {
+				runRepairJob(DMongo, repairs.next())
+			}
+		}()
+	}
+}
+
+// 修复工作协程数（至少为1）
+func repairWorkers() int {
+	if config.GConfig.RepairWorkers <= 0 {
+		return 1
+	}
+	return config.GConfig.RepairWorkers
+}
+
+// 加入修复队列（同一分片已在队列中时不重复加入）
+func (q *repairQueue) add(repairMeta *meta.RepairShard) {
+	var (
+		DMongo    meta.Store
+		objMeta   *meta.ObjectMeta
+		allShards = config.GConfig.DefaultScheme.AllShards()
+		ok        bool
+		err       error
+	)
+
+	q.mutex.Lock()
+	_, ok = q.jobs[repairMeta.ShardHash]
+	q.mutex.Unlock()
+	if ok {
+		return
+	}
+
+	// 按照对象的纠删码方案计算存活的分片数（对象已被删除时使用默认方案，修复时直接完成）
+	if DMongo, err = meta.NewStore(); err == nil {
+		if objMeta, err = DMongo.GetMetaByHash(repairMeta.ObjHash); err == nil && objMeta != nil && objMeta.Name != "" {
+			allShards = objMeta.Scheme().AllShards()
+		}
+	}
+
+	q.mutex.Lock()
+	if _, ok = q.jobs[repairMeta.ShardHash]; !ok {
+		q.jobs[repairMeta.ShardHash] = &repairJob{
+			repairMeta: repairMeta,
+			allShards:  allShards,
+			ObjHash:    repairMeta.ObjHash,
+			ShardHash:  repairMeta.ShardHash,
+			ShardIndex: repairMeta.ShardIndex,
+			Queued:     time.Now(),
+		}
+	}
+	q.mutex.Unlock()
+	q.notify()
+}
+
+// 获取下一个修复任务（阻塞直至有可执行的任务），并将其对象标记为修复中
+func (q *repairQueue) next() (job *repairJob) {
+	for {
+		q.mutex.Lock()
+		if job = q.pick(time.Now()); job != nil {
+			job.Running = true
+			q.objects[job.ObjHash] = true
+		}
+		q.mutex.Unlock()
+		if job != nil {
+			return
+		}
+		select {
+		case <-q.wakeUp:
+		case <-time.After(repairPollInterval):
+		}
+	}
+}
+
+// 选出优先级最高的可执行任务：存活分片数最少，其次加入队列最早（调用方须持有锁）
+// NOTE: 暂停中、正在修复、未到重试时间或者同一对象正在修复的任务不可执行
+func (q *repairQueue) pick(now time.Time) (best *repairJob) {
+	var job *repairJob
+
+	if q.paused {
+		return
+	}
+	q.updateSurviving()
+	for _, job = range q.jobs {
+		if job.Running || job.NextRetry.After(now) || q.objects[job.ObjHash] {
+			continue
+		}
+		if best == nil || job.Surviving < best.Surviving ||
+			(job.Surviving == best.Surviving && job.Queued.Before(best.Queued)) {
+			best = job
+		}
+	}
+	return
+}
+
+// 计算各任务对象存活的分片数（调用方须持有锁）：
+// 丢失分片的任务为分片总数减去丢失的分片数；损坏分片的任务为分片总数减去队列中同一对象损坏的分片数
+func (q *repairQueue) updateSurviving() {
+	var (
+		corrupted = make(map[string]int)
+		job       *repairJob
+	)
+
+	for _, job = range q.jobs {
+		if job.repairMeta.Lost == 0 {
+			corrupted[job.ObjHash]++
+		}
+	}
+	for _, job = range q.jobs {
+		if job.repairMeta.Lost > 0 {
+			job.Surviving = job.allShards - job.repairMeta.Lost
+		} else {
+			job.Surviving = job.allShards - corrupted[job.ObjHash]
+		}
+	}
+}
+
+// 修复成功：移出队列
+// NOTE: 修复流已读取并修复了对象的所有损坏分片，同一对象其他损坏分片的任务一并移出
+//       （若仍未修复，dataServer不会删除其待修复文档，租约过期后重新加入队列）
+func (q *repairQueue) done(job *repairJob) {
+	var other *repairJob
+
+	q.mutex.Lock()
+	delete(q.jobs, job.ShardHash)
+	delete(q.objects, job.ObjHash)
+	if job.repairMeta.Lost == 0 {
+		for _, other = range q.jobs {
+			if other.ObjHash == job.ObjHash && other.repairMeta.Lost == 0 && !other.Running {
+				delete(q.jobs, other.ShardHash)
+			}
+		}
+	}
+	q.repaired++
+	q.mutex.Unlock()
+	q.notify()
+}
+
+// 修复失败：按照退避时间稍后重试
+func (q *repairQueue) fail(job *repairJob, err error) {
+	var (
+		backoff = repairRetryMin
+		i       int
+	)
+
+	q.mutex.Lock()
+	job.Running = false
+	job.Attempts++
+	job.LastError = err.Error()
+	for i = 1; i < job.Attempts && backoff < repairRetryMax; i++ {
+		backoff *= 2
+	}
+	if backoff > repairRetryMax {
+		backoff = repairRetryMax
+	}
+	job.NextRetry = time.Now().Add(backoff)
+	delete(q.objects, job.ObjHash)
+	q.failed++
+	q.mutex.Unlock()
+	q.notify()
+}
+
+// 放弃修复任务（租约被其他apiServer持有或接管）：移出队列
+func (q *repairQueue) remove(job *repairJob) {
+	q.mutex.Lock()
+	delete(q.jobs, job.ShardHash)
+	delete(q.objects, job.ObjHash)
+	q.mutex.Unlock()
+	q.notify()
+}
+
+// 暂停或者恢复修复
+func (q *repairQueue) pause(paused bool) {
+	q.mutex.Lock()
+	q.paused = paused
+	q.mutex.Unlock()
+	q.notify()
+}
+
+// 获取修复队列的状态（任务按照优先级排序）
+func (q *repairQueue) status() (status *repairStatus) {
+	var (
+		job      *repairJob
+		snapshot *repairJob
+	)
+
+	q.mutex.Lock()
+	q.updateSurviving()
+	status = &repairStatus{
+		Paused:   q.paused,
+		Workers:  repairWorkers(),
+		Repaired: q.repaired,
+		Failed:   q.failed,
+		Jobs:     make([]*repairJob, 0, len(q.jobs)),
+	}
+	for _, job = range q.jobs {
+		snapshot = &repairJob{}
+		*snapshot = *job
+		status.Jobs = append(status.Jobs, snapshot)
+	}
+	q.mutex.Unlock()
+
+	sort.Slice(status.Jobs, func(i, j int) bool {
+		if status.Jobs[i].Surviving != status.Jobs[j].Surviving {
+			return status.Jobs[i].Surviving < status.Jobs[j].Surviving
+		}
+		return status.Jobs[i].Queued.Before(status.Jobs[j].Queued)
+	})
+	return
+}
+
+// 唤醒等待任务的工作协程（不阻塞）
+func (q *repairQueue) notify() {
+	select {
+	case q.wakeUp <- struct{}{}:
+	default:
+	}
+}
+
+// ---------------------------------
+// 修复限速：每个数据节点的修复流量（读取和写入分片）不超过repairBandwidth（MB/s，不大于0时不限速）
+// NOTE: 令牌桶算法，每个数据节点一个令牌桶，所有修复工作协程共用；令牌不足时先预留，再等待至令牌补足
+// ---------------------------------
+type nodeLimiter struct {
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+var (
+	nodeLimiters      = make(map[string]*nodeLimiter)
+	nodeLimitersMutex sync.Mutex
+)
+
+// 从数据节点的令牌桶中取出n个令牌，返回须等待的时间
+func (l *nodeLimiter) reserve(n int64, rate float64) (wait time.Duration) {
+	var now = time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// 补充令牌（桶的容量为1秒的流量）
+	if l.last.IsZero() {
+		l.tokens = rate
+	} else if l.tokens += now.Sub(l.last).Seconds() * rate; l.tokens > rate {
+		l.tokens = rate
+	}
+	l.last = now
+	if l.tokens -= float64(n); l.tokens < 0 {
+		wait = time.Duration(-l.tokens / rate * float64(time.Second))
+	}
+	return
+}
+
+// 每个数据节点传输n个字节的修复流量，等待至所有节点的令牌补足
+func waitNodeBandwidth(nodes []string, n int64) {
+	var (
+		rate    = float64(config.GConfig.RepairBandwidth * common.MB)
+		limiter *nodeLimiter
+		node    string
+		wait    time.Duration
+		longest time.Duration
+		ok      bool
+	)
+
+	if rate <= 0 || n <= 0 {
+		return
+	}
+	for _, node = range nodes {
+		nodeLimitersMutex.Lock()
+		if limiter, ok = nodeLimiters[node]; !ok {
+			limiter = &nodeLimiter{}
+			nodeLimiters[node] = limiter
+		}
+		nodeLimitersMutex.Unlock()
+		if wait = limiter.reserve(n, rate); wait > longest {
+			longest = wait
+		}
+	}
+	time.Sleep(longest)
+}
+
+// 修复时限速的reader：每从修复流读取n个字节的对象数据，各定位节点约传输n/数据分片数个字节的分片数据
+// NOTE: 多副本对象按照每个节点传输n个字节计算（偏保守）
+type repairReader struct {
+	reader     io.Reader
+	nodes      []string
+	dataShards int64
+}
+
+func newRepairReader(getStream stream.ObjectGetStream, locateInfo map[int]string, ec common.ECScheme) *repairReader {
+	var reader = &repairReader{reader: getStream, dataShards: int64(ec.DataShards)}
+
+	for _, node := range locateInfo {
+		reader.nodes = append(reader.nodes, node)
+	}
+	return reader
+}
+
+func (r *repairReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	waitNodeBandwidth(r.nodes, (int64(n)+r.dataShards-1)/r.dataShards)
+	return
+}
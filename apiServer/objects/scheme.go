@@ -0,0 +1,29 @@
+package objects
+
+import (
+	"common"
+	"net/http"
+
+	"config"
+	"meta"
+	"utils"
+)
+
+// -------------------------------------------
+// 获取上传对象时指定的存储方案：
+// 1) 请求头x-doss-ec指定的方案（如x-doss-ec: 10+4或x-doss-ec: 3x），格式错误返回ErrInvalidECScheme；
+// 2) 未指定时，若对象大小不超过配置文件中的replicaThreshold（KB），使用多副本方案（replicaCount份副本）；
+// 3) 否则使用存储桶的方案（创建存储桶时指定，未指定则为配置文件中的defaultEC）
+// NOTE: size为-1表示对象大小未知或不适用多副本存储（如断点续传、分段上传），此时不自动选择多副本方案
+// -------------------------------------------
+func UploadScheme(bucketMeta *meta.BucketMeta, header http.Header, size int64) (ec common.ECScheme, err error) {
+	if ec, err = utils.GetECFromHeader(header); err != nil || !ec.IsZero() {
+		return
+	}
+	if config.GConfig.ReplicaThreshold > 0 && size >= 0 && size <= config.GConfig.ReplicaThreshold*common.KB {
+		ec = config.GConfig.ReplicaScheme
+		return
+	}
+	ec = bucketMeta.Scheme()
+	return
+}
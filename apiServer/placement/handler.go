@@ -0,0 +1,180 @@
+package placement
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"apiServer/heartbeat"
+	"apiServer/locate"
+	"common"
+	"config"
+	"hashRing"
+	"meta"
+	"meta/funcParams"
+	"utils"
+)
+
+// 单次检查最多遍历的对象数
+const maxCheckLimit = 1000
+
+// 违反故障域约束的对象
+// Hash：对象hash值；EC：对象的纠删码方案（k+m）；Shards：key为分片下标，value为分片所在的数据节点；
+// Domains：key为故障域，value为该故障域上的分片数量
+type violation struct {
+	Hash    string         `json:"hash"`
+	EC      string         `json:"ec"`
+	Shards  map[int]string `json:"shards"`
+	Domains map[string]int `json:"domains"`
+}
+
+// 故障域约束检查的响应体
+type checkResult struct {
+	Checked    int          `json:"checked"`
+	Violations []*violation `json:"violations"`
+	Truncated  bool         `json:"truncated"`
+	NextMarker string       `json:"nextMarker,omitempty"`
+}
+
+// -------------------------------------------
+// 检查对象分片的放置是否满足故障域约束：GET /placement/?marker=&limit=
+// 约束：任一故障域整体失效时丢失的分片数不超过修复分片数，即每个故障域上的分片数不超过对象纠删码方案的修复分片数
+// NOTE:
+//   1) 按照对象hash值的顺序遍历，每次最多遍历limit（默认且最大为1000）个对象，
+//      若truncated为true，则将响应中的nextMarker作为下一次请求的marker继续检查；
+//   2) 向哈希环上定位的数据节点、代替已满节点写入的数据节点以及下线中的数据节点查询分片的实际位置，
+//      数据迁移完成前的结果可能包含尚未迁移的对象
+// -------------------------------------------
+func Handler(w http.ResponseWriter, r *http.Request) {
+	var (
+		query       = r.URL.Query()
+		marker      string
+		markerBytes []byte
+		limit       int
+		domains     map[string]string
+		DMongo      meta.Store
+		metas       []*meta.ObjectMeta
+		objMeta     *meta.ObjectMeta
+		result      checkResult
+		objViolate  *violation
+		resBytes    []byte
+		err         error
+	)
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if markerBytes, err = base64.URLEncoding.DecodeString(query.Get("marker")); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	marker = string(markerBytes)
+	limit = maxCheckLimit
+	if query.Get("limit") != "" {
+		if limit, err = strconv.Atoi(query.Get("limit")); err != nil || limit <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if limit > maxCheckLimit {
+			limit = maxCheckLimit
+		}
+	}
+
+	// 获取各数据节点所在的故障域，以及按照hash值排序的对象元数据
+	if domains, err = nodeDomains(); err != nil {
+		log.Println(common.ErrGetAllNode, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if DMongo, err = meta.NewStore(); err == nil {
+		metas, err = DMongo.ListHashMetas(marker, limit)
+	}
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// 检查每个对象（同一个hash值只检查一次）
+	result.Violations = []*violation{}
+	for _, objMeta = range metas {
+		if objMeta.Hash == marker {
+			continue
+		}
+
+		// 内联存储的对象没有分片，不检查
+		if objMeta.Inline {
+			marker = objMeta.Hash
+			continue
+		}
+		if objViolate = checkObject(objMeta, domains); objViolate != nil {
+			result.Violations = append(result.Violations, objViolate)
+		}
+		result.Checked++
+		marker = objMeta.Hash
+	}
+	if result.Truncated = len(metas) == limit; result.Truncated {
+		result.NextMarker = base64.URLEncoding.EncodeToString([]byte(marker))
+	}
+
+	resBytes, _ = json.Marshal(result)
+	w.Write(resBytes)
+}
+
+// 获取所有数据节点所在的故障域：key为节点ip，value为故障域
+func nodeDomains() (domains map[string]string, err error) {
+	var (
+		DMongo meta.Store
+		nodes  []*meta.DsNode
+	)
+
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.NodeColName)); err != nil {
+		return
+	}
+	if nodes, err = DMongo.GetAllNodes(); err != nil {
+		return
+	}
+	domains = make(map[string]string)
+	for _, node := range nodes {
+		domains[node.Ip] = node.FailureDomain()
+	}
+	return
+}
+
+// 检查对象的分片所在的故障域，满足约束时返回nil
+func checkObject(objMeta *meta.ObjectMeta, domains map[string]string) (objViolate *violation) {
+	var (
+		dataServers = heartbeat.GetOnlineDataServers()
+		hash        = objMeta.Hash
+		ec          = objMeta.Scheme()
+		nodes       []string
+		writeNodes  []string
+		node        string
+		index       int
+		shardIndex  int
+		domain      string
+	)
+
+	nodes, _ = hashRing.GetNodes(hash, ec)
+	writeNodes, _ = hashRing.GetWriteNodes(hash, ec)
+	objViolate = &violation{Hash: hash, EC: ec.String(), Shards: make(map[int]string), Domains: make(map[string]int)}
+	for _, node = range utils.SliceRemoveReplica(append(append(nodes, writeNodes...), hashRing.OffRingNodes()...)) {
+		if index = utils.SliceIndexOfMember(dataServers, node); index == -1 {
+			continue
+		}
+		if shardIndex = locate.LocateShard(dataServers[index], hash); shardIndex == -1 {
+			continue
+		}
+		objViolate.Shards[shardIndex] = node
+		objViolate.Domains[domains[node]]++
+	}
+	for domain = range objViolate.Domains {
+		if objViolate.Domains[domain] > ec.ParityShards {
+			return
+		}
+	}
+	return nil
+}
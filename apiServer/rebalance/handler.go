@@ -0,0 +1,41 @@
+package rebalance
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"config"
+	"meta"
+	"meta/funcParams"
+)
+
+// 查询数据迁移任务的状态：GET /rebalance/
+// NOTE: 返回迁移任务元数据（源哈希环、目标哈希环、进度和统计信息），不存在迁移任务时返回404
+func Handler(w http.ResponseWriter, r *http.Request) {
+	var (
+		DMongo   meta.Store
+		job      *meta.RebalanceJob
+		resBytes []byte
+		err      error
+	)
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RebalanceColName)); err == nil {
+		job, err = DMongo.GetRebalanceJob()
+	}
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	resBytes, _ = json.Marshal(job)
+	w.Write(resBytes)
+}
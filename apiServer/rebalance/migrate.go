@@ -0,0 +1,297 @@
+package rebalance
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"apiServer/heartbeat"
+	"apiServer/locate"
+	"common"
+	"config"
+	"hashRing"
+	"stream"
+	"utils"
+)
+
+// -------------------------------------------
+// 迁移一个对象：使对象的第i个分片位于目标哈希环上定位的第i个数据节点，返回迁移的分片数量和字节数
+// 1) 在源哈希环和目标哈希环定位的数据节点上查询该对象的分片；
+// 2) 分片已位于目标节点则跳过，否则从其所在节点拷贝至目标节点；
+// 3) 无法拷贝的分片（如所在节点已离线）由纠删码根据其他分片重建后写入目标节点；
+// 4) 所有分片都已位于目标节点后，删除其他节点上的旧分片
+// NOTE: 迁移失败时不删除任何旧分片，由下一次迁移任务重试；分片数量由对象的纠删码方案ec决定；
+//       目标节点已满时，分片位于该节点或者代替该节点写入的节点（见HashRing.GetWriteNodes）上均视为已迁移，
+//       需要拷贝或者重建的分片写入代替的节点（不向已满的节点写入，也不迁移已满节点上已有的分片）
+// -------------------------------------------
+func migrateObject(hash string, size int64, ec common.ECScheme, sources []*hashRing.HashRing,
+	target *hashRing.HashRing, limiter *throttle) (moved int, bytes int64, err error) {
+
+	var (
+		dataServers = heartbeat.GetOnlineDataServers()
+		nodes       []string
+		writeNodes  []string
+		targets     = make([]string, ec.AllShards())
+		writes      = make([]string, ec.AllShards())
+		located     map[int][]string
+		readInfo    = make(map[int]string)
+		rebuild     = make(map[int]string)
+		servers     []string
+		server      string
+		shardSize   int64
+		copied      bool
+		i           int
+	)
+
+	// 目标节点（ip:port）以及写入时代替已满目标节点的节点：需要写入的节点离线时无法迁移
+	nodes, writeNodes = target.GetNodes(hash, ec), target.GetWriteNodes(hash, ec)
+	if len(nodes) != ec.AllShards() || len(writeNodes) != ec.AllShards() {
+		err = common.ErrNotEnoughDS
+		return
+	}
+	for i = range nodes {
+		targets[i], writes[i] = onlineServer(dataServers, nodes[i]), onlineServer(dataServers, writeNodes[i])
+		if writes[i] == "" {
+			err = common.ErrShardTargetOffline
+			return
+		}
+	}
+	located = locateShards(hash, ec, candidates(hash, ec, sources, target), dataServers)
+
+	// 拷贝不在目标节点上的分片
+	shardSize = ec.ShardSize(size)
+	for i = 0; i < ec.AllShards(); i++ {
+		if targets[i] != "" && utils.SliceHasMember(located[i], targets[i]) {
+			readInfo[i] = targets[i]
+			continue
+		}
+		if targets[i] = writes[i]; utils.SliceHasMember(located[i], targets[i]) {
+			readInfo[i] = targets[i]
+			continue
+		}
+		copied = false
+		for _, server = range located[i] {
+			if err = copyShard(server, targets[i], hash, i, shardSize); err == nil {
+				copied = true
+				break
+			}
+		}
+		if !copied {
+			rebuild[i] = targets[i]
+			continue
+		}
+		readInfo[i] = targets[i]
+		moved++
+		bytes += shardSize
+		limiter.wait(shardSize)
+	}
+
+	// 重建无法拷贝的分片
+	err = nil
+	if len(rebuild) > 0 {
+		if err = rebuildShards(readInfo, rebuild, hash, size, ec); err != nil {
+			return
+		}
+		moved += len(rebuild)
+		bytes += shardSize * int64(len(rebuild))
+		limiter.wait(shardSize * int64(len(rebuild)))
+	}
+
+	// 删除其他节点上的旧分片
+	for i, servers = range located {
+		for _, server = range servers {
+			if server != targets[i] {
+				deleteShard(server, hash, i)
+			}
+		}
+	}
+	return
+}
+
+// 可能存储该对象分片的数据节点：目标哈希环和各源哈希环上定位的节点，以及写入时代替已满节点的节点（去重）
+func candidates(hash string, ec common.ECScheme, sources []*hashRing.HashRing, target *hashRing.HashRing) (result []string) {
+	for _, ring := range append(append([]*hashRing.HashRing{}, sources...), target) {
+		result = append(append(result, ring.GetNodes(hash, ec)...), ring.GetWriteNodes(hash, ec)...)
+	}
+	return utils.SliceRemoveReplica(result)
+}
+
+// -------------------------------------------
+// 查询在线的候选节点上存储的该对象分片：key为分片下标，value为存储该分片的数据节点（ip:port）
+// NOTE: 一个节点上可能同时存储了该对象的多个分片（如未删除的旧分片和迁移至该节点的新分片），
+//       故按照分片名逐个确认各分片是否存在（各节点并发查询）
+// -------------------------------------------
+func locateShards(hash string, ec common.ECScheme, nodes []string, dataServers []string) (located map[int][]string) {
+	var (
+		servers []string
+		held    [][]bool
+		server  string
+		wg      sync.WaitGroup
+		i       int
+	)
+
+	for _, node := range nodes {
+		if server = onlineServer(dataServers, node); server != "" {
+			servers = append(servers, server)
+		}
+	}
+	servers = utils.SliceRemoveReplica(servers)
+	held = make([][]bool, len(servers))
+	for i = range servers {
+		held[i] = make([]bool, ec.AllShards())
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for index := range held[i] {
+				held[i][index] = locate.HasShard(servers[i], hash, index)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	located = make(map[int][]string)
+	for i = range servers {
+		for index := range held[i] {
+			if held[i][index] {
+				located[index] = append(located[index], servers[i])
+			}
+		}
+	}
+	return
+}
+
+// 获取哈希环节点（ip）对应的在线数据节点（ip:port），节点离线时返回空字符串
+func onlineServer(dataServers []string, node string) string {
+	for _, dataServer := range dataServers {
+		if strings.Contains(dataServer, node) {
+			return dataServer
+		}
+	}
+	return ""
+}
+
+// -------------------------------------------
+// 将分片从src拷贝至dst：src上的分片经过hash校验后上传至dst的临时文件并提交
+// NOTE: 小文件分片在dataServer上按照聚合对象预定的空间写入，须一次写入整个分片
+// -------------------------------------------
+func copyShard(src string, dst string, hash string, index int, shardSize int64) (err error) {
+	var (
+		name   = fmt.Sprintf("%s.%d", hash, index)
+		reader *stream.GetStream
+		writer *stream.TempPutStream
+		data   []byte
+	)
+
+	if reader, err = stream.NewGetStream(src, name); err != nil {
+		return
+	}
+	defer reader.Close()
+	if writer, err = stream.NewTempPutStream(dst, name, shardSize); err != nil {
+		return
+	}
+	if shardSize < config.GConfig.AggregateObjSize*common.MB {
+		if data, err = ioutil.ReadAll(reader); err == nil {
+			_, err = writer.Write(data)
+		}
+	} else {
+		_, err = io.Copy(writer, reader)
+	}
+	if err != nil {
+		writer.Commit(false)
+		return
+	}
+	writer.Commit(true)
+	return checkShard(dst, hash, index)
+}
+
+// 由纠删码重建rebuild中的分片（key为分片下标，value为目标数据节点），readInfo为读取其他分片的数据节点
+// NOTE: 多副本对象直接从其他可读的副本拷贝
+func rebuildShards(readInfo map[int]string, rebuild map[int]string, hash string, size int64, ec common.ECScheme) (
+	err error) {
+
+	var (
+		rebuildStream stream.ObjectGetStream
+		replicaStream *stream.ReplicaGetStream
+		rsStream      *stream.RSGetStream
+		index         int
+		server        string
+	)
+
+	if ec.IsReplica() {
+		if replicaStream, err = stream.NewReplicaRebuildStream(readInfo, rebuild, hash, size, ec); err != nil {
+			return
+		}
+		rebuildStream = replicaStream
+	} else {
+		if rsStream, err = stream.NewRSRebuildStream(readInfo, rebuild, hash, size, ec); err != nil {
+			return
+		}
+		rebuildStream = rsStream
+	}
+	if _, err = io.Copy(utils.NewNullWriter(), rebuildStream); err != nil {
+		rebuildStream.Abort()
+		return
+	}
+	rebuildStream.Close()
+	for index, server = range rebuild {
+		if err = checkShard(server, hash, index); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 确认分片已提交至数据节点（临时文件提交的结果不返回给调用方，按照分片名定位确认）
+func checkShard(server string, hash string, index int) error {
+	if !locate.HasShard(server, hash, index) {
+		return common.ErrShardNotMigrated
+	}
+	return nil
+}
+
+// 删除数据节点上的旧分片（失败时忽略，由下一次迁移任务重试）
+func deleteShard(server string, hash string, index int) {
+	var (
+		request  *http.Request
+		response *http.Response
+		err      error
+	)
+
+	if request, err = http.NewRequest(http.MethodDelete, fmt.Sprintf("http://%s/objects/%s.%d", server, hash, index), nil); err != nil {
+		return
+	}
+	client := http.Client{}
+	if response, err = client.Do(request); err == nil {
+		response.Body.Close()
+	}
+}
+
+// ---------------------------------
+// 迁移限速：按照累计迁移的字节数和已用时间计算须等待的时间（limit为每秒字节数，不大于0时不限速）
+// ---------------------------------
+type throttle struct {
+	limit int64
+	bytes int64
+	start time.Time
+}
+
+func newThrottle(limit int64) *throttle {
+	return &throttle{limit: limit, start: time.Now()}
+}
+
+func (t *throttle) wait(n int64) {
+	var expect time.Duration
+
+	if t.limit <= 0 {
+		return
+	}
+	t.bytes += n
+	expect = time.Duration(float64(t.bytes) / float64(t.limit) * float64(time.Second))
+	if elapsed := time.Since(t.start); expect > elapsed {
+		time.Sleep(expect - elapsed)
+	}
+}
@@ -0,0 +1,92 @@
+package rebalance
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"common"
+	"config"
+	"hashRing"
+	"meta"
+	"meta/funcParams"
+	"utils"
+)
+
+// 读取对象时使用的源哈希环缓存的有效期
+const readSourcesTTL = 5 * time.Second
+
+var (
+	readSources      []*hashRing.HashRing // 迁移任务中数据可能所在的源哈希环（从元数据中加载）
+	pendingSources   []*hashRing.HashRing // 已变化但尚未保存至迁移任务的哈希环（变化前的哈希环）
+	readSourcesTime  time.Time            // 源哈希环的加载时间
+	readSourcesMutex sync.Mutex
+)
+
+// -------------------------------------------
+// 获取对象的分片可能仍位于的源哈希环上该对象的定位节点（包括写入时代替已满节点的节点，ec为对象的纠删码方案）
+// 1) 迁移任务迁移中，或者已完成但有迁移失败的对象时，对象的分片可能仍位于任务的源哈希环上；
+// 2) 哈希环刚变化、迁移任务尚未保存至元数据时，对象的分片位于变化前的哈希环上
+// NOTE: 只返回与目标哈希环上的定位节点targets不同的定位结果中的节点，没有未完成的迁移任务时返回nil；
+//       迁移任务从元数据中加载后缓存readSourcesTTL，避免每次读取对象都查询元数据，迁移任务创建或更新后缓存立即失效
+// -------------------------------------------
+func SourceNodes(hash string, ec common.ECScheme, targets []string) (nodes []string) {
+	var placement []string
+
+	for _, ring := range loadReadSources() {
+		for _, placement = range [][]string{ring.GetNodes(hash, ec), ring.GetWriteNodes(hash, ec)} {
+			if !utils.SliceEqual(placement, targets) {
+				nodes = append(nodes, placement...)
+			}
+		}
+	}
+	return utils.SliceRemoveReplica(nodes)
+}
+
+// 获取源哈希环（缓存过期时从元数据中重新加载迁移任务，加载失败时沿用缓存）
+func loadReadSources() (sources []*hashRing.HashRing) {
+	var (
+		DMongo meta.Store
+		job    *meta.RebalanceJob
+		source []*meta.RingNode
+		err    error
+	)
+
+	readSourcesMutex.Lock()
+	defer readSourcesMutex.Unlock()
+	if time.Since(readSourcesTime) >= readSourcesTTL {
+		if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RebalanceColName)); err == nil {
+			job, err = DMongo.GetRebalanceJob()
+		}
+		if err != nil {
+			log.Println(err)
+		} else {
+			readSources = nil
+			if job != nil && (job.State == meta.RebalanceStateRunning || job.Failed > 0) {
+				for _, source = range job.Sources {
+					readSources = append(readSources, hashRing.NewHashRing(source))
+				}
+			}
+		}
+		readSourcesTime = time.Now()
+	}
+	sources = append(append(sources, readSources...), pendingSources...)
+	return
+}
+
+// 哈希环变化时记录变化前的哈希环（迁移任务保存前读取对象时使用）
+func addPendingSource(before []*meta.RingNode) {
+	readSourcesMutex.Lock()
+	pendingSources = append(pendingSources, hashRing.NewHashRing(before))
+	readSourcesMutex.Unlock()
+}
+
+// 迁移任务保存后移除最早记录的变化前的哈希环，并使缓存失效
+func removePendingSource() {
+	readSourcesMutex.Lock()
+	if len(pendingSources) > 0 {
+		pendingSources = pendingSources[1:]
+	}
+	readSourcesTime = time.Time{}
+	readSourcesMutex.Unlock()
+}
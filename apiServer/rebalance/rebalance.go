@@ -0,0 +1,183 @@
+package rebalance
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"common"
+	"common/apiFlag"
+	"config"
+	"hashRing"
+	"meta"
+	"meta/funcParams"
+)
+
+// 没有收到哈希环变化时检查迁移任务的间隔（用于接管其他apiServer异常退出后未完成的任务）
+const jobCheckInterval = 30 * time.Second
+
+// 唤醒迁移任务执行协程
+var wakeUp = make(chan struct{}, 1)
+
+// -------------------------------------------
+// 启动数据迁移：数据节点加入或离开哈希环时，将对象分片迁移至新哈希环上的定位节点
+// NOTE:
+//   1) 每个apiServer都会监听到哈希环的变化并创建（或更新）迁移任务，迁移任务在元数据中只有一个；
+//   2) 迁移任务由加锁成功的apiServer执行，锁过期后（如apiServer异常退出）由其他apiServer接管，
+//      并从元数据中保存的进度（marker）处继续迁移
+// -------------------------------------------
+func StartRebalance() {
+	go listenRingChange()
+	for {
+		runJob()
+		select {
+		case <-wakeUp:
+		case <-time.After(jobCheckInterval):
+		}
+	}
+}
+
+// 监听哈希环的变化，创建（或更新）迁移任务，创建失败时间隔jobCheckInterval后重试
+// NOTE: 迁移任务保存前，读取对象时同样从变化前的哈希环上查找分片
+func listenRingChange() {
+	var (
+		DMongo meta.Store
+		change *hashRing.RingChange
+		err    error
+	)
+
+	for change = range hashRing.WatchChange() {
+		addPendingSource(change.Before)
+		for {
+			if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RebalanceColName)); err == nil {
+				_, err = DMongo.StartRebalanceJob(change.Before, change.After)
+			}
+			if err == nil {
+				break
+			}
+			log.Println(common.ErrStartRebalance, err)
+			time.Sleep(jobCheckInterval)
+		}
+		removePendingSource()
+		notify()
+	}
+}
+
+// 唤醒迁移任务执行协程（不阻塞）
+func notify() {
+	select {
+	case wakeUp <- struct{}{}:
+	default:
+	}
+}
+
+// -------------------------------------------
+// 执行迁移任务：对迁移任务加锁，按照对象hash值的顺序分批迁移，每批迁移完成后保存进度并续期锁
+// NOTE: 保存进度失败（目标哈希环已变化或者锁已被接管）时停止本次迁移，目标哈希环变化时立即重新执行
+// -------------------------------------------
+func runJob() {
+	var (
+		locker  = *apiFlag.ListenIp + ":" + strconv.Itoa(*apiFlag.ListenPort)
+		DMongo  meta.Store
+		DMongo2 meta.Store
+		job     *meta.RebalanceJob
+		sources []*hashRing.HashRing
+		source  []*meta.RingNode
+		target  *hashRing.HashRing
+		limiter *throttle
+		metas   []*meta.ObjectMeta
+		objMeta *meta.ObjectMeta
+		moved   int
+		bytes   int64
+		updated bool
+		err     error
+	)
+
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RebalanceColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	if job, err = DMongo.LockRebalanceJob(locker, lockExpire()); err != nil || job == nil {
+		if err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	if DMongo2, err = meta.NewStore(); err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, source = range job.Sources {
+		sources = append(sources, hashRing.NewHashRing(source))
+	}
+	target = hashRing.NewHashRing(job.Target)
+	limiter = newThrottle(config.GConfig.RebalanceBandwidth * common.MB)
+	log.Println("rebalance job", job.Generation, "running from marker", job.Marker)
+
+	for {
+		if metas, err = DMongo2.ListHashMetas(job.Marker, batchSize()); err != nil {
+			log.Println(err)
+			return
+		}
+
+		// 所有对象都已遍历，迁移任务完成
+		if len(metas) == 0 {
+			job.State = meta.RebalanceStateFinished
+			job.Finished = time.Now().UTC()
+			job.Updated = job.Finished
+			if _, err = DMongo.UpdateRebalanceJob(job); err != nil {
+				log.Println(err)
+			}
+			log.Println("rebalance job", job.Generation, "finished, objects:", job.Objects, "failed:", job.Failed)
+			return
+		}
+
+		// NOTE: 同一个hash值可能对应多个对象元数据（相同内容的对象或版本），按照hash值排序后只迁移一次
+		for _, objMeta = range metas {
+			if objMeta.Hash == job.Marker || objMeta.Hash == "" {
+				continue
+			}
+
+			// 内联存储的对象数据保存在元数据中，不需要迁移
+			if objMeta.Inline {
+				job.Marker = objMeta.Hash
+				continue
+			}
+			moved, bytes, err = migrateObject(objMeta.Hash, objMeta.Size, objMeta.Scheme(), sources, target, limiter)
+			job.Objects++
+			job.Shards += int64(moved)
+			job.Bytes += bytes
+			if err != nil {
+				job.Failed++
+				log.Println(common.ErrMigrateObject, objMeta.Hash, err)
+			}
+			job.Marker = objMeta.Hash
+		}
+
+		// 保存进度并续期锁
+		job.Updated = time.Now().UTC()
+		job.LockExpire = job.Updated.Add(lockExpire())
+		if updated, err = DMongo.UpdateRebalanceJob(job); err != nil || !updated {
+			if err != nil {
+				log.Println(err)
+			}
+			log.Println("rebalance job", job.Generation, "changed or taken over, stop at marker", job.Marker)
+			notify()
+			return
+		}
+	}
+}
+
+// 迁移任务锁的过期时间
+func lockExpire() time.Duration {
+	return config.GConfig.RebalanceLockExpire * time.Second
+}
+
+// 每批迁移的对象数量
+func batchSize() int {
+	if config.GConfig.RebalanceBatchSize <= 0 {
+		return 100
+	}
+	return config.GConfig.RebalanceBatchSize
+}
@@ -0,0 +1,90 @@
+package s3
+
+import (
+	"common"
+	"log"
+	"net/http"
+
+	"apiServer/buckets"
+	"meta"
+	"utils"
+)
+
+// -------------------------------------------
+// ListBuckets: GET /
+// -------------------------------------------
+func listBuckets(w http.ResponseWriter, r *http.Request) {
+	var (
+		metas  []*meta.BucketMeta
+		Meta   *meta.BucketMeta
+		result *listAllMyBucketsResult
+		err    error
+	)
+
+	if metas, err = buckets.ListBuckets(); err != nil {
+		log.Println(err)
+		writeError(w, r, errInternalError)
+		return
+	}
+	result = &listAllMyBucketsResult{Owner: owner{ID: "doss", DisplayName: "doss"}}
+	for _, Meta = range metas {
+		result.Buckets = append(result.Buckets, bucketEntry{
+			Name:         Meta.Name,
+			CreationDate: Meta.Created.UTC().Format(s3TimeFormat),
+		})
+	}
+	writeXML(w, result)
+}
+
+// -------------------------------------------
+// CreateBucket: PUT /<bucket>（可以通过请求头x-doss-ec指定桶内对象的纠删码方案）
+// -------------------------------------------
+func createBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	var (
+		ec      common.ECScheme
+		created bool
+		err     error
+	)
+
+	if !utils.IsValidBucketName(bucket) {
+		writeError(w, r, errInvalidBucketName)
+		return
+	}
+	if ec, err = utils.GetECFromHeader(r.Header); err != nil {
+		writeError(w, r, errInvalidArgument)
+		return
+	}
+	if created, err = buckets.CreateBucket(bucket, ec); err != nil {
+		log.Println(err)
+		writeError(w, r, errInternalError)
+		return
+	}
+	if !created {
+		writeError(w, r, errBucketExists)
+		return
+	}
+	w.Header().Set("location", "/"+bucket)
+	w.Header().Set("x-amz-request-id", newRequestId())
+}
+
+// -------------------------------------------
+// DeleteBucket: DELETE /<bucket>（只有空的存储桶才可以删除）
+// -------------------------------------------
+func deleteBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	var err error
+
+	if err = buckets.DeleteBucket(bucket); err != nil {
+		switch err {
+		case common.ErrBucketNotFound:
+			writeError(w, r, errNoSuchBucket)
+		case common.ErrBucketNotEmpty:
+			writeError(w, r, errBucketNotEmpty)
+		default:
+			log.Println(err)
+			writeError(w, r, errInternalError)
+		}
+		return
+	}
+	w.Header().Set("x-amz-request-id", newRequestId())
+	w.WriteHeader(http.StatusNoContent)
+}
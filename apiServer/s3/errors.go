@@ -0,0 +1,94 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// S3错误码定义（对应S3 XML错误响应体中的Code字段）
+type apiError struct {
+	Code       string
+	Message    string
+	StatusCode int
+}
+
+var (
+	errNoSuchBucket         = &apiError{"NoSuchBucket", "The specified bucket does not exist.", http.StatusNotFound}
+	errBucketExists         = &apiError{"BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.", http.StatusConflict}
+	errBucketNotEmpty       = &apiError{"BucketNotEmpty", "The bucket you tried to delete is not empty.", http.StatusConflict}
+	errInvalidBucketName    = &apiError{"InvalidBucketName", "The specified bucket is not valid.", http.StatusBadRequest}
+	errNoSuchKey            = &apiError{"NoSuchKey", "The specified key does not exist.", http.StatusNotFound}
+	errNoSuchVersion        = &apiError{"NoSuchVersion", "The specified version does not exist.", http.StatusNotFound}
+	errInvalidRange         = &apiError{"InvalidRange", "The requested range is not satisfiable.", http.StatusRequestedRangeNotSatisfiable}
+	errNoSuchUpload         = &apiError{"NoSuchUpload", "The specified multipart upload does not exist.", http.StatusNotFound}
+	errInvalidPart          = &apiError{"InvalidPart", "One or more of the specified parts could not be found.", http.StatusBadRequest}
+	errInvalidPartOrder     = &apiError{"InvalidPartOrder", "The list of parts was not in ascending order.", http.StatusBadRequest}
+	errEntityTooSmall       = &apiError{"EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.", http.StatusBadRequest}
+	errMalformedXML         = &apiError{"MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.", http.StatusBadRequest}
+	errInvalidArgument      = &apiError{"InvalidArgument", "Invalid Argument.", http.StatusBadRequest}
+	errBadDigest            = &apiError{"BadDigest", "The Content-SHA256 you specified did not match what we received.", http.StatusBadRequest}
+	errMissingContentLength = &apiError{"MissingContentLength", "You must provide the Content-Length HTTP header.", http.StatusLengthRequired}
+	errMethodNotAllowed     = &apiError{"MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed}
+	errNotImplemented       = &apiError{"NotImplemented", "A header or query you provided implies functionality that is not implemented.", http.StatusNotImplemented}
+	errServiceUnavailable   = &apiError{"ServiceUnavailable", "Please reduce your request rate.", http.StatusServiceUnavailable}
+	errInternalError        = &apiError{"InternalError", "We encountered an internal error. Please try again.", http.StatusInternalServerError}
+)
+
+// S3 XML错误响应体
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestId string   `xml:"RequestId"`
+}
+
+// 生成请求id（写入x-amz-request-id响应头以及错误响应体）
+func newRequestId() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 16)
+}
+
+// 返回S3 XML错误响应（HEAD请求没有响应体，只返回状态码）
+func writeError(w http.ResponseWriter, r *http.Request, e *apiError) {
+	var requestId = newRequestId()
+
+	w.Header().Set("x-amz-request-id", requestId)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(e.StatusCode)
+		return
+	}
+	w.Header().Set("content-type", "application/xml")
+	w.WriteHeader(e.StatusCode)
+	w.Write([]byte(xml.Header))
+	w.Write(errorBody(r, e, requestId))
+}
+
+// 生成S3 XML错误响应体（不包括XML声明）
+func errorBody(r *http.Request, e *apiError, requestId string) (body []byte) {
+	body, _ = xml.Marshal(&errorResponse{
+		Code:      e.Code,
+		Message:   e.Message,
+		Resource:  r.URL.Path,
+		RequestId: requestId,
+	})
+	return
+}
+
+// 返回S3 XML响应体
+func writeXML(w http.ResponseWriter, v interface{}) {
+	var (
+		body []byte
+		err  error
+	)
+
+	if body, err = xml.Marshal(v); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "application/xml")
+	w.Header().Set("x-amz-request-id", newRequestId())
+	w.Write([]byte(xml.Header))
+	w.Write(body)
+}
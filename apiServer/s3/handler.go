@@ -0,0 +1,172 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"apiServer/buckets"
+	"utils"
+)
+
+// -------------------------------------------
+// S3兼容接口（path-style）：
+//   1) GET /: ListBuckets
+//   2) PUT/HEAD/DELETE /<bucket>: CreateBucket、HeadBucket、DeleteBucket
+//   3) GET /<bucket>?list-type=2: ListObjectsV2；GET /<bucket>?versions: ListObjectVersions
+//   4) PUT/GET/HEAD/DELETE /<bucket>/<key>: PutObject、GetObject、HeadObject、DeleteObject
+//   5) POST /<bucket>/<key>?uploads、PUT/GET/POST/DELETE /<bucket>/<key>?uploadId=：分片上传
+// NOTE: S3的存储桶即Doss的存储桶，对象key按照URL路径形式转义后作为元数据中的对象名
+// -------------------------------------------
+func Handler(w http.ResponseWriter, r *http.Request) {
+	var (
+		bucket string
+		key    string
+		exist  bool
+		err    error
+	)
+
+	if bucket, key = parsePath(r.URL.Path); bucket == "" {
+		if r.Method != http.MethodGet {
+			writeError(w, r, errMethodNotAllowed)
+			return
+		}
+		listBuckets(w, r)
+		return
+	}
+
+	// 创建和删除存储桶
+	if key == "" && r.Method == http.MethodPut {
+		createBucket(w, r, bucket)
+		return
+	}
+	if key == "" && r.Method == http.MethodDelete {
+		deleteBucket(w, r, bucket)
+		return
+	}
+
+	// 其余请求均要求存储桶已存在
+	if exist, err = buckets.Exist(bucket); err != nil {
+		log.Println(err)
+		writeError(w, r, errInternalError)
+		return
+	}
+	if !exist {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+
+	// 存储桶级别的请求：HeadBucket和对象列举
+	if key == "" {
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("x-amz-request-id", newRequestId())
+		case http.MethodGet:
+			if _, ok := r.URL.Query()["versions"]; ok {
+				listObjectVersions(w, r, bucket)
+			} else {
+				listObjectsV2(w, r, bucket)
+			}
+		default:
+			writeError(w, r, errMethodNotAllowed)
+		}
+		return
+	}
+
+	// 分片上传相关的请求
+	if isMultipartRequest(r) {
+		multipart(w, r, bucket, key)
+		return
+	}
+
+	// 对象级别的请求
+	switch r.Method {
+	case http.MethodPut:
+		putObject(w, r, bucket, key)
+	case http.MethodGet:
+		getObject(w, r, bucket, key)
+	case http.MethodHead:
+		headObject(w, r, bucket, key)
+	case http.MethodDelete:
+		deleteObject(w, r, bucket, key)
+	default:
+		writeError(w, r, errMethodNotAllowed)
+	}
+}
+
+// 从请求路径中解析出存储桶名和对象key（key中可以包含"/"）
+func parsePath(path string) (bucket string, key string) {
+	var parts []string
+
+	parts = strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	bucket = parts[0]
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+	return
+}
+
+// 根据对象key（请求路径中反转义后的对象key）生成元数据中的对象名
+// NOTE: 与/objects接口的对象名保持一致（见utils.CanonicalObjectName：反转义后再按照EscapeObjectName转义）
+func objectName(key string) string {
+	return utils.EscapeObjectName(key)
+}
+
+// 根据元数据中的对象名还原对象key
+func objectKey(name string) (key string) {
+	var err error
+
+	if key, err = url.PathUnescape(name); err != nil {
+		key = name
+	}
+	return
+}
+
+// 获取客户端提供的对象hash（base64编码）：
+// 1) digest: SHA-256=<base64>（与/objects接口一致）；
+// 2) x-amz-content-sha256: <hex>（aws SigV4签名时的负载散列值，UNSIGNED-PAYLOAD等取值则忽略）
+func getRequestHash(header http.Header) (hash string) {
+	var (
+		amzHash string
+		sum     []byte
+		err     error
+	)
+
+	if hash = utils.GetHashFromHeader(header); hash != "" {
+		return
+	}
+	if amzHash = header.Get("x-amz-content-sha256"); len(amzHash) != 64 {
+		return
+	}
+	if sum, err = hex.DecodeString(amzHash); err != nil {
+		return
+	}
+	hash = base64.StdEncoding.EncodeToString(sum)
+	return
+}
+
+// 根据元数据中的对象hash生成ETag（sha256的十六进制表示）
+// NOTE: 分片上传合并的对象未给出hash时，hash为组合后的散列值附加"-<part数量>"，ETag同样保留该后缀（与S3一致）
+func etag(hash string) string {
+	var (
+		unescaped string
+		suffix    string
+		sum       []byte
+		i         int
+		err       error
+	)
+
+	if unescaped, err = url.PathUnescape(hash); err != nil {
+		return "\"" + hash + "\""
+	}
+	if i = strings.LastIndex(unescaped, "-"); i != -1 {
+		unescaped, suffix = unescaped[:i], unescaped[i:]
+	}
+	if sum, err = base64.StdEncoding.DecodeString(unescaped); err != nil {
+		return "\"" + hash + "\""
+	}
+	return "\"" + hex.EncodeToString(sum) + suffix + "\""
+}
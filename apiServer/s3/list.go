@@ -0,0 +1,269 @@
+package s3
+
+import (
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"meta"
+)
+
+const (
+	maxListKeys   = 1000 // 单次列举最多返回的key数量（S3协议上限）
+	listBatchSize = 1000 // 每批从元数据中读取的对象名数量
+	s3TimeFormat  = "2006-01-02T15:04:05.000Z"
+)
+
+// 解析max-keys查询参数（默认值与上限均为1000）
+func parseMaxKeys(value string) (maxKeys int, apiErr *apiError) {
+	var err error
+
+	if value == "" {
+		maxKeys = maxListKeys
+		return
+	}
+	if maxKeys, err = strconv.Atoi(value); err != nil || maxKeys < 0 {
+		apiErr = errInvalidArgument
+		return
+	}
+	if maxKeys > maxListKeys {
+		maxKeys = maxListKeys
+	}
+	return
+}
+
+// -------------------------------------------
+// 列举存储桶中对象的所有版本（包括删除标记），并按照delimiter汇总公共前缀
+// Param:
+//   marker: 从该对象名（元数据中的对象名）之后开始列举
+// Return:
+//   nextMarker: 本次列举的最后一个对象名；truncated: 是否还有后续结果
+// -------------------------------------------
+func listVersionMetas(bucket, prefix, delimiter, marker string, maxKeys int) (
+	metas []*meta.ObjectMeta, prefixes []string, nextMarker string, truncated bool, err error) {
+
+	var (
+		DMongo     meta.Store
+		namePrefix string
+		page       []*meta.ObjectMeta
+		Meta       *meta.ObjectMeta
+		lastName   string
+		nameCount  int
+		count      int
+		key        string
+		rest       string
+		index      int
+		cp         string
+	)
+
+	if DMongo, err = meta.NewStore(); err != nil {
+		return
+	}
+	namePrefix = objectName(prefix)
+	for {
+		if page, err = DMongo.ListVersionMetas(bucket, namePrefix, marker, listBatchSize); err != nil || len(page) == 0 {
+			return
+		}
+
+		nameCount = 0
+		for _, Meta = range page {
+			// 同一对象名的其他版本
+			if Meta.Name == lastName {
+				if len(metas) > 0 && metas[len(metas)-1].Name == Meta.Name {
+					metas = append(metas, Meta)
+				}
+				continue
+			}
+			lastName = Meta.Name
+			marker = Meta.Name
+			nameCount++
+
+			// 按照delimiter汇总公共前缀
+			key = objectKey(Meta.Name)
+			if delimiter != "" {
+				rest = strings.TrimPrefix(key, prefix)
+				if index = strings.Index(rest, delimiter); index >= 0 {
+					if cp = prefix + rest[:index+len(delimiter)]; len(prefixes) == 0 || prefixes[len(prefixes)-1] != cp {
+						if count == maxKeys {
+							truncated = true
+							return
+						}
+						prefixes = append(prefixes, cp)
+						count++
+					}
+					nextMarker = Meta.Name
+					continue
+				}
+			}
+
+			if count == maxKeys {
+				truncated = true
+				return
+			}
+			metas = append(metas, Meta)
+			nextMarker = Meta.Name
+			count++
+		}
+
+		// 本批读取的对象名数量不足一批，说明已经没有后续的对象
+		if nameCount < listBatchSize {
+			return
+		}
+	}
+}
+
+// -------------------------------------------
+// ListObjectsV2: GET /<bucket>?list-type=2&prefix=&delimiter=&max-keys=&continuation-token=&start-after=
+// NOTE: continuation-token为meta.ListObjects返回的nextMarker的base64编码
+// -------------------------------------------
+func listObjectsV2(w http.ResponseWriter, r *http.Request, bucket string) {
+	var (
+		query      = r.URL.Query()
+		result     *listBucketResult
+		maxKeys    int
+		apiErr     *apiError
+		marker     string
+		tokenBytes []byte
+		metas      []*meta.ObjectMeta
+		Meta       *meta.ObjectMeta
+		prefixes   []string
+		prefix     string
+		nextMarker string
+		DMongo     meta.Store
+		err        error
+	)
+
+	if maxKeys, apiErr = parseMaxKeys(query.Get("max-keys")); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	result = &listBucketResult{
+		Name:              bucket,
+		Prefix:            query.Get("prefix"),
+		Delimiter:         query.Get("delimiter"),
+		StartAfter:        query.Get("start-after"),
+		ContinuationToken: query.Get("continuation-token"),
+		MaxKeys:           maxKeys,
+	}
+
+	// 确定列举的起始位置：continuation-token优先于start-after
+	if result.ContinuationToken != "" {
+		if tokenBytes, err = base64.URLEncoding.DecodeString(result.ContinuationToken); err != nil {
+			writeError(w, r, errInvalidArgument)
+			return
+		}
+		marker = string(tokenBytes)
+	} else if result.StartAfter != "" {
+		marker = objectName(result.StartAfter)
+	}
+
+	if DMongo, err = meta.NewStore(); err == nil {
+		metas, prefixes, nextMarker, result.IsTruncated, err = DMongo.ListObjects(
+			bucket, objectName(result.Prefix), objectName(result.Delimiter), marker, maxKeys,
+		)
+	}
+	if err != nil {
+		log.Println(err)
+		writeError(w, r, errInternalError)
+		return
+	}
+	for _, Meta = range metas {
+		result.Contents = append(result.Contents, objectEntry{
+			Key:          objectKey(Meta.Name),
+			LastModified: Meta.Modified.UTC().Format(s3TimeFormat),
+			ETag:         etag(Meta.Hash),
+			Size:         Meta.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	for _, prefix = range prefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: objectKey(prefix)})
+	}
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+	if result.IsTruncated {
+		result.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(nextMarker))
+	}
+	writeXML(w, result)
+}
+
+// -------------------------------------------
+// ListObjectVersions: GET /<bucket>?versions&prefix=&delimiter=&max-keys=&key-marker=
+// NOTE: 版本号即为元数据中的version，hash为空字符串的版本作为DeleteMarker返回；暂不支持version-id-marker
+// -------------------------------------------
+func listObjectVersions(w http.ResponseWriter, r *http.Request, bucket string) {
+	var (
+		query      = r.URL.Query()
+		result     *listVersionsResult
+		maxKeys    int
+		apiErr     *apiError
+		marker     string
+		metas      []*meta.ObjectMeta
+		Meta       *meta.ObjectMeta
+		prefixes   []string
+		prefix     string
+		nextMarker string
+		lastName   string
+		isLatest   bool
+		modified   string
+		err        error
+	)
+
+	if maxKeys, apiErr = parseMaxKeys(query.Get("max-keys")); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	result = &listVersionsResult{
+		Name:            bucket,
+		Prefix:          query.Get("prefix"),
+		Delimiter:       query.Get("delimiter"),
+		KeyMarker:       query.Get("key-marker"),
+		VersionIdMarker: query.Get("version-id-marker"),
+		MaxKeys:         maxKeys,
+	}
+	if result.KeyMarker != "" {
+		marker = objectName(result.KeyMarker)
+	}
+
+	metas, prefixes, nextMarker, result.IsTruncated, err = listVersionMetas(
+		bucket, result.Prefix, result.Delimiter, marker, maxKeys,
+	)
+	if err != nil {
+		log.Println(err)
+		writeError(w, r, errInternalError)
+		return
+	}
+
+	// 同一对象的版本按照版本号倒序排列，第一个即为最新版本
+	for _, Meta = range metas {
+		isLatest = Meta.Name != lastName
+		lastName = Meta.Name
+		modified = Meta.Modified.UTC().Format(s3TimeFormat)
+		if Meta.Hash == "" {
+			result.DeleteMarkers = append(result.DeleteMarkers, deleteMarkerEntry{
+				Key:          objectKey(Meta.Name),
+				VersionId:    strconv.Itoa(Meta.Version),
+				IsLatest:     isLatest,
+				LastModified: modified,
+			})
+			continue
+		}
+		result.Versions = append(result.Versions, versionEntry{
+			Key:          objectKey(Meta.Name),
+			VersionId:    strconv.Itoa(Meta.Version),
+			IsLatest:     isLatest,
+			LastModified: modified,
+			ETag:         etag(Meta.Hash),
+			Size:         Meta.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	for _, prefix = range prefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: prefix})
+	}
+	if result.IsTruncated {
+		result.NextKeyMarker = objectKey(nextMarker)
+	}
+	writeXML(w, result)
+}
@@ -0,0 +1,303 @@
+package s3
+
+import (
+	"common"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"apiServer/uploads"
+	"meta"
+)
+
+// 判断是否为分片上传相关的请求（?uploads或?uploadId=）
+func isMultipartRequest(r *http.Request) bool {
+	var query = r.URL.Query()
+
+	if _, ok := query["uploads"]; ok {
+		return true
+	}
+	return query.Get("uploadId") != ""
+}
+
+// -------------------------------------------
+// 分片上传：
+//   1) POST ?uploads: CreateMultipartUpload
+//   2) PUT ?partNumber=&uploadId=: UploadPart
+//   3) GET ?uploadId=: ListParts
+//   4) POST ?uploadId=: CompleteMultipartUpload
+//   5) DELETE ?uploadId=: AbortMultipartUpload
+// NOTE: part的ETag与对象一致，为part数据sha256的十六进制表示
+// -------------------------------------------
+func multipart(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	var (
+		uploadId string
+		upload   *meta.UploadMeta
+		err      error
+	)
+
+	if uploadId = r.URL.Query().Get("uploadId"); uploadId == "" {
+		if r.Method != http.MethodPost {
+			writeError(w, r, errMethodNotAllowed)
+			return
+		}
+		createMultipartUpload(w, r, bucket, key)
+		return
+	}
+
+	if upload, err = uploads.GetUpload(bucket, objectName(key), uploadId); err != nil {
+		log.Println(err)
+		if err == common.ErrUploadNotFound {
+			writeError(w, r, errNoSuchUpload)
+		} else {
+			writeError(w, r, errInternalError)
+		}
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		uploadPart(w, r, upload)
+	case http.MethodGet:
+		listParts(w, r, upload, key)
+	case http.MethodPost:
+		completeMultipartUpload(w, r, upload, key)
+	case http.MethodDelete:
+		abortMultipartUpload(w, r, upload)
+	default:
+		writeError(w, r, errMethodNotAllowed)
+	}
+}
+
+// 创建分片上传
+func createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	var (
+		ec       common.ECScheme
+		apiErr   *apiError
+		uploadId string
+		err      error
+	)
+
+	if ec, apiErr = uploadScheme(r, bucket, -1); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	if uploadId, err = uploads.Initiate(bucket, objectName(key), ec); err != nil {
+		log.Println(err)
+		writeError(w, r, errInternalError)
+		return
+	}
+	writeXML(w, &initiateMultipartUploadResult{Bucket: bucket, Key: key, UploadId: uploadId})
+}
+
+// 上传part：与PutObject一致，若客户端未提供hash则先暂存到本地临时文件
+func uploadPart(w http.ResponseWriter, r *http.Request, upload *meta.UploadMeta) {
+	var (
+		number  int
+		hash    string
+		size    int64
+		body    io.Reader
+		tmpFile *os.File
+		resCode int
+		err     error
+	)
+
+	if number, err = strconv.Atoi(r.URL.Query().Get("partNumber")); err != nil ||
+		number < 1 || number > uploads.MaxPartNumber {
+		writeError(w, r, errInvalidArgument)
+		return
+	}
+	if strings.HasPrefix(r.Header.Get("x-amz-content-sha256"), "STREAMING-") ||
+		strings.Contains(r.Header.Get("content-encoding"), "aws-chunked") {
+		writeError(w, r, errNotImplemented)
+		return
+	}
+
+	body = r.Body
+	size = r.ContentLength
+	if hash = getRequestHash(r.Header); hash == "" || size < 0 {
+		if tmpFile, hash, size, err = spoolBody(r.Body); err != nil {
+			log.Println(err)
+			writeError(w, r, errInternalError)
+			return
+		}
+		defer os.Remove(tmpFile.Name())
+		defer tmpFile.Close()
+		body = tmpFile
+	}
+
+	if resCode, err = uploads.PutPart(upload, number, body, hash, size); err != nil || resCode != http.StatusOK {
+		log.Println(err)
+		switch resCode {
+		case http.StatusBadRequest:
+			writeError(w, r, errBadDigest)
+		case http.StatusServiceUnavailable:
+			writeError(w, r, errServiceUnavailable)
+		default:
+			writeError(w, r, errInternalError)
+		}
+		return
+	}
+	w.Header().Set("etag", etag(url.PathEscape(hash)))
+	w.Header().Set("x-amz-request-id", newRequestId())
+}
+
+// 列举已上传的part
+func listParts(w http.ResponseWriter, r *http.Request, upload *meta.UploadMeta, key string) {
+	var (
+		parts  []*meta.UploadPartMeta
+		part   *meta.UploadPartMeta
+		result listPartsResult
+		err    error
+	)
+
+	if parts, err = uploads.ListParts(upload); err != nil {
+		log.Println(err)
+		writeError(w, r, errInternalError)
+		return
+	}
+	result = listPartsResult{Bucket: upload.Bucket, Key: key, UploadId: upload.UploadId}
+	for _, part = range parts {
+		result.Parts = append(result.Parts, partEntry{
+			PartNumber:   part.Number,
+			LastModified: part.Modified.UTC().Format(s3TimeFormat),
+			ETag:         etag(part.Hash),
+			Size:         part.Size,
+		})
+	}
+	writeXML(w, &result)
+}
+
+// -------------------------------------------
+// 合并分片上传：请求体中part的ETag转换为part的hash值
+// NOTE: 合并在后台进行，在uploads.CompleteWait之内结束时直接返回结果；
+//       否则先返回200，之后每隔CompleteWait发送空格保活，合并结束后在响应体中返回结果或者错误（与S3一致），
+//       此时响应头中没有x-amz-version-id
+// -------------------------------------------
+func completeMultipartUpload(w http.ResponseWriter, r *http.Request, upload *meta.UploadMeta, key string) {
+	var (
+		request   completeMultipartUploadRequest
+		parts     []uploads.CompletePart
+		done      <-chan *uploads.CompleteResult
+		result    *uploads.CompleteResult
+		ticker    *time.Ticker
+		flusher   http.Flusher
+		requestId string
+		body      []byte
+		sum       []byte
+		resCode   int
+		i         int
+		err       error
+	)
+
+	if err = xml.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Parts) == 0 {
+		writeError(w, r, errMalformedXML)
+		return
+	}
+	parts = make([]uploads.CompletePart, len(request.Parts))
+	for i = range request.Parts {
+		if sum, err = hex.DecodeString(strings.Trim(request.Parts[i].ETag, "\"")); err != nil {
+			writeError(w, r, errInvalidPart)
+			return
+		}
+		parts[i] = uploads.CompletePart{
+			Number: request.Parts[i].PartNumber,
+			Hash:   base64.StdEncoding.EncodeToString(sum),
+		}
+	}
+
+	if _, done, resCode, err = uploads.Complete(upload, parts, ""); err != nil {
+		log.Println(err)
+		writeError(w, r, completeError(err, resCode))
+		return
+	}
+	select {
+	case result = <-done:
+		if result.Err != nil {
+			writeError(w, r, completeError(result.Err, result.ResCode))
+			return
+		}
+		w.Header().Set("x-amz-version-id", strconv.Itoa(result.Meta.Version))
+		writeXML(w, newCompleteResult(upload, key, result.Meta))
+		return
+	case <-time.After(uploads.CompleteWait):
+	}
+
+	// 合并耗时较长：先返回200，合并结束之前定期发送空格保活
+	requestId = newRequestId()
+	w.Header().Set("content-type", "application/xml")
+	w.Header().Set("x-amz-request-id", requestId)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	flusher, _ = w.(http.Flusher)
+	ticker = time.NewTicker(uploads.CompleteWait)
+	defer ticker.Stop()
+	for result == nil {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case result = <-done:
+		case <-ticker.C:
+			w.Write([]byte(" "))
+		}
+	}
+	if result.Err != nil {
+		body = errorBody(r, completeError(result.Err, result.ResCode), requestId)
+	} else {
+		body, _ = xml.Marshal(newCompleteResult(upload, key, result.Meta))
+	}
+	w.Write(body)
+}
+
+// 合并分片上传的响应体
+func newCompleteResult(upload *meta.UploadMeta, key string, Meta *meta.ObjectMeta) *completeMultipartUploadResult {
+	return &completeMultipartUploadResult{
+		Location: "/" + upload.Bucket + "/" + key,
+		Bucket:   upload.Bucket,
+		Key:      key,
+		ETag:     etag(Meta.Hash),
+	}
+}
+
+// 合并分片上传的错误对应的S3错误
+func completeError(err error, resCode int) *apiError {
+	switch err {
+	case common.ErrInvalidPart:
+		return errInvalidPart
+	case common.ErrInvalidPartOrder:
+		return errInvalidPartOrder
+	case common.ErrPartTooSmall:
+		return errEntityTooSmall
+	case common.ErrUploadNotFound:
+		return errNoSuchUpload
+	}
+	if resCode == http.StatusServiceUnavailable {
+		return errServiceUnavailable
+	}
+	return errInternalError
+}
+
+// 取消分片上传
+func abortMultipartUpload(w http.ResponseWriter, r *http.Request, upload *meta.UploadMeta) {
+	var err error
+
+	if err = uploads.Abort(upload); err != nil {
+		log.Println(err)
+		if err == common.ErrUploadNotFound {
+			writeError(w, r, errNoSuchUpload)
+		} else {
+			writeError(w, r, errInternalError)
+		}
+		return
+	}
+	w.Header().Set("x-amz-request-id", newRequestId())
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,273 @@
+package s3
+
+import (
+	"common"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"apiServer/buckets"
+	"apiServer/objects"
+	"meta"
+	"meta/funcParams"
+	"utils"
+)
+
+// -------------------------------------------
+// PutObject：若客户端未提供对象hash，则先将数据暂存到本地临时文件并计算sha256，再从临时文件上传
+// -------------------------------------------
+func putObject(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	var (
+		hash      string
+		size      int64
+		body      io.Reader
+		tmpFile   *os.File
+		ec        common.ECScheme
+		apiErr    *apiError
+		data      []byte
+		inline    bool
+		metaParam funcParams.MetaParamFunc
+		resCode   int
+		DMongo    meta.Store
+		err       error
+	)
+
+	// 不支持aws-chunked分块签名的上传方式
+	if strings.HasPrefix(r.Header.Get("x-amz-content-sha256"), "STREAMING-") ||
+		strings.Contains(r.Header.Get("content-encoding"), "aws-chunked") {
+		writeError(w, r, errNotImplemented)
+		return
+	}
+
+	body = r.Body
+	size = r.ContentLength
+	if hash = getRequestHash(r.Header); hash == "" || size < 0 {
+		if tmpFile, hash, size, err = spoolBody(r.Body); err != nil {
+			log.Println(err)
+			writeError(w, r, errInternalError)
+			return
+		}
+		defer os.Remove(tmpFile.Name())
+		defer tmpFile.Close()
+		body = tmpFile
+	}
+	if ec, apiErr = uploadScheme(r, bucket, size); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
+	// 很小的对象内联存储在元数据中（inline为false说明该数据已存储在数据节点，按照正常流程去重）
+	if objects.InlineUpload(r.Header, size) {
+		if data, inline, resCode, err = objects.PutInlineObject(body, url.PathEscape(hash), size); err != nil {
+			log.Println(err)
+			writeError(w, r, putError(resCode))
+			return
+		}
+	}
+
+	// 上传对象（若hash已存在则只添加元数据）
+	if inline {
+		metaParam = funcParams.MetaParamInline(data)
+	} else {
+		if ec, resCode, err = objects.PutObject(body, hash, size, ec); err != nil || resCode != http.StatusOK {
+			log.Println(err)
+			writeError(w, r, putError(resCode))
+			return
+		}
+		metaParam = funcParams.MetaParamEC(ec)
+	}
+
+	// 添加对象元数据（bucket、name、size、hash、version、ec或内联数据）
+	if DMongo, err = meta.NewStore(); err == nil {
+		_, err = DMongo.PutObjectMeta(bucket, objectName(key), size, url.PathEscape(hash), metaParam)
+	}
+	if err != nil {
+		log.Println(err)
+		writeError(w, r, errInternalError)
+		return
+	}
+	w.Header().Set("etag", etag(url.PathEscape(hash)))
+	w.Header().Set("x-amz-request-id", newRequestId())
+}
+
+// 上传对象数据失败时返回的错误（resCode为objects.PutObject等返回的状态码）
+func putError(resCode int) *apiError {
+	switch resCode {
+	case http.StatusBadRequest:
+		return errBadDigest
+	case http.StatusServiceUnavailable:
+		return errServiceUnavailable
+	default:
+		return errInternalError
+	}
+}
+
+// 获取上传对象的存储方案：请求头x-doss-ec指定的方案，未指定时小对象使用多副本方案，否则使用存储桶的方案
+// NOTE: size为-1时不自动选择多副本方案（如分段上传）
+func uploadScheme(r *http.Request, bucket string, size int64) (ec common.ECScheme, apiErr *apiError) {
+	var (
+		bucketMeta *meta.BucketMeta
+		err        error
+	)
+
+	if bucketMeta, err = buckets.GetBucket(bucket); err != nil {
+		log.Println(err)
+		apiErr = errInternalError
+		return
+	}
+	if bucketMeta.Name == "" {
+		apiErr = errNoSuchBucket
+		return
+	}
+	if ec, err = objects.UploadScheme(bucketMeta, r.Header, size); err != nil {
+		apiErr = errInvalidArgument
+	}
+	return
+}
+
+// 将请求体暂存到临时文件，同时计算sha256散列值（返回的文件指针已移动到文件开头）
+func spoolBody(body io.Reader) (file *os.File, hash string, size int64, err error) {
+	var hashCalc = sha256.New()
+
+	if file, err = ioutil.TempFile("", "doss-s3-"); err != nil {
+		return
+	}
+	if size, err = io.Copy(io.MultiWriter(file, hashCalc), body); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return
+	}
+	hash = base64.StdEncoding.EncodeToString(hashCalc.Sum(nil))
+	return
+}
+
+// 获取对象元数据（versionId查询参数对应元数据中的版本号）
+func getObjectMeta(r *http.Request, bucket string, key string) (Meta *meta.ObjectMeta, apiErr *apiError) {
+	var (
+		DMongo    meta.Store
+		versionId string
+		version   int
+		err       error
+	)
+
+	if DMongo, err = meta.NewStore(); err != nil {
+		log.Println(err)
+		apiErr = errInternalError
+		return
+	}
+	if versionId = r.URL.Query().Get("versionId"); versionId == "" {
+		Meta, err = DMongo.GetObjectMeta(bucket, objectName(key))
+	} else {
+		if version, err = strconv.Atoi(versionId); err != nil {
+			apiErr = errNoSuchVersion
+			return
+		}
+		Meta, err = DMongo.GetObjectMeta(bucket, objectName(key), funcParams.MetaParamVersion(version))
+	}
+	if err != nil {
+		log.Println(err)
+		apiErr = errInternalError
+		return
+	}
+	if Meta == nil || Meta.Hash == "" {
+		apiErr = errNoSuchKey
+		if versionId != "" {
+			apiErr = errNoSuchVersion
+		}
+	}
+	return
+}
+
+// 设置对象的通用响应头
+func setObjectHeaders(w http.ResponseWriter, Meta *meta.ObjectMeta) {
+	w.Header().Set("etag", etag(Meta.Hash))
+	w.Header().Set("last-modified", Meta.Modified.UTC().Format(http.TimeFormat))
+	w.Header().Set("x-amz-version-id", strconv.Itoa(Meta.Version))
+	w.Header().Set("content-type", "application/octet-stream")
+	w.Header().Set("x-amz-request-id", newRequestId())
+}
+
+// -------------------------------------------
+// GetObject（支持Range请求头，包括多个区间）
+// -------------------------------------------
+func getObject(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	var (
+		Meta   *meta.ObjectMeta
+		apiErr *apiError
+		ranges []utils.ByteRange
+		err    error
+	)
+
+	if Meta, apiErr = getObjectMeta(r, bucket, key); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	// 与S3一致：区间不可满足时返回InvalidRange，格式错误时忽略该请求头（返回整个对象）
+	if ranges, err = utils.ParseRangeHeader(r.Header.Get("range"), Meta.Size); err == common.ErrRangeNotSatisfiable {
+		w.Header().Set("content-range", fmt.Sprintf("bytes */%d", Meta.Size))
+		writeError(w, r, errInvalidRange)
+		return
+	} else if err != nil {
+		ranges = nil
+	}
+
+	// 将对象数据（或请求的区间）写入响应：ServeObject只在写入响应头之前返回错误，
+	// 之后读取失败时由ServeObject中断连接，因此此处可以安全地返回错误信息（移除已设置的对象响应头）
+	setObjectHeaders(w, Meta)
+	if err = objects.ServeObject(w, Meta, ranges); err != nil {
+		log.Println("GetRSStream error:", err)
+		w.Header().Del("etag")
+		w.Header().Del("last-modified")
+		w.Header().Del("x-amz-version-id")
+		writeError(w, r, errServiceUnavailable)
+	}
+}
+
+// -------------------------------------------
+// HeadObject
+// -------------------------------------------
+func headObject(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	var (
+		Meta   *meta.ObjectMeta
+		apiErr *apiError
+	)
+
+	if Meta, apiErr = getObjectMeta(r, bucket, key); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	setObjectHeaders(w, Meta)
+	w.Header().Set("accept-ranges", "bytes")
+	w.Header().Set("content-length", strconv.FormatInt(Meta.Size, 10))
+}
+
+// -------------------------------------------
+// DeleteObject：与/objects接口一致，只添加删除标记（S3中删除不存在的对象同样返回204）
+// -------------------------------------------
+func deleteObject(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	if r.URL.Query().Get("versionId") != "" {
+		writeError(w, r, errNotImplemented)
+		return
+	}
+	if err := objects.DeleteObject(bucket, objectName(key)); err != nil {
+		log.Println(err)
+		writeError(w, r, errInternalError)
+		return
+	}
+	w.Header().Set("x-amz-delete-marker", "true")
+	w.Header().Set("x-amz-request-id", newRequestId())
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,10 +3,10 @@ package temp
 import (
 	"apiServer/locate"
 	"common"
-	"config"
 	"io"
 	"log"
 	"meta"
+	"meta/funcParams"
 	"net/http"
 	"net/url"
 	"stream"
@@ -24,7 +24,10 @@ func put(w http.ResponseWriter, r *http.Request) {
 		offset      int64
 		putBytes    []byte
 		putLen      int
+		blockSize   int
 		hashSum     string
+		ec          common.ECScheme
+		DMongo      meta.Store
 		err         error
 	)
 
@@ -47,7 +50,8 @@ func put(w http.ResponseWriter, r *http.Request) {
 	// NOTE: 除非正好将对象完整上传，否则接口服务每次只接受BlockSize字节的整数倍，不足的部分将被丢弃，
 	//       如果客户端的分块小于BlockSize字节，那么上传的数据就会被全部丢弃，
 	//       客户端需要在PUT之前可调用temp接口的HEAD方法检查该token当前的进度，并选择合适的偏移量和分块大小
-	putBytes = make([]byte, config.GConfig.BlockSize)
+	blockSize = stream.BlockSize(putStream.EC)
+	putBytes = make([]byte, blockSize)
 	for {
 		putLen, err = io.ReadFull(r.Body, putBytes)
 		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
@@ -64,7 +68,7 @@ func put(w http.ResponseWriter, r *http.Request) {
 
 		// 如果某次读取到的长度不到BlockSize字节且读到的总长度不等于对象的大小，
 		// 说明本次客户端上传结束，还有后续数据要上传，此时接口服务丢弃最后那次读到的长度不到BlockSize的数据
-		if putLen != config.GConfig.BlockSize && currentSize != putStream.Size {
+		if putLen != blockSize && currentSize != putStream.Size {
 			return
 		}
 		putStream.Write(putBytes[:putLen])
@@ -74,19 +78,34 @@ func put(w http.ResponseWriter, r *http.Request) {
 		// 若散列值一致，则继续检查该散列值是否已经存在，如果存在则删除临时对象，否则将临时对象转正
 		if currentSize == putStream.Size {
 			putStream.Flush()
-			getStream, err = stream.NewRSRecoverableGetStream(putStream.Servers, putStream.UUIDs, putStream.Size)
+			getStream, err = stream.NewRSRecoverableGetStream(
+				putStream.Servers, putStream.UUIDs, putStream.Size, putStream.EC,
+			)
 			if hashSum = url.PathEscape(utils.CalculateHash(getStream)); hashSum != putStream.Hash {
 				putStream.Commit(false)
 				log.Println(common.ErrRecoverPutHashMismatch)
 				w.WriteHeader(http.StatusForbidden)
 				return
 			}
-			if locate.FileExist(url.PathEscape(hashSum)) {
+			// NOTE: 上传期间可能有其他对象以不同的纠删码方案写入了相同的数据，此时沿用已有数据的方案
+			if ec, err = locate.StoredScheme(hashSum, putStream.EC); err != nil {
+				putStream.Commit(false)
+				log.Println(common.ErrPutObjectMeta, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if locate.FileExist(url.PathEscape(hashSum), ec) {
 				putStream.Commit(false)
 			} else {
+				ec = putStream.EC
 				putStream.Commit(true)
 			}
-			if _, err = meta.NewDossMongo().PutObjectMeta(putStream.Name, putStream.Size, putStream.Hash); err != nil {
+			if DMongo, err = meta.NewStore(); err == nil {
+				_, err = DMongo.PutObjectMeta(
+					putStream.Bucket, putStream.Name, putStream.Size, putStream.Hash, funcParams.MetaParamEC(ec),
+				)
+			}
+			if err != nil {
 				log.Println(common.ErrPutObjectMeta, err)
 				w.WriteHeader(http.StatusInternalServerError)
 			}
@@ -0,0 +1,250 @@
+package uploads
+
+import (
+	"common"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"apiServer/buckets"
+	"apiServer/objects"
+	"meta"
+	"utils"
+)
+
+// 创建分片上传的响应体
+type initiateResult struct {
+	Bucket   string `json:"bucket"`
+	Name     string `json:"name"`
+	UploadId string `json:"uploadId"`
+}
+
+// 列举part的响应体
+type partEntry struct {
+	Number   int    `json:"partNumber"`
+	Size     int64  `json:"size"`
+	Hash     string `json:"hash"`
+	Modified string `json:"modified"`
+}
+
+// -------------------------------------------
+// 分片上传接口：/uploads/<bucket>/<object_name>
+//   1) POST：创建分片上传，返回uploadId（请求头x-doss-ec可指定纠删码方案）；
+//   2) PUT ?uploadId=&partNumber=：上传part（请求头digest、size与PUT /objects一致）；
+//   3) GET ?uploadId=：列举已上传的part，响应头x-doss-upload-state为上传状态；
+//   4) POST ?uploadId=：合并各part为正式对象（请求体为part列表，请求头digest可选），合并在后台进行；
+//   5) DELETE ?uploadId=：取消分片上传
+// -------------------------------------------
+func Handler(w http.ResponseWriter, r *http.Request) {
+	var (
+		bucket     string
+		name       string
+		uploadId   string
+		bucketMeta *meta.BucketMeta
+		upload     *meta.UploadMeta
+		err        error
+	)
+
+	// 解析存储桶名和对象名，并检查存储桶是否存在
+	if bucket, name = utils.GetBucketObjectFromPath(r.URL.EscapedPath()); name == "" {
+		log.Println(common.ErrMissObjectName)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if bucketMeta, err = buckets.GetBucket(bucket); err != nil {
+		log.Println(common.ErrGetBucketMeta, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if bucketMeta.Name == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// 创建分片上传
+	if uploadId = r.URL.Query().Get("uploadId"); uploadId == "" {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		initiate(w, r, bucketMeta, name)
+		return
+	}
+
+	// 列举part以及查询上传状态（包括已结束的上传），其余请求均针对上传中的分片上传
+	if r.Method == http.MethodGet {
+		upload, err = GetUploadStatus(bucket, name, uploadId)
+	} else {
+		upload, err = GetUpload(bucket, name, uploadId)
+	}
+	if err != nil {
+		log.Println(err)
+		if err == common.ErrUploadNotFound {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		putPart(w, r, upload)
+	case http.MethodGet:
+		listParts(w, upload)
+	case http.MethodPost:
+		complete(w, r, upload)
+	case http.MethodDelete:
+		abort(w, upload)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// 创建分片上传：返回{"bucket", "name", "uploadId"}（纠删码方案由请求头x-doss-ec或存储桶的方案决定）
+func initiate(w http.ResponseWriter, r *http.Request, bucketMeta *meta.BucketMeta, name string) {
+	var (
+		ec       common.ECScheme
+		uploadId string
+		resBytes []byte
+		err      error
+	)
+
+	if ec, err = objects.UploadScheme(bucketMeta, r.Header, -1); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if uploadId, err = Initiate(bucketMeta.Name, name, ec); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resBytes, _ = json.Marshal(&initiateResult{bucketMeta.Name, name, uploadId})
+	w.Write(resBytes)
+}
+
+// 上传part：PUT /uploads/<bucket>/<object_name>?uploadId=&partNumber=
+func putPart(w http.ResponseWriter, r *http.Request, upload *meta.UploadMeta) {
+	var (
+		number  int
+		hash    string
+		resCode int
+		err     error
+	)
+
+	if number, err = strconv.Atoi(r.URL.Query().Get("partNumber")); err != nil {
+		log.Println(common.ErrInvalidPartNumber, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if hash = utils.GetHashFromHeader(r.Header); hash == "" {
+		log.Println(common.ErrMissObjectHash)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if resCode, err = PutPart(upload, number, r.Body, hash, utils.GetSizeFromHeader(r.Header)); err != nil {
+		log.Println(err)
+	}
+	w.WriteHeader(resCode)
+}
+
+// -------------------------------------------
+// 列举已上传的part：GET /uploads/<bucket>/<object_name>?uploadId=
+// 同时返回上传状态（用于查询后台合并的结果）：
+//   1) x-doss-upload-state：uploading、completing、completed或aborted；
+//   2) 合并中或者已完成时，etag为合并后对象的hash值；上一次合并失败时，x-doss-upload-error为失败原因
+// -------------------------------------------
+func listParts(w http.ResponseWriter, upload *meta.UploadMeta) {
+	var (
+		parts    []*meta.UploadPartMeta
+		entries  []partEntry
+		resBytes []byte
+		i        int
+		err      error
+	)
+
+	if parts, err = ListParts(upload); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	entries = make([]partEntry, len(parts))
+	for i = range parts {
+		entries[i] = partEntry{
+			Number:   parts[i].Number,
+			Size:     parts[i].Size,
+			Hash:     parts[i].Hash,
+			Modified: parts[i].Modified.UTC().Format(http.TimeFormat),
+		}
+	}
+	w.Header().Set("x-doss-upload-state", upload.State)
+	if upload.Hash != "" {
+		w.Header().Set("etag", "\""+upload.Hash+"\"")
+	}
+	if upload.Error != "" {
+		w.Header().Set("x-doss-upload-error", upload.Error)
+	}
+	resBytes, _ = json.Marshal(entries)
+	w.Write(resBytes)
+}
+
+// -------------------------------------------
+// 合并分片上传：POST /uploads/<bucket>/<object_name>?uploadId=
+// 请求体：[{"partNumber": 1, "hash": "<part hash>"}, ...]
+// NOTE: 1) part列表不合法返回400，上传不存在或者已开始合并返回404；
+//       2) 合并在CompleteWait之内结束时返回结果：成功后返回对象版本号（x-doss-version），
+//          对象hash与请求头digest不一致返回400；
+//       3) 否则返回202，合并在后台继续进行，之后通过GET ?uploadId=查询上传状态（合并失败后可以重新合并）；
+//       合并中和合并成功时etag均为合并后对象的hash值
+// -------------------------------------------
+func complete(w http.ResponseWriter, r *http.Request, upload *meta.UploadMeta) {
+	var (
+		parts   []CompletePart
+		hash    string
+		done    <-chan *CompleteResult
+		result  *CompleteResult
+		resCode int
+		err     error
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&parts); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if hash, done, resCode, err = Complete(upload, parts, utils.GetHashFromHeader(r.Header)); err != nil {
+		log.Println(err)
+		w.WriteHeader(resCode)
+		return
+	}
+	w.Header().Set("etag", "\""+hash+"\"")
+
+	select {
+	case result = <-done:
+	case <-time.After(CompleteWait):
+		w.Header().Set("x-doss-upload-state", meta.UploadStateCompleting)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if result.Err != nil {
+		w.WriteHeader(result.ResCode)
+		return
+	}
+	w.Header().Set("x-doss-version", strconv.Itoa(result.Meta.Version))
+}
+
+// 取消分片上传：DELETE /uploads/<bucket>/<object_name>?uploadId=
+func abort(w http.ResponseWriter, upload *meta.UploadMeta) {
+	var err error
+
+	if err = Abort(upload); err != nil {
+		log.Println(err)
+		if err == common.ErrUploadNotFound {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
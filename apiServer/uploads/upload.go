@@ -0,0 +1,376 @@
+package uploads
+
+import (
+	"common"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"apiServer/objects"
+	"config"
+	"meta"
+	"meta/funcParams"
+	"stream"
+	"utils"
+)
+
+const (
+	MaxPartNumber = 10000         // part编号的最大值（编号从1开始）
+	MinPartSize   = 5 * common.MB // 除最后一个part之外，每个part的最小size
+)
+
+// 合并请求等待后台合并结束的时间：超过此时间仍未结束时，合并请求不再等待（原生接口返回202，S3接口开始发送保活空格）
+const CompleteWait = 10 * time.Second
+
+// 合并分片上传时客户端给出的part列表（须按照part编号升序）
+type CompletePart struct {
+	Number int    `json:"partNumber"`
+	Hash   string `json:"hash"`
+}
+
+// 生成分片上传集合的数据库操作结构体
+func newUploadMongo() (meta.Store, error) {
+	return meta.NewStore(funcParams.MongoParamCollection(config.GConfig.UploadColName))
+}
+
+// 将客户端给出的hash（base64或URL转义后的base64）统一为元数据中的URL转义形式
+func escapeHash(hash string) string {
+	if unescaped, err := url.PathUnescape(hash); err == nil {
+		hash = unescaped
+	}
+	return url.PathEscape(hash)
+}
+
+// 创建分片上传（返回上传id），ec为各part以及合并后对象的纠删码方案
+func Initiate(bucket string, name string, ec common.ECScheme) (uploadId string, err error) {
+	var DMongo meta.Store
+
+	if DMongo, err = newUploadMongo(); err != nil {
+		return
+	}
+	return DMongo.NewUpload(bucket, name, funcParams.MetaParamEC(ec))
+}
+
+// 获取上传中的分片上传：上传不存在、合并中、已结束或者存储桶名、对象名不一致时返回ErrUploadNotFound
+func GetUpload(bucket string, name string, uploadId string) (upload *meta.UploadMeta, err error) {
+	var DMongo meta.Store
+
+	if DMongo, err = newUploadMongo(); err != nil {
+		return
+	}
+	if upload, err = DMongo.GetUpload(uploadId); err != nil {
+		return
+	}
+	if upload == nil || upload.Bucket != bucket || upload.Name != name || upload.State != meta.UploadStateUploading {
+		upload = nil
+		err = common.ErrUploadNotFound
+	}
+	return
+}
+
+// 获取分片上传（包括已结束的上传，用于查询上传状态）：上传不存在或者存储桶名、对象名不一致时返回ErrUploadNotFound
+func GetUploadStatus(bucket string, name string, uploadId string) (upload *meta.UploadMeta, err error) {
+	var DMongo meta.Store
+
+	if DMongo, err = newUploadMongo(); err != nil {
+		return
+	}
+	if upload, err = DMongo.GetUpload(uploadId); err != nil {
+		return
+	}
+	if upload == nil || upload.Bucket != bucket || upload.Name != name {
+		upload = nil
+		err = common.ErrUploadNotFound
+	}
+	return
+}
+
+// -------------------------------------------
+// 上传part：part数据与普通对象一样按照part的hash值进行纠删码存储（相同数据只存储一份），
+// 上传完成后记录part元数据，同一part重复上传时以最后一次为准
+// NOTE: 各part之间互不依赖，可以由多个客户端并行上传；part按照上传的纠删码方案存储（数据已存在时沿用其方案）
+// -------------------------------------------
+func PutPart(upload *meta.UploadMeta, number int, r io.Reader, hash string, size int64) (resCode int, err error) {
+	var (
+		DMongo meta.Store
+		ec     common.ECScheme
+	)
+
+	if number < 1 || number > MaxPartNumber {
+		resCode = http.StatusBadRequest
+		err = common.ErrInvalidPartNumber
+		return
+	}
+	if ec, resCode, err = objects.PutObject(r, hash, size, upload.Scheme()); err != nil || resCode != http.StatusOK {
+		return
+	}
+	if DMongo, err = newUploadMongo(); err == nil {
+		err = DMongo.PutUploadPart(upload.UploadId, number, size, url.PathEscape(hash), funcParams.MetaParamEC(ec))
+	}
+	if err != nil {
+		resCode = http.StatusInternalServerError
+	}
+	return
+}
+
+// 获取已上传的所有part（按照part编号升序）
+func ListParts(upload *meta.UploadMeta) (parts []*meta.UploadPartMeta, err error) {
+	var DMongo meta.Store
+
+	if DMongo, err = newUploadMongo(); err != nil {
+		return
+	}
+	return DMongo.GetUploadParts(upload.UploadId)
+}
+
+// 合并分片上传的结果（合并成功时Meta为对象元数据，失败时Err为失败原因、ResCode为对应的状态码）
+type CompleteResult struct {
+	Meta    *meta.ObjectMeta
+	ResCode int
+	Err     error
+}
+
+// -------------------------------------------
+// 合并分片上传：
+// 1) 检查part列表：编号严格升序、每个part均已上传且hash一致、除最后一个part之外不小于MinPartSize；
+// 2) 将上传状态置为completing并记录对象hash，之后在后台合并（见completeUpload），返回对象hash和合并结果的通道；
+//    客户端未给出对象hash时，对象hash由各part的hash组合得到（见composeHash），无需事先读取part数据
+// NOTE: 1) part列表不合法或者上传已不是uploading状态时直接返回错误，不开始合并；
+//       2) 合并在后台进行，不依赖于客户端的请求，调用方可以等待done或者直接返回（之后通过上传状态查询结果）；
+//       3) 各part的数据在上传结束后由dataServer的数据检查任务清除
+// -------------------------------------------
+func Complete(upload *meta.UploadMeta, completeParts []CompletePart, hash string) (
+	objectHash string, done <-chan *CompleteResult, resCode int, err error) {
+
+	var (
+		DMongo   meta.Store
+		uploaded []*meta.UploadPartMeta
+		partMap  map[int]*meta.UploadPartMeta
+		part     *meta.UploadPartMeta
+		parts    []*meta.UploadPartMeta
+		size     int64
+		composed bool
+		begun    bool
+		resultCh chan *CompleteResult
+		i        int
+	)
+
+	// 检查part列表
+	resCode = http.StatusBadRequest
+	if len(completeParts) == 0 {
+		err = common.ErrInvalidPart
+		return
+	}
+	if DMongo, err = newUploadMongo(); err != nil {
+		resCode = http.StatusInternalServerError
+		return
+	}
+	if uploaded, err = DMongo.GetUploadParts(upload.UploadId); err != nil {
+		resCode = http.StatusInternalServerError
+		return
+	}
+	partMap = make(map[int]*meta.UploadPartMeta)
+	for _, part = range uploaded {
+		partMap[part.Number] = part
+	}
+	for i = range completeParts {
+		if i > 0 && completeParts[i].Number <= completeParts[i-1].Number {
+			err = common.ErrInvalidPartOrder
+			return
+		}
+		if part = partMap[completeParts[i].Number]; part == nil || part.Hash != escapeHash(completeParts[i].Hash) {
+			err = common.ErrInvalidPart
+			return
+		}
+		if i < len(completeParts)-1 && part.Size < MinPartSize {
+			err = common.ErrPartTooSmall
+			return
+		}
+		parts = append(parts, part)
+		size += part.Size
+	}
+
+	// 客户端未给出对象hash时，由各part的hash组合得到对象hash
+	if composed = hash == ""; composed {
+		hash = composeHash(parts)
+	} else if hash, err = url.PathUnescape(escapeHash(hash)); err != nil {
+		return
+	}
+
+	// 开始合并（并发的合并请求中只有一个可以开始）
+	if begun, err = DMongo.BeginCompleteUpload(upload.UploadId, url.PathEscape(hash)); err != nil || !begun {
+		resCode = http.StatusInternalServerError
+		if err == nil {
+			resCode = http.StatusNotFound
+			err = common.ErrUploadNotFound
+		}
+		return
+	}
+	resultCh = make(chan *CompleteResult, 1)
+	go completeUpload(upload, parts, hash, size, composed, resultCh)
+	objectHash, done, resCode = url.PathEscape(hash), resultCh, http.StatusAccepted
+	return
+}
+
+// -------------------------------------------
+// 后台合并分片上传：按照顺序读取各个part的数据写入最终对象的上传数据流（各part的数据只读取一遍），
+// 读取时校验各part的hash；客户端给出对象hash时同时计算整个对象的hash进行校验（若该hash值的数据已存在则不重复写入）
+// 合并成功后将上传状态置为completed并添加对象元数据，失败时将上传状态恢复为uploading并记录失败原因（客户端可以重新合并）
+// NOTE: 合并期间上传被取消（或者超期）时，合并结束后不再添加对象元数据
+// -------------------------------------------
+func completeUpload(upload *meta.UploadMeta, parts []*meta.UploadPartMeta, hash string, size int64, composed bool,
+	resultCh chan<- *CompleteResult) {
+
+	var (
+		DMongo   meta.Store
+		ec       common.ECScheme
+		finished bool
+		result   = &CompleteResult{ResCode: http.StatusInternalServerError}
+		err      error
+	)
+
+	defer func() {
+		if result.Err != nil {
+			log.Println(common.ErrUploadComplete, upload.UploadId, result.Err)
+			if result.Err != common.ErrUploadNotFound {
+				if DMongo, err = newUploadMongo(); err == nil {
+					_, err = DMongo.FailCompleteUpload(upload.UploadId, result.Err.Error())
+				}
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+		resultCh <- result
+	}()
+
+	// 合并各part数据
+	if composed {
+		ec, result.Err = objects.PutComposedObject(newPartsReader(parts), hash, size, upload.Scheme())
+	} else {
+		ec, result.ResCode, result.Err = objects.PutObject(newPartsReader(parts), hash, size, upload.Scheme())
+		if result.ResCode == http.StatusBadRequest {
+			result.Err = common.ErrUploadHashMismatch
+		}
+	}
+	if result.Err != nil {
+		return
+	}
+
+	// 结束上传并添加对象元数据
+	result.ResCode = http.StatusInternalServerError
+	if DMongo, result.Err = newUploadMongo(); result.Err != nil {
+		return
+	}
+	if finished, result.Err = DMongo.FinishUpload(upload.UploadId, meta.UploadStateCompleted); result.Err != nil || !finished {
+		if result.Err == nil {
+			result.ResCode = http.StatusNotFound
+			result.Err = common.ErrUploadNotFound
+		}
+		return
+	}
+	if DMongo, result.Err = meta.NewStore(); result.Err != nil {
+		return
+	}
+	if _, result.Err = DMongo.PutObjectMeta(
+		upload.Bucket, upload.Name, size, url.PathEscape(hash), funcParams.MetaParamEC(ec),
+	); result.Err != nil {
+		return
+	}
+	if result.Meta, result.Err = DMongo.GetLastVersionMeta(upload.Bucket, upload.Name); result.Err != nil || result.Meta == nil {
+		if result.Err == nil {
+			result.Err = common.ErrGetLastVersionMeta
+		}
+		return
+	}
+	result.ResCode = http.StatusOK
+}
+
+// -------------------------------------------
+// 由各part的hash组合得到对象hash（客户端未给出对象hash时使用）：
+// 各part的hash依次以换行分隔后计算sha256，再附加"-<part数量>"（与S3分片上传的ETag格式一致）
+// NOTE: 相同的part组合得到相同的对象hash（相同数据只存储一份），
+//       附加的"-"不会出现在数据的散列值（base64）中，故不会与普通对象的hash值相同
+// -------------------------------------------
+func composeHash(parts []*meta.UploadPartMeta) string {
+	var (
+		hashes = make([]string, len(parts))
+		hash   string
+		i      int
+	)
+
+	for i = range parts {
+		hashes[i] = parts[i].Hash
+	}
+	hash, _ = url.PathUnescape(utils.CalculateHash(strings.NewReader(strings.Join(hashes, "\n"))))
+	return hash + "-" + strconv.Itoa(len(parts))
+}
+
+// 取消分片上传（各part的数据由dataServer的数据检查任务清除）
+func Abort(upload *meta.UploadMeta) (err error) {
+	var (
+		DMongo   meta.Store
+		finished bool
+	)
+
+	if DMongo, err = newUploadMongo(); err != nil {
+		return
+	}
+	if finished, err = DMongo.FinishUpload(upload.UploadId, meta.UploadStateAborted); err == nil && !finished {
+		err = common.ErrUploadNotFound
+	}
+	return
+}
+
+// 按照顺序依次读取各个part数据的读取流（读到某个part时才生成该part的下载流）
+// NOTE: 读取的同时计算当前part数据的hash值，读完一个part时与part元数据中的hash不一致则返回ErrPartHashMismatch
+type partsReader struct {
+	parts    []*meta.UploadPartMeta
+	part     *meta.UploadPartMeta
+	current  stream.ObjectGetStream
+	hashCalc hash.Hash
+}
+
+func newPartsReader(parts []*meta.UploadPartMeta) *partsReader {
+	return &partsReader{parts: parts}
+}
+
+func (r *partsReader) Read(p []byte) (n int, err error) {
+	for n == 0 {
+		if r.current == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			r.part, r.parts = r.parts[0], r.parts[1:]
+			if r.part.Size == 0 {
+				continue
+			}
+			if r.current, err = objects.GetStream(
+				&meta.ObjectMeta{Hash: r.part.Hash, Size: r.part.Size, EC: r.part.Scheme()},
+			); err != nil {
+				return
+			}
+			r.hashCalc = sha256.New()
+		}
+		n, err = r.current.Read(p)
+		r.hashCalc.Write(p[:n])
+		if err == io.EOF {
+			r.current.Close()
+			r.current, err = nil, nil
+			if url.PathEscape(base64.StdEncoding.EncodeToString(r.hashCalc.Sum(nil))) != r.part.Hash {
+				err = common.ErrPartHashMismatch
+				return
+			}
+		} else if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -4,15 +4,17 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"strings"
 
 	"meta"
+	"utils"
 )
 
 func Handler(w http.ResponseWriter, r *http.Request) {
 	var (
 		method   string
+		bucket   string
 		name     string
+		DMongo   meta.Store
 		metas    []*meta.ObjectMeta
 		resBytes []byte
 		i        int
@@ -26,8 +28,14 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 查询数据库，获取该对象所有版本的元数据
-	name = strings.Split(r.URL.EscapedPath(), "/")[2]
-	if metas, err = meta.NewDossMongo().GetAllVersionMetas(name); err != nil {
+	if bucket, name = utils.GetBucketObjectFromPath(r.URL.EscapedPath()); name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if DMongo, err = meta.NewStore(); err == nil {
+		metas, err = DMongo.GetAllVersionMetas(bucket, name)
+	}
+	if err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
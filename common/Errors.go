@@ -5,9 +5,14 @@ import "errors"
 // 全局错误码定义
 var (
 	// 参数检查、初始化操作的错误码定义
-	ErrParseConfig    = errors.New("parse config file error")
-	ErrMissObjectSize = errors.New("missing object size in header")
-	ErrMissObjectHash = errors.New("missing object hash in header")
+	ErrParseConfig         = errors.New("parse config file error")
+	ErrMissObjectSize      = errors.New("missing object size in header")
+	ErrMissObjectHash      = errors.New("missing object hash in header")
+	ErrMissObjectName      = errors.New("missing object name in url")
+	ErrBucketName          = errors.New("invalid bucket name")
+	ErrInvalidRange        = errors.New("invalid range header")
+	ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+	ErrInvalidECScheme     = errors.New("invalid erasure coding scheme, expect k+m or Nx")
 
 	// 数据库操作相关的错误码定义
 	ErrNewChangeStream    = errors.New("new ChangeStream failed")
@@ -17,7 +22,15 @@ var (
 	ErrUpdateAggMeta      = errors.New("update aggregate meta error")
 	ErrNewAggMeta         = errors.New("new aggregate meta error")
 	ErrRegisterNode       = errors.New("register dataServer to node collection error")
+	ErrNodeNotFound       = errors.New("ds node not found")
+	ErrInvalidHeartbeat   = errors.New("invalid heartbeat message")
+	ErrBoltServer         = errors.New("embedded meta server request failed")
+	ErrBoltServerNotSet   = errors.New("embedded meta server address (boltServer) is not set")
+	ErrEnsureIndexes      = errors.New("ensure meta indexes error, unique object version index is required")
 	ErrGetLastVersionMeta = errors.New("get last version meta error")
+	ErrGetBucketMeta      = errors.New("get bucket meta error")
+	ErrBucketNotFound     = errors.New("bucket not found")
+	ErrBucketNotEmpty     = errors.New("bucket is not empty")
 
 	// 文件操作相关的错误码定义
 	ErrOpenFile            = errors.New("open file error")
@@ -26,15 +39,29 @@ var (
 	ErrOpenTempDatFile     = errors.New("open temp dat file error")
 	ErrCopyBodyToFile      = errors.New("copy request body to file error")
 	ErrSizeMismatch        = errors.New("copy to file size mismatch")
+	ErrNoChecksum          = errors.New("block checksum file missing or not matching the file size")
+	ErrBlockChecksum       = errors.New("block checksum mismatch")
+	ErrSaveChecksum        = errors.New("save block checksum file error")
 	ErrWatchFilePath       = errors.New("watch file path error")
 	ErrWatcherEvent        = errors.New("get watch file event error")
 	ErrCheckPath           = errors.New("check file path error")
 	ErrCheckAggObjRootPath = errors.New("check aggregate objects storage root error")
 	ErrCheckObjRootPath    = errors.New("check objects storage root error")
+	ErrNoOnlineDisk        = errors.New("no online disk in storage roots")
+	ErrNoDiskSpace         = errors.New("no online disk has enough free space")
+	ErrDiskOffline         = errors.New("disk marked offline after I/O error")
+
+	// 心跳传输相关的错误码定义
+	ErrHeartbeatTransport = errors.New("unknown heartbeat transport, expect amqp or http")
+	ErrNoHeartbeatServer  = errors.New("no apiServer configured to receive heartbeat")
+	ErrPublishHeartbeat   = errors.New("publish heartbeat error")
+	ErrHeartbeatRejected  = errors.New("heartbeat rejected by apiServer")
 
 	// 一致性哈希相关的错误码定义
 	ErrDataLocate          = errors.New("data locate failed")
 	ErrNotEnoughDS         = errors.New("cannot find enough dataServer")
+	ErrFailureDomains      = errors.New("not enough failure domains to place shards, at most parity shards per domain")
+	ErrNodesFull           = errors.New("not enough dataServer below the full watermark")
 	ErrGetAllNode          = errors.New("get all ds nodes error")
 	ErrForbidSetCubeNum    = errors.New("nodes already exist in the ring, modify cube number is not allowed")
 	ErrCubeNumLessThanZero = errors.New("num must be more than 0, suggest more than 32")
@@ -46,13 +73,49 @@ var (
 	ErrRecoverPut             = errors.New("recoverable put error")
 	ErrRecoverPutExceedSize   = errors.New("recoverable put exceed size")
 	ErrRecoverPutHashMismatch = errors.New("recoverable put done but hash mismatch")
+	ErrRecoverPutReplica      = errors.New("replicated object can not be uploaded by recoverable put")
+	ErrNoReplicaAvailable     = errors.New("no replica of the object is readable")
 	ErrPutObjectMeta          = errors.New("put object meta error")
+	ErrVersionConflict        = errors.New("object version conflict, retries exhausted")
 	ErrWriteToAggObject       = errors.New("write request body to aggregate object file error")
+	ErrResponseAborted        = errors.New("read object failed after response header sent, connection aborted")
 
 	// 断点续传相关的错误码定义
 	ErrOnlySeekCurrent = errors.New("whence only support SeekCurrent")
 	ErrOnlyForwardSeek = errors.New("only support forward seek")
 
+	// 分片上传相关的错误码定义
+	ErrUploadNotFound     = errors.New("multipart upload not found or already finished")
+	ErrInvalidPartNumber  = errors.New("invalid part number")
+	ErrInvalidPart        = errors.New("part not uploaded or hash mismatch")
+	ErrInvalidPartOrder   = errors.New("part list is not in ascending order")
+	ErrPartTooSmall       = errors.New("part is smaller than the minimum allowed size")
+	ErrUploadHashMismatch = errors.New("completed object hash mismatch")
+	ErrPartHashMismatch   = errors.New("part data hash mismatch")
+	ErrUploadComplete     = errors.New("complete multipart upload error")
+
+	// 数据迁移相关的错误码定义
+	ErrRebalanceConflict  = errors.New("rebalance job was modified concurrently, retries exhausted")
+	ErrShardTargetOffline = errors.New("target dataServer of shard is offline")
+	ErrShardNotMigrated   = errors.New("shard was not committed on target dataServer")
+	ErrStartRebalance     = errors.New("start rebalance job error")
+	ErrMigrateObject      = errors.New("migrate object error")
+	ErrDrainNode          = errors.New("drain ds node error")
+	ErrSetNodeWeight      = errors.New("set ds node weight by capacity error")
+	ErrSetNodeFull        = errors.New("set ds node full error")
+
+	// 对象修复相关的错误码定义
+	ErrRepairLeaseLost = errors.New("repair lease was taken over by another apiServer, discard repaired data")
+	ErrLoadScrubMarker = errors.New("load scrub checkpoint error")
+	ErrSaveScrubMarker = errors.New("save scrub checkpoint error")
+	ErrEnqueueRepair   = errors.New("enqueue corrupted shard to repair collection error")
+	ErrNoLostShard     = errors.New("no lost shard can be rebuilt on online dataServer")
+	ErrLostShardRemain = errors.New("lost shards remain after repair")
+
+	// 聚合对象整理相关的错误码定义
+	ErrCompactShardHash = errors.New("compacted shard hash mismatch, aggregate object not compacted")
+	ErrCompactAggregate = errors.New("compact aggregate object error")
+
 	// JWT相关的错误码定义
 	ErrNewToken   = errors.New("generate jwt token error")
 	ErrParseToken = errors.New("parse jwt token error")
@@ -13,6 +13,12 @@ var ListenIp = flag.String("listen_ip", utils.GetLocalIp(), "apiServer's listen
 // apiServer程序监听的port
 var ListenPort = flag.Int("listen_port", config.GConfig.ApiServerPort, "apiServer's listen port")
 
+// apiServer程序S3兼容接口监听的port（为0则不开启）
+var S3ListenPort = flag.Int("s3_listen_port", config.GConfig.S3ServerPort, "apiServer's S3 compatible listen port")
+
+// 元数据存储后端为bolt时，是否由本apiServer打开数据库文件并提供元数据服务（只能有一个apiServer设置）
+var BoltOwner = flag.Bool("bolt_owner", false, "apiServer opens the bolt meta db and serves other processes")
+
 // 初始化，解析命令行参数
 func init() {
 	flag.Parse()
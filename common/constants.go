@@ -5,4 +5,5 @@ const (
 	KB = 1024
 	MB = 1024 * KB
 	GB = 1024 * MB
+	TB = 1024 * GB
 )
@@ -4,6 +4,7 @@ import (
 	"config"
 	"flag"
 	"os"
+	"strings"
 	"utils"
 )
 
@@ -16,8 +17,37 @@ var ListenPort = flag.Int("listen_port", config.GConfig.DataServerPort, "dataSer
 // 数据节点的存储空间权重（默认是1）
 var Weight = flag.Int("weight", config.GConfig.DataServerWeight, "dataServer's weight")
 
-// 数据节点的数据根目录
-var StorageRoot = flag.String("storage_root", os.Getenv("DOSS_STORAGE_ROOT"), "dataServer's storage root path")
+// 数据节点所在的可用区（故障域标签，默认为空）
+var Zone = flag.String("zone", "", "dataServer's zone label")
+
+// 数据节点所在的机架（故障域标签，可用区内唯一，默认为空）
+var Rack = flag.String("rack", "", "dataServer's rack label")
+
+// 数据节点的数据根目录（多块磁盘时以逗号分隔，每块磁盘一个根目录）
+var StorageRoot = flag.String("storage_root", os.Getenv("DOSS_STORAGE_ROOT"),
+	"dataServer's storage root paths, separated by comma (one root per disk)")
+
+// 获取数据节点的所有数据根目录（去除空白和重复的目录）
+func StorageRoots() (roots []string) {
+	var root string
+
+	for _, root = range strings.Split(*StorageRoot, ",") {
+		if root = strings.TrimSpace(root); root != "" && !utils.SliceHasMember(roots, root) {
+			roots = append(roots, root)
+		}
+	}
+	return
+}
+
+// 命令行参数是否被显式指定
+func IsSet(name string) (set bool) {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return
+}
 
 // 初始化，解析命令行参数
 func init() {
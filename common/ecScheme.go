@@ -0,0 +1,106 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 纠删码方案的分片总数上限（reedsolomon库的限制）
+const MaxECShards = 256
+
+// 数据存储模式
+const (
+	StorageModeEC      = "ec"      // 纠删码：对象编码为DataShards个数据分片和ParityShards个修复分片
+	StorageModeReplica = "replica" // 多副本：每个分片都是对象的完整副本（用于小对象）
+)
+
+// -------------------------------------------
+// 纠删码方案：DataShards个数据分片 + ParityShards个修复分片（字符串形式为"k+m"，如"4+2"、"10+4"）
+// NOTE: 1) 方案随对象元数据一起保存，读取、修复、迁移对象时均使用对象自身的方案，
+//          因此修改配置文件中的默认方案后，已有对象仍可按原方案读取；
+//       2) 多副本模式的N个副本表示为1个数据分片 + N-1个修复分片（字符串形式为"Nx"，如"3x"），
+//          分片定位、故障域约束（每个故障域上的副本数不超过N-1）与纠删码一致
+// -------------------------------------------
+type ECScheme struct {
+	DataShards   int    `bson:"data_shards" json:"dataShards"`
+	ParityShards int    `bson:"parity_shards" json:"parityShards"`
+	Mode         string `bson:"mode" json:"mode"` // 存储模式（为空表示纠删码）
+}
+
+// 生成n个副本的多副本方案
+func NewReplicaScheme(n int) ECScheme {
+	return ECScheme{DataShards: 1, ParityShards: n - 1, Mode: StorageModeReplica}
+}
+
+// 解析"k+m"形式的纠删码方案或"Nx"形式的多副本方案
+func ParseECScheme(s string) (ec ECScheme, err error) {
+	var (
+		parts    []string
+		replicas int
+	)
+
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "x") {
+		if replicas, err = strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(s, "x"))); err != nil {
+			err = ErrInvalidECScheme
+			return
+		}
+		if ec = NewReplicaScheme(replicas); !ec.Valid() {
+			err = ErrInvalidECScheme
+		}
+		return
+	}
+	if parts = strings.Split(s, "+"); len(parts) != 2 {
+		err = ErrInvalidECScheme
+		return
+	}
+	ec.Mode = StorageModeEC
+	if ec.DataShards, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+		err = ErrInvalidECScheme
+		return
+	}
+	if ec.ParityShards, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+		err = ErrInvalidECScheme
+		return
+	}
+	if !ec.Valid() {
+		err = ErrInvalidECScheme
+	}
+	return
+}
+
+// 分片总数（多副本模式为副本数）
+func (ec ECScheme) AllShards() int {
+	return ec.DataShards + ec.ParityShards
+}
+
+// 每个分片的大小（对象大小按数据分片数向上取整均分，多副本模式为对象大小）
+func (ec ECScheme) ShardSize(size int64) int64 {
+	return (size + int64(ec.DataShards) - 1) / int64(ec.DataShards)
+}
+
+// 是否为多副本模式
+func (ec ECScheme) IsReplica() bool {
+	return ec.Mode == StorageModeReplica
+}
+
+// 是否为空方案（旧版本写入的元数据中没有保存纠删码方案）
+func (ec ECScheme) IsZero() bool {
+	return ec.DataShards == 0 && ec.ParityShards == 0
+}
+
+// 是否为合法的方案：k >= 1, m >= 1, k + m <= MaxECShards（多副本模式k为1）
+func (ec ECScheme) Valid() bool {
+	if ec.IsReplica() && ec.DataShards != 1 {
+		return false
+	}
+	return ec.DataShards >= 1 && ec.ParityShards >= 1 && ec.AllShards() <= MaxECShards
+}
+
+func (ec ECScheme) String() string {
+	if ec.IsReplica() {
+		return fmt.Sprintf("%dx", ec.AllShards())
+	}
+	return fmt.Sprintf("%d+%d", ec.DataShards, ec.ParityShards)
+}
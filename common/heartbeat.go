@@ -0,0 +1,82 @@
+package common
+
+import "math"
+
+// -------------------------------------------
+// 心跳消息的版本：
+//   0) 只有监听地址字符串（旧版本dataServer），或者只包含监听地址和容量的JSON对象；
+//   1) 包含节点id、容量、分片数量、磁盘健康状态、构建版本和运行时长的JSON对象
+// NOTE: apiServer兼容所有版本的心跳消息，高版本中新增的字段由低版本的apiServer忽略
+// -------------------------------------------
+const HeartbeatVersion = 1
+
+// 程序的构建版本（编译时通过 -ldflags "-X common.BuildVersion=<版本>" 指定）
+var BuildVersion = "dev"
+
+// -------------------------------------------
+// 数据节点的心跳消息：
+// NodeId：数据节点表中该节点的ObjectId；Addr：数据节点的监听地址（ip:port）；
+// Total、Free：在线磁盘的总容量和可用容量（字节）；Shards、Aggregates：节点上的分片数和聚合对象数；
+// Disks：各磁盘的健康状态；Build：dataServer的构建版本；Uptime：dataServer的运行时长（秒）
+// -------------------------------------------
+type Heartbeat struct {
+	Version    int          `json:"version"`
+	NodeId     string       `json:"nodeId"`
+	Addr       string       `json:"addr"`
+	Total      uint64       `json:"total"`
+	Free       uint64       `json:"free"`
+	Shards     int          `json:"shards"`
+	Aggregates int          `json:"aggregates"`
+	Disks      []DiskHealth `json:"disks"`
+	Build      string       `json:"build"`
+	Uptime     int64        `json:"uptime"`
+}
+
+// 心跳消息中磁盘的健康状态（Error为磁盘离线的原因）
+type DiskHealth struct {
+	Root   string `json:"root"`
+	Online bool   `json:"online"`
+	Total  uint64 `json:"total"`
+	Free   uint64 `json:"free"`
+	Error  string `json:"error,omitempty"`
+}
+
+// 按照容量计算数据节点在哈希环上的权重：每TB容量为1，至少为1
+func CapacityWeight(total uint64) int {
+	return int(math.Max(1, math.Round(float64(total)/float64(TB))))
+}
+
+// 容量对应的权重（未取整）偏离当前权重超过0.5加上当前权重的该比例时，才按照容量调整权重
+const WeightChangeRatio = 0.1
+
+// -------------------------------------------
+// 按照容量判断是否需要调整数据节点的权重（weight为当前权重）
+// NOTE: 权重变化会改变哈希环并迁移分片，故只在容量变化明显时调整：容量在取整的边界附近波动、
+//       少量空间的增减不会使权重来回变化；当前权重不合法（不大于0）时总是调整
+// -------------------------------------------
+func CapacityWeightChanged(weight int, total uint64) bool {
+	var exact = math.Max(1, float64(total)/float64(TB))
+
+	if weight <= 0 {
+		return true
+	}
+	return CapacityWeight(total) != weight && math.Abs(exact-float64(weight)) > 0.5+WeightChangeRatio*float64(weight)
+}
+
+// 心跳中的磁盘是否都在线（有磁盘离线时总容量不完整，不据此调整权重）
+func (hb *Heartbeat) AllDisksOnline() bool {
+	for _, d := range hb.Disks {
+		if !d.Online {
+			return false
+		}
+	}
+	return true
+}
+
+// 数据节点的磁盘使用率（总容量为0时返回0）
+func (hb *Heartbeat) Usage() float64 {
+	if hb.Total == 0 {
+		return 0
+	}
+	return float64(hb.Total-hb.Free) / float64(hb.Total)
+}
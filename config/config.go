@@ -12,30 +12,61 @@ import (
 
 // 程序全局配置
 type Config struct {
-	ApiServerPort       int           `json:"apiServerPort"`
-	DataServerPort      int           `json:"dataServerPort"`
-	HeartbeatInterval   time.Duration `json:"heartbeatInterval"`
-	HeartbeatOverTime   time.Duration `json:"heartbeatOverTime"`
-	DataServerWeight    int           `json:"dataServerWeight"`
-	DefaultVirtualCubes int           `json:"defaultVirtualCubes"`
-	AggregateObjSize    int64         `json:"aggregateObjSize"`
-	DataShards          int           `json:"dataShards"`
-	ParityShards        int           `json:"parityShards"`
-	AllShards           int
-	BlockSize           int
-	BlockPerShard       int           `json:"blockPerShard"`
-	RabbitMQUrl         string        `json:"rabbitMQUrl"`
-	ExchangeType        string        `json:"exchangeType"`
-	HeartbeatExchange   string        `json:"heartbeatExchange"`
-	MongodbUrl          string        `json:"mongodbUrl"`
-	MongoConnectTimeout time.Duration `json:"mongodbConnectTimeout"`
-	DatabaseName        string        `json:"databaseName"`
-	ObjectColName       string        `json:"objectColName"`
-	AggregateObjColName string        `json:"aggregateObjColName"`
-	ObjShardColName     string        `json:"objShardColName"`
-	RepairObjColName    string        `json:"repairObjColName"`
-	NodeColName         string        `json:"nodeColName"`
-	JwtSecretKey        string        `json:"jwtJwtSecretKey"`
+	ApiServerPort         int           `json:"apiServerPort"`
+	S3ServerPort          int           `json:"s3ServerPort"`
+	DataServerPort        int           `json:"dataServerPort"`
+	HeartbeatInterval     time.Duration `json:"heartbeatInterval"`
+	HeartbeatOverTime     time.Duration `json:"heartbeatOverTime"`
+	HeartbeatTransport    string        `json:"heartbeatTransport"`
+	HeartbeatApiServers   []string      `json:"heartbeatApiServers"`
+	DataServerWeight      int           `json:"dataServerWeight"`
+	NodeFullWatermark     float64       `json:"nodeFullWatermark"`
+	FailureDomain         string        `json:"failureDomain"`
+	DefaultVirtualCubes   int           `json:"defaultVirtualCubes"`
+	AggregateObjSize      int64         `json:"aggregateObjSize"`
+	AggregateCompactRatio float64       `json:"aggregateCompactRatio"`
+	DataShards            int           `json:"dataShards"`
+	ParityShards          int           `json:"parityShards"`
+	AllShards             int
+	BlockSize             int
+	LegacyScheme          common.ECScheme
+	DefaultScheme         common.ECScheme
+	ReplicaScheme         common.ECScheme
+	BlockPerShard         int           `json:"blockPerShard"`
+	DefaultEC             string        `json:"defaultEC"`
+	ReplicaThreshold      int64         `json:"replicaThreshold"`
+	ReplicaCount          int           `json:"replicaCount"`
+	InlineThreshold       int64         `json:"inlineThreshold"`
+	RabbitMQUrl           string        `json:"rabbitMQUrl"`
+	ExchangeType          string        `json:"exchangeType"`
+	HeartbeatExchange     string        `json:"heartbeatExchange"`
+	MetaBackend           string        `json:"metaBackend"`
+	BoltPath              string        `json:"boltPath"`
+	BoltServer            string        `json:"boltServer"`
+	MongodbUrl            string        `json:"mongodbUrl"`
+	MongoConnectTimeout   time.Duration `json:"mongodbConnectTimeout"`
+	MongoOpTimeout        time.Duration `json:"mongodbOpTimeout"`
+	MongoPoolSize         uint16        `json:"mongodbPoolSize"`
+	DatabaseName          string        `json:"databaseName"`
+	ObjectColName         string        `json:"objectColName"`
+	BucketColName         string        `json:"bucketColName"`
+	UploadColName         string        `json:"uploadColName"`
+	UploadPartColName     string        `json:"uploadPartColName"`
+	AggregateObjColName   string        `json:"aggregateObjColName"`
+	ObjShardColName       string        `json:"objShardColName"`
+	RepairObjColName      string        `json:"repairObjColName"`
+	NodeColName           string        `json:"nodeColName"`
+	RebalanceColName      string        `json:"rebalanceColName"`
+	RebalanceBandwidth    int64         `json:"rebalanceBandwidth"`
+	RebalanceBatchSize    int           `json:"rebalanceBatchSize"`
+	RebalanceLockExpire   time.Duration `json:"rebalanceLockExpire"`
+	RepairLockExpire      time.Duration `json:"repairLockExpire"`
+	RepairWorkers         int           `json:"repairWorkers"`
+	RepairBandwidth       int64         `json:"repairBandwidth"`
+	LostShardScanInterval time.Duration `json:"lostShardScanInterval"`
+	ScrubInterval         time.Duration `json:"scrubInterval"`
+	ScrubBandwidth        int64         `json:"scrubBandwidth"`
+	JwtSecretKey          string        `json:"jwtJwtSecretKey"`
 }
 
 var (
@@ -68,6 +99,24 @@ func InitConfig(file string) (err error) {
 	conf.AllShards = conf.DataShards + conf.ParityShards
 	conf.BlockSize = conf.BlockPerShard * conf.DataShards
 
+	// dataShards、parityShards为未保存纠删码方案的旧对象所使用的方案；新写入的对象默认使用defaultEC（为空则与旧方案一致）
+	conf.LegacyScheme = common.ECScheme{
+		DataShards: conf.DataShards, ParityShards: conf.ParityShards, Mode: common.StorageModeEC,
+	}
+	conf.DefaultScheme = conf.LegacyScheme
+	if conf.DefaultEC != "" {
+		if conf.DefaultScheme, err = common.ParseECScheme(conf.DefaultEC); err != nil {
+			return
+		}
+	}
+
+	// 不大于replicaThreshold的对象使用replicaCount个副本存储
+	conf.ReplicaScheme = common.NewReplicaScheme(conf.ReplicaCount)
+	if conf.ReplicaThreshold > 0 && !conf.ReplicaScheme.Valid() {
+		err = common.ErrInvalidECScheme
+		return
+	}
+
 	GConfig = &conf
 	return
 }
@@ -16,7 +16,9 @@ func SystemDataCheck() {
 	cronExpr = "0 0 4 * * ?"
 	_ = Cron.AddFunc(cronExpr, func() {
 		MetadataCheck()
+		MultipartCheck()
 		ObjectsCheck()
+		AggregatesCompact()
 	})
 	Cron.Start()
 
@@ -0,0 +1,326 @@
+package check
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"common"
+	"config"
+	"dataServer/disk"
+	"dataServer/locate"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"meta"
+	"meta/funcParams"
+	"utils"
+)
+
+// 整理完成后，原聚合对象移入回收站前的等待时间（等待已获取到旧分片元数据的读取请求完成）
+const compactRetireDelay = time.Minute
+
+// 整理的目标聚合对象：新生成的聚合对象，写入期间不加入内存中的locate信息，不会被分配给新的上传
+type compactTarget struct {
+	name string
+	root string
+	file *os.File
+	size int64
+}
+
+// -------------------------------------------
+// 聚合对象整理：小对象被删除后，聚合对象中的数据只有在引用数为0时才会被回收，
+// 已写满的聚合对象中仍被引用的数据占比低于aggregateCompactRatio时，将仍被引用的分片拷贝至新的聚合对象，
+// 逐个更新分片元数据中的聚合对象信息，之后回收原聚合对象
+// NOTE:
+//   1) 只整理本节点上已写满的聚合对象（未写满的聚合对象仍会被分配给新的上传），
+//      数据库中的size与内存中的size不一致（有正在进行的上传）或者有分片待修复时，本次不整理；
+//   2) 拷贝时校验分片hash值，不一致则放弃整理该聚合对象（由巡检或者读取时发现并修复）；
+//   3) 分片元数据通过比较并交换更新，分片在拷贝期间被删除、修复或者迁移时放弃该分片；
+//   4) 原聚合对象等待compactRetireDelay后，再次确认不再被任何分片引用，才删除其元数据并移入回收站
+// -------------------------------------------
+func AggregatesCompact() {
+	var (
+		DMongoAgg    meta.Store
+		DMongoShard  meta.Store
+		DMongoRepair meta.Store
+		name         string
+		shards       []*meta.ObjectShardMeta
+		target       *compactTarget
+		compacted    []string
+		ok           bool
+		err          error
+	)
+
+	if config.GConfig.AggregateCompactRatio <= 0 {
+		return
+	}
+	if DMongoAgg, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	if DMongoShard, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.ObjShardColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	if DMongoRepair, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RepairObjColName)); err != nil {
+		log.Println(err)
+		return
+	}
+
+	// 将待整理聚合对象中仍被引用的分片依次拷贝至目标聚合对象（目标聚合对象写满后再生成新的目标聚合对象）
+	for _, name = range locate.GetSealedAggregates() {
+		if shards, ok = compactCandidate(DMongoAgg, DMongoShard, DMongoRepair, name); !ok {
+			continue
+		}
+		if target, err = compactAggregate(DMongoAgg, DMongoShard, name, shards, target); err != nil {
+			log.Println(common.ErrCompactAggregate, name, err)
+			continue
+		}
+		compacted = append(compacted, name)
+	}
+	target.seal(DMongoAgg)
+	if len(compacted) == 0 {
+		return
+	}
+
+	// 回收原聚合对象
+	time.Sleep(compactRetireDelay)
+	for _, name = range compacted {
+		retireAggregate(DMongoAgg, DMongoShard, name)
+	}
+}
+
+// 获取仍引用聚合对象的分片元数据以及这些分片在该聚合对象上的数据总量
+func referencedShards(DMongoShard meta.Store, aggMeta *meta.AggregateMeta) (
+	shards []*meta.ObjectShardMeta, refSize int64, err error) {
+
+	var (
+		visited    = make(map[string]bool)
+		refShard   string
+		objectName string
+		shardIndex int
+		shardMeta  *meta.ObjectShardMeta
+		aggObject  *meta.AggObject
+		referenced bool
+	)
+
+	for _, refShard = range aggMeta.RefBy {
+		if visited[refShard] || len(strings.Split(refShard, ".")) < 2 {
+			continue
+		}
+		visited[refShard] = true
+		objectName = strings.Split(refShard, ".")[0]
+		shardIndex, _ = strconv.Atoi(strings.Split(refShard, ".")[1])
+		if shardMeta, err = DMongoShard.GetShardMetaByIndex(objectName, shardIndex); err != nil {
+			return
+		}
+		if shardMeta.Hash == "" {
+			continue
+		}
+
+		// 分片已迁移至其他聚合对象时不再引用该聚合对象
+		referenced = false
+		for _, aggObject = range shardMeta.Aggregate {
+			if aggObject.Name == aggMeta.Name {
+				refSize += aggObject.Size
+				referenced = true
+			}
+		}
+		if referenced {
+			shards = append(shards, shardMeta)
+		}
+	}
+	return
+}
+
+// 判断聚合对象是否需要整理，需要整理时返回仍引用该聚合对象的分片元数据
+func compactCandidate(DMongoAgg, DMongoShard, DMongoRepair meta.Store, name string) (
+	shards []*meta.ObjectShardMeta, ok bool) {
+
+	var (
+		aggMeta    *meta.AggregateMeta
+		shardMeta  *meta.ObjectShardMeta
+		repairMeta *meta.RepairShard
+		refSize    int64
+		err        error
+	)
+
+	if aggMeta, err = DMongoAgg.GetAggregateMeta(name); err != nil || aggMeta.Name == "" || aggMeta.Size == 0 {
+		return
+	}
+	if aggMeta.Size != locate.GetAggObjSize(name) {
+		return
+	}
+	if shards, refSize, err = referencedShards(DMongoShard, aggMeta); err != nil {
+		log.Println(common.ErrGetShardMetaByHash, err)
+		return
+	}
+	if float64(refSize) >= float64(aggMeta.Size)*config.GConfig.AggregateCompactRatio {
+		return
+	}
+
+	// 有分片待修复时不整理（修复完成后的提交会按照修复前的聚合对象信息覆盖分片元数据）
+	for _, shardMeta = range shards {
+		repairMeta, err = DMongoRepair.GetRepairShardMeta(shardMeta.Hash)
+		if err != nil || repairMeta.ShardHash != "" {
+			return
+		}
+	}
+	ok = true
+	return
+}
+
+// 将聚合对象中仍被引用的分片拷贝至目标聚合对象并更新分片元数据，返回当前的目标聚合对象
+func compactAggregate(DMongoAgg, DMongoShard meta.Store, name string, shards []*meta.ObjectShardMeta,
+	target *compactTarget) (*compactTarget, error) {
+
+	var (
+		shardMeta *meta.ObjectShardMeta
+		newAggs   []*meta.AggObject
+		aggObject *meta.AggObject
+		offset    int64
+		swapped   bool
+		err       error
+	)
+
+	for _, shardMeta = range shards {
+		if target == nil || target.size+shardMeta.Size > config.GConfig.AggregateObjSize*common.MB {
+			target.seal(DMongoAgg)
+			if target, err = newCompactTarget(DMongoAgg); err != nil {
+				return nil, err
+			}
+		}
+
+		// 拷贝分片数据并校验hash值，失败时丢弃已写入目标聚合对象的数据
+		offset = target.size
+		if err = target.copyShard(shardMeta); err != nil {
+			_ = target.file.Truncate(offset)
+			return target, err
+		}
+
+		// 更新分片元数据：分片在此期间已被修改时丢弃拷贝的数据
+		newAggs = []*meta.AggObject{{Name: target.name, Offset: offset, Size: shardMeta.Size}}
+		swapped, err = DMongoShard.SwapShardAggregate(shardMeta.Object, shardMeta.Index, shardMeta.Hash,
+			shardMeta.Aggregate, newAggs)
+		if err != nil {
+			target.size += shardMeta.Size
+			return target, err
+		}
+		if !swapped {
+			_ = target.file.Truncate(offset)
+			continue
+		}
+		target.size += shardMeta.Size
+		err = DMongoAgg.UpdateAggregateMeta(target.name, target.size, 1,
+			shardMeta.Object+"."+strconv.Itoa(shardMeta.Index))
+		if err != nil {
+			log.Println(common.ErrUpdateAggMeta, err)
+		}
+
+		// 分片跨越的其他聚合对象引用数减1（未被引用的聚合对象由检查任务清除）
+		for _, aggObject = range shardMeta.Aggregate {
+			if aggObject.Name != name {
+				_ = DMongoAgg.UpdateAggregateMeta(aggObject.Name, -1, -1, "")
+			}
+		}
+	}
+	return target, nil
+}
+
+// 生成新的目标聚合对象
+func newCompactTarget(DMongoAgg meta.Store) (target *compactTarget, err error) {
+	var (
+		objectId primitive.ObjectID
+		root     string
+		file     *os.File
+	)
+
+	if root, err = disk.Choose(config.GConfig.AggregateObjSize * common.MB); err != nil {
+		return
+	}
+	if objectId, err = DMongoAgg.NewAggregateMeta(); err != nil {
+		return
+	}
+	file, err = os.OpenFile(root+"/aggregate_objects/"+objectId.Hex(), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		disk.ReportError(root+"/aggregate_objects/"+objectId.Hex(), err)
+		_, _ = DMongoAgg.DeleteAggregateMeta(objectId.Hex())
+		return
+	}
+	target = &compactTarget{name: objectId.Hex(), root: root, file: file}
+	return
+}
+
+// 将分片各段数据拷贝至目标聚合对象的末尾，并校验分片hash值
+func (target *compactTarget) copyShard(shardMeta *meta.ObjectShardMeta) (err error) {
+	var (
+		HashCalc  hash.Hash = sha256.New()
+		aggObject *meta.AggObject
+		written   int64
+		HashSum   string
+	)
+
+	if _, err = target.file.Seek(target.size, io.SeekStart); err != nil {
+		return
+	}
+	for _, aggObject = range shardMeta.Aggregate {
+		written, err = utils.SeekCopy(locate.AggObjectPath(aggObject.Name),
+			io.MultiWriter(target.file, HashCalc), aggObject.Offset, aggObject.Size)
+		if err != nil {
+			return
+		}
+		if written != aggObject.Size {
+			return common.ErrSizeMismatch
+		}
+	}
+	HashSum = url.PathEscape(base64.StdEncoding.EncodeToString(HashCalc.Sum(nil)))
+	if HashSum != shardMeta.Hash {
+		return common.ErrCompactShardHash
+	}
+	return target.file.Sync()
+}
+
+// 目标聚合对象写入完成：加入内存中的locate信息（未写满时可被分配给新的上传），没有写入数据时删除
+func (target *compactTarget) seal(DMongoAgg meta.Store) {
+	if target == nil {
+		return
+	}
+	_ = target.file.Close()
+	if target.size == 0 {
+		_, _ = DMongoAgg.DeleteAggregateMeta(target.name)
+		_ = os.Remove(target.root + "/aggregate_objects/" + target.name)
+		return
+	}
+	locate.AggObjectAdd(target.name, target.root, target.size)
+}
+
+// 回收整理完成的聚合对象：确认不再被任何分片引用后删除其元数据，并移入回收站
+func retireAggregate(DMongoAgg, DMongoShard meta.Store, name string) {
+	var (
+		aggMeta *meta.AggregateMeta
+		shards  []*meta.ObjectShardMeta
+		path    string
+		err     error
+	)
+
+	if aggMeta, err = DMongoAgg.GetAggregateMeta(name); err != nil || aggMeta.Name == "" {
+		return
+	}
+	if shards, _, err = referencedShards(DMongoShard, aggMeta); err != nil || len(shards) > 0 {
+		return
+	}
+	if _, err = DMongoAgg.DeleteAggregateMeta(name); err != nil {
+		log.Println(common.ErrCompactAggregate, name, err)
+		return
+	}
+	path = locate.AggObjectPath(name)
+	locate.AggObjectDelete(name)
+	_ = os.Rename(path, disk.GarbagePath(path))
+	log.Println("aggregate object compacted:", name)
+}
@@ -9,26 +9,29 @@ import (
 const RemainVersionCount = 5
 
 // 检查元数据：将早期的版本删除，类似队列结构，先入先出
+// NOTE: 内联存储的对象数据保存在元数据中，随早期版本的元数据一起删除
 func MetadataCheck() {
 	var (
-		DMongo      *meta.DossMongo
+		DMongo      meta.Store
 		repairMetas []*meta.ObjectMeta
 		repairMeta  *meta.ObjectMeta
 		objMetas    []*meta.ObjectMeta
 		i           int
 		err         error
 	)
-	DMongo = meta.NewDossMongo()
+	if DMongo, err = meta.NewStore(); err != nil {
+		return
+	}
 	repairMetas, err = DMongo.GetALLTooMuchVersionMeta(RemainVersionCount)
 	if err != nil {
 		return
 	}
 	for _, repairMeta = range repairMetas {
-		if objMetas, err = DMongo.GetAllVersionMetas(repairMeta.Name); err != nil {
+		if objMetas, err = DMongo.GetAllVersionMetas(repairMeta.Bucket, repairMeta.Name); err != nil {
 			continue
 		}
 		for i = 1; i <= len(objMetas)-RemainVersionCount; i++ {
-			_, _ = DMongo.DeleteObjectMeta(objMetas[i].Name, funcParams.MetaParamVersion(i))
+			_, _ = DMongo.DeleteObjectMeta(objMetas[i].Bucket, objMetas[i].Name, funcParams.MetaParamVersion(i))
 		}
 	}
 }
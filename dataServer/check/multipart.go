@@ -0,0 +1,146 @@
+package check
+
+import (
+	"log"
+	"path/filepath"
+	"time"
+
+	"config"
+	"dataServer/disk"
+	"dataServer/locate"
+	"meta"
+	"meta/funcParams"
+	"utils"
+)
+
+// 分片上传的有效期：超过此时间仍未完成的上传将被取消（单位：秒）
+const MultipartUploadExpire = 7 * 24 * 60 * 60
+
+// 已结束的分片上传元数据的保留时间：保证每个数据节点的检查任务都清除过该上传的part数据后再删除元数据（单位：秒）
+const MultipartMetaRetain = 2 * 24 * 60 * 60
+
+// -------------------------------------------
+// 清除分片上传的part数据：
+// 1) 将超期未完成的上传置为aborted；
+// 2) 对于已结束（完成或取消）的上传，将本节点上不再被引用的part数据移到回收站；
+// 3) 删除结束时间超过MultipartMetaRetain的上传元数据
+// NOTE: part数据不再被引用是指：没有对象元数据使用该hash值，且没有未结束的上传中的part使用该hash值
+// -------------------------------------------
+func MultipartCheck() {
+	var (
+		DMongo  meta.Store
+		uploads []*meta.UploadMeta
+		upload  *meta.UploadMeta
+		parts   []*meta.UploadPartMeta
+		part    *meta.UploadPartMeta
+		now     = time.Now()
+		err     error
+	)
+
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.UploadColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	if uploads, err = DMongo.GetExpiredUploads(now.Add(-MultipartUploadExpire * time.Second)); err != nil {
+		log.Println(err)
+		return
+	}
+	for _, upload = range uploads {
+		_, _ = DMongo.FinishUpload(upload.UploadId, meta.UploadStateAborted)
+	}
+
+	if uploads, err = DMongo.GetFinishedUploads(); err != nil {
+		log.Println(err)
+		return
+	}
+	for _, upload = range uploads {
+		if parts, err = DMongo.GetUploadParts(upload.UploadId); err != nil {
+			continue
+		}
+		for _, part = range parts {
+			if !isPartReferenced(DMongo, part.Hash) {
+				removePartData(part.Hash)
+			}
+		}
+		if now.Sub(upload.Finished) > MultipartMetaRetain*time.Second {
+			_ = DMongo.DeleteUpload(upload.UploadId)
+		}
+	}
+}
+
+// 判断part数据是否仍被对象元数据或者未结束的上传引用
+// NOTE: 内联存储的对象数据保存在元数据中，不引用数据节点上的part数据
+func isPartReferenced(DMongo meta.Store, hash string) bool {
+	var (
+		DMongo2 meta.Store
+		objMeta *meta.ObjectMeta
+		parts   []*meta.UploadPartMeta
+		part    *meta.UploadPartMeta
+		upload  *meta.UploadMeta
+		err     error
+	)
+
+	if DMongo2, err = meta.NewStore(); err != nil {
+		return true
+	}
+	if objMeta, err = DMongo2.GetMetaByHash(hash); err != nil || (objMeta != nil && !objMeta.Inline) {
+		return true
+	}
+	if parts, err = DMongo.GetUploadPartsByHash(hash); err != nil {
+		return true
+	}
+	for _, part = range parts {
+		if upload, err = DMongo.GetUpload(part.UploadId); err != nil {
+			return true
+		}
+		if upload != nil && upload.Unfinished() {
+			return true
+		}
+	}
+	return false
+}
+
+// 将本节点上part的分片数据移到回收站：
+// 1) 大文件：将/objects目录下的分片文件移到/garbage目录，并删除其按块校验和文件；
+// 2) 小文件：将分片所引用的本节点上的聚合对象引用数减1，并删除分片元数据（未被引用的聚合对象由ObjectsCheck清除）
+func removePartData(hash string) {
+	var (
+		hashFiles   []string
+		hashFile    string
+		DMongo      meta.Store
+		DMongo2     meta.Store
+		shardMetas  []*meta.ObjectShardMeta
+		shardMeta   *meta.ObjectShardMeta
+		aggObject   *meta.AggObject
+		aggObjNames []string
+		err         error
+	)
+
+	hashFiles = locate.ObjectFiles(hash)
+	for _, hashFile = range hashFiles {
+		locate.ObjectDelete(hash)
+		disk.MoveShardToGarbage(hashFile)
+	}
+
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.ObjShardColName)); err != nil {
+		return
+	}
+	if DMongo2, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName)); err != nil {
+		return
+	}
+	if shardMetas, err = DMongo.GetShardMetasByObject(hash); err != nil {
+		return
+	}
+	hashFiles = globDisks("aggregate_objects")
+	for _, hashFile = range hashFiles {
+		aggObjNames = append(aggObjNames, filepath.Base(hashFile))
+	}
+	for _, shardMeta = range shardMetas {
+		for _, aggObject = range shardMeta.Aggregate {
+			if utils.SliceHasMember(aggObjNames, aggObject.Name) {
+				_ = DMongo2.UpdateAggregateMeta(aggObject.Name, -1, -1, "")
+				_, _ = DMongo.DeleteShardMetaByIndex(shardMeta.Object, shardMeta.Index)
+			}
+		}
+	}
+}
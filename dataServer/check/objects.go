@@ -8,8 +8,8 @@ import (
 	"strings"
 	"time"
 
-	"common/dataFlag"
 	"config"
+	"dataServer/disk"
 	"dataServer/locate"
 	"meta"
 	"meta/funcParams"
@@ -19,12 +19,15 @@ import (
 // 对象在回收站中的持续时间：超过此时间，将被永久删除（单位：秒）
 const ObjectGarbageDuration = 10 * 24 * 60 * 60
 
+// 按块校验和文件对应的分片已不存在超过此时间后删除（校验和文件在分片文件重命名为正式文件之前写入）
+const checksumOrphanDuration = time.Hour
+
 func ObjectsCheck() {
 	var (
 		files        []string
 		hash         string
-		DMongo       *meta.DossMongo
-		DMongo2      *meta.DossMongo
+		DMongo       meta.Store
+		DMongo2      meta.Store
 		objMeta      *meta.ObjectMeta
 		shardMetas   []*meta.ObjectShardMeta
 		shardMeta    *meta.ObjectShardMeta
@@ -36,16 +39,16 @@ func ObjectsCheck() {
 		index        int
 		fileInfo     os.FileInfo
 		srcPath      string
-		dstPath      string
 		err          error
 	)
 
-	utils.CheckFilePath(*dataFlag.StorageRoot + "/garbage")
-
 	// 清除大文件：若最新版本的对象元数据hash值为空字符串，
-	// 则说明需要将该对象移除：将对象移到/garbage目录，在之后的定期扫描中清除时间较久的对象
-	DMongo = meta.NewDossMongo()
-	files, _ = filepath.Glob(*dataFlag.StorageRoot + "/objects/*")
+	// 则说明需要将该对象移除：将对象移到所在磁盘的/garbage目录，在之后的定期扫描中清除时间较久的对象
+	if DMongo, err = meta.NewStore(); err != nil {
+		log.Println(err)
+		return
+	}
+	files = globDisks("objects")
 	for index = range files {
 		hash = strings.Split(filepath.Base(files[index]), ".")[0]
 		if objMeta, err = DMongo.GetMetaByHash(hash); err != nil {
@@ -53,19 +56,24 @@ func ObjectsCheck() {
 			continue
 		}
 		if objMeta != nil && objMeta.Hash == "" {
-			hashFiles, _ = filepath.Glob(*dataFlag.StorageRoot + "/objects/" + hash + ".*")
-			if len(hashFiles) != 1 {
+			if hashFiles = locate.ObjectFiles(hash); len(hashFiles) != 1 {
 				return
 			}
 			locate.ObjectDelete(hash)
-			os.Rename(hashFiles[0], *dataFlag.StorageRoot+"/garbage/"+filepath.Base(hashFiles[0]))
+			disk.MoveShardToGarbage(hashFiles[0])
 		}
 	}
 
 	// 清除对象分片所在的聚合对象
-	files, _ = filepath.Glob(*dataFlag.StorageRoot + "/aggregate_objects/*")
-	DMongo = meta.NewDossMongo(funcParams.MongoParamCollection(config.GConfig.ObjShardColName))
-	DMongo2 = meta.NewDossMongo(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName))
+	files = globDisks("aggregate_objects")
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.ObjShardColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	if DMongo2, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName)); err != nil {
+		log.Println(err)
+		return
+	}
 	if shardMetas, err = DMongo.GetShardMetaByHash(""); err != nil {
 		log.Println(common.ErrGetShardMetaByHash, err)
 		return
@@ -85,14 +93,24 @@ func ObjectsCheck() {
 	// 将未被引用的聚合对象放入回收站
 	unRefAggObjs, _ = DMongo2.DeleteUnRefAggregates()
 	for _, unRefAggObj = range unRefAggObjs {
+		srcPath = locate.AggObjectPath(unRefAggObj)
 		locate.AggObjectDelete(unRefAggObj)
-		srcPath = *dataFlag.StorageRoot + "/aggregate_objects/" + unRefAggObj
-		dstPath = *dataFlag.StorageRoot + "/garbage/" + unRefAggObj
-		os.Rename(srcPath, dstPath)
+		os.Rename(srcPath, disk.GarbagePath(srcPath))
 	}
 
-	// 真正移除对象：将回收站中存在时间较久的对象删除
-	files, _ = filepath.Glob(*dataFlag.StorageRoot + "/garbage/*")
+	// 删除分片提交失败（或者分片移入回收站时未能删除）的按块校验和文件
+	files = globDisks("checksums")
+	for index = range files {
+		if _, err = os.Stat(filepath.Dir(filepath.Dir(files[index])) + "/objects/" + filepath.Base(files[index])); !os.IsNotExist(err) {
+			continue
+		}
+		if fileInfo, err = os.Stat(files[index]); err == nil && time.Since(fileInfo.ModTime()) > checksumOrphanDuration {
+			os.Remove(files[index])
+		}
+	}
+
+	// 真正移除对象：将各磁盘回收站中存在时间较久的对象删除
+	files = globDisks("garbage")
 	for index = range files {
 		if fileInfo, err = os.Stat(files[index]); err != nil {
 			continue
@@ -102,3 +120,17 @@ func ObjectsCheck() {
 		}
 	}
 }
+
+// 获取所有在线磁盘上某个数据目录下的文件
+func globDisks(dir string) (files []string) {
+	var (
+		root    string
+		matches []string
+	)
+
+	for _, root = range disk.Roots() {
+		matches, _ = filepath.Glob(root + "/" + dir + "/*")
+		files = append(files, matches...)
+	}
+	return
+}
@@ -8,26 +8,48 @@ import (
 
 	"common/dataFlag"
 	"dataServer/check"
+	"dataServer/disk"
 	"dataServer/heartbeat"
 	"dataServer/locate"
 	"dataServer/objects"
+	"dataServer/scrub"
 	"dataServer/temp"
 )
 
-// 将本机监听ip和端口注册到数据库中、设置线程数量
+// 初始化本机的磁盘，将本机监听ip和端口注册到数据库中、设置线程数量
+// NOTE: 未指定weight参数时，按照在线磁盘的总容量计算节点权重（之后由apiServer按照心跳中的容量调整）
 func init() {
-	heartbeat.RegisterNodeToDB(*dataFlag.ListenIp, *dataFlag.Weight)
+	var (
+		weight = *dataFlag.Weight
+		fixed  = dataFlag.IsSet("weight")
+	)
+
+	disk.Init(dataFlag.StorageRoots())
+	if !fixed {
+		weight = disk.CapacityWeight()
+	}
+	heartbeat.RegisterNodeToDB(*dataFlag.ListenIp, weight, fixed, *dataFlag.Zone, *dataFlag.Rack)
 	runtime.GOMAXPROCS(runtime.NumCPU())
 }
 
 func main() {
-	go locate.CollectObjects(*dataFlag.StorageRoot)
-	go locate.CollectAggObjects(*dataFlag.StorageRoot)
+	var root string
+
+	disk.SetOfflineHandler(locate.DiskOffline)
+	for _, root = range disk.Roots() {
+		go locate.CollectObjects(root)
+		go locate.CollectAggObjects(root)
+	}
+	go disk.StartMonitor()
 	go check.SystemDataCheck()
+	go scrub.StartScrub()
 	go heartbeat.StartHeartbeat(*dataFlag.ListenIp, strconv.Itoa(*dataFlag.ListenPort))
 	http.HandleFunc("/locate/", locate.Handler)
 	http.HandleFunc("/objects/", objects.Handler)
 	http.HandleFunc("/temp/", temp.Handler)
+	http.HandleFunc("/stat/", locate.StatHandler)
+	http.HandleFunc("/scrub/", scrub.StatHandler)
+	http.HandleFunc("/disks/", disk.Handler)
 
 	log.Fatal(http.ListenAndServe(*dataFlag.ListenIp+":"+strconv.Itoa(*dataFlag.ListenPort), nil))
 }
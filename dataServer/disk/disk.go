@@ -0,0 +1,295 @@
+package disk
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"common"
+	"utils"
+)
+
+// 磁盘健康检查（刷新容量并探测是否可写）的间隔
+const diskCheckInterval = time.Minute
+
+// 磁盘探测文件名（位于存储根目录下，写入后立即删除）
+const probeFile = ".doss_probe"
+
+// 每块磁盘的存储根目录下的数据目录
+var dataDirs = []string{"objects", "aggregate_objects", "temp", "garbage", "checksums"}
+
+// -------------------------------------------
+// 数据节点的一块磁盘（一个存储根目录）
+// Total、Free：磁盘的总容量和可用容量（字节）；Error：磁盘离线的原因
+// -------------------------------------------
+type Disk struct {
+	Root   string `json:"root"`
+	Online bool   `json:"online"`
+	Total  uint64 `json:"total"`
+	Free   uint64 `json:"free"`
+	Error  string `json:"error,omitempty"`
+}
+
+var (
+	disks          []*Disk
+	diskMutex      sync.RWMutex
+	offlineHandler func(root string)
+)
+
+// -------------------------------------------
+// 初始化本节点的磁盘：创建各磁盘的数据目录，检查磁盘是否可用
+// NOTE: 启动时不可用的磁盘直接标记为离线（不收集其上的分片，丢失的分片由apiServer的丢失分片检测发现并修复）
+// -------------------------------------------
+func Init(roots []string) {
+	var (
+		root   string
+		dir    string
+		d      *Disk
+		online int
+		err    error
+	)
+
+	for _, root = range roots {
+		d = &Disk{Root: filepath.Clean(root)}
+		for _, dir = range dataDirs {
+			if err = utils.CheckFilePath(d.Root + "/" + dir); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = d.refresh()
+		}
+		if err != nil {
+			d.Error = err.Error()
+			log.Println(common.ErrDiskOffline, d.Root, err)
+		} else {
+			d.Online = true
+			online++
+		}
+		disks = append(disks, d)
+	}
+	if online == 0 {
+		log.Fatal(common.ErrNoOnlineDisk, roots)
+	}
+}
+
+// 设置磁盘离线时的回调函数（移除该磁盘上分片的定位信息并上报丢失的分片）
+func SetOfflineHandler(handler func(root string)) {
+	offlineHandler = handler
+}
+
+// 获取所有在线磁盘的存储根目录（按照启动参数中的顺序）
+func Roots() (roots []string) {
+	var d *Disk
+
+	diskMutex.RLock()
+	defer diskMutex.RUnlock()
+	for _, d = range disks {
+		if d.Online {
+			roots = append(roots, d.Root)
+		}
+	}
+	return
+}
+
+// 获取所有磁盘信息的拷贝（包括离线的磁盘）
+func Disks() (list []Disk) {
+	var d *Disk
+
+	diskMutex.RLock()
+	defer diskMutex.RUnlock()
+	for _, d = range disks {
+		list = append(list, *d)
+	}
+	return
+}
+
+// 获取在线磁盘的总容量和可用容量
+func Capacity() (total uint64, free uint64) {
+	var d *Disk
+
+	diskMutex.RLock()
+	defer diskMutex.RUnlock()
+	for _, d = range disks {
+		if d.Online {
+			total += d.Total
+			free += d.Free
+		}
+	}
+	return
+}
+
+// 按照在线磁盘的总容量计算数据节点的权重（与apiServer按照心跳中的容量计算的权重一致）
+func CapacityWeight() int {
+	var total, _ = Capacity()
+
+	return common.CapacityWeight(total)
+}
+
+// -------------------------------------------
+// 为新的分片（或者聚合对象）选择磁盘：选择可用容量最大的在线磁盘
+// NOTE: 选中后先从该磁盘的可用容量中扣除size（容量在健康检查时刷新），使同时写入的分片分散到各块磁盘
+// -------------------------------------------
+func Choose(size int64) (root string, err error) {
+	var (
+		d    *Disk
+		best *Disk
+	)
+
+	diskMutex.Lock()
+	defer diskMutex.Unlock()
+	for _, d = range disks {
+		if d.Online && d.Free >= uint64(size) && (best == nil || d.Free > best.Free) {
+			best = d
+		}
+	}
+	if best == nil {
+		err = common.ErrNoDiskSpace
+		return
+	}
+	best.Free -= uint64(size)
+	root = best.Root
+	return
+}
+
+// 获取文件所在磁盘的存储根目录（文件不在任何磁盘上时返回空字符串）
+func Owner(path string) (root string) {
+	var d *Disk
+
+	path = filepath.Clean(path)
+	diskMutex.RLock()
+	defer diskMutex.RUnlock()
+	for _, d = range disks {
+		if strings.HasPrefix(path, d.Root+string(filepath.Separator)) && len(d.Root) > len(root) {
+			root = d.Root
+		}
+	}
+	return
+}
+
+// 获取文件在其所在磁盘上的回收站路径（移入回收站不跨越磁盘）
+func GarbagePath(path string) string {
+	return filepath.Dir(filepath.Dir(path)) + "/garbage/" + filepath.Base(path)
+}
+
+// 获取大文件分片的按块校验和文件路径（位于分片所在磁盘的checksums目录，文件名与分片文件相同）
+func ChecksumPath(path string) string {
+	return filepath.Dir(filepath.Dir(path)) + "/checksums/" + filepath.Base(path)
+}
+
+// -------------------------------------------
+// 将大文件分片移入所在磁盘的回收站，同时删除其按块校验和文件
+// NOTE: 回收站中的分片不再被读取；校验和文件删除失败时不影响移动结果，由定期检查任务清除
+// -------------------------------------------
+func MoveShardToGarbage(path string) (err error) {
+	if err = os.Rename(path, GarbagePath(path)); err != nil {
+		return
+	}
+	os.Remove(ChecksumPath(path))
+	return
+}
+
+// -------------------------------------------
+// 上报文件读写错误：文件不存在等错误不影响磁盘状态；其他错误时探测磁盘是否可写，不可写则将磁盘标记为离线
+// NOTE: 离线的磁盘在dataServer重启前不再使用（其上的分片已作为丢失分片修复至其他磁盘），更换磁盘后重启即可
+// -------------------------------------------
+func ReportError(path string, err error) {
+	var (
+		root  string
+		d     *Disk
+		found *Disk
+	)
+
+	if err == nil || os.IsNotExist(err) {
+		return
+	}
+	if root = Owner(path); root == "" {
+		return
+	}
+	diskMutex.RLock()
+	for _, d = range disks {
+		if d.Root == root && d.Online {
+			found = d
+		}
+	}
+	diskMutex.RUnlock()
+	if found == nil || probe(root) == nil {
+		return
+	}
+	setOffline(found, err)
+}
+
+// 定期检查在线磁盘：刷新容量，磁盘不可写时标记为离线
+func StartMonitor() {
+	var (
+		d      *Disk
+		online []*Disk
+		total  uint64
+		free   uint64
+		err    error
+	)
+
+	for {
+		time.Sleep(diskCheckInterval)
+		diskMutex.RLock()
+		online = online[:0]
+		for _, d = range disks {
+			if d.Online {
+				online = append(online, d)
+			}
+		}
+		diskMutex.RUnlock()
+
+		for _, d = range online {
+			if total, free, err = statfs(d.Root); err == nil {
+				err = probe(d.Root)
+			}
+			if err != nil {
+				setOffline(d, err)
+				continue
+			}
+			diskMutex.Lock()
+			d.Total, d.Free = total, free
+			diskMutex.Unlock()
+		}
+	}
+}
+
+// 刷新磁盘容量并探测磁盘是否可写（调用方须保证磁盘未被其他协程访问）
+func (d *Disk) refresh() (err error) {
+	if d.Total, d.Free, err = statfs(d.Root); err != nil {
+		return
+	}
+	return probe(d.Root)
+}
+
+// 将磁盘标记为离线，并执行离线回调
+func setOffline(d *Disk, err error) {
+	diskMutex.Lock()
+	if !d.Online {
+		diskMutex.Unlock()
+		return
+	}
+	d.Online = false
+	d.Error = err.Error()
+	diskMutex.Unlock()
+
+	log.Println(common.ErrDiskOffline, d.Root, err)
+	if offlineHandler != nil {
+		go offlineHandler(d.Root)
+	}
+}
+
+// 探测磁盘是否可写：在存储根目录下写入并删除探测文件
+func probe(root string) (err error) {
+	var path = root + "/" + probeFile
+
+	if err = ioutil.WriteFile(path, []byte(time.Now().String()), 0644); err != nil {
+		return
+	}
+	return os.Remove(path)
+}
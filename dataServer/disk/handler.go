@@ -0,0 +1,33 @@
+package disk
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// 本节点的磁盘信息（GET /disks/的响应体），Total、Free为在线磁盘的总容量和可用容量
+type DiskStat struct {
+	Total uint64 `json:"total"`
+	Free  uint64 `json:"free"`
+	Disks []Disk `json:"disks"`
+}
+
+// -------------------------------------------
+// 查询本节点的磁盘：GET /disks/
+// -------------------------------------------
+func Handler(w http.ResponseWriter, r *http.Request) {
+	var (
+		stat     DiskStat
+		resBytes []byte
+	)
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	stat.Total, stat.Free = Capacity()
+	stat.Disks = Disks()
+	resBytes, _ = json.Marshal(stat)
+	w.Write(resBytes)
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package disk
+
+import "syscall"
+
+// 获取存储根目录所在文件系统的总容量和可用容量（字节）
+func statfs(root string) (total uint64, free uint64, err error) {
+	var stat syscall.Statfs_t
+
+	if err = syscall.Statfs(root, &stat); err != nil {
+		return
+	}
+	total = uint64(stat.Blocks) * uint64(stat.Bsize)
+	free = uint64(stat.Bavail) * uint64(stat.Bsize)
+	return
+}
@@ -0,0 +1,29 @@
+//go:build windows
+// +build windows
+
+package disk
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// 获取存储根目录所在磁盘的总容量和可用容量（字节）
+func statfs(root string) (total uint64, free uint64, err error) {
+	var (
+		path *uint16
+		ret  uintptr
+	)
+
+	if path, err = syscall.UTF16PtrFromString(root); err != nil {
+		return
+	}
+	ret, _, err = procGetDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(path)),
+		uintptr(unsafe.Pointer(&free)), uintptr(unsafe.Pointer(&total)), 0)
+	if ret != 0 {
+		err = nil
+	}
+	return
+}
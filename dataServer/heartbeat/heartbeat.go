@@ -6,35 +6,114 @@ import (
 	"time"
 
 	"config"
+	"dataServer/disk"
+	"dataServer/locate"
+	"membership"
 	"meta"
 	"meta/funcParams"
-	"rbmq"
-	"utils"
 )
 
-// 开始向apiServer汇报心跳消息
+var (
+	nodeId    string       // 数据节点表中本节点的ObjectId（注册时获取）
+	startTime = time.Now() // dataServer的启动时间（用于计算运行时长）
+)
+
+// -------------------------------------------
+// 开始向apiServer汇报心跳消息（版本见common.HeartbeatVersion，apiServer据此维护集群成员并调整节点权重）
+// NOTE: 心跳的传输方式见配置项heartbeatTransport；发送失败时只在首次失败时记录日志，之后的心跳继续重试
+// -------------------------------------------
 func StartHeartbeat(ListenIp, ListenPort string) {
-	var mq *rbmq.Producer
-	mq = rbmq.NewProducer(utils.GetRabbitMqUrl())
-	defer mq.Close()
+	var (
+		publisher membership.Publisher
+		heartbeat common.Heartbeat
+		failing   bool
+		err       error
+	)
+
+	if publisher, err = membership.NewPublisher(); err != nil {
+		log.Fatal(err)
+	}
+	defer publisher.Close()
 	for {
-		mq.Publish(config.GConfig.HeartbeatExchange, ListenIp+":"+ListenPort)
+		heartbeat = newHeartbeat(ListenIp + ":" + ListenPort)
+		if err = publisher.Publish(&heartbeat); err != nil && !failing {
+			log.Println(common.ErrPublishHeartbeat, err)
+		} else if err == nil && failing {
+			log.Println("heartbeat published again")
+		}
+		failing = err != nil
 		time.Sleep(config.GConfig.HeartbeatInterval * time.Second)
 	}
 }
 
-// 将当前节点IP和weight注册到MongoDB数据库中
-func RegisterNodeToDB(ListenIp string, Weight int) {
+// 生成本节点当前的心跳消息
+func newHeartbeat(addr string) (heartbeat common.Heartbeat) {
+	var d disk.Disk
+
+	heartbeat = common.Heartbeat{
+		Version: common.HeartbeatVersion,
+		NodeId:  nodeId,
+		Addr:    addr,
+		Build:   common.BuildVersion,
+		Uptime:  int64(time.Since(startTime).Seconds()),
+	}
+	heartbeat.Total, heartbeat.Free = disk.Capacity()
+	heartbeat.Shards, heartbeat.Aggregates = locate.Counts()
+	for _, d = range disk.Disks() {
+		heartbeat.Disks = append(heartbeat.Disks, common.DiskHealth{
+			Root: d.Root, Online: d.Online, Total: d.Total, Free: d.Free, Error: d.Error,
+		})
+	}
+	return
+}
+
+// 将当前节点IP、weight以及故障域标签（zone、rack）注册到MongoDB数据库中
+// NOTE: 节点已注册时更新权重（按照容量计算的权重只在变化明显时更新）和故障域标签
+//       （权重或标签变化后apiServer会更新哈希环并迁移分片），
+//       FixedWeight为true表示权重由weight参数指定，apiServer不再按照心跳中的容量调整该节点的权重
+func RegisterNodeToDB(ListenIp string, Weight int, FixedWeight bool, Zone string, Rack string) {
 	var (
-		DMongo *meta.DossMongo
+		DMongo meta.Store
+		node   *meta.DsNode
 		err    error
 	)
 
 	// 将数据节点注册到MongoDB数据库中
-	DMongo = meta.NewDossMongo(
+	if DMongo, err = meta.NewStore(
 		funcParams.MongoParamCollection(config.GConfig.NodeColName),
-	)
+	); err != nil {
+		log.Fatal(common.ErrRegisterNode, err)
+	}
 	if _, err = DMongo.AddDsNode(ListenIp, Weight); err != nil {
 		log.Fatal(common.ErrRegisterNode, err)
 	}
+	if node, err = DMongo.GetNodeByIp(ListenIp); err != nil {
+		log.Fatal(common.ErrRegisterNode, err)
+	}
+	// NOTE: 按照容量计算的权重只在容量变化明显且所有磁盘都在线时更新（与apiServer按照心跳调整权重的规则一致），
+	//       避免每次重启都因为容量的微小变化或者磁盘暂时离线而修改权重、迁移分片
+	if FixedWeight || node.FixedWeight || capacityWeightChanged(node.Weight) {
+		if _, err = DMongo.SetDsNodeWeight(ListenIp, Weight, FixedWeight); err != nil {
+			log.Fatal(common.ErrRegisterNode, err)
+		}
+	}
+	if _, err = DMongo.SetDsNodeDomain(ListenIp, Zone, Rack); err != nil {
+		log.Fatal(common.ErrRegisterNode, err)
+	}
+	nodeId = node.OId.Hex()
+}
+
+// 按照本节点在线磁盘的总容量是否需要更新数据节点表中的权重weight（有磁盘离线时不更新）
+func capacityWeightChanged(weight int) bool {
+	var (
+		total, _ = disk.Capacity()
+		d        disk.Disk
+	)
+
+	for _, d = range disk.Disks() {
+		if !d.Online {
+			return false
+		}
+	}
+	return common.CapacityWeightChanged(weight, total)
 }
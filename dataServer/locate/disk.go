@@ -0,0 +1,131 @@
+package locate
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"config"
+	"meta"
+	"meta/funcParams"
+	"utils"
+)
+
+// -------------------------------------------
+// 磁盘离线时的回调函数：移除该磁盘上大文件分片和聚合对象的定位信息，
+// 并将这些分片（包括聚合对象中的小文件分片）作为丢失分片加入待修复集合，由apiServer重建至本节点的其他磁盘
+// NOTE: 对象已存在丢失分片修复任务时不重复加入，apiServer修复时会重新检测对象所有丢失的分片
+// -------------------------------------------
+func DiskOffline(root string) {
+	var (
+		lost         = make(map[string][]int) // key: 对象hash值；value：丢失的分片下标
+		aggNames     []string
+		name         string
+		hash         string
+		indexes      []int
+		DMongoAgg    meta.Store
+		DMongoShard  meta.Store
+		DMongoRepair meta.Store
+		aggMeta      *meta.AggregateMeta
+		repairMeta   *meta.RepairShard
+		err          error
+	)
+
+	// 移除定位信息
+	objMutex.Lock()
+	for hash, name = range objDisks {
+		if name == root {
+			lost[hash] = append(lost[hash], objects[hash])
+			delete(objects, hash)
+			delete(objDisks, hash)
+		}
+	}
+	objMutex.Unlock()
+	aggObjMutex.Lock()
+	for name = range aggObjects {
+		if aggDisks[name] == root {
+			aggNames = append(aggNames, name)
+			delete(aggObjects, name)
+			delete(aggDisks, name)
+		}
+	}
+	aggObjMutex.Unlock()
+
+	if DMongoAgg, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	if DMongoShard, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.ObjShardColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	if DMongoRepair, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RepairObjColName)); err != nil {
+		log.Println(err)
+		return
+	}
+
+	// 收集引用离线聚合对象的小文件分片
+	for _, name = range aggNames {
+		if aggMeta, err = DMongoAgg.GetAggregateMeta(name); err != nil || aggMeta.Name == "" {
+			continue
+		}
+		lostMiniShards(DMongoShard, aggMeta, lost)
+	}
+
+	// 加入待修复集合
+	for hash, indexes = range lost {
+		repairMeta, err = DMongoRepair.GetRepairShardMeta(meta.LostShardKey(hash))
+		if err == nil && repairMeta.ShardHash != "" {
+			continue
+		}
+		if _, err = DMongoRepair.PutLostShardMeta(hash, indexes); err != nil {
+			log.Println(err)
+		}
+	}
+	log.Println("disk", root, "offline, objects with lost shards:", len(lost), "aggregate objects:", len(aggNames))
+}
+
+// 收集引用聚合对象的小文件分片（分片未被删除且仍引用该聚合对象），并移除其定位信息
+func lostMiniShards(DMongoShard meta.Store, aggMeta *meta.AggregateMeta, lost map[string][]int) {
+	var (
+		refShard   string
+		objectName string
+		shardIndex int
+		shardMeta  *meta.ObjectShardMeta
+		aggObject  *meta.AggObject
+		err        error
+	)
+
+	for _, refShard = range utils.SliceRemoveReplica(aggMeta.RefBy) {
+		if len(strings.Split(refShard, ".")) < 2 {
+			continue
+		}
+		objectName = strings.Split(refShard, ".")[0]
+		shardIndex, _ = strconv.Atoi(strings.Split(refShard, ".")[1])
+		if shardMeta, err = DMongoShard.GetShardMetaByIndex(objectName, shardIndex); err != nil || shardMeta.Hash == "" {
+			continue
+		}
+		for _, aggObject = range shardMeta.Aggregate {
+			if aggObject.Name != aggMeta.Name {
+				continue
+			}
+			if !intsHasMember(lost[objectName], shardIndex) {
+				lost[objectName] = append(lost[objectName], shardIndex)
+			}
+			if ObjectLocate(objectName) == shardIndex {
+				ObjectDelete(objectName)
+			}
+			break
+		}
+	}
+}
+
+// 判断整数切片中是否存在某个成员
+func intsHasMember(slice []int, member int) bool {
+	for _, item := range slice {
+		if item == member {
+			return true
+		}
+	}
+	return false
+}
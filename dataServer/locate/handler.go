@@ -7,38 +7,119 @@ import (
 	"strconv"
 	"strings"
 
+	"config"
 	"meta"
+	"meta/funcParams"
 )
 
+// -------------------------------------------
+// 定位对象分片：GET /locate/<object_hash> 或者 GET /locate/<object_hash>.<shard_index>
+// NOTE: 1) 返回本节点上存储的该对象分片的index，若本节点上不存在该对象的分片，则返回空的响应体；
+//       2) 本节点上存储了同一对象的多个分片时（如迁移中的旧分片和新分片），不指定分片下标只返回其中一个，
+//          指定分片下标时只在本节点上存储了该分片时返回该下标
+// -------------------------------------------
 func Handler(w http.ResponseWriter, r *http.Request) {
 	var (
-		method string
-		name   string
-		Meta   *meta.ObjectMeta
-		id     int
-		err    error
+		name  string
+		hash  string
+		index int
+		id    int
+		err   error
 	)
 
 	// HTTP请求检查
-	method = r.Method
-	if method != http.MethodGet {
+	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	// 获取对象元数据
+	// 指定分片下标：查找本节点上是否存储了该分片
 	name = strings.Split(r.URL.EscapedPath(), "/")[2]
-	if Meta, err = meta.NewDossMongo().GetLastVersionMeta(name); err != nil {
-		log.Println(common.ErrGetLastVersionMeta, err)
+	if parts := strings.Split(name, "."); len(parts) == 2 {
+		if index, err = strconv.Atoi(parts[1]); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if shardExist(parts[0], index) {
+			w.Write([]byte(strconv.Itoa(index)))
+		}
+		return
 	}
 
-	// 根据元数据中的hash值进行定位
-	if Meta == nil {
-		w.WriteHeader(http.StatusNotFound)
-		return
+	// 先在内存中查找大对象的分片，找不到则查找位于本节点聚合对象中的小对象分片
+	hash = name
+	if id = ObjectLocate(hash); id == -1 {
+		id = miniObjectLocate(hash)
 	}
-	id = ObjectLocate(Meta.Hash)
 	if id != -1 {
 		w.Write([]byte(strconv.Itoa(id)))
 	}
 }
+
+// 本节点上是否存储了对象的第index个分片：大对象的分片文件位于本节点的磁盘上，或者小对象分片所在的聚合对象都位于本节点
+func shardExist(hash string, index int) bool {
+	var (
+		shardMeta *meta.ObjectShardMeta
+		aggObject *meta.AggObject
+		err       error
+	)
+
+	if ObjectLocate(hash) == index || len(ObjectFiles(hash+"."+strconv.Itoa(index))) > 0 {
+		return true
+	}
+
+	DMongo, err := meta.NewStore(funcParams.MongoParamCollection(config.GConfig.ObjShardColName))
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	if shardMeta, err = DMongo.GetShardMetaByIndex(hash, index); err != nil {
+		return false
+	}
+	if shardMeta.Hash == "" || len(shardMeta.Aggregate) == 0 {
+		return false
+	}
+	for _, aggObject = range shardMeta.Aggregate {
+		if !AggObjectExist(aggObject.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// 定位小对象分片：分片元数据中记录的聚合对象都位于本节点时，说明该分片存储在本节点
+func miniObjectLocate(hash string) int {
+	var (
+		shardMetas []*meta.ObjectShardMeta
+		shardMeta  *meta.ObjectShardMeta
+		aggObject  *meta.AggObject
+		local      bool
+		err        error
+	)
+
+	DMongo, err := meta.NewStore(funcParams.MongoParamCollection(config.GConfig.ObjShardColName))
+	if err != nil {
+		log.Println(err)
+		return -1
+	}
+	if shardMetas, err = DMongo.GetShardMetasByObject(hash); err != nil {
+		log.Println(common.ErrGetShardMetaByHash, err)
+		return -1
+	}
+	for _, shardMeta = range shardMetas {
+		if shardMeta.Hash == "" || len(shardMeta.Aggregate) == 0 {
+			continue
+		}
+		local = true
+		for _, aggObject = range shardMeta.Aggregate {
+			if !AggObjectExist(aggObject.Name) {
+				local = false
+				break
+			}
+		}
+		if local {
+			return shardMeta.Index
+		}
+	}
+	return -1
+}
@@ -15,12 +15,14 @@ import (
 	"sync"
 
 	"config"
+	"dataServer/disk"
 	"meta"
 	"meta/funcParams"
 	"utils"
 )
 
 var aggObjects = make(map[string]int64) // key: 聚合对象名；value：聚合对象当前尺寸
+var aggDisks = make(map[string]string)  // key: 聚合对象名；value：聚合对象所在磁盘的存储根目录
 var aggObjMutex sync.RWMutex
 
 // 实现聚合对象数组的排序接口（按照size排序从大到小）
@@ -43,20 +45,41 @@ func GetAvailAggregates() (aggObjs AggObjSlice) {
 		name string
 		size int64
 	)
+	aggObjMutex.RLock()
 	for name, size = range aggObjects {
 		if size < config.GConfig.AggregateObjSize*common.MB {
 			aggObjs = append(aggObjs, name)
 		}
 	}
+	aggObjMutex.RUnlock()
 	sort.Sort(aggObjs)
 	return
 }
 
+// 获取所有已写满的聚合对象（不再分配给新的上传）
+func GetSealedAggregates() (names []string) {
+	var (
+		name string
+		size int64
+	)
+
+	aggObjMutex.RLock()
+	defer aggObjMutex.RUnlock()
+	for name, size = range aggObjects {
+		if size >= config.GConfig.AggregateObjSize*common.MB {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
 // 删除指定的聚合对象信息
 func AggObjectDelete(name string) {
 	aggObjMutex.Lock()
 	defer aggObjMutex.Unlock()
 	delete(aggObjects, name)
+	delete(aggDisks, name)
 }
 
 // 获取聚合对象的size
@@ -71,6 +94,14 @@ func GetAggObjSize(name string) (size int64) {
 	return
 }
 
+// 判断聚合对象是否位于本节点
+func AggObjectExist(name string) (ok bool) {
+	aggObjMutex.RLock()
+	_, ok = aggObjects[name]
+	aggObjMutex.RUnlock()
+	return
+}
+
 // 更新聚合对象的size（若不存在则创建）
 func UpdateAggObjSize(name string, newSize int64) {
 	aggObjMutex.Lock()
@@ -78,6 +109,32 @@ func UpdateAggObjSize(name string, newSize int64) {
 	aggObjects[name] = newSize
 }
 
+// 添加聚合对象的定位信息，并记录聚合对象所在的磁盘
+func AggObjectAdd(name string, root string, size int64) {
+	aggObjMutex.Lock()
+	defer aggObjMutex.Unlock()
+	aggObjects[name] = size
+	aggDisks[name] = root
+}
+
+// 获取聚合对象文件的路径（聚合对象不在本节点上时，返回第一块在线磁盘上的路径）
+func AggObjectPath(name string) string {
+	var (
+		root  string
+		roots []string
+	)
+
+	aggObjMutex.RLock()
+	root = aggDisks[name]
+	aggObjMutex.RUnlock()
+	if root == "" {
+		if roots = disk.Roots(); len(roots) > 0 {
+			root = roots[0]
+		}
+	}
+	return root + "/aggregate_objects/" + name
+}
+
 // 收集聚合对象的定位信息
 func CollectAggObjects(storeRoot string) {
 	var (
@@ -89,10 +146,11 @@ func CollectAggObjects(storeRoot string) {
 		err         error
 	)
 
-	// 检查存储根目录
+	// 检查存储根目录（检查失败时将该磁盘标记为离线）
 	if err = utils.CheckFilePath(storeRoot + "/aggregate_objects"); err != nil {
 		log.Println(common.ErrCheckAggObjRootPath, err)
-		os.Exit(-1)
+		disk.ReportError(storeRoot+"/aggregate_objects", err)
+		return
 	}
 
 	// 收集根目录下对象
@@ -112,7 +170,7 @@ func CollectAggObjects(storeRoot string) {
 		}
 		fileHandler.Close()
 		aggName = filepath.Base(file)
-		aggObjects[aggName] = fileInfo.Size()
+		AggObjectAdd(aggName, storeRoot, fileInfo.Size())
 	}
 
 	// 监控根目录对象的变化
@@ -123,9 +181,9 @@ func CollectAggObjects(storeRoot string) {
 // 聚合对象目录下文件发生改变时的回调函数
 func repairAggObjects(changedFiles []string) {
 	var (
-		DMongoAgg    *meta.DossMongo
-		DMongoRepair *meta.DossMongo
-		DMongoShard  *meta.DossMongo
+		DMongoAgg    meta.Store
+		DMongoRepair meta.Store
+		DMongoShard  meta.Store
 		changedFile  string
 		aggMeta      *meta.AggregateMeta
 		shardMeta    *meta.ObjectShardMeta
@@ -139,9 +197,18 @@ func repairAggObjects(changedFiles []string) {
 		err          error
 	)
 
-	DMongoAgg = meta.NewDossMongo(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName))
-	DMongoRepair = meta.NewDossMongo(funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
-	DMongoShard = meta.NewDossMongo(funcParams.MongoParamCollection(config.GConfig.ObjShardColName))
+	if DMongoAgg, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	if DMongoRepair, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RepairObjColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	if DMongoShard, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.ObjShardColName)); err != nil {
+		log.Println(err)
+		return
+	}
 
 	// 修复对象分片数据
 	for _, changedFile = range changedFiles {
@@ -10,12 +10,14 @@ import (
 	"sync"
 
 	"config"
+	"dataServer/disk"
 	"meta"
 	"meta/funcParams"
 	"utils"
 )
 
 var objects = make(map[string]int)
+var objDisks = make(map[string]string) // key: 对象hash值；value：大文件分片所在磁盘的存储根目录
 var objMutex sync.RWMutex
 
 func GetObjectsInfo() *map[string]int {
@@ -38,10 +40,46 @@ func ObjectAdd(hash string, id int) {
 	objects[hash] = id
 }
 
+// 添加大文件分片的定位信息，并记录分片所在的磁盘
+func ObjectAddOnDisk(hash string, id int, root string) {
+	objMutex.Lock()
+	defer objMutex.Unlock()
+	objects[hash] = id
+	objDisks[hash] = root
+}
+
 func ObjectDelete(hash string) {
 	objMutex.Lock()
 	defer objMutex.Unlock()
 	delete(objects, hash)
+	delete(objDisks, hash)
+}
+
+// 获取大文件分片所在磁盘的存储根目录（未记录时返回空字符串）
+func ObjectDisk(hash string) string {
+	objMutex.RLock()
+	defer objMutex.RUnlock()
+	return objDisks[hash]
+}
+
+// 获取本节点上的分片文件（shardName为 对象hash.分片序号 或者 对象hash）：
+// 先在定位信息记录的磁盘上查找，找不到时在所有在线磁盘上查找
+func ObjectFiles(shardName string) (files []string) {
+	var (
+		root    string
+		matches []string
+	)
+
+	if root = ObjectDisk(strings.Split(shardName, ".")[0]); root != "" {
+		if files, _ = filepath.Glob(root + "/objects/" + shardName + ".*"); len(files) > 0 {
+			return
+		}
+	}
+	for _, root = range disk.Roots() {
+		matches, _ = filepath.Glob(root + "/objects/" + shardName + ".*")
+		files = append(files, matches...)
+	}
+	return
 }
 
 // 收集对象的定位信息
@@ -55,10 +93,11 @@ func CollectObjects(storeRoot string) {
 		err      error
 	)
 
-	// 检查存储根目录
+	// 检查存储根目录（检查失败时将该磁盘标记为离线）
 	if err = utils.CheckFilePath(storeRoot + "/objects"); err != nil {
 		log.Println(common.ErrCheckObjRootPath, err)
-		os.Exit(-1)
+		disk.ReportError(storeRoot+"/objects", err)
+		return
 	}
 
 	// 收集根目录下对象
@@ -72,7 +111,7 @@ func CollectObjects(storeRoot string) {
 		if id, err = strconv.Atoi(fileInfo[1]); err != nil {
 			log.Panicf(err.Error())
 		}
-		objects[hash] = id
+		ObjectAddOnDisk(hash, id, storeRoot)
 	}
 
 	// 监控根目录对象的变化
@@ -83,7 +122,7 @@ func CollectObjects(storeRoot string) {
 // 对象目录下文件发生改变时的回调函数
 func repairObjects(changedFiles []string) {
 	var (
-		DMongo      *meta.DossMongo
+		DMongo      meta.Store
 		changedFile string
 		fileInfo    []string
 		objHash     string
@@ -95,7 +134,10 @@ func repairObjects(changedFiles []string) {
 		err         error
 	)
 
-	DMongo = meta.NewDossMongo(funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RepairObjColName)); err != nil {
+		log.Println(err)
+		return
+	}
 
 	// 修复对象分片数据
 	for _, changedFile = range changedFiles {
@@ -0,0 +1,74 @@
+package locate
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"config"
+	"meta"
+	"meta/funcParams"
+)
+
+// 本节点存储的分片统计
+// Objects：/objects目录下的大文件分片数量；MiniShards：本节点聚合对象上的小文件分片（引用）数量
+type ShardStat struct {
+	Objects    int `json:"objects"`
+	MiniShards int `json:"miniShards"`
+}
+
+// 获取本节点内存中的分片数量和聚合对象数量（用于心跳消息，不查询数据库）
+func Counts() (shards int, aggregates int) {
+	objMutex.RLock()
+	shards = len(objects)
+	objMutex.RUnlock()
+
+	aggObjMutex.RLock()
+	aggregates = len(aggObjects)
+	aggObjMutex.RUnlock()
+	return
+}
+
+// -------------------------------------------
+// 查询本节点存储的分片数量：GET /stat/
+// NOTE: 用于数据节点下线时查询迁移进度，小文件分片数量为本节点各聚合对象的引用数之和
+// -------------------------------------------
+func StatHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		stat     ShardStat
+		names    []string
+		name     string
+		DMongo   meta.Store
+		aggMeta  *meta.AggregateMeta
+		resBytes []byte
+		err      error
+	)
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	objMutex.RLock()
+	stat.Objects = len(objects)
+	objMutex.RUnlock()
+
+	aggObjMutex.RLock()
+	for name = range aggObjects {
+		names = append(names, name)
+	}
+	aggObjMutex.RUnlock()
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName)); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	for _, name = range names {
+		if aggMeta, err = DMongo.GetAggregateMeta(name); err == nil && aggMeta.RefCount > 0 {
+			stat.MiniShards += aggMeta.RefCount
+		}
+	}
+
+	resBytes, _ = json.Marshal(stat)
+	w.Write(resBytes)
+}
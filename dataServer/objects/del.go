@@ -0,0 +1,62 @@
+package objects
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"dataServer/disk"
+	"dataServer/locate"
+)
+
+// -------------------------------------------
+// 删除本节点上的对象分片：DELETE /objects/<object_hash>.<shard_index>
+// 用于数据迁移：分片已位于目标哈希环上的数据节点后，由apiServer删除其他节点上的旧分片
+// NOTE:
+//   1) 分片文件移到/garbage目录（不触发数据修复），由定期检查任务清除，同时删除其按块校验和文件；
+//   2) 内存中的定位信息只在指向被删除的分片时移除；
+//   3) 小文件分片的数据位于聚合对象中，由分片元数据引用，迁移时已在目标节点上更新，此处无需处理；
+//   4) 分片不存在时同样返回成功，保证重复删除的幂等性
+// -------------------------------------------
+func del(w http.ResponseWriter, r *http.Request) {
+	var (
+		shardName  string
+		objectName string
+		shardIndex int
+		hashFiles  []string
+		hashFile   string
+		err        error
+	)
+
+	shardName = strings.Split(r.URL.EscapedPath(), "/")[2]
+	if len(strings.Split(shardName, ".")) != 2 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	objectName = strings.Split(shardName, ".")[0]
+	if shardIndex, err = strconv.Atoi(strings.Split(shardName, ".")[1]); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	hashFiles = locate.ObjectFiles(shardName)
+	for _, hashFile = range hashFiles {
+		if err = disk.MoveShardToGarbage(hashFile); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	if locate.ObjectLocate(objectName) != shardIndex {
+		return
+	}
+
+	// 本节点上仍存在该对象的其他分片（如迁移至本节点的分片）时，定位信息改为该分片
+	locate.ObjectDelete(objectName)
+	hashFiles = locate.ObjectFiles(objectName)
+	for _, hashFile = range hashFiles {
+		if shardIndex, err = strconv.Atoi(strings.Split(filepath.Base(hashFile), ".")[1]); err == nil {
+			locate.ObjectAddOnDisk(objectName, shardIndex, disk.Owner(hashFile))
+		}
+	}
+}
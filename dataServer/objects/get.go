@@ -4,14 +4,18 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"hash"
+	"log"
 	"net/http"
 	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
 
-	"common/dataFlag"
+	"common"
 	"config"
+	"dataServer/disk"
+	"dataServer/locate"
+	"dataServer/scrub"
 	"meta"
 	"meta/funcParams"
 	"utils"
@@ -19,13 +23,14 @@ import (
 
 func get(w http.ResponseWriter, r *http.Request) {
 	var (
-		DMongo     *meta.DossMongo
+		DMongo     meta.Store
 		shardMeta  *meta.ObjectShardMeta
-		shardPath  string
 		shardName  string
 		objectName string
 		shardIndex int
 		filePath   string
+		files      []string
+		offset     int64
 		err        error
 	)
 
@@ -33,75 +38,169 @@ func get(w http.ResponseWriter, r *http.Request) {
 	shardName = strings.Split(r.URL.EscapedPath(), "/")[2]
 	objectName = strings.Split(shardName, ".")[0]
 	shardIndex, _ = strconv.Atoi(strings.Split(shardName, ".")[1])
+	offset = utils.GetOffsetFromHeader(r.Header)
 
 	// 判断分片size，若小于聚合对象最大size，则进行小文件处理逻辑
-	DMongo = meta.NewDossMongo(funcParams.MongoParamCollection(config.GConfig.ObjShardColName))
-	shardMeta, err = DMongo.GetShardMetaByIndex(objectName, shardIndex)
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.ObjShardColName)); err == nil {
+		shardMeta, err = DMongo.GetShardMetaByIndex(objectName, shardIndex)
+	}
 	if err == nil && len(shardMeta.Aggregate) > 0 {
-		getMiniFile(w, shardMeta)
+		getMiniFile(w, shardMeta, offset)
 		return
 	}
 
-	// 处理大文件逻辑
-	shardPath = *dataFlag.StorageRoot + "/objects/" + shardName + ".*"
-	filePath = checkFile(shardPath, 0, 0, strings.Split(shardPath, ".")[2])
-	if filePath == "" {
+	// 处理大文件逻辑（分片文件位于定位信息记录的磁盘上），区间读取时按块校验
+	files = locate.ObjectFiles(shardName)
+	if offset > 0 {
+		getRange(w, files, objectName, shardIndex, offset)
+		return
+	}
+	if filePath = checkFile(files, 0, 0); filePath == "" {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 	utils.SeekCopy(filePath, w, 0, 0)
 }
 
-// 小文件处理逻辑
-func getMiniFile(w http.ResponseWriter, shardMeta *meta.ObjectShardMeta) {
+// -------------------------------------------
+// 大文件分片的区间读取：按照写入时保存的按块校验和，逐块校验offset所在的块及之后的数据后再返回
+// 1) 第一块校验失败或者分片不存在时返回404，apiServer由其他分片解码出该分片的数据；
+// 2) 之后的某块校验失败时响应头已发出，中断连接，apiServer读取出错后同样改为由其他分片解码；
+// 3) 没有按块校验和的分片（之前的版本写入）先校验整个分片的hash值；
+// NOTE: 区间读取时apiServer不修复分片，校验失败的分片由本节点加入待修复集合
+// -------------------------------------------
+func getRange(w http.ResponseWriter, files []string, objectName string, shardIndex int, offset int64) {
+	var (
+		writer   = &partialWriter{w: w}
+		fileInfo []string
+		err      error
+	)
+
+	if len(files) != 1 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if fileInfo = strings.Split(filepath.Base(files[0]), "."); len(fileInfo) != 3 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	_, err = utils.VerifyBlockCopy(files[0], disk.ChecksumPath(files[0]), writer, offset)
+	if err == common.ErrNoChecksum {
+		if checkFile(files, 0, 0) == "" {
+			err = common.ErrBlockChecksum
+		} else {
+			_, err = utils.SeekCopy(files[0], writer, offset, 0)
+		}
+	}
+	if err == nil {
+		return
+	}
+	if err == common.ErrBlockChecksum {
+		log.Println(err, files[0])
+		scrub.ReportCorrupted(objectName, shardIndex, fileInfo[2])
+	} else {
+		disk.ReportError(files[0], err)
+	}
+	if writer.written > 0 {
+		panic(http.ErrAbortHandler)
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// 区间读取的响应：写入第一个字节时才发出206响应头，在此之前出错时仍可返回404
+type partialWriter struct {
+	w       http.ResponseWriter
+	written int64
+}
+
+func (p *partialWriter) Write(b []byte) (n int, err error) {
+	if p.written == 0 {
+		p.w.WriteHeader(http.StatusPartialContent)
+	}
+	n, err = p.w.Write(b)
+	p.written += int64(n)
+	return
+}
+
+// -------------------------------------------
+// 小文件处理逻辑：校验分片的hash值后返回分片数据（offset大于0时为区间读取，从offset处开始返回）
+// NOTE: 小文件分片不大于聚合对象，区间读取时同样校验整个分片；hash值不一致时返回404，
+//       区间读取时apiServer不修复分片，故同时将该分片加入待修复集合
+// -------------------------------------------
+func getMiniFile(w http.ResponseWriter, shardMeta *meta.ObjectShardMeta, offset int64) {
 	var (
 		aggObjects = shardMeta.Aggregate
 		aggObject  *meta.AggObject
 		aggPath    string
 		HashCalc   hash.Hash
 		HashSum    string
+		size       int64
+		err        error
 	)
 
 	// 生成一个哈希计算器，并将该分片所在的聚合对象中对应的数据流式拷贝至该计算器，得出哈希计算结果
 	HashCalc = sha256.New()
 	for _, aggObject = range aggObjects {
-		aggPath = *dataFlag.StorageRoot + "/aggregate_objects/" + aggObject.Name
-		utils.SeekCopy(aggPath, HashCalc, int64(aggObject.Offset), int64(aggObject.Size))
+		aggPath = locate.AggObjectPath(aggObject.Name)
+		if _, err = utils.SeekCopy(aggPath, HashCalc, int64(aggObject.Offset), int64(aggObject.Size)); err != nil {
+			disk.ReportError(aggPath, err)
+		}
 	}
 	HashSum = url.PathEscape(base64.StdEncoding.EncodeToString(HashCalc.Sum(nil)))
 
-	// 若哈希不一致，则返回404，apiServer会进行该数据流的修复
+	// 若哈希不一致，则返回404，apiServer会进行该数据流的修复（区间读取时由本节点加入待修复集合）
 	// 若哈希一致，则拷贝数据流到http.ResponseWriter
 	if HashSum != shardMeta.Hash {
+		if offset > 0 {
+			scrub.ReportCorrupted(shardMeta.Object, shardMeta.Index, shardMeta.Hash)
+		}
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
+
+	// 区间读取：略过offset之前的聚合片段，从offset所在片段的相应位置开始拷贝
+	if offset > 0 {
+		w.WriteHeader(http.StatusPartialContent)
+	}
 	for _, aggObject = range aggObjects {
-		aggPath = *dataFlag.StorageRoot + "/aggregate_objects/" + aggObject.Name
-		utils.SeekCopy(aggPath, w, int64(aggObject.Offset), int64(aggObject.Size))
+		if size = int64(aggObject.Size); offset >= size {
+			offset -= size
+			continue
+		}
+		aggPath = locate.AggObjectPath(aggObject.Name)
+		utils.SeekCopy(aggPath, w, int64(aggObject.Offset)+offset, size-offset)
+		offset = 0
 	}
 }
 
-// 校验文件数据：若散列值一致则返回文件路径，不一致则返回空路径触发数据修复
-func checkFile(path string, offset int64, copyLen int64, expectHash string) (filePath string) {
+// 校验文件数据（文件名格式为 对象hash.分片序号.分片hash）：若散列值一致则返回文件路径，不一致则返回空路径触发数据修复
+// NOTE: 读取出错时上报磁盘错误（磁盘不可写时标记为离线）
+func checkFile(files []string, offset int64, copyLen int64) (filePath string) {
 	var (
-		files    []string
+		fileInfo []string
 		HashCalc hash.Hash
 		HashSum  string
+		err      error
 	)
-	if files, _ = filepath.Glob(path); len(files) != 1 {
+	if len(files) != 1 {
+		return
+	}
+	if fileInfo = strings.Split(filepath.Base(files[0]), "."); len(fileInfo) != 3 {
 		return
 	}
-	filePath = files[0]
 
 	// 生成一个哈希计算器，并将文件流式拷贝至该计算器，得出哈希计算结果
 	HashCalc = sha256.New()
-	utils.SeekCopy(filePath, HashCalc, offset, copyLen)
+	if _, err = utils.SeekCopy(files[0], HashCalc, offset, copyLen); err != nil {
+		disk.ReportError(files[0], err)
+		return
+	}
 	HashSum = url.PathEscape(base64.StdEncoding.EncodeToString(HashCalc.Sum(nil)))
 
 	// 比对hash值
-	if HashSum != expectHash {
-		filePath = ""
+	if HashSum == fileInfo[2] {
+		filePath = files[0]
 	}
 	return
 }
@@ -10,5 +10,9 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		get(w, r)
 		return
 	}
+	if m == http.MethodDelete {
+		del(w, r)
+		return
+	}
 	w.WriteHeader(http.StatusMethodNotAllowed)
 }
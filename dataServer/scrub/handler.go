@@ -0,0 +1,25 @@
+package scrub
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// -------------------------------------------
+// 查询本节点的数据巡检进度与统计：GET /scrub/
+// -------------------------------------------
+func StatHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		current  Stat
+		resBytes []byte
+	)
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	current = GetStat()
+	resBytes, _ = json.Marshal(current)
+	w.Write(resBytes)
+}
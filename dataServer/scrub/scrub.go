@@ -0,0 +1,461 @@
+package scrub
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"common"
+	"config"
+	"dataServer/disk"
+	"dataServer/locate"
+	"meta"
+	"meta/funcParams"
+	"utils"
+)
+
+// 每块磁盘上巡检的目录（按磁盘顺序依次巡检各磁盘上的这些目录）
+var scrubDirs = []string{"objects", "aggregate_objects"}
+
+// 程序启动后开始巡检前的等待时间（等待对象定位信息收集完成）
+const scrubStartDelay = time.Minute
+
+// 每巡检多少个文件保存一次巡检进度
+const scrubMarkerBatch = 100
+
+// 巡检进度文件名（位于第一块在线磁盘的存储根目录下）
+const scrubMarkerFile = "scrub.json"
+
+// -------------------------------------------
+// 巡检进度与统计信息（同时作为巡检进度保存至存储根目录，重启后从保存的进度继续巡检）
+// Dir为当前巡检的目录（包含磁盘的存储根目录），为空表示当前没有进行中的巡检，Marker为Dir目录下最后一个巡检完成的文件名
+// -------------------------------------------
+type Stat struct {
+	Running        bool      `json:"running"`
+	Round          int       `json:"round"`
+	Dir            string    `json:"dir"`
+	Marker         string    `json:"marker"`
+	Files          int64     `json:"files"`
+	Shards         int64     `json:"shards"`
+	Bytes          int64     `json:"bytes"`
+	Corrupted      int64     `json:"corrupted"`
+	TotalCorrupted int64     `json:"totalCorrupted"`
+	RoundStart     time.Time `json:"roundStart"`
+	LastRoundEnd   time.Time `json:"lastRoundEnd"`
+}
+
+var stat Stat
+var statMutex sync.RWMutex
+
+// 获取巡检统计信息的拷贝
+func GetStat() Stat {
+	statMutex.RLock()
+	defer statMutex.RUnlock()
+	return stat
+}
+
+// -------------------------------------------
+// 启动数据巡检：每隔scrubInterval小时按文件名顺序读取本节点的全部分片并重新计算hash值，
+// 与文件名（大文件）或者分片元数据（小文件）中的hash值比较，不一致则加入待修复集合
+// NOTE:
+//   1) 目录监听只能发现写入和删除事件，巡检用于发现冷数据的静默损坏（bit rot）；
+//   2) 读取速率受scrubBandwidth限制，避免影响正常的业务IO；
+//   3) 每巡检scrubMarkerBatch个文件保存一次进度，重启后从保存的进度继续巡检；
+//   4) 读取大文件分片出错时上报磁盘错误（磁盘不可用时标记为离线，其上的分片由丢失分片修复流程重建）
+// -------------------------------------------
+func StartScrub() {
+	var (
+		interval time.Duration
+		wait     time.Duration
+	)
+
+	if config.GConfig.ScrubInterval <= 0 {
+		return
+	}
+	interval = config.GConfig.ScrubInterval * time.Hour
+	loadMarker()
+	time.Sleep(scrubStartDelay)
+
+	for {
+		// 上一轮巡检已完成：等待至下一轮巡检开始时间
+		statMutex.RLock()
+		wait = 0
+		if stat.Dir == "" {
+			wait = time.Until(stat.LastRoundEnd.Add(interval))
+		}
+		statMutex.RUnlock()
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+		runRound()
+	}
+}
+
+// 获取本轮需要巡检的目录：各在线磁盘上的巡检目录
+func scrubPaths() (dirs []string) {
+	var root, dir string
+
+	for _, root = range disk.Roots() {
+		for _, dir = range scrubDirs {
+			dirs = append(dirs, root+"/"+dir)
+		}
+	}
+	return
+}
+
+// 执行一轮巡检（从保存的进度处继续）
+func runRound() {
+	var (
+		DMongoRepair meta.Store
+		DMongoAgg    meta.Store
+		DMongoShard  meta.Store
+		limiter      *throttle
+		dirs         = scrubPaths()
+		dirIndex     int
+		files        []string
+		file         string
+		name         string
+		marker       string
+		count        int
+		err          error
+	)
+
+	if DMongoRepair, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RepairObjColName)); err != nil {
+		log.Println(err)
+		time.Sleep(scrubStartDelay)
+		return
+	}
+	if DMongoAgg, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName)); err != nil {
+		log.Println(err)
+		time.Sleep(scrubStartDelay)
+		return
+	}
+	if DMongoShard, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.ObjShardColName)); err != nil {
+		log.Println(err)
+		time.Sleep(scrubStartDelay)
+		return
+	}
+	limiter = newThrottle(config.GConfig.ScrubBandwidth * common.MB)
+
+	if len(dirs) == 0 {
+		time.Sleep(scrubStartDelay)
+		return
+	}
+
+	// 开始新一轮巡检
+	statMutex.Lock()
+	if stat.Dir == "" {
+		stat.Round++
+		stat.Dir = dirs[0]
+		stat.Marker = ""
+		stat.Files, stat.Shards, stat.Bytes, stat.Corrupted = 0, 0, 0, 0
+		stat.RoundStart = time.Now()
+	}
+	stat.Running = true
+	dirIndex = utils.SliceIndexOfMember(dirs, stat.Dir)
+	marker = stat.Marker
+	statMutex.Unlock()
+	// 保存的进度所在的磁盘已离线时，从第一个目录开始巡检
+	if dirIndex < 0 {
+		dirIndex, marker = 0, ""
+	}
+
+	for ; dirIndex < len(dirs); dirIndex++ {
+		files, _ = filepath.Glob(dirs[dirIndex] + "/*")
+		for _, file = range files {
+			// filepath.Glob返回的文件名按字典序排列，跳过已巡检的文件
+			if name = filepath.Base(file); name <= marker {
+				continue
+			}
+			if filepath.Base(dirs[dirIndex]) == "objects" {
+				scrubObject(DMongoRepair, limiter, file)
+			} else {
+				scrubAggObject(DMongoRepair, DMongoAgg, DMongoShard, limiter, file)
+			}
+
+			statMutex.Lock()
+			stat.Dir, stat.Marker = dirs[dirIndex], name
+			stat.Files++
+			statMutex.Unlock()
+			if count++; count%scrubMarkerBatch == 0 {
+				saveMarker()
+			}
+		}
+		marker = ""
+		if dirIndex+1 < len(dirs) {
+			statMutex.Lock()
+			stat.Dir, stat.Marker = dirs[dirIndex+1], ""
+			statMutex.Unlock()
+			saveMarker()
+		}
+	}
+
+	// 本轮巡检完成
+	statMutex.Lock()
+	stat.Running = false
+	stat.Dir, stat.Marker = "", ""
+	stat.LastRoundEnd = time.Now()
+	log.Println("scrub round", stat.Round, "finished, files:", stat.Files, "shards:", stat.Shards,
+		"bytes:", stat.Bytes, "corrupted:", stat.Corrupted)
+	statMutex.Unlock()
+	saveMarker()
+}
+
+// -------------------------------------------
+// 巡检大文件分片：文件名格式为 对象hash.分片序号.分片hash
+// -------------------------------------------
+func scrubObject(DMongoRepair meta.Store, limiter *throttle, file string) {
+	var (
+		fileInfo    []string
+		fileHandler *os.File
+		reader      *throttleReader
+		hashSum     string
+		err         error
+	)
+
+	if fileInfo = strings.Split(filepath.Base(file), "."); len(fileInfo) != 3 {
+		return
+	}
+	// 文件在巡检过程中被删除（如移入回收站）时跳过
+	if fileHandler, err = os.Open(file); err != nil {
+		return
+	}
+	reader = &throttleReader{reader: fileHandler, limiter: limiter}
+	hashSum = utils.CalculateHash(reader)
+	fileHandler.Close()
+
+	// 读取出错时不比较hash值（磁盘故障时由磁盘离线流程上报丢失的分片）
+	if reader.err != nil {
+		disk.ReportError(file, reader.err)
+		return
+	}
+
+	statMutex.Lock()
+	stat.Shards++
+	stat.Bytes += reader.read
+	statMutex.Unlock()
+
+	if hashSum != fileInfo[2] {
+		enqueueRepair(DMongoRepair, fileInfo[0], fileInfo[1], fileInfo[2])
+	}
+}
+
+// -------------------------------------------
+// 巡检聚合对象：逐个校验引用该聚合对象的小文件分片
+// NOTE: 若数据库中聚合对象size不等于内存中的聚合对象size，说明当前有正常的上传数据流，本轮跳过该聚合对象
+// -------------------------------------------
+func scrubAggObject(DMongoRepair, DMongoAgg, DMongoShard meta.Store, limiter *throttle, file string) {
+	var (
+		aggName    string
+		aggMeta    *meta.AggregateMeta
+		refShard   string
+		objectName string
+		shardIndex int
+		shardMeta  *meta.ObjectShardMeta
+		aggObject  *meta.AggObject
+		aggPath    string
+		HashCalc   hash.Hash
+		HashSum    string
+		written    int64
+		bytes      int64
+		err        error
+	)
+
+	aggName = filepath.Base(file)
+	aggMeta, err = DMongoAgg.GetAggregateMeta(aggName)
+	if err != nil || aggMeta.RefCount == 0 {
+		return
+	}
+	if aggMeta.Size != locate.GetAggObjSize(aggName) {
+		return
+	}
+
+	for _, refShard = range aggMeta.RefBy {
+		if len(strings.Split(refShard, ".")) < 2 {
+			continue
+		}
+		objectName = strings.Split(refShard, ".")[0]
+		shardIndex, _ = strconv.Atoi(strings.Split(refShard, ".")[1])
+		shardMeta, err = DMongoShard.GetShardMetaByIndex(objectName, shardIndex)
+		if err != nil || shardMeta.Hash == "" {
+			continue
+		}
+
+		// 将分片在聚合对象中的各段数据流式拷贝至哈希计算器，读取失败（聚合对象已被删除）时跳过该分片
+		HashCalc, bytes = sha256.New(), 0
+		for _, aggObject = range shardMeta.Aggregate {
+			aggPath = locate.AggObjectPath(aggObject.Name)
+			written, err = utils.SeekCopy(aggPath, HashCalc, int64(aggObject.Offset), int64(aggObject.Size))
+			limiter.wait(written)
+			bytes += written
+			if err != nil {
+				disk.ReportError(aggPath, err)
+				break
+			}
+		}
+		if err != nil {
+			continue
+		}
+		HashSum = url.PathEscape(base64.StdEncoding.EncodeToString(HashCalc.Sum(nil)))
+
+		statMutex.Lock()
+		stat.Shards++
+		stat.Bytes += bytes
+		statMutex.Unlock()
+
+		if HashSum != shardMeta.Hash {
+			enqueueRepair(DMongoRepair, objectName, strconv.Itoa(shardIndex), shardMeta.Hash)
+		}
+	}
+}
+
+// 读取时发现损坏的分片（区间读取不修复分片）：加入待修复集合，与巡检发现的损坏分片一同计入统计
+func ReportCorrupted(objHash string, shardIndex int, shardHash string) {
+	var (
+		DMongoRepair meta.Store
+		err          error
+	)
+
+	if DMongoRepair, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.RepairObjColName)); err != nil {
+		log.Println(err)
+		return
+	}
+	enqueueRepair(DMongoRepair, objHash, strconv.Itoa(shardIndex), shardHash)
+}
+
+// 将损坏的分片加入待修复集合（已存在则不重复加入）
+func enqueueRepair(DMongoRepair meta.Store, objHash, shardIndex, shardHash string) {
+	var (
+		repairMeta *meta.RepairShard
+		err        error
+	)
+
+	statMutex.Lock()
+	stat.Corrupted++
+	stat.TotalCorrupted++
+	statMutex.Unlock()
+	log.Println("corrupted shard found:", objHash, shardIndex, shardHash)
+
+	repairMeta, err = DMongoRepair.GetRepairShardMeta(shardHash)
+	if err == nil && repairMeta.ShardHash != "" {
+		return
+	}
+	if _, err = DMongoRepair.PutRepairShardMeta(objHash, shardIndex, shardHash); err != nil {
+		log.Println(common.ErrEnqueueRepair, err)
+	}
+}
+
+// -------------------------------------------
+// 巡检进度的加载与保存：先写入临时文件再重命名，避免宕机时进度文件不完整
+// NOTE: 进度保存在第一块在线磁盘上，加载时依次尝试各在线磁盘（第一块磁盘离线后仍可从其他磁盘加载）
+// -------------------------------------------
+func loadMarker() {
+	var (
+		root    string
+		content []byte
+		err     error
+	)
+
+	for _, root = range disk.Roots() {
+		if content, err = ioutil.ReadFile(root + "/" + scrubMarkerFile); err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			log.Println(common.ErrLoadScrubMarker, err)
+		}
+	}
+	if content == nil {
+		return
+	}
+	statMutex.Lock()
+	defer statMutex.Unlock()
+	if err = json.Unmarshal(content, &stat); err != nil {
+		log.Println(common.ErrLoadScrubMarker, err)
+		stat = Stat{}
+	}
+	stat.Running = false
+}
+
+func saveMarker() {
+	var (
+		roots   = disk.Roots()
+		content []byte
+		tmpPath string
+		err     error
+	)
+
+	if len(roots) == 0 {
+		return
+	}
+	statMutex.RLock()
+	content, err = json.Marshal(stat)
+	statMutex.RUnlock()
+	if err != nil {
+		log.Println(common.ErrSaveScrubMarker, err)
+		return
+	}
+	tmpPath = roots[0] + "/" + scrubMarkerFile + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, content, 0644); err != nil {
+		log.Println(common.ErrSaveScrubMarker, err)
+		return
+	}
+	if err = os.Rename(tmpPath, roots[0]+"/"+scrubMarkerFile); err != nil {
+		log.Println(common.ErrSaveScrubMarker, err)
+	}
+}
+
+// ---------------------------------
+// 巡检限速：按照累计读取的字节数和已用时间计算须等待的时间（limit为每秒字节数，不大于0时不限速）
+// ---------------------------------
+type throttle struct {
+	limit int64
+	bytes int64
+	start time.Time
+}
+
+func newThrottle(limit int64) *throttle {
+	return &throttle{limit: limit, start: time.Now()}
+}
+
+func (t *throttle) wait(n int64) {
+	var expect time.Duration
+
+	if t.limit <= 0 {
+		return
+	}
+	t.bytes += n
+	expect = time.Duration(float64(t.bytes) / float64(t.limit) * float64(time.Second))
+	if elapsed := time.Since(t.start); expect > elapsed {
+		time.Sleep(expect - elapsed)
+	}
+}
+
+// 读取时限速的reader（用于大文件分片的hash计算，避免一次读取整个大文件造成IO突发）
+// err记录读取过程中出现的错误（io.EOF除外）
+type throttleReader struct {
+	reader  io.Reader
+	limiter *throttle
+	read    int64
+	err     error
+}
+
+func (r *throttleReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	r.read += int64(n)
+	r.limiter.wait(int64(n))
+	return
+}
@@ -7,7 +7,6 @@ import (
 	"os"
 	"strings"
 
-	"common/dataFlag"
 	"config"
 	"dataServer/locate"
 	"meta"
@@ -36,7 +35,7 @@ func del(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	infoFile = *dataFlag.StorageRoot + "/temp/" + uuid
+	infoFile = TempInfo.root() + "/temp/" + uuid
 	datFile = infoFile + ".dat"
 	os.Remove(infoFile)
 	os.Remove(datFile)
@@ -47,16 +46,20 @@ func deleteMiniFile(w http.ResponseWriter, TempInfo *tempInfo) {
 	var (
 		aggObject  *meta.AggObject
 		aggObjFile string
-		DMongo     *meta.DossMongo
+		DMongo     meta.Store
 		aggMeta    *meta.AggregateMeta
 		file       *os.File
 		err        error
 	)
 
 	// 打开每个聚合对象文件句柄，并回滚到上传之前的size
-	DMongo = meta.NewDossMongo(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName))
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName)); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 	for _, aggObject = range TempInfo.Aggregate {
-		aggObjFile = *dataFlag.StorageRoot + "/aggregate_objects/" + aggObject.Name
+		aggObjFile = locate.AggObjectPath(aggObject.Name)
 		if file, err = os.OpenFile(aggObjFile, os.O_RDWR, 0644); err != nil {
 			log.Println(common.ErrOpenFile, err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -78,6 +81,6 @@ func deleteMiniFile(w http.ResponseWriter, TempInfo *tempInfo) {
 		locate.AggObjectDelete(aggObject.Name)
 	}
 
-	os.Remove(*dataFlag.StorageRoot + "/temp/" + TempInfo.Uuid)
+	os.Remove(TempInfo.root() + "/temp/" + TempInfo.Uuid)
 	return
 }
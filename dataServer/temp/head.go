@@ -7,8 +7,6 @@ import (
 	"net/http"
 	"os"
 	"strings"
-
-	"common/dataFlag"
 )
 
 func head(w http.ResponseWriter, r *http.Request) {
@@ -21,7 +19,7 @@ func head(w http.ResponseWriter, r *http.Request) {
 	)
 	// 若访问的是小文件，则在/temp目录下找不到该.dat文件，返回404
 	uuid = strings.Split(r.URL.EscapedPath(), "/")[2]
-	path = *dataFlag.StorageRoot + "/temp/" + uuid + ".dat"
+	path = tempInfoPath(uuid) + ".dat"
 	if file, err = os.Open(path); err != nil {
 		log.Println(common.ErrOpenTempDatFile, err)
 		w.WriteHeader(http.StatusNotFound)
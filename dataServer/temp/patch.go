@@ -10,8 +10,8 @@ import (
 	"os"
 	"strings"
 
-	"common/dataFlag"
 	"config"
+	"dataServer/disk"
 	"dataServer/locate"
 	"meta"
 	"utils"
@@ -36,7 +36,7 @@ func patch(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	infoFile = *dataFlag.StorageRoot + "/temp/" + uuid
+	infoFile = TempInfo.root() + "/temp/" + uuid
 
 	// 判断文件size，若size小于聚合对象的最大长度，则进行小文件合并处理逻辑
 	if TempInfo.Size < config.GConfig.AggregateObjSize*common.MB {
@@ -53,8 +53,9 @@ func patch(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// 将request body内容流式拷贝到.dat文件中
+	// 将request body内容流式拷贝到.dat文件中（出错时上报磁盘错误，磁盘仍可写时视为网络错误）
 	if _, err = io.Copy(file, r.Body); err != nil {
+		disk.ReportError(datFile, err)
 		log.Println(common.ErrCopyBodyToFile, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -75,13 +76,31 @@ func patch(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// 根据uuid查找tempInfo文件的路径（位于POST时选择的磁盘上，找不到时返回以第一块在线磁盘为根目录的路径）
+func tempInfoPath(uuid string) (path string) {
+	var (
+		root  string
+		roots = disk.Roots()
+	)
+
+	for _, root = range roots {
+		if _, err := os.Stat(root + "/temp/" + uuid); err == nil {
+			return root + "/temp/" + uuid
+		}
+	}
+	if len(roots) > 0 {
+		path = roots[0] + "/temp/" + uuid
+	}
+	return
+}
+
 // 根据uuid文件名解析tempInfo文件
 func readFromFile(uuid string) (info *tempInfo, err error) {
 	var (
 		file      *os.File
 		fileBytes []byte
 	)
-	if file, err = os.Open(*dataFlag.StorageRoot + "/temp/" + uuid); err != nil {
+	if file, err = os.Open(tempInfoPath(uuid)); err != nil {
 		return
 	}
 	defer file.Close()
@@ -99,9 +118,6 @@ func patchMiniFile(w http.ResponseWriter, r *http.Request, TempInfo *tempInfo) {
 		err        error
 	)
 
-	// 检查aggregate_objects目录
-	_ = utils.CheckFilePath(*dataFlag.StorageRoot + "/aggregate_objects")
-
 	// 获取该分片数据占据的聚合对象信息（tempInfo信息）
 	if aggObjects = TempInfo.Aggregate; len(aggObjects) == 0 {
 		log.Println(common.ErrGetAggInfo, locate.GetAggObjectsInfo())
@@ -111,8 +127,9 @@ func patchMiniFile(w http.ResponseWriter, r *http.Request, TempInfo *tempInfo) {
 
 	// 将上传流写入聚合对象文件
 	for _, aggObject = range aggObjects {
-		path = *dataFlag.StorageRoot + "/aggregate_objects/" + aggObject.Name
+		path = locate.AggObjectPath(aggObject.Name)
 		if _, err = utils.SeekWrite(r.Body, aggObject.Size, path, aggObject.Offset); err != nil {
+			disk.ReportError(path, err)
 			log.Println(common.ErrWriteToAggObject, err)
 			w.WriteHeader(http.StatusInternalServerError)
 		}
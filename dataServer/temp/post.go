@@ -11,20 +11,21 @@ import (
 	"strings"
 	"sync"
 
-	"common/dataFlag"
 	"config"
+	"dataServer/disk"
 	"dataServer/locate"
 	"github.com/mongodb/mongo-go-driver/bson/primitive"
 	"meta"
 	"meta/funcParams"
-	"utils"
 )
 
+// Disk：临时文件所在磁盘的存储根目录（大文件分片的数据也写入该磁盘）
 type tempInfo struct {
 	Uuid      string
 	Name      string
 	Size      int64
 	Aggregate []*meta.AggObject
+	Disk      string
 }
 
 func (t *tempInfo) hash() string {
@@ -38,6 +39,18 @@ func (t *tempInfo) id() int {
 	return id
 }
 
+// 临时文件所在磁盘的存储根目录（未记录磁盘的旧tempInfo文件位于第一块在线磁盘）
+func (t *tempInfo) root() string {
+	var roots []string
+
+	if t.Disk == "" {
+		if roots = disk.Roots(); len(roots) > 0 {
+			return roots[0]
+		}
+	}
+	return t.Disk
+}
+
 func post(w http.ResponseWriter, r *http.Request) {
 	var (
 		Uuid       uuid.UUID
@@ -46,6 +59,7 @@ func post(w http.ResponseWriter, r *http.Request) {
 		size       int64
 		TempInfo   tempInfo
 		aggObjects []*meta.AggObject
+		root       string
 		err        error
 	)
 
@@ -59,17 +73,26 @@ func post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 执行小文件处理逻辑
+	// 执行小文件处理逻辑，选择临时文件所在的磁盘
+	// NOTE: 大文件分片选择可用容量最大的磁盘；小文件的数据位于聚合对象中，临时文件不占用磁盘空间
 	if size < config.GConfig.AggregateObjSize*common.MB {
 		if aggObjects, err = postMiniFile(w, name, size); err != nil {
 			log.Println("POST:", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		root, err = disk.Choose(0)
+	} else {
+		root, err = disk.Choose(size)
+	}
+	if err != nil {
+		log.Println("POST:", err)
+		w.WriteHeader(http.StatusInsufficientStorage)
+		return
 	}
 
 	// 生成TempInfo信息并写入文件
-	TempInfo = tempInfo{UuidStr, name, size, aggObjects}
+	TempInfo = tempInfo{UuidStr, name, size, aggObjects, root}
 	if err = TempInfo.writeToFile(); err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -95,21 +118,25 @@ func postMiniFile(w http.ResponseWriter, name string, size int64) (aggObjects []
 		aggAvailObj    string
 		totalAvailSize int64
 		remainSize     int64
-		DMongo         *meta.DossMongo
+		DMongo         meta.Store
 		index          int
 		objectId       primitive.ObjectID
+		root           string
 		aggObjMutex    sync.Mutex
 	)
 
 	aggObjMutex.Lock()
 	defer aggObjMutex.Unlock()
 
-	// 查看数据库中是否有记录，若存在，则说明该请求是由于纠删码修复导致，则不生成新的信息
-	DMongo = meta.NewDossMongo(funcParams.MongoParamCollection(config.GConfig.ObjShardColName))
+	// 查看数据库中是否有记录，若存在且引用的聚合对象都位于本节点，则说明该请求是由于纠删码修复导致，则不生成新的信息
+	// NOTE: 聚合对象位于其他节点时，说明该请求是由于数据迁移导致，须在本节点上重新分配空间
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.ObjShardColName)); err != nil {
+		return
+	}
 	objectName = strings.Split(name, ".")[0]
 	shardIndex, _ = strconv.Atoi(strings.Split(name, ".")[1])
 	shardMeta, err = DMongo.GetShardMetaByIndex(objectName, shardIndex)
-	if err == nil && len(shardMeta.Aggregate) > 0 {
+	if err == nil && len(shardMeta.Aggregate) > 0 && isLocalAggregates(shardMeta.Aggregate) {
 		aggObjects = shardMeta.Aggregate
 		return
 	}
@@ -123,14 +150,20 @@ func postMiniFile(w http.ResponseWriter, name string, size int64) (aggObjects []
 	}
 
 	// 若可用空间不足，则再创建一个聚合对象（将聚合对象信息写入数据库、内存中locate信息）
-	DMongo = meta.NewDossMongo(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName))
+	// NOTE: 新的聚合对象位于可用容量最大的磁盘
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName)); err != nil {
+		return
+	}
 	if len(aggObjects) == 0 || totalAvailSize < size {
+		if root, err = disk.Choose(config.GConfig.AggregateObjSize * common.MB); err != nil {
+			return
+		}
 		if objectId, err = DMongo.NewAggregateMeta(); err != nil {
 			log.Println(common.ErrNewAggMeta, err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		locate.UpdateAggObjSize(objectId.Hex(), 0)
+		locate.AggObjectAdd(objectId.Hex(), root, 0)
 		// 将新生成的聚合对象信息收集到aggObjects数组，用于写入tempInfo文件
 		aggObject = &meta.AggObject{Name: objectId.Hex(), Offset: 0}
 		aggObjects = append(aggObjects, aggObject)
@@ -159,14 +192,24 @@ func postMiniFile(w http.ResponseWriter, name string, size int64) (aggObjects []
 	return
 }
 
+// 判断聚合对象是否都位于本节点
+func isLocalAggregates(aggObjects []*meta.AggObject) bool {
+	for _, aggObject := range aggObjects {
+		if !locate.AggObjectExist(aggObject.Name) {
+			return false
+		}
+	}
+	return true
+}
+
 // 将temp信息存入文件
 func (t *tempInfo) writeToFile() (err error) {
 	var (
 		file *os.File
 		body []byte
 	)
-	_ = utils.CheckFilePath(*dataFlag.StorageRoot + "/temp")
-	if file, err = os.Create(*dataFlag.StorageRoot + "/temp/" + t.Uuid); err != nil {
+	if file, err = os.Create(t.root() + "/temp/" + t.Uuid); err != nil {
+		disk.ReportError(t.root()+"/temp/"+t.Uuid, err)
 		return
 	}
 	defer file.Close()
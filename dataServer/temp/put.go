@@ -12,8 +12,8 @@ import (
 	"os"
 	"strings"
 
-	"common/dataFlag"
 	"config"
+	"dataServer/disk"
 	"dataServer/locate"
 	"meta"
 	"meta/funcParams"
@@ -29,6 +29,10 @@ func put(w http.ResponseWriter, r *http.Request) {
 		file        *os.File
 		datFileInfo os.FileInfo
 		datFileHash string
+		shardPath   string
+		replaced    []string
+		oldPath     string
+		checksums   *utils.BlockChecksum
 		actualSize  int64
 		err         error
 	)
@@ -48,7 +52,7 @@ func put(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 打开.dat文件句柄
-	infoFile = *dataFlag.StorageRoot + "/temp/" + uuid
+	infoFile = TempInfo.root() + "/temp/" + uuid
 	datFile = infoFile + ".dat"
 	if file, err = os.Open(datFile); err != nil {
 		log.Println(common.ErrOpenTempDatFile, err)
@@ -73,13 +77,34 @@ func put(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 若通过则重命名该.dat文件为正式文件
-	datFileHash = utils.CalculateHash(file)
+	// 计算分片hash值的同时计算按块校验和（用于区间读取时的校验），先保存校验和，再重命名该.dat文件为正式文件
+	// NOTE: 校验和保存失败时不影响提交，删除原有的校验和文件（修复覆盖的分片），区间读取时改为校验整个分片
+	checksums = utils.NewBlockChecksum(config.GConfig.BlockPerShard)
+	datFileHash = utils.CalculateHash(io.TeeReader(file, checksums))
 	file.Close()
-	os.Rename(datFile, *dataFlag.StorageRoot+"/objects/"+TempInfo.Name+"."+datFileHash)
+	shardPath = TempInfo.root() + "/objects/" + TempInfo.Name + "." + datFileHash
+	if err = checksums.Save(disk.ChecksumPath(shardPath)); err != nil {
+		os.Remove(disk.ChecksumPath(shardPath))
+		disk.ReportError(shardPath, err)
+		log.Println(common.ErrSaveChecksum, err)
+	}
+	replaced = locate.ObjectFiles(TempInfo.Name)
+	if err = os.Rename(datFile, shardPath); err != nil {
+		disk.ReportError(datFile, err)
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	// 将对象信息添加到内存中的locate信息中
-	locate.ObjectAdd(TempInfo.hash(), TempInfo.id())
+	// 修复写入的分片代替本节点上原有的同一分片（位于其他磁盘或者文件名中的hash值不同）：将原有的分片及其校验和移入回收站
+	for _, oldPath = range replaced {
+		if oldPath != shardPath {
+			disk.MoveShardToGarbage(oldPath)
+		}
+	}
+
+	// 将对象信息添加到内存中的locate信息中（并记录分片所在的磁盘）
+	locate.ObjectAddOnDisk(TempInfo.hash(), TempInfo.id(), TempInfo.root())
 }
 
 // 小文件处理逻辑
@@ -90,15 +115,17 @@ func putMiniFile(w http.ResponseWriter, TempInfo *tempInfo) {
 		file           *os.File
 		hashCalculator = sha256.New()
 		shardHashSum   string
-		DMongo         *meta.DossMongo
+		DMongo         meta.Store
+		DMongo2        meta.Store
 		shardMeta      *meta.ObjectShardMeta
 		err            error
 	)
 
 	// 打开每个聚合对象文件句柄，并将数据属于该分片的数据拷贝到哈希计算器中
 	for _, aggObject = range TempInfo.Aggregate {
-		aggObjPath = *dataFlag.StorageRoot + "/aggregate_objects/" + aggObject.Name
+		aggObjPath = locate.AggObjectPath(aggObject.Name)
 		if file, err = os.OpenFile(aggObjPath, os.O_RDWR, 0644); err != nil {
+			disk.ReportError(aggObjPath, err)
 			log.Println(common.ErrOpenFile, err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -112,14 +139,27 @@ func putMiniFile(w http.ResponseWriter, TempInfo *tempInfo) {
 	shardHashSum = url.PathEscape(base64.StdEncoding.EncodeToString(hashCalculator.Sum(nil)))
 
 	// 更新信息：内存中聚合对象信息、数据库中的对象分片信息、内存中对象的分片信息
-	DMongo = meta.NewDossMongo(funcParams.MongoParamCollection(config.GConfig.ObjShardColName))
+	if DMongo, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.ObjShardColName)); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 	shardMeta, err = DMongo.GetShardMetaByIndex(TempInfo.hash(), TempInfo.id())
-	if err == nil && shardMeta.Hash != shardHashSum {
+	if err == nil && (shardMeta.Hash != shardHashSum || !sameAggregates(shardMeta.Aggregate, TempInfo.Aggregate)) {
 		for _, aggObject = range TempInfo.Aggregate {
 			if aggObject.Name != "" {
 				locate.UpdateAggObjSize(aggObject.Name, locate.GetAggObjSize(aggObject.Name)+aggObject.Size)
 			}
 		}
+		// 分片由其他节点迁移至本节点：原聚合对象的引用数减1（未被引用的聚合对象由检查任务清除），并删除原分片元数据
+		if len(shardMeta.Aggregate) > 0 && !sameAggregates(shardMeta.Aggregate, TempInfo.Aggregate) {
+			if DMongo2, err = meta.NewStore(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName)); err == nil {
+				for _, aggObject = range shardMeta.Aggregate {
+					_ = DMongo2.UpdateAggregateMeta(aggObject.Name, -1, -1, "")
+				}
+			}
+			_, _ = DMongo.DeleteShardMetaByIndex(TempInfo.hash(), TempInfo.id())
+		}
 		_, _ = DMongo.PutObjectShardMeta(
 			TempInfo.hash(), TempInfo.id(), TempInfo.Size, shardHashSum, TempInfo.Aggregate,
 		)
@@ -129,6 +169,19 @@ func putMiniFile(w http.ResponseWriter, TempInfo *tempInfo) {
 	}
 
 	// 移除临时信息文件
-	os.Remove(*dataFlag.StorageRoot + "/temp/" + TempInfo.Uuid)
+	os.Remove(TempInfo.root() + "/temp/" + TempInfo.Uuid)
 	return
 }
+
+// 判断两个分片引用的聚合对象是否相同
+func sameAggregates(a []*meta.AggObject, b []*meta.AggObject) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Offset != b[i].Offset {
+			return false
+		}
+	}
+	return true
+}
@@ -2,18 +2,15 @@ package hashRing
 
 import (
 	"common"
-	"context"
 	"errors"
 	"hash/crc32"
 	"log"
 	"sort"
 	"strconv"
 	"sync"
-	"time"
 
 	"config"
 	"github.com/mongodb/mongo-go-driver/bson/primitive"
-	"github.com/mongodb/mongo-go-driver/mongo"
 	"meta"
 	"meta/funcParams"
 	"utils"
@@ -21,8 +18,25 @@ import (
 
 var (
 	GHashRing *HashRing // HashRing结构体单例
+
+	// 哈希环变化的通知通道（缓冲已满时丢弃通知）
+	ringChanges = make(chan *RingChange, ringChangeBuffer)
+
+	// 不在哈希环上但仍可读取的数据节点（下线中）：key为节点ip，value为数据节点表中该节点的ObjectId
+	// NOTE: 这些节点不在哈希环上（不再写入新的分片），但在分片迁移完成前仍可读取其上的分片
+	offRingNodes = make(map[string]primitive.ObjectID)
+	offRingMutex sync.RWMutex
 )
 
+// 哈希环变化通知通道的缓冲大小
+const ringChangeBuffer = 1024
+
+// 哈希环的变化：Before、After分别为变化前后哈希环上的物理节点（及其权重、故障域）
+type RingChange struct {
+	Before []*meta.RingNode
+	After  []*meta.RingNode
+}
+
 // 实现sort接口
 type uintArray []uint32
 
@@ -35,6 +49,7 @@ func (x uintArray) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
 // sortedRing:    将ring map的key(虚拟cube的hash值)进行排序组成的slice
 // members:       当前加入到哈希环中的物理节点, key是物理节点标识，value为true或者false
 // weights:       当前环中物理节点的权重，key是物理节点标识, value是该节点权重值
+// domains:       当前环中物理节点所在的故障域，key是物理节点标识，value是故障域（未设置时为空字符串）
 // numberOfCubes: 每个物理节点创建的cube数（权重为1的cube值，若权重为5，则cube数为numberOfCubes * 5
 // NOTE: 标识可以是ip，也可以是ip+pid等自定义标识
 type HashRing struct {
@@ -42,6 +57,8 @@ type HashRing struct {
 	sortedRing    uintArray
 	members       map[string]bool
 	weights       map[string]int
+	domains       map[string]string
+	full          map[string]bool // 已满的节点（仍在哈希环上，不再写入新的分片）
 	objectIds     map[string]primitive.ObjectID
 	numberOfCubes int
 	sync.RWMutex
@@ -53,12 +70,53 @@ func InitHashRing() *HashRing {
 		ringMap:       make(map[uint32]string),
 		members:       make(map[string]bool),
 		weights:       make(map[string]int),
+		domains:       make(map[string]string),
+		full:          make(map[string]bool),
 		objectIds:     make(map[string]primitive.ObjectID),
 		numberOfCubes: config.GConfig.DefaultVirtualCubes,
 	}
 	return GHashRing
 }
 
+// -------------------------------------
+// 按照物理节点及其权重、故障域创建一个独立的HashRing（不影响HashRing单例）
+// NOTE: 用于按照历史的哈希环计算对象的定位节点（如数据迁移时计算分片迁移前后的位置），
+//       每个节点的cube数与HashRing单例一致
+// -------------------------------------
+func NewHashRing(nodes []*meta.RingNode) (ring *HashRing) {
+	var (
+		node   *meta.RingNode
+		weight int
+		i      int
+	)
+
+	ring = &HashRing{
+		ringMap:       make(map[uint32]string),
+		members:       make(map[string]bool),
+		weights:       make(map[string]int),
+		domains:       make(map[string]string),
+		full:          make(map[string]bool),
+		objectIds:     make(map[string]primitive.ObjectID),
+		numberOfCubes: GetHashRing().numberOfCubes,
+	}
+	for _, node = range nodes {
+		if weight = node.Weight; weight <= 0 {
+			weight = 1
+		}
+		for i = 0; i < ring.numberOfCubes*weight; i++ {
+			ring.ringMap[generateHash(generateKey(node.Ip, i))] = node.Ip
+		}
+		ring.members[node.Ip] = true
+		ring.weights[node.Ip] = weight
+		ring.domains[node.Ip] = node.Domain
+		if node.Full {
+			ring.full[node.Ip] = true
+		}
+	}
+	ring.updateSortedRing()
+	return
+}
+
 // 获取HashRing结构体（若当前没有创建HashRing结构体单例则创建该单例并返回其引用地址）
 func GetHashRing() *HashRing {
 	if GHashRing != nil {
@@ -73,65 +131,192 @@ func GetHashRing() *HashRing {
 // ----------------------------------
 func CheckHashRing() {
 	var (
-		DMongo      *meta.DossMongo
-		DMongo2     *meta.DossMongo
+		DMongo      meta.Store
 		Nodes       []*meta.DsNode
 		Node        *meta.DsNode
-		CStream     *mongo.ChangeStream
+		events      <-chan *meta.ChangeEvent
+		event       *meta.ChangeEvent
 		DNodeChange *meta.DsNode
-		empty       bool
+		before      []*meta.RingNode
 		err         error
 	)
 
-	// 创建DossMongo操作结构体（DMongo用于操作数据节点信息的表，DMongo2用于操作对象元数据的表）
-	DMongo = meta.NewDossMongo(
+	// 创建DossMongo操作结构体（用于操作数据节点信息的表）
+	if DMongo, err = meta.NewStore(
 		funcParams.MongoParamCollection(config.GConfig.NodeColName),
-	)
-	DMongo2 = meta.NewDossMongo()
+	); err != nil {
+		log.Fatal(err)
+	}
 
 	// 先获取所有的数据节点列表
 	if Nodes, err = DMongo.GetAllNodes(); err != nil {
 		log.Fatal(common.ErrGetAllNode, err)
 	}
 	for _, Node = range Nodes {
-		AddNode(Node.OId, Node.Ip, Node.Weight)
+		applyNode(Node)
 	}
 
-	// 返回*mongo.changeStream，用于监听node表的changeStream
-	if CStream, err = DMongo.Collection.Watch(context.TODO(), mongo.Pipeline{}); err != nil {
+	// 监听node表的变化事件（MongoDB的changeStream或嵌入式存储的本地通知）
+	if events, err = DMongo.Watch(); err != nil {
 		log.Fatal(common.ErrNewChangeStream, err)
 		return
 	}
-	defer CStream.Close(context.TODO())
 
-	// 持续监听数据节点表的变化
-	// TODO:若meta表不为空，则说明系统中已上传有对象，下一版本需完善数据迁移流程
-	for {
-		if CStream.Next(context.TODO()) {
-			var nodeStream meta.NodeStream
-			if err = CStream.Decode(&nodeStream); err != nil {
-				continue
+	// 持续监听数据节点表的变化，哈希环变化后通知数据迁移（见WatchChange）
+	for event = range events {
+		before = Snapshot()
+		switch event.Type {
+		case "insert", "update", "replace":
+			if DNodeChange, err = DMongo.GetNodeByOId(event.DocKey.ObjectId); err == nil && DNodeChange != nil {
+				applyNode(DNodeChange)
 			}
-			DMongo = meta.NewDossMongo(
-				funcParams.MongoParamCollection(config.GConfig.NodeColName),
-			)
-
-			switch nodeStream.Type {
-			case "insert":
-				empty, err = DMongo2.IsMetaCollectionEmpty()
-				if err == nil && empty {
-					DNodeChange, _ = DMongo.GetNodeByOId(nodeStream.DocKey.ObjectId)
-					AddNode(DNodeChange.OId, DNodeChange.Ip, DNodeChange.Weight)
-				}
-			case "delete":
-				empty, err = DMongo2.IsMetaCollectionEmpty()
-				if err == nil && empty {
-					RemoveNode(GetIpByObjectId(nodeStream.DocKey.ObjectId))
-				}
+		case "delete":
+			if node := GetIpByObjectId(event.DocKey.ObjectId); node != "" {
+				RemoveNode(node)
 			}
+			removeOffRing(event.DocKey.ObjectId)
+		}
+		notifyChange(before, Snapshot())
+	}
+	log.Println(common.ErrNewChangeStream, "node change stream closed")
+}
+
+// -------------------------------------------
+// 按照数据节点的状态维护哈希环：正常的节点加入哈希环（并更新其权重、故障域和已满标记），下线中的节点移出哈希环
+// NOTE:
+//   1) 权重变化时按照新的权重重新加入哈希环，哈希环的变化通知数据迁移，由数据迁移任务迁移受影响的分片；
+//   2) 已满的节点仍在哈希环上（读取以及已有分片的定位不变，不迁移其上的分片），只在选择写入新分片的节点时略过，
+//      见GetWriteNodes；恢复写入后由数据迁移任务将期间写入其他节点的分片迁移回该节点
+// -------------------------------------------
+func applyNode(node *meta.DsNode) {
+	var offRing = node.State == meta.NodeStateDraining
+
+	offRingMutex.Lock()
+	if offRing {
+		offRingNodes[node.Ip] = node.OId
+	} else {
+		delete(offRingNodes, node.Ip)
+	}
+	offRingMutex.Unlock()
+
+	if offRing {
+		if GetIpByObjectId(node.OId) != "" {
+			RemoveNode(node.Ip)
 		}
-		time.Sleep(time.Second * 1)
+		return
+	}
+	if GetIpByObjectId(node.OId) != "" && nodeWeight(node.Ip) != validWeight(node.Weight) {
+		RemoveNode(node.Ip)
 	}
+	if GetIpByObjectId(node.OId) == "" {
+		AddNode(node.OId, node.Ip, node.Weight)
+	}
+	setDomain(node.Ip, node.FailureDomain())
+	setFull(node.Ip, node.Full)
+}
+
+// 获取哈希环上物理节点的权重（节点不在哈希环上时返回0）
+func nodeWeight(node string) int {
+	var ring = GetHashRing()
+
+	ring.RLock()
+	defer ring.RUnlock()
+	return ring.weights[node]
+}
+
+// 哈希环上实际使用的权重（不大于0的权重视为1）
+func validWeight(weight int) int {
+	if weight <= 0 {
+		return 1
+	}
+	return weight
+}
+
+// 设置哈希环上物理节点所在的故障域
+func setDomain(node string, domain string) {
+	var ring = GetHashRing()
+
+	ring.Lock()
+	defer ring.Unlock()
+
+	if ring.members[node] {
+		ring.domains[node] = domain
+	}
+}
+
+// 设置哈希环上物理节点是否已满
+func setFull(node string, full bool) {
+	var ring = GetHashRing()
+
+	ring.Lock()
+	defer ring.Unlock()
+
+	if ring.members[node] && full {
+		ring.full[node] = true
+	} else {
+		delete(ring.full, node)
+	}
+}
+
+// 数据节点从数据节点表中删除后，不再作为仍可读取的节点
+func removeOffRing(oid primitive.ObjectID) {
+	offRingMutex.Lock()
+	defer offRingMutex.Unlock()
+
+	for ip, offRingOid := range offRingNodes {
+		if offRingOid == oid {
+			delete(offRingNodes, ip)
+		}
+	}
+}
+
+// 获取不在哈希环上但仍可读取的数据节点（下线中，分片迁移完成前其上的分片仍可读取）
+func OffRingNodes() (nodes []string) {
+	offRingMutex.RLock()
+	defer offRingMutex.RUnlock()
+
+	for node := range offRingNodes {
+		nodes = append(nodes, node)
+	}
+	return
+}
+
+// --------------------------------------
+// 获取哈希环变化的通知通道：数据节点加入或离开哈希环后，通道中会收到变化前后的哈希环
+// NOTE: 通道在进程内只有一个，应只由一个调用方（数据迁移）读取
+// --------------------------------------
+func WatchChange() <-chan *RingChange {
+	return ringChanges
+}
+
+// 哈希环有变化时发送通知（不阻塞哈希环的维护，通道已满时丢弃通知）
+func notifyChange(before []*meta.RingNode, after []*meta.RingNode) {
+	if meta.SameRing(before, after) {
+		return
+	}
+	select {
+	case ringChanges <- &RingChange{Before: before, After: after}:
+	default:
+		log.Println("drop hash ring change", before, "->", after)
+	}
+}
+
+// 获取当前哈希环的快照：哈希环上的物理节点及其权重、故障域、已满标记（按照节点标识排序）
+func Snapshot() (nodes []*meta.RingNode) {
+	var (
+		ring   = GetHashRing()
+		node   string
+		weight int
+	)
+
+	ring.RLock()
+	defer ring.RUnlock()
+
+	for node, weight = range ring.weights {
+		nodes = append(nodes, &meta.RingNode{Ip: node, Weight: weight, Domain: ring.domains[node], Full: ring.full[node]})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Ip < nodes[j].Ip })
+	return
 }
 
 // 根据objectId获取其物理节点标识
@@ -141,6 +326,10 @@ func GetIpByObjectId(oid primitive.ObjectID) (node string) {
 		oidValue primitive.ObjectID
 		ring     = GetHashRing()
 	)
+
+	ring.RLock()
+	defer ring.RUnlock()
+
 	for nodeKey, oidValue = range ring.objectIds {
 		if oidValue == oid {
 			node = nodeKey
@@ -217,7 +406,7 @@ func AddNode(oid primitive.ObjectID, node string, weight int) {
 	ring.weights[node] = weight
 	ring.objectIds[node] = oid
 
-	updateSortedRing()
+	ring.updateSortedRing()
 }
 
 // 一次性添加多个节点到哈希环上
@@ -250,7 +439,7 @@ func AddNodes(nodeWeight map[string]int, nodeOid map[string]primitive.ObjectID)
 		ring.objectIds[node] = oid
 	}
 
-	updateSortedRing()
+	ring.updateSortedRing()
 }
 
 // 从哈希环上移除该节点
@@ -271,8 +460,10 @@ func RemoveNode(node string) {
 	}
 	delete(ring.members, node)
 	delete(ring.weights, node)
+	delete(ring.domains, node)
+	delete(ring.full, node)
 	delete(ring.objectIds, node)
-	updateSortedRing()
+	ring.updateSortedRing()
 }
 
 // 获取元素名在哈希环上最接近的物理节点（顺时针）
@@ -291,68 +482,152 @@ func GetNode(name string) (node string, err error) {
 		return
 	}
 	key = generateHash(name)
-	index = search(key)
+	index = ring.search(key)
 	node = ring.ringMap[ring.sortedRing[index]]
 	return
 }
 
-// GetN方法：获取一个元素定位在N个物理节点上（顺时针查找）
-// Param: name：元素名，n：获取的物理节点数量
-// NOTE: 若找到的节点数m小于n，则返回这m个节点
-func GetNodes(name string, n int) (nodes []string, err error) {
+// GetN方法：获取一个元素按照纠删码方案ec定位的ec.AllShards()个物理节点（顺时针查找）
+// Param: name：元素名，ec：纠删码方案（决定物理节点数量以及每个故障域最多放置的节点数）
+// NOTE: 若找到的节点数m小于ec.AllShards()，则返回这m个节点
+func GetNodes(name string, ec common.ECScheme) (nodes []string, err error) {
+	nodes = GetHashRing().GetNodes(name, ec)
+	return
+}
+
+// 获取写入新分片时一个元素按照纠删码方案ec定位的物理节点（见HashRing.GetWriteNodes）
+func GetWriteNodes(name string, ec common.ECScheme) (nodes []string, err error) {
+	nodes = GetHashRing().GetWriteNodes(name, ec)
+	return
+}
+
+// -------------------------------------
+// 获取一个元素在该哈希环上按照纠删码方案ec定位的N（ec.AllShards()）个物理节点
+// （顺时针查找，用于HashRing单例以及NewHashRing创建的哈希环）
+// NOTE: 按照故障域分散放置：每个故障域先最多放置ceil(N/故障域数)个节点，故障域内的节点数不足以选满N个节点时
+//       逐步放宽限制，但每个故障域最多放置ec.ParityShards个节点（任一故障域整体失效时丢失的分片数不超过修复分片数）；
+//       故障域数量或者故障域内的节点数不足以满足该约束时返回的节点数少于N（写入失败，见ErrFailureDomains）；
+//       哈希环上只有一个故障域（未设置故障域）时不限制，与顺时针查找N个不同的节点一致
+// -------------------------------------
+func (ring *HashRing) GetNodes(name string, ec common.ECScheme) (nodes []string) {
+	ring.RLock()
+	defer ring.RUnlock()
+	return ring.getNodes(name, ec)
+}
+
+// -------------------------------------
+// 获取写入新分片时一个元素在该哈希环上按照纠删码方案ec定位的物理节点：与GetNodes相同，
+// 但定位到已满节点的分片改为写入顺时针查找的下一个未满、不重复且满足故障域约束的节点，其他分片的位置不变
+// NOTE: 没有可以代替的节点时返回nil（无法写入）；读取和数据迁移时同时接受这两种定位结果
+// -------------------------------------
+func (ring *HashRing) GetWriteNodes(name string, ec common.ECScheme) (nodes []string) {
 	var (
-		ring        = GetHashRing()
-		memberCount int
-		key         uint32
-		i           int
-		node        string
-		start       int
+		counts    = make(map[string]int)
+		start     int
+		maxDomain int
+		node      string
+		i         int
+		j         int
 	)
 
 	ring.RLock()
 	defer ring.RUnlock()
 
+	if nodes = ring.getNodes(name, ec); len(ring.full) == 0 {
+		return
+	}
+	_, maxDomain = ring.domainLimit(len(nodes), ec.ParityShards)
+	for _, node = range nodes {
+		if !ring.full[node] {
+			counts[ring.domains[node]]++
+		}
+	}
+	start = ring.search(generateHash(name))
+	for i = range nodes {
+		if !ring.full[nodes[i]] {
+			continue
+		}
+		for j = 0; j < len(ring.sortedRing) && ring.full[nodes[i]]; j++ {
+			node = ring.ringMap[ring.sortedRing[(start+j)%len(ring.sortedRing)]]
+			if ring.full[node] || utils.SliceHasMember(nodes, node) || counts[ring.domains[node]] >= maxDomain {
+				continue
+			}
+			nodes[i] = node
+			counts[ring.domains[node]]++
+		}
+		if ring.full[nodes[i]] {
+			return nil
+		}
+	}
+	return
+}
+
+// 获取一个元素在该哈希环上按照纠删码方案ec定位的物理节点（调用方持有读锁）
+func (ring *HashRing) getNodes(name string, ec common.ECScheme) (nodes []string) {
+	var (
+		n         = ec.AllShards()
+		start     int
+		perDomain int
+		maxDomain int
+	)
+
 	if len(ring.ringMap) == 0 {
 		return
 	}
 
-	memberCount = len(Members())
-	if int64(memberCount) < int64(n) {
-		n = int(memberCount)
+	if len(ring.members) < n {
+		n = len(ring.members)
 	}
 
-	// 获取第一个定位的物理节点
-	key = generateHash(name)
-	i = search(key)
-	node = ring.ringMap[ring.sortedRing[i]]
-	nodes = append(nodes, node)
-	if len(nodes) == n {
-		return
+	// 获取第一个定位的cube，从此处顺时针查找
+	start = ring.search(generateHash(name))
+	perDomain, maxDomain = ring.domainLimit(n, ec.ParityShards)
+	for ; len(nodes) < n && perDomain <= maxDomain; perDomain++ {
+		nodes = ring.walk(start, n, perDomain)
+	}
+	return
+}
+
+// 每个故障域最多放置的节点数：perDomain为将n个节点平均分散到哈希环上的所有故障域时的数量，
+// maxDomain为放宽限制时的上限（多个故障域时为修复分片数parity，只有一个故障域时为n）
+func (ring *HashRing) domainLimit(n int, parity int) (perDomain int, maxDomain int) {
+	var domains = make(map[string]bool)
+
+	for node := range ring.members {
+		domains[ring.domains[node]] = true
+	}
+	if maxDomain = n; len(domains) > 1 {
+		maxDomain = parity
+	}
+	if perDomain = (n + len(domains) - 1) / len(domains); perDomain > maxDomain {
+		perDomain = maxDomain
 	}
+	return
+}
 
-	// 顺时针获取其他物理节点
-	start = i
-	for i = start + 1; i != start; i++ {
-		if i >= len(ring.sortedRing) {
-			i = 0
-		}
-		node = ring.ringMap[ring.sortedRing[i]]
-		if !utils.SliceHasMember(nodes, node) {
-			nodes = append(nodes, node)
-		}
-		if len(nodes) == n {
-			break
+// 从第start个cube开始顺时针查找n个不同的物理节点，每个故障域最多perDomain个
+func (ring *HashRing) walk(start int, n int, perDomain int) (nodes []string) {
+	var (
+		counts = make(map[string]int)
+		node   string
+		domain string
+		i      int
+	)
+
+	for i = 0; i < len(ring.sortedRing) && len(nodes) < n; i++ {
+		node = ring.ringMap[ring.sortedRing[(start+i)%len(ring.sortedRing)]]
+		if domain = ring.domains[node]; utils.SliceHasMember(nodes, node) || counts[domain] >= perDomain {
+			continue
 		}
+		nodes = append(nodes, node)
+		counts[domain]++
 	}
 	return
 }
 
 // 顺时针查找最接近key的hash值的那个cube
-func search(key uint32) (index int) {
-	var (
-		ring        = GetHashRing()
-		compareFunc func(x int) bool
-	)
+func (ring *HashRing) search(key uint32) (index int) {
+	var compareFunc func(x int) bool
 
 	compareFunc = func(x int) bool {
 		return ring.sortedRing[x] > key
@@ -365,9 +640,8 @@ func search(key uint32) (index int) {
 }
 
 // 更新sortedRing，当哈希环发生变化时，需要更新sortedRing
-func updateSortedRing() {
+func (ring *HashRing) updateSortedRing() {
 	var (
-		ring   = GetHashRing()
 		hashes uintArray
 		hash   uint32
 	)
@@ -6,8 +6,11 @@ import (
 	"strconv"
 	"testing"
 
+	"common"
 	"config"
 	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"meta"
+	"utils"
 )
 
 func checkEqual(num, expected interface{}, t *testing.T) {
@@ -27,9 +30,9 @@ func TestHashRing_AddNode(t *testing.T) {
 	var ring *HashRing
 	ring = InitHashRing()
 	AddNode(primitive.NewObjectID(), "192.168.1.10", 1)
-	checkEqual(len(ringMap), config.GConfig.DefaultVirtualCubes, t)
-	checkEqual(len(sortedRing), config.GConfig.DefaultVirtualCubes, t)
-	if sort.IsSorted(sortedRing) == false {
+	checkEqual(len(ring.ringMap), config.GConfig.DefaultVirtualCubes, t)
+	checkEqual(len(ring.sortedRing), config.GConfig.DefaultVirtualCubes, t)
+	if sort.IsSorted(ring.sortedRing) == false {
 		t.Error("expected sorted ring to be sorted")
 	}
 	_ = InitHashRing()
@@ -44,10 +47,10 @@ func TestSetCubeNumber(t *testing.T) {
 	if err = SetCubeNumber(40); err != nil {
 		t.Error("TestSetCubeNumber err: ", err)
 	}
-	checkEqual(numberOfCubes, 40, t)
+	checkEqual(ring.numberOfCubes, 40, t)
 
 	AddNode(primitive.NewObjectID(), "192.168.1.10", 1)
-	checkEqual(len(ringMap), 40, t)
+	checkEqual(len(ring.ringMap), 40, t)
 
 	_ = InitHashRing()
 }
@@ -70,9 +73,9 @@ func TestHashRing_AddNodes(t *testing.T) {
 		ObjectIds[ip] = primitive.NewObjectID()
 	}
 	AddNodes(Nodes, ObjectIds)
-	checkEqual(len(ringMap), config.GConfig.DefaultVirtualCubes*55, t)
-	checkEqual(len(sortedRing), config.GConfig.DefaultVirtualCubes*55, t)
-	if sort.IsSorted(sortedRing) == false {
+	checkEqual(len(ring.ringMap), config.GConfig.DefaultVirtualCubes*55, t)
+	checkEqual(len(ring.sortedRing), config.GConfig.DefaultVirtualCubes*55, t)
+	if sort.IsSorted(ring.sortedRing) == false {
 		t.Errorf("expected sorted ring to be sorted")
 	}
 
@@ -90,8 +93,8 @@ func TestHashRing_RemoveNode(t *testing.T) {
 	ring = InitHashRing()
 	AddNode(primitive.NewObjectID(), "192.168.1.10", 1)
 	RemoveNode("192.168.1.10")
-	checkEqual(len(ringMap), 0, t)
-	checkEqual(len(sortedRing), 0, t)
+	checkEqual(len(ring.ringMap), 0, t)
+	checkEqual(len(ring.sortedRing), 0, t)
 
 	Nodes = make(map[string]int)
 	ObjectIds = make(map[string]primitive.ObjectID)
@@ -101,9 +104,50 @@ func TestHashRing_RemoveNode(t *testing.T) {
 		ObjectIds[ip] = primitive.NewObjectID()
 	}
 	AddNodes(Nodes, ObjectIds)
-	checkEqual(len(ringMap), 7040, t)
+	checkEqual(len(ring.ringMap), 7040, t)
 	RemoveNode("192.168.1.10")
-	checkEqual(len(ringMap), 5760, t)
+	checkEqual(len(ring.ringMap), 5760, t)
+
+	_ = InitHashRing()
+}
+
+// 测试按照数据节点表维护哈希环：权重变化时重建节点的cube，已满的节点移出哈希环但仍可读取
+func TestApplyNode(t *testing.T) {
+	var (
+		ring = InitHashRing()
+		node = &meta.DsNode{OId: primitive.NewObjectID(), Ip: "192.168.1.10", Weight: 1}
+	)
+
+	applyNode(node)
+	checkEqual(len(ring.ringMap), config.GConfig.DefaultVirtualCubes, t)
+
+	node.Weight = 3
+	applyNode(node)
+	checkEqual(len(ring.ringMap), config.GConfig.DefaultVirtualCubes*3, t)
+	checkEqual(ring.weights["192.168.1.10"], 3, t)
+
+	// 已满的节点仍在哈希环上（已有分片的定位不变），只标记为已满
+	node.Full = true
+	applyNode(node)
+	checkEqual(len(ring.ringMap), config.GConfig.DefaultVirtualCubes*3, t)
+	checkEqual(len(OffRingNodes()), 0, t)
+	if nodes := Snapshot(); len(nodes) != 1 || !nodes[0].Full {
+		t.Error("Expect full node to stay on the ring, got:", nodes)
+	}
+
+	node.Full = false
+	applyNode(node)
+	checkEqual(len(ring.ringMap), config.GConfig.DefaultVirtualCubes*3, t)
+	if nodes := Snapshot(); len(nodes) != 1 || nodes[0].Full {
+		t.Error("Expect node to be writable again, got:", nodes)
+	}
+
+	node.State = meta.NodeStateDraining
+	applyNode(node)
+	checkEqual(len(ring.ringMap), 0, t)
+	if nodes := OffRingNodes(); len(nodes) != 1 || nodes[0] != "192.168.1.10" {
+		t.Error("Expect draining node to be readable off the ring, got:", nodes)
+	}
 
 	_ = InitHashRing()
 }
@@ -213,7 +257,7 @@ func TestHashRing_GetNodes(t *testing.T) {
 	}
 	AddNodes(Nodes, ObjectIds)
 
-	nodes, err = GetNodes("hello", 3)
+	nodes, err = GetNodes("hello", common.ECScheme{DataShards: 2, ParityShards: 1})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -231,7 +275,7 @@ func TestHashRing_GetNodes(t *testing.T) {
 	}
 
 	AddNode(primitive.NewObjectID(), "192.168.1.20", 10)
-	nodes, err = GetNodes("hello", 3)
+	nodes, err = GetNodes("hello", common.ECScheme{DataShards: 2, ParityShards: 1})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -325,3 +369,134 @@ func TestHashRing_Balance(t *testing.T) {
 
 	_ = InitHashRing()
 }
+
+func TestHashRing_GetWriteNodes(t *testing.T) {
+	var (
+		ec      = common.ECScheme{DataShards: 4, ParityShards: 2}
+		nodes   []*meta.RingNode
+		ring    *HashRing
+		located []string
+		written []string
+		full    string
+		i       int
+		j       int
+	)
+
+	_ = InitHashRing()
+	for i = 0; i < 10; i++ {
+		nodes = append(nodes, &meta.RingNode{Ip: "192.168.1." + strconv.Itoa(i+1), Weight: 1})
+	}
+
+	// 没有已满的节点时与GetNodes一致
+	ring = NewHashRing(nodes)
+	if located, written = ring.GetNodes("hello", ec), ring.GetWriteNodes("hello", ec); !utils.SliceEqual(located, written) {
+		t.Fatal("expected the same nodes without full nodes, got", located, written)
+	}
+
+	// 节点已满时不改变定位结果，写入时只代替该节点上的分片
+	full = located[2]
+	for j = range nodes {
+		nodes[j].Full = nodes[j].Ip == full
+	}
+	ring = NewHashRing(nodes)
+	for i = 0; i < 100; i++ {
+		located, written = ring.GetNodes(fmt.Sprintf("key%d", i), ec), ring.GetWriteNodes(fmt.Sprintf("key%d", i), ec)
+		if len(utils.SliceRemoveReplica(written)) != 6 || utils.SliceHasMember(written, full) {
+			t.Fatal("expected 6 distinct writable nodes, got", written)
+		}
+		for j = range located {
+			if located[j] != full && written[j] != located[j] {
+				t.Fatal("expected only shards of the full node to move, got", located, written)
+			}
+		}
+	}
+	if located = NewHashRing(nodes).GetNodes("hello", ec); located[2] != full {
+		t.Error("expected full node to stay in placement, got", located)
+	}
+
+	// 没有可以代替的节点时无法写入
+	for j = range nodes[:6] {
+		nodes[j].Full = j == 0
+	}
+	ring = NewHashRing(nodes[:6])
+	for i = 0; i < 100; i++ {
+		if written = ring.GetWriteNodes(fmt.Sprintf("key%d", i), ec); written != nil {
+			t.Fatal("expected no writable nodes, got", written)
+		}
+	}
+	_ = InitHashRing()
+}
+
+func TestHashRing_GetNodesFailureDomain(t *testing.T) {
+	var (
+		ec      = common.ECScheme{DataShards: 4, ParityShards: 2}
+		nodes   []*meta.RingNode
+		ring    *HashRing
+		located []string
+		domains map[string]string
+		counts  map[string]int
+		i       int
+		j       int
+		node    string
+	)
+
+	// 3个机架，每个机架3个节点：6个分片在每个机架上最多放置2个
+	_ = InitHashRing()
+	domains = make(map[string]string)
+	for i = 0; i < 9; i++ {
+		node = "192.168.1." + strconv.Itoa(i+1)
+		domains[node] = "zone1/rack" + strconv.Itoa(i%3)
+		nodes = append(nodes, &meta.RingNode{Ip: node, Weight: i%2 + 1, Domain: domains[node]})
+	}
+	ring = NewHashRing(nodes)
+	for i = 0; i < 1000; i++ {
+		located = ring.GetNodes(fmt.Sprintf("key%d", i), ec)
+		if len(utils.SliceRemoveReplica(located)) != 6 {
+			t.Fatal("expected 6 distinct nodes, got", located)
+		}
+		counts = make(map[string]int)
+		for _, node = range located {
+			if counts[domains[node]]++; counts[domains[node]] > 2 {
+				t.Fatal("too many shards in", domains[node], located)
+			}
+		}
+	}
+
+	// 只有2个机架时4+2方案每个机架最多放置2个分片：返回的节点不足6个（无法写入），而不是放宽故障域约束
+	for j = range nodes[:6] {
+		nodes[j].Domain = "rack" + strconv.Itoa(j%2)
+		domains[nodes[j].Ip] = nodes[j].Domain
+	}
+	ring = NewHashRing(nodes[:6])
+	for i = 0; i < 100; i++ {
+		located = ring.GetNodes(fmt.Sprintf("key%d", i), ec)
+		if len(utils.SliceRemoveReplica(located)) != 4 {
+			t.Fatal("expected 4 distinct nodes, got", located)
+		}
+		counts = make(map[string]int)
+		for _, node = range located {
+			if counts[domains[node]]++; counts[domains[node]] > ec.ParityShards {
+				t.Fatal("too many shards in", domains[node], located)
+			}
+		}
+	}
+
+	// 修复分片数足够时放宽限制：3+3方案每个机架放置3个分片
+	if located = ring.GetNodes("hello", common.ECScheme{DataShards: 3, ParityShards: 3}); len(utils.SliceRemoveReplica(located)) != 6 {
+		t.Error("expected 6 distinct nodes, got", located)
+	}
+
+	// 未设置故障域时与HashRing单例的定位结果一致
+	for j = range nodes {
+		nodes[j].Domain = ""
+		AddNode(primitive.NewObjectID(), nodes[j].Ip, nodes[j].Weight)
+	}
+	ring = NewHashRing(nodes)
+	for i = 0; i < 100; i++ {
+		located, _ = GetNodes(fmt.Sprintf("key%d", i), ec)
+		if fmt.Sprint(located) != fmt.Sprint(ring.GetNodes(fmt.Sprintf("key%d", i), ec)) {
+			t.Fatal("expected the same nodes as the hash ring singleton")
+		}
+	}
+	_ = InitHashRing()
+}
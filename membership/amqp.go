@@ -0,0 +1,57 @@
+package membership
+
+import (
+	"common"
+	"config"
+	"github.com/streadway/amqp"
+	"rbmq"
+	"utils"
+)
+
+// 通过RabbitMQ发送心跳：发布到心跳交换机上（fanout类型，每个apiServer的队列都会收到）
+type amqpPublisher struct {
+	producer *rbmq.Producer
+}
+
+func newAMQPPublisher() *amqpPublisher {
+	return &amqpPublisher{producer: rbmq.NewProducer(utils.GetRabbitMqUrl())}
+}
+
+func (p *amqpPublisher) Publish(heartbeat *common.Heartbeat) error {
+	return p.producer.Publish(config.GConfig.HeartbeatExchange, heartbeat)
+}
+
+func (p *amqpPublisher) Close() {
+	p.producer.Close()
+}
+
+// 通过RabbitMQ接收心跳：每个apiServer声明自己的队列并绑定到心跳交换机
+type amqpSubscriber struct {
+	consumer *rbmq.Consumer
+	messages chan []byte
+}
+
+func newAMQPSubscriber() *amqpSubscriber {
+	var s = &amqpSubscriber{
+		consumer: rbmq.NewConsumer(utils.GetRabbitMqUrl()),
+		messages: make(chan []byte),
+	}
+
+	s.consumer.DeclareExchange(config.GConfig.HeartbeatExchange)
+	s.consumer.QueueBind(config.GConfig.HeartbeatExchange)
+	go func(deliveries <-chan amqp.Delivery) {
+		for delivery := range deliveries {
+			s.messages <- delivery.Body
+		}
+		close(s.messages)
+	}(s.consumer.Consume())
+	return s
+}
+
+func (s *amqpSubscriber) Messages() <-chan []byte {
+	return s.messages
+}
+
+func (s *amqpSubscriber) Close() {
+	s.consumer.Close()
+}
@@ -0,0 +1,161 @@
+package membership
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"common"
+	"utils"
+)
+
+// 推送心跳至单个apiServer的超时时间
+const httpPushTimeout = 2 * time.Second
+
+// 心跳消息体的最大长度
+const maxHeartbeatSize = 64 * common.KB
+
+// apiServer缓存的未处理心跳消息数量（缓存已满时拒绝推送，dataServer在下一个心跳间隔重新推送）
+const httpMessageBuffer = 1024
+
+var (
+	httpMessages chan []byte // 当前接收推送心跳的通道（没有http接收方时为nil）
+	httpMutex    sync.RWMutex
+)
+
+// -------------------------------------------
+// 通过HTTP推送心跳：dataServer并发地将心跳消息POST至每个apiServer的/heartbeat/接口
+// NOTE: 至少一个apiServer接收成功即视为发送成功，未接收成功的apiServer在之后的心跳中恢复
+// -------------------------------------------
+type httpPublisher struct {
+	servers []string
+	client  *http.Client
+}
+
+func newHTTPPublisher() (publisher *httpPublisher, err error) {
+	var servers = utils.GetHeartbeatApiServers()
+
+	if len(servers) == 0 {
+		err = common.ErrNoHeartbeatServer
+		return
+	}
+	publisher = &httpPublisher{servers: servers, client: &http.Client{Timeout: httpPushTimeout}}
+	return
+}
+
+func (p *httpPublisher) Publish(heartbeat *common.Heartbeat) (err error) {
+	var (
+		body     []byte
+		wg       sync.WaitGroup
+		errs     = make([]error, len(p.servers))
+		accepted bool
+		i        int
+	)
+
+	if body, err = json.Marshal(heartbeat); err != nil {
+		return
+	}
+	for i = range p.servers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = p.push(p.servers[i], body)
+		}(i)
+	}
+	wg.Wait()
+
+	for i = range errs {
+		if errs[i] == nil {
+			accepted = true
+		} else {
+			err = errs[i]
+		}
+	}
+	if accepted {
+		err = nil
+	}
+	return
+}
+
+// 推送心跳至一个apiServer
+func (p *httpPublisher) push(server string, body []byte) (err error) {
+	var resp *http.Response
+
+	if resp, err = p.client.Post("http://"+server+"/heartbeat/", "application/json", bytes.NewReader(body)); err != nil {
+		return
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		err = common.ErrHeartbeatRejected
+	}
+	return
+}
+
+func (p *httpPublisher) Close() {
+	p.client.CloseIdleConnections()
+}
+
+// 通过HTTP接收心跳：由Handler将dataServer推送的心跳消息转发至接收方
+type httpSubscriber struct {
+	messages chan []byte
+}
+
+func newHTTPSubscriber() *httpSubscriber {
+	var s = &httpSubscriber{messages: make(chan []byte, httpMessageBuffer)}
+
+	httpMutex.Lock()
+	httpMessages = s.messages
+	httpMutex.Unlock()
+	return s
+}
+
+func (s *httpSubscriber) Messages() <-chan []byte {
+	return s.messages
+}
+
+func (s *httpSubscriber) Close() {
+	httpMutex.Lock()
+	defer httpMutex.Unlock()
+	if httpMessages == s.messages {
+		httpMessages = nil
+	}
+	close(s.messages)
+}
+
+// -------------------------------------------
+// 接收dataServer推送的心跳：POST /heartbeat/
+// NOTE: 心跳消息由接收方解析和校验；apiServer没有http接收方（传输方式为amqp）时返回404
+// -------------------------------------------
+func Handler(w http.ResponseWriter, r *http.Request) {
+	var (
+		body []byte
+		err  error
+	)
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if body, err = ioutil.ReadAll(io.LimitReader(r.Body, maxHeartbeatSize)); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	httpMutex.RLock()
+	defer httpMutex.RUnlock()
+	if httpMessages == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	select {
+	case httpMessages <- body:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
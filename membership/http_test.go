@@ -0,0 +1,83 @@
+package membership
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"common"
+)
+
+func TestHTTPTransport(t *testing.T) {
+	var (
+		server     *httptest.Server
+		publisher  *httpPublisher
+		subscriber *httpSubscriber
+		heartbeat  common.Heartbeat
+		received   common.Heartbeat
+		body       []byte
+		resp       *http.Response
+		err        error
+	)
+
+	server = httptest.NewServer(http.HandlerFunc(Handler))
+	defer server.Close()
+	publisher = &httpPublisher{
+		servers: []string{strings.TrimPrefix(server.URL, "http://")},
+		client:  &http.Client{Timeout: httpPushTimeout},
+	}
+	defer publisher.Close()
+	heartbeat = common.Heartbeat{Version: common.HeartbeatVersion, Addr: "192.168.1.10:33000", Total: common.MB}
+
+	// 没有http接收方时拒绝推送
+	if err = publisher.Publish(&heartbeat); err != common.ErrHeartbeatRejected {
+		t.Error("expected heartbeat rejected without subscriber, got", err)
+	}
+
+	// 推送的心跳由接收方收到
+	subscriber = newHTTPSubscriber()
+	if err = publisher.Publish(&heartbeat); err != nil {
+		t.Fatal("Publish err:", err)
+	}
+	select {
+	case body = <-subscriber.Messages():
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat not received")
+	}
+	if err = json.Unmarshal(body, &received); err != nil {
+		t.Fatal("Unmarshal err:", err)
+	}
+	if received.Addr != heartbeat.Addr || received.Total != heartbeat.Total {
+		t.Errorf("received %+v, expected %+v", received, heartbeat)
+	}
+
+	// 只接受POST请求
+	if resp, err = http.Get(server.URL + "/heartbeat/"); err != nil {
+		t.Fatal("Get err:", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Error("expected status 405, got", resp.StatusCode)
+	}
+
+	// 部分apiServer不可达时仍发送成功，全部不可达时返回错误
+	publisher.servers = append(publisher.servers, "127.0.0.1:1")
+	if err = publisher.Publish(&heartbeat); err != nil {
+		t.Error("expected publish succeeded with one apiServer reachable, got", err)
+	}
+	<-subscriber.Messages()
+	publisher.servers = publisher.servers[1:]
+	if err = publisher.Publish(&heartbeat); err == nil {
+		t.Error("expected publish failed with no apiServer reachable")
+	}
+
+	// 接收方关闭后拒绝推送
+	subscriber.Close()
+	publisher.servers = []string{strings.TrimPrefix(server.URL, "http://")}
+	if err = publisher.Publish(&heartbeat); err != common.ErrHeartbeatRejected {
+		t.Error("expected heartbeat rejected after subscriber closed")
+	}
+}
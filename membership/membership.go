@@ -0,0 +1,56 @@
+package membership
+
+import (
+	"common"
+	"config"
+)
+
+// 心跳的传输方式（配置项heartbeatTransport）
+const (
+	TransportAMQP = "amqp" // 通过RabbitMQ的交换机广播给所有apiServer（默认）
+	TransportHTTP = "http" // dataServer直接向配置的apiServer列表推送，无需消息中间件
+)
+
+// ================================
+// 心跳消息的发送方（dataServer）：将心跳消息发送给所有apiServer
+// NOTE: 至少一个apiServer收到心跳时返回nil
+// ================================
+type Publisher interface {
+	Publish(heartbeat *common.Heartbeat) error
+	Close()
+}
+
+// ================================
+// 心跳消息的接收方（apiServer）：Messages返回收到的心跳消息体，由调用方解析（兼容各版本的心跳消息）
+// ================================
+type Subscriber interface {
+	Messages() <-chan []byte
+	Close()
+}
+
+// 根据配置项heartbeatTransport创建心跳消息的发送方
+func NewPublisher() (publisher Publisher, err error) {
+	switch config.GConfig.HeartbeatTransport {
+	case TransportAMQP, "":
+		publisher = newAMQPPublisher()
+	case TransportHTTP:
+		publisher, err = newHTTPPublisher()
+	default:
+		err = common.ErrHeartbeatTransport
+	}
+	return
+}
+
+// 根据配置项heartbeatTransport创建心跳消息的接收方
+// NOTE: 传输方式为http时，须将Handler注册到apiServer的/heartbeat/接口上接收dataServer推送的心跳
+func NewSubscriber() (subscriber Subscriber, err error) {
+	switch config.GConfig.HeartbeatTransport {
+	case TransportAMQP, "":
+		subscriber = newAMQPSubscriber()
+	case TransportHTTP:
+		subscriber = newHTTPSubscriber()
+	default:
+		err = common.ErrHeartbeatTransport
+	}
+	return
+}
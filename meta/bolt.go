@@ -0,0 +1,1530 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"common"
+	"config"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	bolt "go.etcd.io/bbolt"
+	"meta/funcParams"
+)
+
+// 嵌入式存储中每个集合的变化事件通道的缓冲大小（通道已满时丢弃事件）
+const boltEventBuffer = 1024
+
+// 键中各字段之间的分隔符（存储桶名、对象名、hash值中不会出现该字符）
+const boltKeySep = "\x00"
+
+// -------------------------------------------
+// 嵌入式元数据存储（bbolt）：
+// 1) 每个集合对应数据库文件中的一个bucket，文档使用gob编码，键按照各集合的查询方式构造：
+//      对象元数据：存储桶名 + 对象名 + 版本号（大端序，保证同一对象的版本按照版本号升序）；
+//      存储桶、聚合对象元数据：名称；分片上传元数据：上传id；part元数据：上传id + part编号；
+//      对象分片元数据：对象hash + 分片index；待修复对象分片、数据节点元数据：objectId；数据迁移任务：任务名；
+// 2) 写操作在一个读写事务中完成（bbolt同一时间只有一个读写事务），因此版本号的分配等操作是原子的；
+// 3) 文档变化事件（数据节点的插入、状态及标签的更新和删除，待修复对象分片的插入和删除）通过进程内的通道通知Watch的调用方
+// NOTE: 数据库文件同一时间只能被一个进程打开，多进程部署时由打开数据库文件的进程提供元数据服务，
+//       其他进程通过remoteStore访问，变化事件由元数据服务推送（见boltRemote.go）
+// -------------------------------------------
+type boltStore struct {
+	db         *bolt.DB
+	collection string
+}
+
+var (
+	boltDB      *bolt.DB
+	boltDBMutex sync.Mutex
+
+	// 各集合的变化事件通道
+	boltWatchers     = make(map[string][]chan *ChangeEvent)
+	boltWatcherMutex sync.Mutex
+)
+
+// 创建嵌入式元数据存储（数据库文件在进程内只打开一次，打开失败时返回错误，下一次调用时重新打开）
+func newBoltStore(collection string) (store *boltStore, err error) {
+	boltDBMutex.Lock()
+	defer boltDBMutex.Unlock()
+
+	if boltDB == nil {
+		if err = os.MkdirAll(filepath.Dir(config.GConfig.BoltPath), 0755); err != nil {
+			return
+		}
+		if boltDB, err = bolt.Open(config.GConfig.BoltPath, 0600, &bolt.Options{Timeout: 5 * time.Second}); err != nil {
+			boltDB = nil
+			return
+		}
+	}
+	store = &boltStore{db: boltDB, collection: collection}
+	return
+}
+
+// 关闭嵌入式存储的数据库文件
+func closeBoltDB() (err error) {
+	boltDBMutex.Lock()
+	defer boltDBMutex.Unlock()
+
+	if boltDB != nil {
+		err = boltDB.Close()
+		boltDB = nil
+	}
+	return
+}
+
+// ===========================================
+// 嵌入式存储的基础操作
+// ===========================================
+// 在只读事务中操作bucket（bucket不存在时视为空集合，不调用fn）
+func (s *boltStore) view(name string, fn func(b *bolt.Bucket) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		var b *bolt.Bucket
+
+		if b = tx.Bucket([]byte(name)); b == nil {
+			return nil
+		}
+		return fn(b)
+	})
+}
+
+// 在读写事务中操作bucket（bucket不存在时创建）
+func (s *boltStore) update(name string, fn func(b *bolt.Bucket) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var (
+			b   *bolt.Bucket
+			err error
+		)
+
+		if b, err = tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+// 编码文档并写入
+func putDoc(b *bolt.Bucket, key []byte, doc interface{}) error {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(doc); err != nil {
+		return err
+	}
+	return b.Put(key, buf.Bytes())
+}
+
+// 读取并解码文档（文档不存在时found为false）
+func getDoc(b *bolt.Bucket, key []byte, doc interface{}) (found bool, err error) {
+	var value []byte
+
+	if value = b.Get(key); value == nil {
+		return
+	}
+	return true, decodeDoc(value, doc)
+}
+
+func decodeDoc(value []byte, doc interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(value)).Decode(doc)
+}
+
+// 按照键前缀遍历文档（fn返回false时停止遍历）
+func scanPrefix(b *bolt.Bucket, prefix []byte, fn func(k, v []byte) bool) {
+	var (
+		c    = b.Cursor()
+		k, v []byte
+	)
+
+	for k, v = c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// 删除若干个键（bbolt在游标遍历过程中删除会跳过元素，故先收集键再删除）
+func deleteKeys(b *bolt.Bucket, keys [][]byte) (deleteCount int64, err error) {
+	for _, key := range keys {
+		if err = b.Delete(key); err != nil {
+			return
+		}
+		deleteCount++
+	}
+	return
+}
+
+// 整数的大端序表示（保证按照键排序时与整数顺序一致）
+func uint64Key(n int) []byte {
+	var key = make([]byte, 8)
+
+	binary.BigEndian.PutUint64(key, uint64(n))
+	return key
+}
+
+func joinKey(parts ...string) []byte {
+	return []byte(strings.Join(parts, boltKeySep))
+}
+
+// 对象元数据的键：bucket + name + version
+func objectPrefix(bucket string, name string) []byte {
+	return joinKey(bucket, name, "")
+}
+func objectKey(bucket string, name string, version int) []byte {
+	return append(objectPrefix(bucket, name), uint64Key(version)...)
+}
+
+// 对象分片元数据的键：object + index
+func shardKey(object string, index int) []byte {
+	return append(joinKey(object, ""), uint64Key(index)...)
+}
+
+// part元数据的键：uploadId + number
+func partKey(uploadId string, number int) []byte {
+	return append(joinKey(uploadId, ""), uint64Key(number)...)
+}
+
+// ===========================================
+// 对象元数据操作定义
+// ===========================================
+// -------------------------------------------
+// 上传对象元数据：在同一个读写事务中获取最新版本并写入新版本，因此无需加锁
+// NOTE: 对象元数据文档没有objectId，insertedID仅用于与DossMongo保持一致
+// -------------------------------------------
+func (s *boltStore) PutObjectMeta(bucket string, name string, size int64, hash string,
+	paramFunc ...funcParams.MetaParamFunc) (insertedID primitive.ObjectID, err error) {
+
+	var params = funcParams.NewMetaParams(paramFunc)
+
+	err = s.update(s.collection, func(b *bolt.Bucket) error {
+		var (
+			now     = time.Now().UTC()
+			created = now
+			version int
+			last    *ObjectMeta
+		)
+
+		// 获取该对象最新的版本号和创建时间（若最新版本为删除标记，则重新计算创建时间）
+		if last = lastVersionMeta(b, bucket, name); last != nil {
+			version = last.Version
+			if last.Hash != "" && !last.Created.IsZero() {
+				created = last.Created
+			}
+		}
+		return putDoc(b, objectKey(bucket, name, version+1), &ObjectMeta{
+			Bucket:   bucket,
+			Name:     name,
+			Version:  version + 1,
+			Size:     size,
+			Hash:     hash,
+			EC:       params.EC,
+			Inline:   params.Inline,
+			Data:     params.Data,
+			Created:  created,
+			Modified: now,
+		})
+	})
+	if err == nil {
+		insertedID = primitive.NewObjectID()
+	}
+	return
+}
+
+// 获取对象最新版本的元数据（不存在则返回nil）
+func lastVersionMeta(b *bolt.Bucket, bucket string, name string) (meta *ObjectMeta) {
+	scanPrefix(b, objectPrefix(bucket, name), func(k, v []byte) bool {
+		var doc = &ObjectMeta{}
+
+		if decodeDoc(v, doc) == nil {
+			meta = doc
+		}
+		return true
+	})
+	return
+}
+
+// 获取对象元数据（版本不存在时返回空的ObjectMeta，与DossMongo一致）
+func (s *boltStore) GetObjectMeta(bucket string, name string, paramFunc ...funcParams.MetaParamFunc) (
+	meta *ObjectMeta, err error) {
+
+	var version = funcParams.NewMetaParams(paramFunc).Version
+
+	if version == -1 {
+		return s.GetLastVersionMeta(bucket, name)
+	}
+	meta = &ObjectMeta{}
+	err = s.view(s.collection, func(b *bolt.Bucket) (err error) {
+		if _, err = getDoc(b, objectKey(bucket, name, version), meta); err != nil {
+			meta = &ObjectMeta{}
+		}
+		return
+	})
+	return
+}
+
+// 获取对象最新版本的元数据（不存在则返回nil）
+func (s *boltStore) GetLastVersionMeta(bucket string, name string) (meta *ObjectMeta, err error) {
+	err = s.view(s.collection, func(b *bolt.Bucket) error {
+		meta = lastVersionMeta(b, bucket, name)
+		return nil
+	})
+	return
+}
+
+// 获取对象所有版本的元数据（按照版本号升序）
+func (s *boltStore) GetAllVersionMetas(bucket string, name string) (metas []*ObjectMeta, err error) {
+	err = s.view(s.collection, func(b *bolt.Bucket) error {
+		scanPrefix(b, objectPrefix(bucket, name), func(k, v []byte) bool {
+			var meta = &ObjectMeta{}
+
+			if decodeDoc(v, meta) == nil {
+				metas = append(metas, meta)
+			}
+			return true
+		})
+		return nil
+	})
+	return
+}
+
+// -------------------------------------------
+// 按照对象名顺序遍历存储桶中的对象元数据（参数与DossMongo.listMetas一致）
+// NOTE: 键按照对象名升序、版本号升序排列，故同一对象名的版本需收集后倒序输出
+// -------------------------------------------
+func (s *boltStore) listMetas(bucket string, prefix string, marker string, limit int, latestOnly bool) (
+	metas []*ObjectMeta, err error) {
+
+	var (
+		scope     = joinKey(bucket, prefix)
+		start     = scope
+		group     []*ObjectMeta
+		lastName  string
+		nameCount int
+	)
+
+	// 同一对象名的版本收集完毕后输出
+	flush := func() {
+		if len(group) == 0 {
+			return
+		}
+		if latestOnly {
+			metas = append(metas, group[len(group)-1])
+			return
+		}
+		for i := len(group) - 1; i >= 0; i-- {
+			metas = append(metas, group[i])
+		}
+	}
+
+	// 从marker之后开始遍历（marker的所有版本的键均小于marker + "\x01"）
+	if marker >= prefix {
+		start = joinKey(bucket, marker+"\x01")
+	}
+	err = s.view(s.collection, func(b *bolt.Bucket) error {
+		var (
+			c    = b.Cursor()
+			k, v []byte
+		)
+
+		for k, v = c.Seek(start); k != nil && bytes.HasPrefix(k, scope); k, v = c.Next() {
+			var meta = &ObjectMeta{}
+
+			if decodeDoc(v, meta) != nil || meta.Name <= marker {
+				continue
+			}
+			if meta.Name != lastName {
+				flush()
+				group = nil
+				if nameCount == limit {
+					break
+				}
+				lastName = meta.Name
+				nameCount++
+			}
+			group = append(group, meta)
+		}
+		flush()
+		return nil
+	})
+	return
+}
+
+// 按照对象名顺序获取每个对象最新版本的元数据（包含删除标记）
+func (s *boltStore) ListLatestMetas(bucket string, prefix string, marker string, limit int) (
+	metas []*ObjectMeta, err error) {
+	return s.listMetas(bucket, prefix, marker, limit, true)
+}
+
+// 按照对象名顺序获取对象所有版本的元数据（同一对象的版本按照版本号倒序）
+func (s *boltStore) ListVersionMetas(bucket string, prefix string, marker string, limit int) (
+	metas []*ObjectMeta, err error) {
+	return s.listMetas(bucket, prefix, marker, limit, false)
+}
+
+// 列举存储桶中的对象，并按照delimiter汇总公共前缀
+func (s *boltStore) ListObjects(bucket, prefix, delimiter, marker string, limit int) (
+	metas []*ObjectMeta, prefixes []string, nextMarker string, truncated bool, err error) {
+	return listObjects(s, bucket, prefix, delimiter, marker, limit)
+}
+
+// 遍历所有的对象元数据
+func (s *boltStore) scanObjectMetas(fn func(meta *ObjectMeta)) error {
+	return s.view(s.collection, func(b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			var meta = &ObjectMeta{}
+
+			if decodeDoc(v, meta) == nil {
+				fn(meta)
+			}
+			return nil
+		})
+	})
+}
+
+// 按照对象hash获取最新版本的元数据（与DossMongo一致，最多返回一个元数据）
+// NOTE: 嵌入式存储没有hash索引，需遍历所有的对象元数据
+func (s *boltStore) GetAllMetasByHash(hash string) (metas []*ObjectMeta, err error) {
+	var latest *ObjectMeta
+
+	err = s.scanObjectMetas(func(meta *ObjectMeta) {
+		if meta.Hash == hash && (latest == nil || meta.Version > latest.Version) {
+			latest = meta
+		}
+	})
+	if latest != nil {
+		metas = append(metas, latest)
+	}
+	return
+}
+
+// 按照对象hash获取最新版本的元数据
+func (s *boltStore) GetMetaByHash(hash string) (meta *ObjectMeta, err error) {
+	var metas []*ObjectMeta
+
+	if metas, err = s.GetAllMetasByHash(hash); err != nil {
+		return
+	}
+	if len(metas) > 0 {
+		meta = metas[0]
+	}
+	return
+}
+
+// 获取所有的对象版本数量超过count的元数据（即版本号为count+1的元数据）
+func (s *boltStore) GetALLTooMuchVersionMeta(count int) (metas []*ObjectMeta, err error) {
+	err = s.scanObjectMetas(func(meta *ObjectMeta) {
+		if meta.Version == count+1 {
+			metas = append(metas, meta)
+		}
+	})
+	return
+}
+
+// 按照hash值升序列举hash值大于marker的对象元数据（最多limit条）
+func (s *boltStore) ListHashMetas(marker string, limit int) (metas []*ObjectMeta, err error) {
+	if err = s.scanObjectMetas(func(meta *ObjectMeta) {
+		if meta.Hash > marker {
+			metas = append(metas, meta)
+		}
+	}); err != nil {
+		return
+	}
+	sort.SliceStable(metas, func(i, j int) bool { return metas[i].Hash < metas[j].Hash })
+	if len(metas) > limit {
+		metas = metas[:limit]
+	}
+	return
+}
+
+// 删除对象元数据（不指定版本号则删除所有版本）
+func (s *boltStore) DeleteObjectMeta(bucket string, name string, paramFunc ...funcParams.MetaParamFunc) (
+	deleteCount int64, err error) {
+
+	var version = funcParams.NewMetaParams(paramFunc).Version
+
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		var keys [][]byte
+
+		if version != -1 {
+			if b.Get(objectKey(bucket, name, version)) != nil {
+				keys = append(keys, objectKey(bucket, name, version))
+			}
+		} else {
+			scanPrefix(b, objectPrefix(bucket, name), func(k, v []byte) bool {
+				keys = append(keys, append([]byte{}, k...))
+				return true
+			})
+		}
+		deleteCount, err = deleteKeys(b, keys)
+		return
+	})
+	return
+}
+
+// 查看对象元数据表是否为空
+func (s *boltStore) IsMetaCollectionEmpty() (empty bool, err error) {
+	empty = true
+	err = s.view(s.collection, func(b *bolt.Bucket) error {
+		if k, _ := b.Cursor().First(); k != nil {
+			empty = false
+		}
+		return nil
+	})
+	return
+}
+
+// 查看存储桶是否为空（存储桶中所有对象的最新版本均为删除标记时视为空）
+func (s *boltStore) IsBucketEmpty(bucket string) (empty bool, err error) {
+	return isBucketEmpty(s, bucket)
+}
+
+// 删除存储桶中所有对象的元数据（包括删除标记和历史版本）
+func (s *boltStore) DeleteBucketObjectMetas(bucket string) (deleteCount int64, err error) {
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		var keys [][]byte
+
+		scanPrefix(b, joinKey(bucket, ""), func(k, v []byte) bool {
+			keys = append(keys, append([]byte{}, k...))
+			return true
+		})
+		deleteCount, err = deleteKeys(b, keys)
+		return
+	})
+	return
+}
+
+// ===========================================
+// 存储桶元数据操作定义
+// ===========================================
+// 创建存储桶元数据（若存储桶已存在则created为false）
+func (s *boltStore) CreateBucket(name string, paramFunc ...funcParams.MetaParamFunc) (created bool, err error) {
+	var doc = &BucketMeta{Name: name, EC: funcParams.NewMetaParams(paramFunc).EC, Created: time.Now().UTC()}
+
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		if b.Get([]byte(name)) != nil {
+			return
+		}
+		if err = putDoc(b, []byte(name), doc); err == nil {
+			created = true
+		}
+		return
+	})
+	return
+}
+
+// 获取存储桶元数据（若不存在则返回的meta.Name为空字符串）
+func (s *boltStore) GetBucketMeta(name string) (meta *BucketMeta, err error) {
+	meta = &BucketMeta{}
+	err = s.view(s.collection, func(b *bolt.Bucket) (err error) {
+		_, err = getDoc(b, []byte(name), meta)
+		return
+	})
+	return
+}
+
+// 获取所有存储桶元数据（按照存储桶名升序）
+func (s *boltStore) ListBucketMetas() (metas []*BucketMeta, err error) {
+	err = s.view(s.collection, func(b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			var meta = &BucketMeta{}
+
+			if decodeDoc(v, meta) == nil {
+				metas = append(metas, meta)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// 删除存储桶元数据
+func (s *boltStore) DeleteBucketMeta(name string) (deleteCount int64, err error) {
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		if b.Get([]byte(name)) != nil {
+			deleteCount, err = deleteKeys(b, [][]byte{[]byte(name)})
+		}
+		return
+	})
+	return
+}
+
+// ===========================================
+// 分片上传元数据操作定义（part元数据位于UploadPartColName对应的bucket中）
+// ===========================================
+// 创建分片上传（返回上传id）
+func (s *boltStore) NewUpload(bucket string, name string, paramFunc ...funcParams.MetaParamFunc) (
+	uploadId string, err error) {
+
+	var doc = &UploadMeta{
+		UploadId:  primitive.NewObjectID().Hex(),
+		Bucket:    bucket,
+		Name:      name,
+		State:     UploadStateUploading,
+		EC:        funcParams.NewMetaParams(paramFunc).EC,
+		Initiated: time.Now().UTC(),
+	}
+
+	if err = s.update(s.collection, func(b *bolt.Bucket) error {
+		return putDoc(b, []byte(doc.UploadId), doc)
+	}); err == nil {
+		uploadId = doc.UploadId
+	}
+	return
+}
+
+// 获取分片上传元数据（若不存在则返回nil）
+func (s *boltStore) GetUpload(uploadId string) (upload *UploadMeta, err error) {
+	err = s.view(s.collection, func(b *bolt.Bucket) error {
+		var (
+			doc   = &UploadMeta{}
+			found bool
+			err   error
+		)
+
+		if found, err = getDoc(b, []byte(uploadId), doc); found && err == nil {
+			upload = doc
+		}
+		return err
+	})
+	return
+}
+
+// 结束分片上传：将上传状态由uploading或completing修改为state（若上传已结束或不存在则finished为false）
+func (s *boltStore) FinishUpload(uploadId string, state string) (finished bool, err error) {
+	return s.updateUpload(uploadId, func(upload *UploadMeta) bool {
+		if !upload.Unfinished() {
+			return false
+		}
+		upload.State = state
+		upload.Finished = time.Now().UTC()
+		return true
+	})
+}
+
+// 开始合并分片上传：将上传状态由uploading修改为completing，并记录合并后对象的hash值（若上传不是uploading状态或不存在则begun为false）
+func (s *boltStore) BeginCompleteUpload(uploadId string, hash string) (begun bool, err error) {
+	return s.updateUpload(uploadId, func(upload *UploadMeta) bool {
+		if upload.State != UploadStateUploading {
+			return false
+		}
+		upload.State, upload.Hash, upload.Error = UploadStateCompleting, hash, ""
+		return true
+	})
+}
+
+// 合并分片上传失败：将上传状态由completing恢复为uploading并记录失败原因
+func (s *boltStore) FailCompleteUpload(uploadId string, reason string) (failed bool, err error) {
+	return s.updateUpload(uploadId, func(upload *UploadMeta) bool {
+		if upload.State != UploadStateCompleting {
+			return false
+		}
+		upload.State, upload.Hash, upload.Error = UploadStateUploading, "", reason
+		return true
+	})
+}
+
+// 在读写事务中修改分片上传元数据（fn返回false时不修改，上传不存在时updated为false）
+func (s *boltStore) updateUpload(uploadId string, fn func(upload *UploadMeta) bool) (updated bool, err error) {
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		var (
+			upload = &UploadMeta{}
+			found  bool
+		)
+
+		if found, err = getDoc(b, []byte(uploadId), upload); !found || err != nil || !fn(upload) {
+			return
+		}
+		if err = putDoc(b, []byte(uploadId), upload); err == nil {
+			updated = true
+		}
+		return
+	})
+	return
+}
+
+// 遍历分片上传元数据，返回满足条件的上传
+func (s *boltStore) getUploadsByFilter(match func(upload *UploadMeta) bool) (uploads []*UploadMeta, err error) {
+	err = s.view(s.collection, func(b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			var upload = &UploadMeta{}
+
+			if decodeDoc(v, upload) == nil && match(upload) {
+				uploads = append(uploads, upload)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// 获取创建时间早于before且仍未结束（上传中或者合并中）的分片上传
+func (s *boltStore) GetExpiredUploads(before time.Time) (uploads []*UploadMeta, err error) {
+	return s.getUploadsByFilter(func(upload *UploadMeta) bool {
+		return upload.Unfinished() && upload.Initiated.Before(before)
+	})
+}
+
+// 获取所有已结束（完成或取消）的分片上传
+func (s *boltStore) GetFinishedUploads() (uploads []*UploadMeta, err error) {
+	return s.getUploadsByFilter(func(upload *UploadMeta) bool {
+		return !upload.Unfinished()
+	})
+}
+
+// 删除分片上传元数据及其所有part元数据
+func (s *boltStore) DeleteUpload(uploadId string) (err error) {
+	if err = s.update(config.GConfig.UploadPartColName, func(b *bolt.Bucket) (err error) {
+		var keys [][]byte
+
+		scanPrefix(b, joinKey(uploadId, ""), func(k, v []byte) bool {
+			keys = append(keys, append([]byte{}, k...))
+			return true
+		})
+		_, err = deleteKeys(b, keys)
+		return
+	}); err != nil {
+		return
+	}
+	return s.update(s.collection, func(b *bolt.Bucket) error {
+		return b.Delete([]byte(uploadId))
+	})
+}
+
+// 添加part元数据（同一part重复上传时覆盖之前的记录）
+func (s *boltStore) PutUploadPart(uploadId string, number int, size int64, hash string,
+	paramFunc ...funcParams.MetaParamFunc) (err error) {
+
+	return s.update(config.GConfig.UploadPartColName, func(b *bolt.Bucket) error {
+		return putDoc(b, partKey(uploadId, number), &UploadPartMeta{
+			UploadId: uploadId,
+			Number:   number,
+			Size:     size,
+			Hash:     hash,
+			EC:       funcParams.NewMetaParams(paramFunc).EC,
+			Modified: time.Now().UTC(),
+		})
+	})
+}
+
+// 获取分片上传的所有part元数据（按照part编号升序）
+func (s *boltStore) GetUploadParts(uploadId string) (parts []*UploadPartMeta, err error) {
+	err = s.view(config.GConfig.UploadPartColName, func(b *bolt.Bucket) error {
+		scanPrefix(b, joinKey(uploadId, ""), func(k, v []byte) bool {
+			var part = &UploadPartMeta{}
+
+			if decodeDoc(v, part) == nil {
+				parts = append(parts, part)
+			}
+			return true
+		})
+		return nil
+	})
+	return
+}
+
+// 获取引用了该hash值的所有part元数据（按照part编号升序）
+func (s *boltStore) GetUploadPartsByHash(hash string) (parts []*UploadPartMeta, err error) {
+	err = s.view(config.GConfig.UploadPartColName, func(b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			var part = &UploadPartMeta{}
+
+			if decodeDoc(v, part) == nil && part.Hash == hash {
+				parts = append(parts, part)
+			}
+			return nil
+		})
+	})
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	return
+}
+
+// ===========================================
+// 聚合对象元数据操作定义
+// ===========================================
+// 生成新的聚合对象元数据
+func (s *boltStore) NewAggregateMeta() (insertedID primitive.ObjectID, err error) {
+	var objectId = primitive.NewObjectID()
+
+	if err = s.update(s.collection, func(b *bolt.Bucket) error {
+		return putDoc(b, []byte(objectId.Hex()), &AggregateMeta{
+			ObjectId: objectId,
+			Name:     objectId.Hex(),
+			RefBy:    []string{},
+		})
+	}); err == nil {
+		insertedID = objectId
+	}
+	return
+}
+
+// 获取聚合对象元数据（不存在时返回空的AggregateMeta）
+func (s *boltStore) GetAggregateMeta(name string) (meta *AggregateMeta, err error) {
+	meta = &AggregateMeta{}
+	err = s.view(s.collection, func(b *bolt.Bucket) (err error) {
+		_, err = getDoc(b, []byte(name), meta)
+		return
+	})
+	return
+}
+
+// 更新聚合对象元数据（参数含义与DossMongo一致，读取和更新在同一个读写事务中完成，若文档不存在则不更新）
+func (s *boltStore) UpdateAggregateMeta(name string, size int64, RefCount int, RefBy string) (err error) {
+	return s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		var (
+			meta  = &AggregateMeta{}
+			set   AggregateSet
+			found bool
+		)
+
+		if found, err = getDoc(b, []byte(name), meta); !found || err != nil {
+			return
+		}
+		set = newAggregateSet(meta, size, RefCount, RefBy)
+		meta.Size, meta.RefCount, meta.RefBy = set.Size, set.RefCount, set.RefBy
+		return putDoc(b, []byte(name), meta)
+	})
+}
+
+// 删除聚合对象元数据
+func (s *boltStore) DeleteAggregateMeta(name string) (deleteCount int64, err error) {
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		if b.Get([]byte(name)) != nil {
+			deleteCount, err = deleteKeys(b, [][]byte{[]byte(name)})
+		}
+		return
+	})
+	return
+}
+
+// 删除未被引用的聚合对象元数据（并将该聚合对象的集合收集在names切片中返回）
+func (s *boltStore) DeleteUnRefAggregates() (names []string, err error) {
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		var keys [][]byte
+
+		if err = b.ForEach(func(k, v []byte) error {
+			var meta = &AggregateMeta{}
+
+			if decodeDoc(v, meta) == nil && meta.RefCount == 0 && len(meta.RefBy) > 0 {
+				names = append(names, meta.Name)
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		}); err != nil {
+			return
+		}
+		_, err = deleteKeys(b, keys)
+		return
+	})
+	return
+}
+
+// ===========================================
+// 对象分片元数据操作定义
+// ===========================================
+// 插入新的对象分片元数据（同一对象的同一分片只保留最后一次写入的元数据）
+func (s *boltStore) PutObjectShardMeta(object string, index int, size int64, hash string, aggObjects []*AggObject) (
+	insertedID primitive.ObjectID, err error) {
+
+	if err = s.update(s.collection, func(b *bolt.Bucket) error {
+		return putDoc(b, shardKey(object, index), &ObjectShardMeta{
+			Object:    object,
+			Index:     index,
+			Size:      size,
+			Hash:      hash,
+			Aggregate: aggObjects,
+		})
+	}); err == nil {
+		insertedID = primitive.NewObjectID()
+	}
+	return
+}
+
+// 获取对象分片元数据（按照对象名、分片id，不存在时返回空的ObjectShardMeta）
+func (s *boltStore) GetShardMetaByIndex(object string, index int) (meta *ObjectShardMeta, err error) {
+	meta = &ObjectShardMeta{}
+	err = s.view(s.collection, func(b *bolt.Bucket) (err error) {
+		_, err = getDoc(b, shardKey(object, index), meta)
+		return
+	})
+	return
+}
+
+// 遍历键前缀为prefix的对象分片元数据，返回满足条件的分片及其键
+func shardsByFilter(b *bolt.Bucket, prefix []byte, match func(meta *ObjectShardMeta) bool) (
+	metas []*ObjectShardMeta, keys [][]byte) {
+
+	scanPrefix(b, prefix, func(k, v []byte) bool {
+		var meta = &ObjectShardMeta{}
+
+		if decodeDoc(v, meta) == nil && match(meta) {
+			metas = append(metas, meta)
+			keys = append(keys, append([]byte{}, k...))
+		}
+		return true
+	})
+	return
+}
+
+// 获取对象分片元数据（按照分片hash值）
+func (s *boltStore) GetShardMetaByHash(hash string) (metas []*ObjectShardMeta, err error) {
+	err = s.view(s.collection, func(b *bolt.Bucket) error {
+		metas, _ = shardsByFilter(b, nil, func(meta *ObjectShardMeta) bool {
+			return meta.Hash == hash
+		})
+		return nil
+	})
+	return
+}
+
+// 获取对象的所有分片元数据（按照对象hash值）
+func (s *boltStore) GetShardMetasByObject(object string) (metas []*ObjectShardMeta, err error) {
+	err = s.view(s.collection, func(b *bolt.Bucket) error {
+		metas, _ = shardsByFilter(b, joinKey(object, ""), func(meta *ObjectShardMeta) bool {
+			return true
+		})
+		return nil
+	})
+	return
+}
+
+// 删除对象所有的分片元数据（将所有分片hash标记为空字符串）
+func (s *boltStore) DeleteShardMetaByObjHash(objHash string) (count int64, err error) {
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		var metas []*ObjectShardMeta
+
+		metas, _ = shardsByFilter(b, joinKey(objHash, ""), func(meta *ObjectShardMeta) bool {
+			return meta.Hash != ""
+		})
+		for _, meta := range metas {
+			meta.Hash = ""
+			if err = putDoc(b, shardKey(meta.Object, meta.Index), meta); err != nil {
+				return
+			}
+			count++
+		}
+		return
+	})
+	return
+}
+
+// 删除对象分片元数据（按照分片hash值，只删除一个）
+func (s *boltStore) DeleteShardMeta(hash string) (deleteCount int64, err error) {
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		var keys [][]byte
+
+		if _, keys = shardsByFilter(b, nil, func(meta *ObjectShardMeta) bool {
+			return meta.Hash == hash
+		}); len(keys) > 0 {
+			deleteCount, err = deleteKeys(b, keys[:1])
+		}
+		return
+	})
+	return
+}
+
+// 删除对象分片元数据（按照对象名、分片id）
+func (s *boltStore) DeleteShardMetaByIndex(object string, index int) (deleteCount int64, err error) {
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		if b.Get(shardKey(object, index)) != nil {
+			deleteCount, err = deleteKeys(b, [][]byte{shardKey(object, index)})
+		}
+		return
+	})
+	return
+}
+
+// 更新分片所在的聚合对象（分片hash值和所在的聚合对象仍为oldAggs时才更新，读取和更新在同一个读写事务中完成）
+func (s *boltStore) SwapShardAggregate(object string, index int, hash string, oldAggs []*AggObject,
+	newAggs []*AggObject) (swapped bool, err error) {
+
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		var (
+			meta  = &ObjectShardMeta{}
+			found bool
+		)
+
+		if found, err = getDoc(b, shardKey(object, index), meta); !found || err != nil {
+			return
+		}
+		if meta.Hash != hash || !equalAggObjects(meta.Aggregate, oldAggs) {
+			return
+		}
+		meta.Aggregate = newAggs
+		if err = putDoc(b, shardKey(object, index), meta); err == nil {
+			swapped = true
+		}
+		return
+	})
+	return
+}
+
+// 判断两组聚合对象片段是否相同
+func equalAggObjects(a []*AggObject, b []*AggObject) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if *a[i] != *b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ===========================================
+// 待修复对象分片元数据操作定义（键为objectId的十六进制表示）
+// ===========================================
+// 上传待修复对象分片元数据（并通知Watch的调用方）
+func (s *boltStore) PutRepairShardMeta(objHash string, shardIndex string, shardHash string) (
+	insertedID primitive.ObjectID, err error) {
+
+	return s.putRepairDoc(&RepairShard{
+		ObjHash:    objHash,
+		ShardIndex: shardIndex,
+		ShardHash:  shardHash,
+	})
+}
+
+// 上传丢失分片的修复任务（并通知Watch的调用方）
+func (s *boltStore) PutLostShardMeta(objHash string, lostShards []int) (insertedID primitive.ObjectID, err error) {
+	return s.putRepairDoc(newLostShardMeta(objHash, lostShards))
+}
+
+func (s *boltStore) putRepairDoc(doc *RepairShard) (insertedID primitive.ObjectID, err error) {
+	var objectId = primitive.NewObjectID()
+
+	if err = s.update(s.collection, func(b *bolt.Bucket) error {
+		return putDoc(b, []byte(objectId.Hex()), doc)
+	}); err != nil {
+		return
+	}
+	insertedID = objectId
+	s.notify("insert", objectId)
+	return
+}
+
+// 遍历待修复对象分片元数据，返回满足条件的分片及其键
+func repairsByFilter(b *bolt.Bucket, match func(meta *RepairShard) bool) (metas []*RepairShard, keys [][]byte) {
+	scanPrefix(b, nil, func(k, v []byte) bool {
+		var meta = &RepairShard{}
+
+		if decodeDoc(v, meta) == nil && match(meta) {
+			metas = append(metas, meta)
+			keys = append(keys, append([]byte{}, k...))
+		}
+		return true
+	})
+	return
+}
+
+// 获取待修复对象分片元数据（不存在时返回空的RepairShard）
+func (s *boltStore) GetRepairShardMeta(shardHash string) (shardMeta *RepairShard, err error) {
+	shardMeta = &RepairShard{}
+	err = s.view(s.collection, func(b *bolt.Bucket) error {
+		if metas, _ := repairsByFilter(b, func(meta *RepairShard) bool {
+			return meta.ShardHash == shardHash
+		}); len(metas) > 0 {
+			shardMeta = metas[0]
+		}
+		return nil
+	})
+	return
+}
+func (s *boltStore) GetRepairShardMetaByOId(oid primitive.ObjectID) (shardMeta *RepairShard, err error) {
+	shardMeta = &RepairShard{}
+	err = s.view(s.collection, func(b *bolt.Bucket) (err error) {
+		_, err = getDoc(b, []byte(oid.Hex()), shardMeta)
+		return
+	})
+	return
+}
+func (s *boltStore) GetRepairShardMetaByLocker(locker string) (metas []*RepairShard, err error) {
+	err = s.view(s.collection, func(b *bolt.Bucket) error {
+		metas, _ = repairsByFilter(b, func(meta *RepairShard) bool {
+			return meta.Locker == locker
+		})
+		return nil
+	})
+	return
+}
+
+// 获取修复租约未被加锁或者已过期的待修复对象分片元数据
+func (s *boltStore) GetExpiredRepairShardMetas() (metas []*RepairShard, err error) {
+	var now = time.Now().UTC()
+
+	err = s.view(s.collection, func(b *bolt.Bucket) error {
+		metas, _ = repairsByFilter(b, func(meta *RepairShard) bool {
+			return meta.Lockable("", now)
+		})
+		return nil
+	})
+	return
+}
+
+// 获取待修复对象分片的修复租约（未被加锁、已被自己加锁或者租约已过期时才能加锁成功，只更新第一个匹配的文档）
+func (s *boltStore) LockRepairShardMeta(shardHash string, locker string, expire time.Duration) (
+	locked bool, err error) {
+
+	err = s.update(s.collection, func(b *bolt.Bucket) error {
+		var (
+			now   = time.Now().UTC()
+			metas []*RepairShard
+			keys  [][]byte
+		)
+
+		if metas, keys = repairsByFilter(b, func(meta *RepairShard) bool {
+			return meta.ShardHash == shardHash && meta.Lockable(locker, now)
+		}); len(metas) == 0 {
+			return nil
+		}
+		metas[0].Locker = locker
+		metas[0].LockExpire = now.Add(expire)
+		locked = true
+		return putDoc(b, keys[0], metas[0])
+	})
+	return
+}
+
+// 续期修复租约（只有租约仍由locker持有时才能续期成功）
+func (s *boltStore) RenewRepairShardLock(shardHash string, locker string, expire time.Duration) (
+	renewed bool, err error) {
+
+	err = s.update(s.collection, func(b *bolt.Bucket) error {
+		var (
+			metas []*RepairShard
+			keys  [][]byte
+		)
+
+		if metas, keys = repairsByFilter(b, func(meta *RepairShard) bool {
+			return meta.ShardHash == shardHash && meta.Locker == locker
+		}); len(metas) == 0 {
+			return nil
+		}
+		metas[0].LockExpire = time.Now().UTC().Add(expire)
+		renewed = true
+		return putDoc(b, keys[0], metas[0])
+	})
+	return
+}
+
+// 删除待修复对象分片元数据（并通知Watch的调用方）
+func (s *boltStore) DeleteRepairObjectMeta(shardHash string) (deleteCount int64, err error) {
+	var keys [][]byte
+
+	if err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		_, keys = repairsByFilter(b, func(meta *RepairShard) bool {
+			return meta.ShardHash == shardHash
+		})
+		deleteCount, err = deleteKeys(b, keys)
+		return
+	}); err != nil {
+		return
+	}
+	s.notifyKeys("delete", keys)
+	return
+}
+
+// ===========================================
+// 数据节点元数据操作定义（键为objectId的十六进制表示）
+// ===========================================
+// 添加Ds节点（若该ip的节点已存在，则直接返回）
+func (s *boltStore) AddDsNode(ip string, weight int) (insertedID primitive.ObjectID, err error) {
+	var (
+		doc      = &DsNode{OId: primitive.NewObjectID(), Ip: ip, Weight: weight, State: NodeStateActive}
+		inserted bool
+	)
+
+	if err = s.update(s.collection, func(b *bolt.Bucket) error {
+		if nodeByIp(b, ip) != nil {
+			return nil
+		}
+		inserted = true
+		return putDoc(b, []byte(doc.OId.Hex()), doc)
+	}); err != nil || !inserted {
+		return
+	}
+	insertedID = doc.OId
+	s.notify("insert", doc.OId)
+	return
+}
+
+// 根据ip查找Ds节点（不存在则返回nil）
+func nodeByIp(b *bolt.Bucket, ip string) (node *DsNode) {
+	scanPrefix(b, nil, func(k, v []byte) bool {
+		var doc = &DsNode{}
+
+		if decodeDoc(v, doc) == nil && doc.Ip == ip {
+			node = doc
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// 获取所有的Ds节点
+func (s *boltStore) GetAllNodes() (nodes []*DsNode, err error) {
+	err = s.view(s.collection, func(b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			var node = &DsNode{}
+
+			if decodeDoc(v, node) == nil {
+				nodes = append(nodes, node)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// 根据objectID查找Ds节点（不存在则返回ErrNodeNotFound）
+func (s *boltStore) GetNodeByOId(oid primitive.ObjectID) (node *DsNode, err error) {
+	if err = s.view(s.collection, func(b *bolt.Bucket) error {
+		var (
+			doc   = &DsNode{}
+			found bool
+			err   error
+		)
+
+		if found, err = getDoc(b, []byte(oid.Hex()), doc); found && err == nil {
+			node = doc
+		}
+		return err
+	}); err == nil && node == nil {
+		err = common.ErrNodeNotFound
+	}
+	return
+}
+
+// 根据ip查找Ds节点（不存在则返回ErrNodeNotFound）
+func (s *boltStore) GetNodeByIp(ip string) (node *DsNode, err error) {
+	if err = s.view(s.collection, func(b *bolt.Bucket) error {
+		node = nodeByIp(b, ip)
+		return nil
+	}); err == nil && node == nil {
+		err = common.ErrNodeNotFound
+	}
+	return
+}
+
+// 设置Ds节点的状态（节点不存在时matched为false，状态变化时通知Watch的调用方）
+func (s *boltStore) SetDsNodeState(ip string, state string) (matched bool, err error) {
+	var (
+		node    *DsNode
+		changed bool
+	)
+
+	if err = s.update(s.collection, func(b *bolt.Bucket) error {
+		if node = nodeByIp(b, ip); node == nil {
+			return nil
+		}
+		matched = true
+		if changed = node.State != state; !changed {
+			return nil
+		}
+		node.State = state
+		return putDoc(b, []byte(node.OId.Hex()), node)
+	}); err != nil || !changed {
+		return
+	}
+	s.notify("update", node.OId)
+	return
+}
+
+// 设置Ds节点所在的可用区和机架（节点不存在时matched为false，标签变化时通知Watch的调用方）
+func (s *boltStore) SetDsNodeDomain(ip string, zone string, rack string) (matched bool, err error) {
+	var (
+		node    *DsNode
+		changed bool
+	)
+
+	if err = s.update(s.collection, func(b *bolt.Bucket) error {
+		if node = nodeByIp(b, ip); node == nil {
+			return nil
+		}
+		matched = true
+		if changed = node.Zone != zone || node.Rack != rack; !changed {
+			return nil
+		}
+		node.Zone, node.Rack = zone, rack
+		return putDoc(b, []byte(node.OId.Hex()), node)
+	}); err != nil || !changed {
+		return
+	}
+	s.notify("update", node.OId)
+	return
+}
+
+// 设置Ds节点的权重以及权重是否固定（节点不存在时matched为false，变化时通知Watch的调用方）
+func (s *boltStore) SetDsNodeWeight(ip string, weight int, fixed bool) (matched bool, err error) {
+	var (
+		node    *DsNode
+		changed bool
+	)
+
+	if err = s.update(s.collection, func(b *bolt.Bucket) error {
+		if node = nodeByIp(b, ip); node == nil {
+			return nil
+		}
+		matched = true
+		if changed = node.Weight != weight || node.FixedWeight != fixed; !changed {
+			return nil
+		}
+		node.Weight, node.FixedWeight = weight, fixed
+		return putDoc(b, []byte(node.OId.Hex()), node)
+	}); err != nil || !changed {
+		return
+	}
+	s.notify("update", node.OId)
+	return
+}
+
+// 设置Ds节点是否已满（节点不存在时matched为false，变化时通知Watch的调用方）
+func (s *boltStore) SetDsNodeFull(ip string, full bool) (matched bool, err error) {
+	var (
+		node    *DsNode
+		changed bool
+	)
+
+	if err = s.update(s.collection, func(b *bolt.Bucket) error {
+		if node = nodeByIp(b, ip); node == nil {
+			return nil
+		}
+		matched = true
+		if changed = node.Full != full; !changed {
+			return nil
+		}
+		node.Full = full
+		return putDoc(b, []byte(node.OId.Hex()), node)
+	}); err != nil || !changed {
+		return
+	}
+	s.notify("update", node.OId)
+	return
+}
+
+// 删除Ds节点（并通知Watch的调用方）
+func (s *boltStore) DeleteDsNodeByIp(ip string) (deleteCount int64, err error) {
+	var node *DsNode
+
+	if err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		if node = nodeByIp(b, ip); node != nil {
+			deleteCount, err = deleteKeys(b, [][]byte{[]byte(node.OId.Hex())})
+		}
+		return
+	}); err != nil || node == nil {
+		return
+	}
+	s.notify("delete", node.OId)
+	return
+}
+
+// ===========================================
+// 数据迁移任务元数据操作定义（键为任务名）
+// ===========================================
+// 获取数据迁移任务（不存在则返回nil）
+func (s *boltStore) GetRebalanceJob() (job *RebalanceJob, err error) {
+	err = s.view(s.collection, func(b *bolt.Bucket) (err error) {
+		job, err = rebalanceJob(b)
+		return
+	})
+	return
+}
+
+// 读取数据迁移任务（不存在则返回nil）
+func rebalanceJob(b *bolt.Bucket) (job *RebalanceJob, err error) {
+	var (
+		doc   = &RebalanceJob{}
+		found bool
+	)
+
+	if found, err = getDoc(b, []byte(RebalanceJobName), doc); found && err == nil {
+		job = doc
+	}
+	return
+}
+
+// 哈希环由before变为after时创建（或更新）数据迁移任务，返回当前的迁移任务
+func (s *boltStore) StartRebalanceJob(before []*RingNode, after []*RingNode) (job *RebalanceJob, err error) {
+	return s.applyRebalanceJob(func(current *RebalanceJob) *RebalanceJob {
+		return nextRebalanceJob(current, before, after, time.Now().UTC())
+	})
+}
+
+// 重新执行有失败对象的已完成迁移任务，返回当前的迁移任务
+func (s *boltStore) RetryRebalanceJob() (job *RebalanceJob, err error) {
+	return s.applyRebalanceJob(func(current *RebalanceJob) *RebalanceJob {
+		return retryRebalanceJob(current, time.Now().UTC())
+	})
+}
+
+// 在同一个事务中读取迁移任务，并替换为next计算出的任务（next返回nil时不修改）
+func (s *boltStore) applyRebalanceJob(next func(current *RebalanceJob) *RebalanceJob) (job *RebalanceJob, err error) {
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		var nextJob *RebalanceJob
+
+		if job, err = rebalanceJob(b); err != nil {
+			return
+		}
+		if nextJob = next(job); nextJob == nil {
+			return
+		}
+		job = nextJob
+		return putDoc(b, []byte(RebalanceJobName), job)
+	})
+	return
+}
+
+// 对迁移中的任务加锁（任务未被加锁、已被自己加锁或者锁已过期时才能加锁成功，否则返回nil）
+func (s *boltStore) LockRebalanceJob(locker string, expire time.Duration) (job *RebalanceJob, err error) {
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		var now = time.Now().UTC()
+
+		if job, err = rebalanceJob(b); err != nil || job == nil {
+			return
+		}
+		if job.State != RebalanceStateRunning ||
+			(job.Locker != "" && job.Locker != locker && !job.LockExpire.Before(now)) {
+			job = nil
+			return
+		}
+		job.Locker = locker
+		job.LockExpire = now.Add(expire)
+		return putDoc(b, []byte(RebalanceJobName), job)
+	})
+	return
+}
+
+// 保存迁移任务的进度（只有任务代数未变化且仍由job.Locker加锁时才能保存成功）
+func (s *boltStore) UpdateRebalanceJob(job *RebalanceJob) (updated bool, err error) {
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		var current *RebalanceJob
+
+		if current, err = rebalanceJob(b); err != nil || current == nil {
+			return
+		}
+		if current.Generation != job.Generation || current.Locker != job.Locker {
+			return
+		}
+		updated = true
+		return putDoc(b, []byte(RebalanceJobName), job)
+	})
+	return
+}
+
+// ===========================================
+// 丢失分片检测任务元数据操作定义（键为任务名）
+// ===========================================
+// 对检测任务加锁（任务不存在时创建），任务未被加锁、已被自己加锁或者锁已过期时才能加锁成功，否则返回nil
+func (s *boltStore) LockScanJob(name string, locker string, expire time.Duration) (job *ScanJob, err error) {
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		var (
+			now   = time.Now().UTC()
+			doc   = &ScanJob{}
+			found bool
+		)
+
+		if found, err = getDoc(b, []byte(name), doc); err != nil {
+			return
+		}
+		if !found {
+			doc = newScanJob(name, now)
+		}
+		if !doc.Lockable(locker, now) {
+			return
+		}
+		doc.Locker = locker
+		doc.LockExpire = now.Add(expire)
+		job = doc
+		return putDoc(b, []byte(name), job)
+	})
+	return
+}
+
+// 保存检测任务的进度（只有仍由job.Locker加锁时才能保存成功）
+func (s *boltStore) UpdateScanJob(job *ScanJob) (updated bool, err error) {
+	err = s.update(s.collection, func(b *bolt.Bucket) (err error) {
+		var (
+			current = &ScanJob{}
+			found   bool
+		)
+
+		if found, err = getDoc(b, []byte(job.Name), current); err != nil || !found {
+			return
+		}
+		if current.Locker != job.Locker {
+			return
+		}
+		updated = true
+		return putDoc(b, []byte(job.Name), job)
+	})
+	return
+}
+
+// ===========================================
+// 集合操作定义
+// ===========================================
+// -------------------------------------------
+// 监听集合中文档的插入、更新和删除：返回进程内的事件通道
+// NOTE: 只能收到本进程内的变化事件，事件的发送不阻塞写操作，调用方处理不及时导致通道已满时丢弃事件
+// -------------------------------------------
+func (s *boltStore) Watch() (events <-chan *ChangeEvent, err error) {
+	var eventCh = make(chan *ChangeEvent, boltEventBuffer)
+
+	boltWatcherMutex.Lock()
+	defer boltWatcherMutex.Unlock()
+	boltWatchers[s.collection] = append(boltWatchers[s.collection], eventCh)
+	events = eventCh
+	return
+}
+
+// 停止监听：移除Watch返回的事件通道（用于元数据服务中其他进程的监听连接断开时）
+func (s *boltStore) unwatch(events <-chan *ChangeEvent) {
+	boltWatcherMutex.Lock()
+	defer boltWatcherMutex.Unlock()
+
+	for i, eventCh := range boltWatchers[s.collection] {
+		if (<-chan *ChangeEvent)(eventCh) == events {
+			boltWatchers[s.collection] = append(boltWatchers[s.collection][:i], boltWatchers[s.collection][i+1:]...)
+			return
+		}
+	}
+}
+
+// 向集合的所有监听者发送变化事件
+func (s *boltStore) notify(eventType string, oid primitive.ObjectID) {
+	boltWatcherMutex.Lock()
+	defer boltWatcherMutex.Unlock()
+
+	for _, eventCh := range boltWatchers[s.collection] {
+		select {
+		case eventCh <- &ChangeEvent{Type: eventType, DocKey: OIdFilter{ObjectId: oid}}:
+		default:
+			log.Println("drop change event of collection", s.collection, eventType, oid.Hex())
+		}
+	}
+}
+
+// 按照文档的键（objectId的十六进制表示）发送变化事件
+func (s *boltStore) notifyKeys(eventType string, keys [][]byte) {
+	for _, key := range keys {
+		if oid, err := primitive.ObjectIDFromHex(string(key)); err == nil {
+			s.notify(eventType, oid)
+		}
+	}
+}
+
+// 删除集合中的所有元数据
+func (s *boltStore) Drop() (err error) {
+	if err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(s.collection))
+	}); err == bolt.ErrBucketNotFound {
+		err = nil
+	}
+	return
+}
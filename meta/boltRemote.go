@@ -0,0 +1,753 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"common"
+	"config"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"meta/funcParams"
+)
+
+// 访问元数据服务时单次操作的超时时间（不包括Watch）
+const boltRemoteTimeout = 30 * time.Second
+
+// Watch的连接断开后重新连接的间隔
+const boltWatchRetry = time.Second
+
+// 元数据服务返回的错误中，调用方按照错误值进行判断的错误（还原为同一个错误值）
+var boltRemoteErrors = []error{common.ErrNodeNotFound}
+
+var (
+	boltOwner  bool // 本进程是否打开了数据库文件并提供元数据服务（见ServeBolt）
+	boltClient = &http.Client{Timeout: boltRemoteTimeout}
+)
+
+// -------------------------------------------
+// 启动嵌入式存储的元数据服务：打开数据库文件，并在配置项boltServer上监听其他进程的元数据操作
+// NOTE: 1) 由一个apiServer（-bolt_owner）在启动时调用，之后本进程内的NewStore直接使用数据库文件；
+//       2) 其他apiServer和dataServer通过remoteStore访问元数据服务，
+//          文档变化事件由元数据服务推送给其他进程中Watch的调用方
+// -------------------------------------------
+func ServeBolt() (err error) {
+	var listener net.Listener
+
+	if config.GConfig.BoltServer == "" {
+		err = common.ErrBoltServerNotSet
+		return
+	}
+	if _, err = newBoltStore(config.GConfig.ObjectColName); err != nil {
+		return
+	}
+	if listener, err = net.Listen("tcp", config.GConfig.BoltServer); err != nil {
+		return
+	}
+	boltOwner = true
+	go func() {
+		log.Fatal(http.Serve(listener, http.HandlerFunc(boltHandler)))
+	}()
+	return
+}
+
+// -------------------------------------------
+// 元数据服务：POST /meta/<collection>/<method> 或者 GET /meta/<collection>/watch
+// 1) 调用集合的boltStore上与Store接口同名的方法：请求体为gob编码的参数，
+//    可变参数funcParams.MetaParamFunc在调用方合并为*funcParams.MetaParams后传输；
+//    响应体为gob编码的错误信息（无错误时为空字符串）和其余返回值；
+// 2) watch：持续推送gob编码的文档变化事件，直到连接断开
+// -------------------------------------------
+func boltHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		parts = strings.Split(strings.TrimPrefix(r.URL.Path, "/meta/"), "/")
+		store *boltStore
+		err   error
+	)
+
+	if len(parts) != 2 || parts[0] == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if store, err = newBoltStore(parts[0]); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if parts[1] == "watch" {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		serveWatch(w, r, store)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	serveCall(w, r, store, parts[1])
+}
+
+// 调用boltStore上的方法并返回结果
+func serveCall(w http.ResponseWriter, r *http.Request, store *boltStore, name string) {
+	var (
+		method     reflect.Value
+		methodType reflect.Type
+		argType    reflect.Type
+		arg        reflect.Value
+		args       []reflect.Value
+		results    []reflect.Value
+		dec        = gob.NewDecoder(r.Body)
+		buf        bytes.Buffer
+		enc        = gob.NewEncoder(&buf)
+		errMsg     string
+		ok         bool
+		i          int
+		err        error
+	)
+
+	// 只能调用Store接口中的方法（Watch的返回值无法编码，由serveWatch处理）
+	if _, ok = reflect.TypeOf((*Store)(nil)).Elem().MethodByName(name); !ok || name == "Watch" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	method = reflect.ValueOf(store).MethodByName(name)
+	methodType = method.Type()
+	for i = 0; i < methodType.NumIn(); i++ {
+		if argType = methodType.In(i); methodType.IsVariadic() && i == methodType.NumIn()-1 {
+			argType = reflect.TypeOf((*funcParams.MetaParams)(nil))
+		}
+		if arg, err = decodeValue(dec, argType); err != nil {
+			log.Println(name, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if argType != methodType.In(i) {
+			arg = reflect.ValueOf([]funcParams.MetaParamFunc{metaParamsFunc(arg.Interface().(*funcParams.MetaParams))})
+		}
+		args = append(args, arg)
+	}
+	if methodType.IsVariadic() {
+		results = method.CallSlice(args)
+	} else {
+		results = method.Call(args)
+	}
+
+	// 最后一个返回值为error，以错误信息传输
+	if e := results[len(results)-1]; !e.IsNil() {
+		errMsg = e.Interface().(error).Error()
+	}
+	err = enc.Encode(errMsg)
+	for i = 0; err == nil && i < len(results)-1; i++ {
+		err = encodeValue(enc, results[i])
+	}
+	if err != nil {
+		log.Println(name, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(buf.Bytes())
+}
+
+// 将调用方合并后的参数还原为可变参数
+func metaParamsFunc(params *funcParams.MetaParams) funcParams.MetaParamFunc {
+	return func(p *funcParams.MetaParams) {
+		if params != nil {
+			*p = *params
+		}
+	}
+}
+
+// 推送集合的文档变化事件，直到连接断开
+func serveWatch(w http.ResponseWriter, r *http.Request, store *boltStore) {
+	var (
+		events     <-chan *ChangeEvent
+		event      *ChangeEvent
+		enc        = gob.NewEncoder(w)
+		flusher, _ = w.(http.Flusher)
+	)
+
+	events, _ = store.Watch()
+	defer store.unwatch(events)
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event = <-events:
+		}
+		if err := enc.Encode(event); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// 编码一个参数或返回值：先编码是否为nil（gob无法编码nil指针、nil切片等），非nil时再编码值
+func encodeValue(enc *gob.Encoder, value reflect.Value) (err error) {
+	var isNil bool
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		isNil = value.IsNil()
+	}
+	if err = enc.Encode(isNil); err != nil || isNil {
+		return
+	}
+	return enc.EncodeValue(value)
+}
+
+// 按照类型解码一个参数或返回值（与encodeValue对应）
+func decodeValue(dec *gob.Decoder, valueType reflect.Type) (value reflect.Value, err error) {
+	var isNil bool
+
+	value = reflect.New(valueType).Elem()
+	if err = dec.Decode(&isNil); err != nil || isNil {
+		return
+	}
+	err = dec.DecodeValue(value.Addr())
+	return
+}
+
+// ===========================================
+// 访问元数据服务的元数据存储：
+// 每个方法将参数发送给元数据服务，由打开数据库文件的进程中对应集合的boltStore执行
+// NOTE: 元数据服务不可用时各方法返回错误，与MongoDB不可用时一致
+// ===========================================
+type remoteStore struct {
+	collection string
+}
+
+func newRemoteStore(collection string) *remoteStore {
+	return &remoteStore{collection: collection}
+}
+
+// 元数据服务中集合的操作地址
+func (s *remoteStore) url(method string) string {
+	return fmt.Sprintf("http://%s/meta/%s/%s", config.GConfig.BoltServer, s.collection, method)
+}
+
+// 调用元数据服务上的方法：args为方法的参数，results为除error之外的返回值的地址
+func (s *remoteStore) call(method string, args []interface{}, results ...interface{}) (err error) {
+	var (
+		buf      bytes.Buffer
+		enc      = gob.NewEncoder(&buf)
+		response *http.Response
+		dec      *gob.Decoder
+		errMsg   string
+		value    reflect.Value
+		arg      interface{}
+		result   interface{}
+	)
+
+	for _, arg = range args {
+		if err = encodeValue(enc, reflect.ValueOf(arg)); err != nil {
+			return
+		}
+	}
+	if response, err = boltClient.Post(s.url(method), "application/octet-stream", &buf); err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("%s: %s %d", common.ErrBoltServer.Error(), method, response.StatusCode)
+		return
+	}
+
+	dec = gob.NewDecoder(response.Body)
+	if err = dec.Decode(&errMsg); err != nil {
+		return
+	}
+	for _, result = range results {
+		if value, err = decodeValue(dec, reflect.TypeOf(result).Elem()); err != nil {
+			return
+		}
+		reflect.ValueOf(result).Elem().Set(value)
+	}
+	if errMsg != "" {
+		err = remoteError(errMsg)
+	}
+	return
+}
+
+// 还原元数据服务返回的错误
+func remoteError(errMsg string) error {
+	for _, err := range boltRemoteErrors {
+		if err.Error() == errMsg {
+			return err
+		}
+	}
+	return errors.New(errMsg)
+}
+
+// -------------------------------------------
+// 监听集合中文档的插入、更新和删除：由元数据服务推送打开数据库文件的进程内的变化事件
+// NOTE: 首次连接失败时返回错误；之后连接断开时每隔boltWatchRetry重新连接，断开期间的变化事件丢失
+//       （与MongoDB的changeStream中断时一致，调用方通过定期检查等方式弥补）
+// -------------------------------------------
+func (s *remoteStore) Watch() (events <-chan *ChangeEvent, err error) {
+	var (
+		eventCh  = make(chan *ChangeEvent, boltEventBuffer)
+		response *http.Response
+	)
+
+	if response, err = s.openWatch(); err != nil {
+		return
+	}
+	go s.receiveEvents(response, eventCh)
+	events = eventCh
+	return
+}
+
+// 连接元数据服务的监听接口（连接不设置超时）
+func (s *remoteStore) openWatch() (response *http.Response, err error) {
+	if response, err = http.Get(s.url("watch")); err != nil {
+		return
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		err = fmt.Errorf("%s: watch %d", common.ErrBoltServer.Error(), response.StatusCode)
+	}
+	return
+}
+
+// 接收变化事件并发送至事件通道，连接断开后重新连接
+func (s *remoteStore) receiveEvents(response *http.Response, eventCh chan<- *ChangeEvent) {
+	var (
+		dec   *gob.Decoder
+		event *ChangeEvent
+		err   error
+	)
+
+	for {
+		dec = gob.NewDecoder(response.Body)
+		for {
+			event = &ChangeEvent{}
+			if err = dec.Decode(event); err != nil {
+				break
+			}
+			eventCh <- event
+		}
+		response.Body.Close()
+		log.Println(common.ErrBoltServer, "watch", s.collection, err)
+
+		for {
+			time.Sleep(boltWatchRetry)
+			if response, err = s.openWatch(); err == nil {
+				break
+			}
+		}
+	}
+}
+
+// ===========================================
+// 对象元数据
+// ===========================================
+func (s *remoteStore) PutObjectMeta(bucket string, name string, size int64, hash string,
+	paramFunc ...funcParams.MetaParamFunc) (insertedID primitive.ObjectID, err error) {
+
+	err = s.call("PutObjectMeta", []interface{}{bucket, name, size, hash, funcParams.NewMetaParams(paramFunc)}, &insertedID)
+	return
+}
+
+func (s *remoteStore) GetObjectMeta(bucket string, name string, paramFunc ...funcParams.MetaParamFunc) (
+	meta *ObjectMeta, err error) {
+
+	err = s.call("GetObjectMeta", []interface{}{bucket, name, funcParams.NewMetaParams(paramFunc)}, &meta)
+	return
+}
+
+func (s *remoteStore) GetLastVersionMeta(bucket string, name string) (meta *ObjectMeta, err error) {
+	err = s.call("GetLastVersionMeta", []interface{}{bucket, name}, &meta)
+	return
+}
+
+func (s *remoteStore) GetAllVersionMetas(bucket string, name string) (metas []*ObjectMeta, err error) {
+	err = s.call("GetAllVersionMetas", []interface{}{bucket, name}, &metas)
+	return
+}
+
+func (s *remoteStore) ListLatestMetas(bucket string, prefix string, marker string, limit int) (
+	metas []*ObjectMeta, err error) {
+
+	err = s.call("ListLatestMetas", []interface{}{bucket, prefix, marker, limit}, &metas)
+	return
+}
+
+func (s *remoteStore) ListVersionMetas(bucket string, prefix string, marker string, limit int) (
+	metas []*ObjectMeta, err error) {
+
+	err = s.call("ListVersionMetas", []interface{}{bucket, prefix, marker, limit}, &metas)
+	return
+}
+
+func (s *remoteStore) ListObjects(bucket, prefix, delimiter, marker string, limit int) (
+	metas []*ObjectMeta, prefixes []string, nextMarker string, truncated bool, err error) {
+
+	err = s.call("ListObjects", []interface{}{bucket, prefix, delimiter, marker, limit}, &metas, &prefixes, &nextMarker, &truncated)
+	return
+}
+
+func (s *remoteStore) GetAllMetasByHash(hash string) (metas []*ObjectMeta, err error) {
+	err = s.call("GetAllMetasByHash", []interface{}{hash}, &metas)
+	return
+}
+
+func (s *remoteStore) GetMetaByHash(hash string) (meta *ObjectMeta, err error) {
+	err = s.call("GetMetaByHash", []interface{}{hash}, &meta)
+	return
+}
+
+func (s *remoteStore) GetALLTooMuchVersionMeta(count int) (metas []*ObjectMeta, err error) {
+	err = s.call("GetALLTooMuchVersionMeta", []interface{}{count}, &metas)
+	return
+}
+
+func (s *remoteStore) ListHashMetas(marker string, limit int) (metas []*ObjectMeta, err error) {
+	err = s.call("ListHashMetas", []interface{}{marker, limit}, &metas)
+	return
+}
+
+func (s *remoteStore) DeleteObjectMeta(bucket string, name string, paramFunc ...funcParams.MetaParamFunc) (
+	deleteCount int64, err error) {
+
+	err = s.call("DeleteObjectMeta", []interface{}{bucket, name, funcParams.NewMetaParams(paramFunc)}, &deleteCount)
+	return
+}
+
+func (s *remoteStore) IsMetaCollectionEmpty() (empty bool, err error) {
+	err = s.call("IsMetaCollectionEmpty", nil, &empty)
+	return
+}
+
+func (s *remoteStore) IsBucketEmpty(bucket string) (empty bool, err error) {
+	err = s.call("IsBucketEmpty", []interface{}{bucket}, &empty)
+	return
+}
+
+func (s *remoteStore) DeleteBucketObjectMetas(bucket string) (deleteCount int64, err error) {
+	err = s.call("DeleteBucketObjectMetas", []interface{}{bucket}, &deleteCount)
+	return
+}
+
+// ===========================================
+// 存储桶元数据
+// ===========================================
+func (s *remoteStore) CreateBucket(name string, paramFunc ...funcParams.MetaParamFunc) (created bool, err error) {
+	err = s.call("CreateBucket", []interface{}{name, funcParams.NewMetaParams(paramFunc)}, &created)
+	return
+}
+
+func (s *remoteStore) GetBucketMeta(name string) (meta *BucketMeta, err error) {
+	err = s.call("GetBucketMeta", []interface{}{name}, &meta)
+	return
+}
+
+func (s *remoteStore) ListBucketMetas() (metas []*BucketMeta, err error) {
+	err = s.call("ListBucketMetas", nil, &metas)
+	return
+}
+
+func (s *remoteStore) DeleteBucketMeta(name string) (deleteCount int64, err error) {
+	err = s.call("DeleteBucketMeta", []interface{}{name}, &deleteCount)
+	return
+}
+
+// ===========================================
+// 分片上传元数据
+// ===========================================
+func (s *remoteStore) NewUpload(bucket string, name string, paramFunc ...funcParams.MetaParamFunc) (
+	uploadId string, err error) {
+
+	err = s.call("NewUpload", []interface{}{bucket, name, funcParams.NewMetaParams(paramFunc)}, &uploadId)
+	return
+}
+
+func (s *remoteStore) GetUpload(uploadId string) (upload *UploadMeta, err error) {
+	err = s.call("GetUpload", []interface{}{uploadId}, &upload)
+	return
+}
+
+func (s *remoteStore) FinishUpload(uploadId string, state string) (finished bool, err error) {
+	err = s.call("FinishUpload", []interface{}{uploadId, state}, &finished)
+	return
+}
+
+func (s *remoteStore) BeginCompleteUpload(uploadId string, hash string) (begun bool, err error) {
+	err = s.call("BeginCompleteUpload", []interface{}{uploadId, hash}, &begun)
+	return
+}
+
+func (s *remoteStore) FailCompleteUpload(uploadId string, reason string) (failed bool, err error) {
+	err = s.call("FailCompleteUpload", []interface{}{uploadId, reason}, &failed)
+	return
+}
+
+func (s *remoteStore) GetExpiredUploads(before time.Time) (uploads []*UploadMeta, err error) {
+	err = s.call("GetExpiredUploads", []interface{}{before}, &uploads)
+	return
+}
+
+func (s *remoteStore) GetFinishedUploads() (uploads []*UploadMeta, err error) {
+	err = s.call("GetFinishedUploads", nil, &uploads)
+	return
+}
+
+func (s *remoteStore) DeleteUpload(uploadId string) (err error) {
+	err = s.call("DeleteUpload", []interface{}{uploadId})
+	return
+}
+
+func (s *remoteStore) PutUploadPart(uploadId string, number int, size int64, hash string,
+	paramFunc ...funcParams.MetaParamFunc) (err error) {
+
+	err = s.call("PutUploadPart", []interface{}{uploadId, number, size, hash, funcParams.NewMetaParams(paramFunc)})
+	return
+}
+
+func (s *remoteStore) GetUploadParts(uploadId string) (parts []*UploadPartMeta, err error) {
+	err = s.call("GetUploadParts", []interface{}{uploadId}, &parts)
+	return
+}
+
+func (s *remoteStore) GetUploadPartsByHash(hash string) (parts []*UploadPartMeta, err error) {
+	err = s.call("GetUploadPartsByHash", []interface{}{hash}, &parts)
+	return
+}
+
+// ===========================================
+// 聚合对象元数据
+// ===========================================
+func (s *remoteStore) NewAggregateMeta() (insertedID primitive.ObjectID, err error) {
+	err = s.call("NewAggregateMeta", nil, &insertedID)
+	return
+}
+
+func (s *remoteStore) GetAggregateMeta(name string) (meta *AggregateMeta, err error) {
+	err = s.call("GetAggregateMeta", []interface{}{name}, &meta)
+	return
+}
+
+func (s *remoteStore) UpdateAggregateMeta(name string, size int64, RefCount int, RefBy string) (err error) {
+	err = s.call("UpdateAggregateMeta", []interface{}{name, size, RefCount, RefBy})
+	return
+}
+
+func (s *remoteStore) DeleteAggregateMeta(name string) (deleteCount int64, err error) {
+	err = s.call("DeleteAggregateMeta", []interface{}{name}, &deleteCount)
+	return
+}
+
+func (s *remoteStore) DeleteUnRefAggregates() (names []string, err error) {
+	err = s.call("DeleteUnRefAggregates", nil, &names)
+	return
+}
+
+// ===========================================
+// 对象分片元数据
+// ===========================================
+func (s *remoteStore) PutObjectShardMeta(object string, index int, size int64, hash string, aggObjects []*AggObject) (
+	insertedID primitive.ObjectID, err error) {
+
+	err = s.call("PutObjectShardMeta", []interface{}{object, index, size, hash, aggObjects}, &insertedID)
+	return
+}
+
+func (s *remoteStore) GetShardMetaByIndex(object string, index int) (meta *ObjectShardMeta, err error) {
+	err = s.call("GetShardMetaByIndex", []interface{}{object, index}, &meta)
+	return
+}
+
+func (s *remoteStore) GetShardMetaByHash(hash string) (metas []*ObjectShardMeta, err error) {
+	err = s.call("GetShardMetaByHash", []interface{}{hash}, &metas)
+	return
+}
+
+func (s *remoteStore) GetShardMetasByObject(object string) (metas []*ObjectShardMeta, err error) {
+	err = s.call("GetShardMetasByObject", []interface{}{object}, &metas)
+	return
+}
+
+func (s *remoteStore) DeleteShardMetaByObjHash(objHash string) (count int64, err error) {
+	err = s.call("DeleteShardMetaByObjHash", []interface{}{objHash}, &count)
+	return
+}
+
+func (s *remoteStore) DeleteShardMeta(hash string) (deleteCount int64, err error) {
+	err = s.call("DeleteShardMeta", []interface{}{hash}, &deleteCount)
+	return
+}
+
+func (s *remoteStore) DeleteShardMetaByIndex(object string, index int) (deleteCount int64, err error) {
+	err = s.call("DeleteShardMetaByIndex", []interface{}{object, index}, &deleteCount)
+	return
+}
+
+func (s *remoteStore) SwapShardAggregate(object string, index int, hash string, oldAggs []*AggObject,
+	newAggs []*AggObject) (swapped bool, err error) {
+
+	err = s.call("SwapShardAggregate", []interface{}{object, index, hash, oldAggs, newAggs}, &swapped)
+	return
+}
+
+// ===========================================
+// 待修复对象分片元数据
+// ===========================================
+func (s *remoteStore) PutRepairShardMeta(objHash string, shardIndex string, shardHash string) (
+	insertedID primitive.ObjectID, err error) {
+
+	err = s.call("PutRepairShardMeta", []interface{}{objHash, shardIndex, shardHash}, &insertedID)
+	return
+}
+
+func (s *remoteStore) GetRepairShardMeta(shardHash string) (shardMeta *RepairShard, err error) {
+	err = s.call("GetRepairShardMeta", []interface{}{shardHash}, &shardMeta)
+	return
+}
+
+func (s *remoteStore) GetRepairShardMetaByOId(oid primitive.ObjectID) (shardMeta *RepairShard, err error) {
+	err = s.call("GetRepairShardMetaByOId", []interface{}{oid}, &shardMeta)
+	return
+}
+
+func (s *remoteStore) GetRepairShardMetaByLocker(locker string) (metas []*RepairShard, err error) {
+	err = s.call("GetRepairShardMetaByLocker", []interface{}{locker}, &metas)
+	return
+}
+
+func (s *remoteStore) GetExpiredRepairShardMetas() (metas []*RepairShard, err error) {
+	err = s.call("GetExpiredRepairShardMetas", nil, &metas)
+	return
+}
+
+func (s *remoteStore) LockRepairShardMeta(shardHash string, locker string, expire time.Duration) (
+	locked bool, err error) {
+
+	err = s.call("LockRepairShardMeta", []interface{}{shardHash, locker, expire}, &locked)
+	return
+}
+
+func (s *remoteStore) RenewRepairShardLock(shardHash string, locker string, expire time.Duration) (
+	renewed bool, err error) {
+
+	err = s.call("RenewRepairShardLock", []interface{}{shardHash, locker, expire}, &renewed)
+	return
+}
+
+func (s *remoteStore) DeleteRepairObjectMeta(shardHash string) (deleteCount int64, err error) {
+	err = s.call("DeleteRepairObjectMeta", []interface{}{shardHash}, &deleteCount)
+	return
+}
+
+func (s *remoteStore) PutLostShardMeta(objHash string, lostShards []int) (insertedID primitive.ObjectID, err error) {
+	err = s.call("PutLostShardMeta", []interface{}{objHash, lostShards}, &insertedID)
+	return
+}
+
+// ===========================================
+// 数据节点元数据
+// ===========================================
+func (s *remoteStore) AddDsNode(ip string, weight int) (insertedID primitive.ObjectID, err error) {
+	err = s.call("AddDsNode", []interface{}{ip, weight}, &insertedID)
+	return
+}
+
+func (s *remoteStore) GetAllNodes() (nodes []*DsNode, err error) {
+	err = s.call("GetAllNodes", nil, &nodes)
+	return
+}
+
+func (s *remoteStore) GetNodeByOId(oid primitive.ObjectID) (node *DsNode, err error) {
+	err = s.call("GetNodeByOId", []interface{}{oid}, &node)
+	return
+}
+
+func (s *remoteStore) GetNodeByIp(ip string) (node *DsNode, err error) {
+	err = s.call("GetNodeByIp", []interface{}{ip}, &node)
+	return
+}
+
+func (s *remoteStore) SetDsNodeState(ip string, state string) (matched bool, err error) {
+	err = s.call("SetDsNodeState", []interface{}{ip, state}, &matched)
+	return
+}
+
+func (s *remoteStore) SetDsNodeDomain(ip string, zone string, rack string) (matched bool, err error) {
+	err = s.call("SetDsNodeDomain", []interface{}{ip, zone, rack}, &matched)
+	return
+}
+
+func (s *remoteStore) SetDsNodeWeight(ip string, weight int, fixed bool) (matched bool, err error) {
+	err = s.call("SetDsNodeWeight", []interface{}{ip, weight, fixed}, &matched)
+	return
+}
+
+func (s *remoteStore) SetDsNodeFull(ip string, full bool) (matched bool, err error) {
+	err = s.call("SetDsNodeFull", []interface{}{ip, full}, &matched)
+	return
+}
+
+func (s *remoteStore) DeleteDsNodeByIp(ip string) (deleteCount int64, err error) {
+	err = s.call("DeleteDsNodeByIp", []interface{}{ip}, &deleteCount)
+	return
+}
+
+// ===========================================
+// 数据迁移任务元数据
+// ===========================================
+func (s *remoteStore) GetRebalanceJob() (job *RebalanceJob, err error) {
+	err = s.call("GetRebalanceJob", nil, &job)
+	return
+}
+
+func (s *remoteStore) StartRebalanceJob(before []*RingNode, after []*RingNode) (job *RebalanceJob, err error) {
+	err = s.call("StartRebalanceJob", []interface{}{before, after}, &job)
+	return
+}
+
+func (s *remoteStore) LockRebalanceJob(locker string, expire time.Duration) (job *RebalanceJob, err error) {
+	err = s.call("LockRebalanceJob", []interface{}{locker, expire}, &job)
+	return
+}
+
+func (s *remoteStore) UpdateRebalanceJob(job *RebalanceJob) (updated bool, err error) {
+	err = s.call("UpdateRebalanceJob", []interface{}{job}, &updated)
+	return
+}
+
+func (s *remoteStore) RetryRebalanceJob() (job *RebalanceJob, err error) {
+	err = s.call("RetryRebalanceJob", nil, &job)
+	return
+}
+
+// ===========================================
+// 丢失分片检测任务元数据
+// ===========================================
+func (s *remoteStore) LockScanJob(name string, locker string, expire time.Duration) (job *ScanJob, err error) {
+	err = s.call("LockScanJob", []interface{}{name, locker, expire}, &job)
+	return
+}
+
+func (s *remoteStore) UpdateScanJob(job *ScanJob) (updated bool, err error) {
+	err = s.call("UpdateScanJob", []interface{}{job}, &updated)
+	return
+}
+
+// 删除集合中的所有元数据（用于测试恢复环境）
+func (s *remoteStore) Drop() (err error) {
+	err = s.call("Drop", nil)
+	return
+}
@@ -0,0 +1,911 @@
+package meta
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"common"
+	"config"
+	bolt "go.etcd.io/bbolt"
+	"meta/funcParams"
+)
+
+// 嵌入式存储的测试使用临时目录下的数据库文件
+func TestMain(m *testing.M) {
+	var (
+		dir  string
+		code int
+		err  error
+	)
+
+	if dir, err = ioutil.TempDir("", "doss_meta"); err != nil {
+		panic(err)
+	}
+	config.GConfig.BoltPath = filepath.Join(dir, "meta.db")
+	code = m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// 生成指定集合的嵌入式存储，并清空集合
+func newTestBoltStore(t *testing.T, collection string) *boltStore {
+	var (
+		store *boltStore
+		err   error
+	)
+
+	if store, err = newBoltStore(collection); err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Drop()
+	return store
+}
+
+func TestBoltStore_ObjectMeta(t *testing.T) {
+	var (
+		store *boltStore
+		first *ObjectMeta
+		meta  *ObjectMeta
+		metas []*ObjectMeta
+		empty bool
+		count int64
+		err   error
+	)
+
+	store = newTestBoltStore(t, config.GConfig.ObjectColName)
+	if empty, err = store.IsMetaCollectionEmpty(); err != nil || !empty {
+		t.Error("Expect empty collection, got:", empty, err)
+	}
+
+	// 版本号递增，新版本保留创建时间
+	_, _ = store.PutObjectMeta("bucket", "test", 1024, "hash1")
+	_, _ = store.PutObjectMeta("bucket", "test", 2048, "hash2")
+	_, _ = store.PutObjectMeta("bucket", "test2", 10, "hash2")
+	if first, err = store.GetObjectMeta("bucket", "test", funcParams.MetaParamVersion(1)); err != nil || first.Hash != "hash1" {
+		t.Fatal("Get version 1 error, got:", first, err)
+	}
+	if meta, err = store.GetObjectMeta("bucket", "test"); err != nil || meta.Version != 2 || meta.Size != 2048 {
+		t.Fatal("Get last version error, got:", meta, err)
+	}
+	if !meta.Created.Equal(first.Created) || meta.Modified.Before(first.Modified) {
+		t.Error("Got created", meta.Created, "modified", meta.Modified, ", expect created", first.Created)
+	}
+
+	// 不存在的版本返回空的元数据，不存在的对象返回nil
+	if meta, err = store.GetObjectMeta("bucket", "test", funcParams.MetaParamVersion(3)); err != nil || meta.Name != "" {
+		t.Error("Expect empty meta of version 3, got:", meta, err)
+	}
+	if meta, err = store.GetLastVersionMeta("bucket", "none"); err != nil || meta != nil {
+		t.Error("Expect nil meta, got:", meta, err)
+	}
+
+	if metas, err = store.GetAllVersionMetas("bucket", "test"); err != nil || len(metas) != 2 || metas[0].Version != 1 {
+		t.Error("Get all versions error, got:", metas, err)
+	}
+	if meta, err = store.GetMetaByHash("hash2"); err != nil || meta == nil || meta.Version != 2 {
+		t.Error("Get meta by hash error, got:", meta, err)
+	}
+	if metas, err = store.GetALLTooMuchVersionMeta(1); err != nil || len(metas) != 1 || metas[0].Name != "test" {
+		t.Error("Get too much version metas error, got:", metas, err)
+	}
+
+	if count, err = store.DeleteObjectMeta("bucket", "test", funcParams.MetaParamVersion(1)); err != nil || count != 1 {
+		t.Error("Deleted", count, "metas, expect: 1", err)
+	}
+	if count, err = store.DeleteBucketObjectMetas("bucket"); err != nil || count != 2 {
+		t.Error("Deleted", count, "metas, expect: 2", err)
+	}
+	if empty, err = store.IsMetaCollectionEmpty(); err != nil || !empty {
+		t.Error("Expect empty collection, got:", empty, err)
+	}
+}
+
+func TestBoltStore_ListObjects(t *testing.T) {
+	var (
+		store      *boltStore
+		metas      []*ObjectMeta
+		prefixes   []string
+		nextMarker string
+		truncated  bool
+		empty      bool
+		err        error
+	)
+
+	store = newTestBoltStore(t, config.GConfig.ObjectColName)
+	_, _ = store.PutObjectMeta("bucket", "a.txt", 1024, "hash_value_test")
+	_, _ = store.PutObjectMeta("bucket", "dir/b.txt", 1024, "hash_value_test")
+	_, _ = store.PutObjectMeta("bucket", "dir/c.txt", 1024, "hash_value_test")
+	_, _ = store.PutObjectMeta("bucket", "dir2/d.txt", 1024, "hash_value_test")
+	_, _ = store.PutObjectMeta("bucket", "e.txt", 1024, "hash_value_test")
+	_, _ = store.PutObjectMeta("bucket", "e.txt", 0, "")
+	_, _ = store.PutObjectMeta("bucket2", "f.txt", 0, "")
+
+	// 汇总公共前缀：a.txt、dir/、dir2/（e.txt已被删除）
+	if metas, prefixes, _, truncated, err = store.ListObjects("bucket", "", "/", "", 1000); err != nil {
+		t.Error(err)
+	}
+	if len(metas) != 1 || len(prefixes) != 2 || truncated {
+		t.Errorf("Got %d objects, prefixes %v, truncated %v, expect: 1 object, 2 prefixes", len(metas), prefixes, truncated)
+	}
+
+	// 分页列举：每页2个
+	if metas, prefixes, nextMarker, truncated, err = store.ListObjects("bucket", "", "/", "", 2); err != nil {
+		t.Error(err)
+	}
+	if len(metas)+len(prefixes) != 2 || !truncated {
+		t.Errorf("Got %d results, truncated %v, expect: 2 results and truncated", len(metas)+len(prefixes), truncated)
+	}
+	if metas, prefixes, _, truncated, err = store.ListObjects("bucket", "", "/", nextMarker, 2); err != nil {
+		t.Error(err)
+	}
+	if len(metas) != 0 || len(prefixes) != 1 || prefixes[0] != "dir2/" || truncated {
+		t.Errorf("Got %d objects, prefixes %v, truncated %v, expect: prefix dir2/", len(metas), prefixes, truncated)
+	}
+
+	// 按照前缀列举、列举所有版本
+	if metas, _, _, _, err = store.ListObjects("bucket", "dir/", "/", "", 1000); err != nil || len(metas) != 2 {
+		t.Errorf("Got %d objects with prefix dir/, expect: 2, err: %v", len(metas), err)
+	}
+	if metas, err = store.ListVersionMetas("bucket", "e", "", 1000); err != nil || len(metas) != 2 || metas[0].Version != 2 {
+		t.Error("List versions error, got:", metas, err)
+	}
+
+	// 所有对象的最新版本均为删除标记的存储桶视为空
+	if empty, err = store.IsBucketEmpty("bucket2"); err != nil || !empty {
+		t.Error("Expect bucket2 empty, got:", empty, err)
+	}
+	if empty, err = store.IsBucketEmpty("bucket"); err != nil || empty {
+		t.Error("Expect bucket not empty, got:", empty, err)
+	}
+	_ = store.Drop()
+}
+
+func TestBoltStore_Bucket(t *testing.T) {
+	var (
+		store   *boltStore
+		created bool
+		meta    *BucketMeta
+		metas   []*BucketMeta
+		err     error
+	)
+
+	store = newTestBoltStore(t, config.GConfig.BucketColName)
+	if created, err = store.CreateBucket("bucket1"); err != nil || !created {
+		t.Error("Create bucket1 failed:", created, err)
+	}
+	if created, err = store.CreateBucket("bucket1"); err != nil || created {
+		t.Error("Create bucket1 again, expect not created, got:", created, err)
+	}
+	_, _ = store.CreateBucket("bucket0")
+	if metas, err = store.ListBucketMetas(); err != nil || len(metas) != 2 || metas[0].Name != "bucket0" {
+		t.Error("List buckets error, got:", metas, err)
+	}
+	if _, err = store.DeleteBucketMeta("bucket1"); err != nil {
+		t.Error(err)
+	}
+	if meta, err = store.GetBucketMeta("bucket1"); err != nil || meta.Name != "" {
+		t.Error("Expect bucket1 deleted, got:", meta, err)
+	}
+	_ = store.Drop()
+}
+
+func TestBoltStore_ECScheme(t *testing.T) {
+	var (
+		objects  *boltStore
+		buckets  *boltStore
+		uploads  *boltStore
+		ec       = common.ECScheme{DataShards: 10, ParityShards: 4}
+		meta     *ObjectMeta
+		bucket   *BucketMeta
+		uploadId string
+		upload   *UploadMeta
+		parts    []*UploadPartMeta
+		err      error
+	)
+
+	// 对象元数据记录写入时的纠删码方案，未记录方案的旧对象使用dataShards、parityShards
+	objects = newTestBoltStore(t, config.GConfig.ObjectColName)
+	_, _ = objects.PutObjectMeta("bucket", "legacy", 1024, "hash1")
+	_, _ = objects.PutObjectMeta("bucket", "test", 1024, "hash2", funcParams.MetaParamEC(ec))
+	if meta, err = objects.GetLastVersionMeta("bucket", "legacy"); err != nil ||
+		!meta.EC.IsZero() || meta.Scheme() != config.GConfig.LegacyScheme {
+		t.Error("Expect legacy scheme, got:", meta, err)
+	}
+	if meta, err = objects.GetMetaByHash("hash2"); err != nil || meta.EC != ec || meta.Scheme() != ec {
+		t.Error("Expect scheme 10+4, got:", meta, err)
+	}
+
+	// 多副本对象记录存储模式
+	_, _ = objects.PutObjectMeta("bucket", "tiny", 10, "hash4", funcParams.MetaParamEC(common.NewReplicaScheme(3)))
+	if meta, err = objects.GetMetaByHash("hash4"); err != nil || !meta.Scheme().IsReplica() || meta.Scheme().AllShards() != 3 {
+		t.Error("Expect replica scheme 3x, got:", meta, err)
+	}
+
+	// 存储桶未指定方案时使用defaultEC
+	buckets = newTestBoltStore(t, config.GConfig.BucketColName)
+	_, _ = buckets.CreateBucket("bucket0")
+	_, _ = buckets.CreateBucket("bucket1", funcParams.MetaParamEC(ec))
+	if bucket, err = buckets.GetBucketMeta("bucket0"); err != nil || bucket.Scheme() != config.GConfig.DefaultScheme {
+		t.Error("Expect default scheme, got:", bucket, err)
+	}
+	if bucket, err = buckets.GetBucketMeta("bucket1"); err != nil || bucket.Scheme() != ec {
+		t.Error("Expect scheme 10+4, got:", bucket, err)
+	}
+
+	// 分片上传和part记录各自的方案
+	uploads = newTestBoltStore(t, config.GConfig.UploadColName)
+	if uploadId, err = uploads.NewUpload("bucket", "test", funcParams.MetaParamEC(ec)); err != nil {
+		t.Fatal(err)
+	}
+	_ = uploads.PutUploadPart(uploadId, 1, 10, "hash3", funcParams.MetaParamEC(config.GConfig.LegacyScheme))
+	if upload, err = uploads.GetUpload(uploadId); err != nil || upload.Scheme() != ec {
+		t.Error("Expect upload scheme 10+4, got:", upload, err)
+	}
+	if parts, err = uploads.GetUploadParts(uploadId); err != nil ||
+		len(parts) != 1 || parts[0].Scheme() != config.GConfig.LegacyScheme {
+		t.Error("Expect part legacy scheme, got:", parts, err)
+	}
+
+	_ = objects.Drop()
+	_ = buckets.Drop()
+	_ = uploads.Drop()
+}
+
+func TestBoltStore_InlineObject(t *testing.T) {
+	var (
+		store = newTestBoltStore(t, config.GConfig.ObjectColName)
+		meta  *ObjectMeta
+		metas []*ObjectMeta
+		err   error
+	)
+
+	// 内联对象的数据随元数据一起保存，可以按照版本、hash值读取
+	_, _ = store.PutObjectMeta("bucket", "tiny", 5, "hash1", funcParams.MetaParamInline([]byte("hello")))
+	_, _ = store.PutObjectMeta("bucket", "tiny", 0, "")
+	if meta, err = store.GetObjectMeta("bucket", "tiny", funcParams.MetaParamVersion(1)); err != nil ||
+		!meta.Inline || string(meta.Data) != "hello" {
+		t.Error("Expect inline data hello, got:", meta, err)
+	}
+	if meta, err = store.GetMetaByHash("hash1"); err != nil || !meta.Inline || string(meta.Data) != "hello" {
+		t.Error("Expect inline meta by hash, got:", meta, err)
+	}
+	if meta, err = store.GetLastVersionMeta("bucket", "tiny"); err != nil || meta.Inline || meta.Hash != "" {
+		t.Error("Expect delete marker, got:", meta, err)
+	}
+
+	// 按照hash值遍历时同样会列举内联对象（由数据迁移、故障域检查跳过）
+	if metas, err = store.ListHashMetas("", 10); err != nil || len(metas) != 1 || !metas[0].Inline {
+		t.Error("Expect one inline meta, got:", metas, err)
+	}
+	_ = store.Drop()
+}
+
+func TestBoltStore_MultipartUpload(t *testing.T) {
+	var (
+		store    *boltStore
+		uploadId string
+		upload   *UploadMeta
+		uploads  []*UploadMeta
+		parts    []*UploadPartMeta
+		finished bool
+		err      error
+	)
+
+	store = newTestBoltStore(t, config.GConfig.UploadColName)
+	if uploadId, err = store.NewUpload("bucket", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if uploads, err = store.GetExpiredUploads(time.Now().Add(time.Minute)); err != nil || len(uploads) != 1 {
+		t.Error("Get expired uploads error, got:", uploads, err)
+	}
+
+	// 同一part重复上传时覆盖之前的记录，列举时按照part编号升序
+	_ = store.PutUploadPart(uploadId, 2, 5, "hash2")
+	_ = store.PutUploadPart(uploadId, 1, 10, "hash1")
+	_ = store.PutUploadPart(uploadId, 2, 6, "hash2_new")
+	if parts, err = store.GetUploadParts(uploadId); err != nil ||
+		len(parts) != 2 || parts[0].Number != 1 || parts[1].Hash != "hash2_new" || parts[1].Size != 6 {
+		t.Error("Get upload parts error, got:", parts, err)
+	}
+	if parts, err = store.GetUploadPartsByHash("hash1"); err != nil || len(parts) != 1 {
+		t.Error("Get upload parts by hash error, got:", parts, err)
+	}
+
+	// 只有一个请求可以开始合并，合并中的上传未结束；合并失败后恢复为上传中并记录失败原因
+	if finished, err = store.BeginCompleteUpload(uploadId, "object_hash"); err != nil || !finished {
+		t.Error("Begin complete upload failed:", finished, err)
+	}
+	if finished, err = store.BeginCompleteUpload(uploadId, "object_hash"); err != nil || finished {
+		t.Error("Begin complete upload again, expect not begun, got:", finished, err)
+	}
+	if uploads, err = store.GetFinishedUploads(); err != nil || len(uploads) != 0 {
+		t.Error("Expect completing upload unfinished, got:", uploads, err)
+	}
+	if finished, err = store.FailCompleteUpload(uploadId, "merge failed"); err != nil || !finished {
+		t.Error("Fail complete upload failed:", finished, err)
+	}
+	if upload, err = store.GetUpload(uploadId); err != nil || upload.State != UploadStateUploading || upload.Error != "merge failed" {
+		t.Error("Expect uploading with error, got:", upload, err)
+	}
+	if finished, err = store.BeginCompleteUpload(uploadId, "object_hash"); err != nil || !finished {
+		t.Error("Begin complete upload after failure failed:", finished, err)
+	}
+	if upload, err = store.GetUpload(uploadId); err != nil || upload.State != UploadStateCompleting ||
+		upload.Hash != "object_hash" || upload.Error != "" {
+		t.Error("Expect completing upload, got:", upload, err)
+	}
+
+	// 只有一个请求可以结束上传（合并中的上传同样可以结束）
+	if finished, err = store.FinishUpload(uploadId, UploadStateCompleted); err != nil || !finished {
+		t.Error("Finish upload failed:", finished, err)
+	}
+	if finished, err = store.FinishUpload(uploadId, UploadStateAborted); err != nil || finished {
+		t.Error("Finish upload again, expect not finished, got:", finished, err)
+	}
+	if uploads, err = store.GetFinishedUploads(); err != nil || len(uploads) != 1 || uploads[0].State != UploadStateCompleted {
+		t.Error("Get finished uploads error, got:", uploads, err)
+	}
+
+	if err = store.DeleteUpload(uploadId); err != nil {
+		t.Error(err)
+	}
+	if upload, err = store.GetUpload(uploadId); err != nil || upload != nil {
+		t.Error("Expect upload deleted, got:", upload, err)
+	}
+	if parts, err = store.GetUploadParts(uploadId); err != nil || len(parts) != 0 {
+		t.Error("Expect upload parts deleted, got:", parts, err)
+	}
+}
+
+func TestBoltStore_AggregateAndShard(t *testing.T) {
+	var (
+		aggStore   *boltStore
+		shardStore *boltStore
+		aggMeta    *AggregateMeta
+		shardMeta  *ObjectShardMeta
+		shardMetas []*ObjectShardMeta
+		names      []string
+		count      int64
+		swapped    bool
+		err        error
+	)
+
+	// 聚合对象被引用、解除引用后作为未被引用的聚合对象删除
+	aggStore = newTestBoltStore(t, config.GConfig.AggregateObjColName)
+	insertedID, _ := aggStore.NewAggregateMeta()
+	_ = aggStore.UpdateAggregateMeta(insertedID.Hex(), 100, 1, "shard1")
+	if aggMeta, err = aggStore.GetAggregateMeta(insertedID.Hex()); err != nil ||
+		aggMeta.Size != 100 || aggMeta.RefCount != 1 || len(aggMeta.RefBy) != 1 {
+		t.Error("Update aggregate meta error, got:", aggMeta, err)
+	}
+	_ = aggStore.UpdateAggregateMeta(insertedID.Hex(), -1, -1, "")
+	if names, err = aggStore.DeleteUnRefAggregates(); err != nil || len(names) != 1 || names[0] != insertedID.Hex() {
+		t.Error("Delete unreferenced aggregates error, got:", names, err)
+	}
+	if aggMeta, _ = aggStore.GetAggregateMeta(insertedID.Hex()); aggMeta.Name != "" {
+		t.Error("Expect aggregate meta deleted, got:", aggMeta)
+	}
+
+	// 对象分片元数据
+	shardStore = newTestBoltStore(t, config.GConfig.ObjShardColName)
+	_, _ = shardStore.PutObjectShardMeta("object", 0, 10, "shard0", []*AggObject{{Name: "agg", Offset: 0, Size: 10}})
+	_, _ = shardStore.PutObjectShardMeta("object", 1, 10, "shard1", nil)
+	if shardMeta, err = shardStore.GetShardMetaByIndex("object", 0); err != nil ||
+		shardMeta.Hash != "shard0" || len(shardMeta.Aggregate) != 1 {
+		t.Error("Get shard meta by index error, got:", shardMeta, err)
+	}
+	if shardMetas, err = shardStore.GetShardMetaByHash("shard1"); err != nil || len(shardMetas) != 1 {
+		t.Error("Get shard meta by hash error, got:", shardMetas, err)
+	}
+
+	// 聚合对象整理：分片所在的聚合对象与预期不一致（已被修改）时不更新
+	if swapped, err = shardStore.SwapShardAggregate("object", 0, "shard0",
+		[]*AggObject{{Name: "agg", Offset: 5, Size: 10}}, []*AggObject{{Name: "agg2", Offset: 0, Size: 10}}); err != nil || swapped {
+		t.Error("Expect stale aggregate not swapped, got:", swapped, err)
+	}
+	if swapped, err = shardStore.SwapShardAggregate("object", 0, "shard0",
+		[]*AggObject{{Name: "agg", Offset: 0, Size: 10}}, []*AggObject{{Name: "agg2", Offset: 0, Size: 10}}); err != nil || !swapped {
+		t.Error("Expect aggregate swapped, got:", swapped, err)
+	}
+	if shardMeta, _ = shardStore.GetShardMetaByIndex("object", 0); len(shardMeta.Aggregate) != 1 ||
+		shardMeta.Aggregate[0].Name != "agg2" {
+		t.Error("Expect shard moved to agg2, got:", shardMeta.Aggregate)
+	}
+	if count, err = shardStore.DeleteShardMetaByObjHash("object"); err != nil || count != 2 {
+		t.Error("Marked", count, "shards, expect: 2", err)
+	}
+	if count, err = shardStore.DeleteShardMetaByIndex("object", 1); err != nil || count != 1 {
+		t.Error("Deleted", count, "shards, expect: 1", err)
+	}
+	if shardMetas, err = shardStore.GetShardMetasByObject("object"); err != nil ||
+		len(shardMetas) != 1 || shardMetas[0].Hash != "" {
+		t.Error("Get shard metas by object error, got:", shardMetas, err)
+	}
+	_ = aggStore.Drop()
+	_ = shardStore.Drop()
+}
+
+// 测试待修复对象分片、数据节点的变化事件通知
+func TestBoltStore_Watch(t *testing.T) {
+	var (
+		repairStore *boltStore
+		nodeStore   *boltStore
+		events      <-chan *ChangeEvent
+		event       *ChangeEvent
+		repairMeta  *RepairShard
+		node        *DsNode
+		err         error
+	)
+
+	repairStore = newTestBoltStore(t, config.GConfig.RepairObjColName)
+	if events, err = repairStore.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = repairStore.PutRepairShardMeta("object", "1", "shard1")
+	if event = <-events; event.Type != "insert" {
+		t.Fatal("Expect insert event, got:", event)
+	}
+	if repairMeta, err = repairStore.GetRepairShardMetaByOId(event.DocKey.ObjectId); err != nil || repairMeta.ShardHash != "shard1" {
+		t.Error("Get repair shard meta by oid error, got:", repairMeta, err)
+	}
+	_, _ = repairStore.LockRepairShardMeta("shard1", "locker", time.Minute)
+	if repairMeta, err = repairStore.GetRepairShardMeta("shard1"); err != nil || repairMeta.Locker != "locker" {
+		t.Error("Lock repair shard meta error, got:", repairMeta, err)
+	}
+	_, _ = repairStore.DeleteRepairObjectMeta("shard1")
+	if event = <-events; event.Type != "delete" {
+		t.Error("Expect delete event, got:", event)
+	}
+
+	// 同一ip的节点只添加一次
+	nodeStore = newTestBoltStore(t, config.GConfig.NodeColName)
+	if events, err = nodeStore.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = nodeStore.AddDsNode("192.168.1.210", 1)
+	_, _ = nodeStore.AddDsNode("192.168.1.210", 1)
+	if event = <-events; event.Type != "insert" {
+		t.Fatal("Expect insert event, got:", event)
+	}
+	if node, err = nodeStore.GetNodeByOId(event.DocKey.ObjectId); err != nil || node.Ip != "192.168.1.210" {
+		t.Error("Get node by oid error, got:", node, err)
+	}
+	_, _ = nodeStore.DeleteDsNodeByIp("192.168.1.210")
+	if event = <-events; event.Type != "delete" || len(events) != 0 {
+		t.Error("Expect one delete event, got:", event, len(events))
+	}
+	if node, err = nodeStore.GetNodeByIp("192.168.1.210"); err == nil || node != nil {
+		t.Error("Expect node deleted, got:", node, err)
+	}
+	_ = repairStore.Drop()
+	_ = nodeStore.Drop()
+}
+
+// 测试通过元数据服务访问嵌入式存储：参数和返回值（包括可变参数、nil和多个返回值）的传输、错误值的还原和变化事件的推送
+func TestBoltStore_Remote(t *testing.T) {
+	var (
+		server    *httptest.Server
+		store     Store
+		nodeStore Store
+		events    <-chan *ChangeEvent
+		event     *ChangeEvent
+		meta      *ObjectMeta
+		metas     []*ObjectMeta
+		prefixes  []string
+		truncated bool
+		node      *DsNode
+		err       error
+	)
+
+	server = httptest.NewServer(http.HandlerFunc(boltHandler))
+	backend := config.GConfig.MetaBackend
+	config.GConfig.MetaBackend, config.GConfig.BoltServer = BackendBolt, server.Listener.Addr().String()
+	defer func() {
+		config.GConfig.MetaBackend, config.GConfig.BoltServer = backend, ""
+		server.CloseClientConnections() // 断开Watch的连接
+		server.Close()
+	}()
+
+	_ = newTestBoltStore(t, config.GConfig.ObjectColName)
+	if store, err = NewStore(funcParams.MongoParamCollection(config.GConfig.ObjectColName)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.(*remoteStore); !ok {
+		t.Fatalf("Expect remote store, got: %T", store)
+	}
+	_, _ = store.PutObjectMeta("bucket", "dir/a", 1024, "hash1")
+	if _, err = store.PutObjectMeta("bucket", "dir/a", 10, "hash2", funcParams.MetaParamInline([]byte("0123456789"))); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err = store.GetObjectMeta("bucket", "dir/a", funcParams.MetaParamVersion(1)); err != nil || meta.Hash != "hash1" {
+		t.Error("Get version 1 error, got:", meta, err)
+	}
+	if meta, err = store.GetObjectMeta("bucket", "dir/a"); err != nil || !meta.Inline || string(meta.Data) != "0123456789" {
+		t.Error("Get inline meta error, got:", meta, err)
+	}
+	if meta, err = store.GetLastVersionMeta("bucket", "none"); err != nil || meta != nil {
+		t.Error("Expect nil meta, got:", meta, err)
+	}
+	if metas, prefixes, _, truncated, err = store.ListObjects("bucket", "", "/", "", 10); err != nil ||
+		len(metas) != 0 || len(prefixes) != 1 || prefixes[0] != "dir/" || truncated {
+		t.Error("List objects error, got:", metas, prefixes, truncated, err)
+	}
+	_ = store.Drop()
+
+	// 错误值还原为同一个错误，变化事件由元数据服务推送
+	_ = newTestBoltStore(t, config.GConfig.NodeColName)
+	if nodeStore, err = NewStore(funcParams.MongoParamCollection(config.GConfig.NodeColName)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = nodeStore.GetNodeByIp("192.168.1.210"); err != common.ErrNodeNotFound {
+		t.Error("Expect ErrNodeNotFound, got:", err)
+	}
+	if events, err = nodeStore.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = nodeStore.AddDsNode("192.168.1.210", 1)
+	select {
+	case event = <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expect insert event from meta server")
+	}
+	if node, err = nodeStore.GetNodeByOId(event.DocKey.ObjectId); err != nil || event.Type != "insert" || node.Ip != "192.168.1.210" {
+		t.Error("Expect insert event of node, got:", event, node, err)
+	}
+	_ = nodeStore.Drop()
+}
+
+// 测试修复租约：持有者续期期间其他apiServer无法获取，持有者宕机（停止续期）后租约过期并被接管
+func TestBoltStore_RepairLease(t *testing.T) {
+	var (
+		store  = newTestBoltStore(t, config.GConfig.RepairObjColName)
+		expire = 150 * time.Millisecond
+		leaseA *RepairLease
+		leaseB *RepairLease
+		metas  []*RepairShard
+		locked bool
+		err    error
+	)
+
+	_, _ = store.PutRepairShardMeta("object", "1", "shard1")
+	if metas, err = store.GetExpiredRepairShardMetas(); err != nil || len(metas) != 1 {
+		t.Fatal("Expect unlocked repair shard, got:", metas, err)
+	}
+
+	// apiServer A获取租约并在修复期间续期：超过租约时长后B仍无法获取
+	if leaseA, err = AcquireRepairLease(store, "shard1", "apiServerA", expire); err != nil || leaseA == nil {
+		t.Fatal("Acquire lease error:", err)
+	}
+	time.Sleep(2 * expire)
+	if leaseB, err = AcquireRepairLease(store, "shard1", "apiServerB", expire); err != nil || leaseB != nil {
+		t.Fatal("Expect lease held by A, got:", leaseB, err)
+	}
+	if metas, _ = store.GetExpiredRepairShardMetas(); len(metas) != 0 || !leaseA.Held() {
+		t.Fatal("Expect renewed lease, got:", metas)
+	}
+
+	// A在修复过程中宕机（不再续期）：租约过期后B接管，A恢复后无法再续期
+	leaseA.Stop()
+	time.Sleep(expire + expire/2)
+	if metas, _ = store.GetExpiredRepairShardMetas(); len(metas) != 1 || metas[0].Locker != "apiServerA" {
+		t.Fatal("Expect expired lease of A, got:", metas)
+	}
+	if leaseB, err = AcquireRepairLease(store, "shard1", "apiServerB", expire); err != nil || leaseB == nil {
+		t.Fatal("Expect lease taken over by B:", err)
+	}
+	defer leaseB.Stop()
+	if locked, _ = store.RenewRepairShardLock("shard1", "apiServerA", expire); locked {
+		t.Error("Expect renew of A failed")
+	}
+	if locked, _ = store.LockRepairShardMeta("shard1", "apiServerA", expire); locked {
+		t.Error("Expect lock of A failed")
+	}
+
+	// 续期中的租约被接管时（如持有者长时间无法访问元数据服务），持有者的Held返回false
+	leaseB.Stop()
+	if leaseA, err = AcquireRepairLease(store, "shard1", "apiServerA", expire); err != nil || leaseA != nil {
+		t.Fatal("Expect lease still held by B, got:", leaseA, err)
+	}
+	time.Sleep(expire + expire/2)
+	if leaseA, err = AcquireRepairLease(store, "shard1", "apiServerA", expire); err != nil || leaseA == nil {
+		t.Fatal("Expect lease taken over by A:", err)
+	}
+	defer leaseA.Stop()
+	_ = store.update(store.collection, func(b *bolt.Bucket) error {
+		metas, keys := repairsByFilter(b, func(meta *RepairShard) bool { return true })
+		metas[0].Locker = "apiServerB"
+		return putDoc(b, keys[0], metas[0])
+	})
+	time.Sleep(expire / 2)
+	if leaseA.Held() {
+		t.Error("Expect lease of A lost")
+	}
+	_ = store.Drop()
+}
+
+// 续期出错的元数据服务（模拟持有者无法访问元数据服务）
+type renewErrorStore struct {
+	Store
+}
+
+func (s renewErrorStore) RenewRepairShardLock(shardHash, locker string, expire time.Duration) (bool, error) {
+	return false, errors.New("renew failed")
+}
+
+// 测试修复租约续期出错：持有者无法确认租约是否被接管，距离上一次成功续期超过租约时长的2/3后Held返回false
+func TestBoltStore_RepairLeaseRenewError(t *testing.T) {
+	var (
+		store  = newTestBoltStore(t, config.GConfig.RepairObjColName)
+		expire = 150 * time.Millisecond
+		lease  *RepairLease
+		err    error
+	)
+
+	_, _ = store.PutRepairShardMeta("object", "1", "shard1")
+	if lease, err = AcquireRepairLease(renewErrorStore{store}, "shard1", "apiServerA", expire); err != nil || lease == nil {
+		t.Fatal("Acquire lease error:", err)
+	}
+	defer lease.Stop()
+	time.Sleep(expire / 2)
+	if !lease.Held() {
+		t.Error("Expect lease held before renew margin")
+	}
+	time.Sleep(expire / 2)
+	if lease.Held() {
+		t.Error("Expect lease lost after failed renewals")
+	}
+	_ = store.Drop()
+}
+
+// 测试数据迁移任务的创建、更新目标哈希环、加锁和保存进度
+func TestBoltStore_RebalanceJob(t *testing.T) {
+	var (
+		store   *boltStore
+		objects *boltStore
+		job     *RebalanceJob
+		metas   []*ObjectMeta
+		updated bool
+		err     error
+	)
+
+	before := []*RingNode{{Ip: "192.168.1.1", Weight: 1}, {Ip: "192.168.1.2", Weight: 1}}
+	after := []*RingNode{{Ip: "192.168.1.1", Weight: 1}, {Ip: "192.168.1.2", Weight: 1}, {Ip: "192.168.1.3", Weight: 1}}
+	after2 := []*RingNode{{Ip: "192.168.1.1", Weight: 1}, {Ip: "192.168.1.3", Weight: 1}}
+
+	store = newTestBoltStore(t, config.GConfig.RebalanceColName)
+	if job, err = store.GetRebalanceJob(); err != nil || job != nil {
+		t.Error("Expect no rebalance job, got:", job, err)
+	}
+	if job, err = store.StartRebalanceJob(before, before); err != nil || job != nil {
+		t.Error("Expect no rebalance job for unchanged ring, got:", job, err)
+	}
+
+	// 多个apiServer监听到同一变化时只创建一次
+	if job, err = store.StartRebalanceJob(before, after); err != nil || job.Generation != 1 || len(job.Sources) != 1 {
+		t.Fatal("Start rebalance job error, got:", job, err)
+	}
+	if job, err = store.StartRebalanceJob(before, after); err != nil || job.Generation != 1 {
+		t.Error("Expect the same rebalance job, got:", job, err)
+	}
+
+	// 加锁：其他apiServer在锁过期前无法加锁
+	if job, err = store.LockRebalanceJob("api1", time.Minute); err != nil || job == nil || job.Locker != "api1" {
+		t.Fatal("Lock rebalance job error, got:", job, err)
+	}
+	if job, err = store.LockRebalanceJob("api2", time.Minute); err != nil || job != nil {
+		t.Error("Expect rebalance job locked by api1, got:", job, err)
+	}
+
+	// 保存进度
+	job, _ = store.GetRebalanceJob()
+	job.Marker = "hash1"
+	if updated, err = store.UpdateRebalanceJob(job); err != nil || !updated {
+		t.Error("Update rebalance job error:", updated, err)
+	}
+
+	// 迁移中目标哈希环再次变化：原目标哈希环加入源哈希环，从头开始遍历，已加锁的apiServer无法保存进度
+	if job, err = store.StartRebalanceJob(after, after2); err != nil ||
+		job.Generation != 2 || len(job.Sources) != 2 || job.Marker != "" {
+		t.Error("Retarget rebalance job error, got:", job, err)
+	}
+	job.Generation = 1
+	job.Marker = "hash2"
+	if updated, err = store.UpdateRebalanceJob(job); err != nil || updated {
+		t.Error("Expect stale rebalance job not updated, got:", updated, err)
+	}
+
+	// 锁过期后由其他apiServer接管
+	if job, err = store.LockRebalanceJob("api1", -time.Second); err != nil || job == nil {
+		t.Fatal("Lock rebalance job error, got:", job, err)
+	}
+	if job, err = store.LockRebalanceJob("api2", time.Minute); err != nil || job == nil || job.Locker != "api2" {
+		t.Error("Expect rebalance job taken over by api2, got:", job, err)
+	}
+
+	// 有迁移失败的对象时，完成后可重新执行；新的哈希环变化保留原来的源哈希环
+	job.State = RebalanceStateFinished
+	job.Failed = 1
+	_, _ = store.UpdateRebalanceJob(job)
+	if job, err = store.RetryRebalanceJob(); err != nil ||
+		job.State != RebalanceStateRunning || job.Generation != 3 || job.Failed != 0 || len(job.Sources) != 2 {
+		t.Error("Retry rebalance job error, got:", job, err)
+	}
+	if job, err = store.RetryRebalanceJob(); err != nil || job.Generation != 3 {
+		t.Error("Expect running rebalance job not retried, got:", job, err)
+	}
+	job, _ = store.LockRebalanceJob("api2", time.Minute)
+	job.State = RebalanceStateFinished
+	job.Failed = 1
+	_, _ = store.UpdateRebalanceJob(job)
+	if job, err = store.StartRebalanceJob(after2, before); err != nil || job.Generation != 4 || len(job.Sources) != 3 {
+		t.Error("Expect sources of failed rebalance job kept, got:", job, err)
+	}
+	_ = store.Drop()
+
+	// 按照hash值的顺序遍历对象元数据
+	objects = newTestBoltStore(t, config.GConfig.ObjectColName)
+	_, _ = objects.PutObjectMeta("bucket", "c", 10, "hash3")
+	_, _ = objects.PutObjectMeta("bucket", "a", 10, "hash1")
+	_, _ = objects.PutObjectMeta("bucket", "b", 10, "hash2")
+	if metas, err = objects.ListHashMetas("hash1", 10); err != nil ||
+		len(metas) != 2 || metas[0].Hash != "hash2" || metas[1].Hash != "hash3" {
+		t.Error("List hash metas error, got:", metas, err)
+	}
+	_ = objects.Drop()
+}
+
+// 测试丢失分片的修复任务，以及丢失分片检测任务的加锁和进度保存
+func TestBoltStore_LostShardScan(t *testing.T) {
+	var (
+		repairs      Store
+		store        Store
+		repairMeta   *RepairShard
+		job          *ScanJob
+		rebalanceJob *RebalanceJob
+		updated      bool
+		err          error
+	)
+
+	// 丢失分片的修复任务按照对象hash值构造shardHash，记录丢失的分片下标和数量
+	repairs = newTestBoltStore(t, config.GConfig.RepairObjColName)
+	if _, err = repairs.PutLostShardMeta("hash1", []int{0, 3}); err != nil {
+		t.Fatal("Put lost shard meta error:", err)
+	}
+	if repairMeta, err = repairs.GetRepairShardMeta(LostShardKey("hash1")); err != nil ||
+		repairMeta.ObjHash != "hash1" || repairMeta.ShardIndex != "0,3" || repairMeta.Lost != 2 {
+		t.Error("Get lost shard meta error, got:", repairMeta, err)
+	}
+	if _, err = repairs.DeleteRepairObjectMeta(LostShardKey("hash1")); err != nil {
+		t.Error("Delete lost shard meta error:", err)
+	}
+	_ = repairs.Drop()
+
+	// 任务不存在时加锁即创建，其他apiServer在锁过期前无法加锁
+	store = newTestBoltStore(t, config.GConfig.RebalanceColName)
+	if job, err = store.LockScanJob(LostShardScanName, "api1", time.Minute); err != nil ||
+		job == nil || job.Round != 1 || job.Locker != "api1" {
+		t.Fatal("Lock scan job error, got:", job, err)
+	}
+	if job, err = store.LockScanJob(LostShardScanName, "api2", time.Minute); err != nil || job != nil {
+		t.Error("Expect scan job locked by api1, got:", job, err)
+	}
+
+	// 保存进度：只有持有锁的apiServer才能保存
+	job, _ = store.LockScanJob(LostShardScanName, "api1", -time.Second)
+	job.Marker = "hash1"
+	job.Objects = 1
+	if updated, err = store.UpdateScanJob(job); err != nil || !updated {
+		t.Error("Update scan job error:", updated, err)
+	}
+
+	// 锁过期后由其他apiServer接管，并从保存的进度处继续，原持有者无法再保存进度
+	if job, err = store.LockScanJob(LostShardScanName, "api2", time.Minute); err != nil ||
+		job == nil || job.Locker != "api2" || job.Marker != "hash1" || job.Objects != 1 {
+		t.Fatal("Expect scan job taken over by api2, got:", job, err)
+	}
+	job.Locker = "api1"
+	if updated, err = store.UpdateScanJob(job); err != nil || updated {
+		t.Error("Expect scan job not updated by api1, got:", updated, err)
+	}
+
+	// 检测任务与数据迁移任务保存在同一集合中，互不影响
+	if rebalanceJob, err = store.GetRebalanceJob(); err != nil || rebalanceJob != nil {
+		t.Error("Expect no rebalance job, got:", rebalanceJob, err)
+	}
+	_ = store.Drop()
+}
+
+// 测试数据节点的状态更新及其变化事件
+func TestBoltStore_NodeState(t *testing.T) {
+	var (
+		store   *boltStore
+		events  <-chan *ChangeEvent
+		event   *ChangeEvent
+		node    *DsNode
+		matched bool
+		err     error
+	)
+
+	store = newTestBoltStore(t, config.GConfig.NodeColName)
+	if events, err = store.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = store.AddDsNode("192.168.1.210", 1)
+	<-events
+	if node, err = store.GetNodeByIp("192.168.1.210"); err != nil || node.State != NodeStateActive {
+		t.Error("Expect active node, got:", node, err)
+	}
+	if matched, err = store.SetDsNodeState("192.168.1.210", NodeStateDraining); err != nil || !matched {
+		t.Error("Set node state error:", matched, err)
+	}
+	if event = <-events; event.Type != "update" || event.DocKey.ObjectId != node.OId {
+		t.Error("Expect update event, got:", event)
+	}
+	if node, err = store.GetNodeByIp("192.168.1.210"); err != nil || node.State != NodeStateDraining {
+		t.Error("Expect draining node, got:", node, err)
+	}
+	if matched, err = store.SetDsNodeState("192.168.1.211", NodeStateDraining); err != nil || matched {
+		t.Error("Expect node not found, got:", matched, err)
+	}
+	if _, err = store.GetNodeByIp("192.168.1.211"); err != common.ErrNodeNotFound {
+		t.Error("Expect ErrNodeNotFound, got:", err)
+	}
+	_ = store.Drop()
+}
+
+// 测试数据节点的权重、已满标记更新及其变化事件（没有变化时不产生事件）
+func TestBoltStore_NodeWeight(t *testing.T) {
+	var (
+		store   *boltStore
+		events  <-chan *ChangeEvent
+		event   *ChangeEvent
+		node    *DsNode
+		matched bool
+		err     error
+	)
+
+	store = newTestBoltStore(t, config.GConfig.NodeColName)
+	if events, err = store.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = store.AddDsNode("192.168.1.210", 1)
+	<-events
+
+	if matched, err = store.SetDsNodeWeight("192.168.1.210", 3, false); err != nil || !matched {
+		t.Error("Set node weight error:", matched, err)
+	}
+	if event = <-events; event.Type != "update" {
+		t.Error("Expect update event, got:", event)
+	}
+	if matched, err = store.SetDsNodeWeight("192.168.1.210", 3, false); err != nil || !matched {
+		t.Error("Set node weight error:", matched, err)
+	}
+	if matched, err = store.SetDsNodeFull("192.168.1.210", true); err != nil || !matched {
+		t.Error("Set node full error:", matched, err)
+	}
+	if event = <-events; event.Type != "update" {
+		t.Error("Expect update event, got:", event)
+	}
+	select {
+	case event = <-events:
+		t.Error("Expect no event for unchanged node, got:", event)
+	default:
+	}
+	if node, err = store.GetNodeByIp("192.168.1.210"); err != nil || node.Weight != 3 || node.FixedWeight || !node.Full {
+		t.Error("Expect full node with weight 3, got:", node, err)
+	}
+
+	if matched, err = store.SetDsNodeWeight("192.168.1.211", 3, true); err != nil || matched {
+		t.Error("Expect node not found, got:", matched, err)
+	}
+	if matched, err = store.SetDsNodeFull("192.168.1.211", true); err != nil || matched {
+		t.Error("Expect node not found, got:", matched, err)
+	}
+	_ = store.Drop()
+}
@@ -0,0 +1,88 @@
+package meta
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"config"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+	"utils"
+)
+
+// 未配置mongodbOpTimeout时单次数据库操作的超时时间（单位：秒）
+const defaultOpTimeout = 10
+
+// 进程内共用的MongoDB客户端（所有DossMongo共用该客户端的连接池）
+var (
+	mongoClient      *mongo.Client
+	mongoClientMutex sync.Mutex
+)
+
+// ---------------------------------
+// 获取进程内共用的MongoDB客户端
+// NOTE:
+//   1) 首次调用时创建客户端，连接池大小为配置项mongodbPoolSize（为0时使用驱动的默认值）；
+//   2) 创建失败时返回错误，下一次调用时重新创建
+// ---------------------------------
+func getMongoClient() (client *mongo.Client, err error) {
+	var (
+		clientOptions *options.ClientOptions
+		ctx           context.Context
+		cancel        context.CancelFunc
+	)
+
+	mongoClientMutex.Lock()
+	defer mongoClientMutex.Unlock()
+	if mongoClient != nil {
+		return mongoClient, nil
+	}
+
+	clientOptions = options.Client().ApplyURI(utils.GetMongodbUrl())
+	if config.GConfig.MongoPoolSize > 0 {
+		clientOptions.SetMaxPoolSize(config.GConfig.MongoPoolSize)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), config.GConfig.MongoConnectTimeout*time.Second)
+	defer cancel()
+	if client, err = mongo.Connect(ctx, clientOptions); err != nil {
+		return
+	}
+	mongoClient = client
+	return
+}
+
+// 生成单次数据库操作的context（超时时间为配置项mongodbOpTimeout，查询时包括遍历结果的时间）
+func opContext() (context.Context, context.CancelFunc) {
+	var timeout = config.GConfig.MongoOpTimeout
+
+	if timeout <= 0 {
+		timeout = defaultOpTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout*time.Second)
+}
+
+// ---------------------------------
+// 释放元数据存储的资源：断开共用的MongoDB客户端、关闭嵌入式存储的数据库文件
+// NOTE: 进程退出前调用，调用之后再次获取Store时将重新建立连接
+// ---------------------------------
+func Close() (err error) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	mongoClientMutex.Lock()
+	if mongoClient != nil {
+		ctx, cancel = opContext()
+		err = mongoClient.Disconnect(ctx)
+		cancel()
+		mongoClient = nil
+	}
+	mongoClientMutex.Unlock()
+
+	if boltErr := closeBoltDB(); err == nil {
+		err = boltErr
+	}
+	return
+}
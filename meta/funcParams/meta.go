@@ -1,5 +1,7 @@
 package funcParams
 
+import "common"
+
 // ---------------------------------
 // 实现元数据操作的可选参数，支持默认值
 // EXPLAIN：使用Functional Options Pattern方式
@@ -8,9 +10,13 @@ package funcParams
 // 定义函数类型：用于修改MetaParams结构体
 type MetaParamFunc func(opts *MetaParams)
 
-// MongoDB的选项：Version: 版本号
+// MongoDB的选项：Version: 版本号；EC: 写入元数据时记录的纠删码方案（为空则不记录，读取时按旧方案处理）；
+// Inline、Data: 对象数据内联存储在元数据中
 type MetaParams struct {
 	Version int
+	EC      common.ECScheme
+	Inline  bool
+	Data    []byte
 }
 
 // 创建默认参数（Version默认值为-1，代表最新版本）
@@ -28,6 +34,21 @@ func MetaParamVersion(version int) MetaParamFunc {
 	}
 }
 
+// 设置EC属性（通过闭包产生可以修改MetaParams结构体的EC属性的函数）
+func MetaParamEC(ec common.ECScheme) MetaParamFunc {
+	return func(params *MetaParams) {
+		params.EC = ec
+	}
+}
+
+// 设置Inline、Data属性：对象数据内联存储在元数据中
+func MetaParamInline(data []byte) MetaParamFunc {
+	return func(params *MetaParams) {
+		params.Inline = true
+		params.Data = data
+	}
+}
+
 // ----------------------------
 // 获取MetaParams结构体（通过传入的函数参数生成MetaParams结构体并返回引用地址）
 // ----------------------------
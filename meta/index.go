@@ -0,0 +1,61 @@
+package meta
+
+import (
+	"config"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+)
+
+// -------------------------------------------
+// 创建元数据集合所需的索引（索引已存在时MongoDB不会重复创建，可在程序启动时调用）
+// NOTE: 嵌入式存储的键已按照查询方式构造，无需创建索引
+// -------------------------------------------
+func EnsureIndexes() (err error) {
+	var DMongo *DossMongo
+
+	if config.GConfig.MetaBackend == BackendBolt {
+		return
+	}
+	if DMongo, err = NewDossMongo(); err != nil {
+		return
+	}
+	ctx, cancel := opContext()
+	defer cancel()
+
+	// 对象元数据集合（(bucket, name, version)唯一，保证多个apiServer并发上传同名对象时版本号不重复）
+	if _, err = DMongo.Collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: &ObjectNameIndex{Bucket: 1, Name: 1, Version: -1}, Options: options.Index().SetUnique(true)},
+		{Keys: &ObjectHashIndex{Hash: 1}},
+	}); err != nil {
+		return
+	}
+
+	// 存储桶元数据集合
+	if _, err = DMongo.Database.Collection(config.GConfig.BucketColName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    &BucketNameIndex{Name: 1},
+		Options: options.Index().SetUnique(true),
+	}); err != nil {
+		return
+	}
+
+	// 分片上传元数据集合、part元数据集合
+	if _, err = DMongo.Database.Collection(config.GConfig.UploadColName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    &UploadIdIndex{UploadId: 1},
+		Options: options.Index().SetUnique(true),
+	}); err != nil {
+		return
+	}
+	if _, err = DMongo.partCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: &UploadPartIndex{UploadId: 1, Number: 1}, Options: options.Index().SetUnique(true)},
+		{Keys: &UploadPartHashIndex{Hash: 1}},
+	}); err != nil {
+		return
+	}
+
+	// 数据迁移任务集合（任务名唯一，保证多个apiServer同时创建任务时只有一个成功）
+	_, err = DMongo.Database.Collection(config.GConfig.RebalanceColName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    &RebalanceNameIndex{Name: 1},
+		Options: options.Index().SetUnique(true),
+	})
+	return
+}
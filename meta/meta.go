@@ -2,8 +2,14 @@ package meta
 
 import (
 	"context"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"common"
 	"github.com/mongodb/mongo-go-driver/bson/primitive"
 	"github.com/mongodb/mongo-go-driver/mongo"
 	"github.com/mongodb/mongo-go-driver/mongo/options"
@@ -11,12 +17,21 @@ import (
 	"meta/funcParams"
 )
 
+const (
+	listBatchSize = 1000         // 列举对象时每批从数据库读取的对象名数量
+	maxNameChar   = "\U0010FFFF" // 比任何合法对象名字符都大的字符，用于跳过某个前缀下的所有对象
+)
+
+// 上传对象元数据时版本号冲突的最大重试次数
+const maxPutMetaRetry = 100
+
 // -------------------------------------------
 // 上传对象元数据（插入一条文档）
 // NOTE:
-// 	 1) 若name存在则将版本号加1，若不存在则版本号置为1；
-// 	 2) 该方法整个执行过程需用原子锁得以并发保证，这是因为：
-// 	    可能存在多个协程在GetLastVersionMeta得到都是1，导致真正插入操作InsertOne时插入的版本号全部是2
+// 	 1) 对象名在存储桶内唯一，若bucket下name存在则将版本号加1，若不存在则版本号置为1；
+// 	 2) 版本号的唯一性由(bucket, name, version)唯一索引保证（由EnsureIndexes创建，apiServer启动时调用，创建失败时拒绝启动）：
+// 	    多个apiServer可能同时得到相同的最新版本号，插入时违反唯一索引的一方重新获取最新版本号后再插入；
+// 	 3) 进程内的原子锁只用于减少同一个apiServer内各协程之间的版本号冲突
 // -------------------------------------------
 // 声明PutObjectMeta操作的原子锁
 var putMetaMutex *sync.Mutex
@@ -25,51 +40,94 @@ var putMetaMutex *sync.Mutex
 func init() {
 	putMetaMutex = new(sync.Mutex)
 }
-func (DMongo *DossMongo) PutObjectMeta(name string, size int64, hash string) (
-	insertedID primitive.ObjectID, err error) {
+func (DMongo *DossMongo) PutObjectMeta(bucket string, name string, size int64, hash string,
+	paramFunc ...funcParams.MetaParamFunc) (insertedID primitive.ObjectID, err error) {
+
+	// 将执行过程加原子锁
+	putMetaMutex.Lock()
+	defer putMetaMutex.Unlock()
+
+	return DMongo.insertObjectMeta(bucket, name, size, hash, paramFunc...)
+}
+
+// 插入版本号为最新版本号加1的对象元数据，版本号被其他写入者占用时随机等待一段时间后重试
+func (DMongo *DossMongo) insertObjectMeta(bucket string, name string, size int64, hash string,
+	paramFunc ...funcParams.MetaParamFunc) (insertedID primitive.ObjectID, err error) {
 
 	var (
+		params  = funcParams.NewMetaParams(paramFunc)
 		version int
+		now     time.Time
+		created time.Time
 		doc     *ObjectMeta
 		meta    *ObjectMeta
 		result  *mongo.InsertOneResult
+		retry   int
 	)
 
-	// 将执行过程加原子锁
-	putMetaMutex.Lock()
-	defer putMetaMutex.Unlock()
+	for retry = 0; retry < maxPutMetaRetry; retry++ {
+		if retry > 0 {
+			time.Sleep(time.Duration(rand.Intn(10)+1) * time.Millisecond)
+		}
 
-	// 获取该对象最新的版本号
-	meta, err = DMongo.GetLastVersionMeta(name)
-	if err != nil || meta == nil {
+		// 获取该对象最新的版本号和创建时间（若最新版本为删除标记，则重新计算创建时间）
+		now = time.Now().UTC()
+		created = now
+		if meta, err = DMongo.GetLastVersionMeta(bucket, name); err != nil {
+			return
+		}
 		version = 0
-	} else {
-		version = meta.Version
-	}
+		if meta != nil {
+			version = meta.Version
+			if meta.Hash != "" && !meta.Created.IsZero() {
+				created = meta.Created
+			}
+		}
 
-	// 构造待上传的BSON文档并进行插入
-	doc = &ObjectMeta{
-		Name:    name,
-		Version: version + 1,
-		Size:    size,
-		Hash:    hash,
-	}
-	if result, err = DMongo.Collection.InsertOne(context.TODO(), doc); err != nil {
+		// 构造待上传的BSON文档并进行插入
+		doc = &ObjectMeta{
+			Bucket:   bucket,
+			Name:     name,
+			Version:  version + 1,
+			Size:     size,
+			Hash:     hash,
+			EC:       params.EC,
+			Inline:   params.Inline,
+			Data:     params.Data,
+			Created:  created,
+			Modified: now,
+		}
+		// 每次插入使用新的超时上下文（重试期间之前的上下文可能已经超时）
+		ctx, cancel := opContext()
+		result, err = DMongo.Collection.InsertOne(ctx, doc)
+		cancel()
+		if err != nil {
+			if isDuplicateKeyError(err) {
+				continue
+			}
+			return
+		}
+
+		// result.InsertedID类型为interface{}，故需进行类型断言转换为primitive.ObjectID类型
+		insertedID = result.InsertedID.(primitive.ObjectID)
 		return
 	}
-
-	// result.InsertedID类型为interface{}，故需进行类型断言转换为primitive.ObjectID类型
-	insertedID = result.InsertedID.(primitive.ObjectID)
+	err = common.ErrVersionConflict
 	return
 }
 
+// 判断是否为违反唯一索引的错误（MongoDB错误码E11000）
+func isDuplicateKeyError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "E11000")
+}
+
 // -------------------------------------------
 // 获取对象元数据
 // call方式：
-//   1) GetObjectMeta(name): 返回该对象最新版本的元数据
-//   2) GetObjectMeta(name, MetaOptVersion(version)): 返回该对象版本号为version的元数据
+//   1) GetObjectMeta(bucket, name): 返回该对象最新版本的元数据
+//   2) GetObjectMeta(bucket, name, MetaOptVersion(version)): 返回该对象版本号为version的元数据
 // -------------------------------------------
-func (DMongo *DossMongo) GetObjectMeta(name string, paramFunc ...funcParams.MetaParamFunc) (
+func (DMongo *DossMongo) GetObjectMeta(bucket string, name string, paramFunc ...funcParams.MetaParamFunc) (
 	meta *ObjectMeta, err error) {
 
 	var (
@@ -79,23 +137,27 @@ func (DMongo *DossMongo) GetObjectMeta(name string, paramFunc ...funcParams.Meta
 		metaParams *funcParams.MetaParams
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 获取参数（版本号version，默认值为-1）
 	metaParams = funcParams.NewMetaParams(paramFunc)
 	version = metaParams.Version
 
 	// 若得出的版本号为-1，则查询最新版本
 	if version == -1 {
-		return DMongo.GetLastVersionMeta(name)
+		return DMongo.GetLastVersionMeta(bucket, name)
 	}
 
 	// 过滤条件
 	filter = &NameVersionFilter{
+		Bucket:  bucket,
 		Name:    name,
 		Version: version,
 	}
 
 	// 执行FindOne查询操作（若不存在则将err置为nil）
-	if result = DMongo.Collection.FindOne(context.TODO(), filter); result.Err() != nil {
+	if result = DMongo.Collection.FindOne(ctx, filter); result.Err() != nil {
 		meta = &ObjectMeta{}
 		if err = result.Err(); err == mongo.ErrNoDocuments {
 			err = nil
@@ -109,7 +171,7 @@ func (DMongo *DossMongo) GetObjectMeta(name string, paramFunc ...funcParams.Meta
 // -------------------------------------------
 // 获取对象最新版本的元数据
 // -------------------------------------------
-func (DMongo *DossMongo) GetLastVersionMeta(name string) (meta *ObjectMeta, err error) {
+func (DMongo *DossMongo) GetLastVersionMeta(bucket string, name string) (meta *ObjectMeta, err error) {
 	var (
 		filter     *NameFilter
 		findOption *options.FindOptions
@@ -117,9 +179,13 @@ func (DMongo *DossMongo) GetLastVersionMeta(name string) (meta *ObjectMeta, err
 		cursor     *mongo.Cursor
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 过滤条件
 	filter = &NameFilter{
-		Name: name,
+		Bucket: bucket,
+		Name:   name,
 	}
 
 	// 设置Find选项（version：倒序，limit：1）
@@ -129,13 +195,13 @@ func (DMongo *DossMongo) GetLastVersionMeta(name string) (meta *ObjectMeta, err
 	findOption = options.Find().SetSort(sortOption).SetLimit(1)
 
 	// Find最新版本的对象元数据
-	if cursor, err = DMongo.Collection.Find(context.TODO(), filter, findOption); err != nil {
+	if cursor, err = DMongo.Collection.Find(ctx, filter, findOption); err != nil {
 		return
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	// 解码BSON文档
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		meta = &ObjectMeta{}
 		if err = cursor.Decode(meta); err != nil {
 			continue
@@ -148,7 +214,7 @@ func (DMongo *DossMongo) GetLastVersionMeta(name string) (meta *ObjectMeta, err
 // -------------------------------------------
 // 获取对象所有版本的元数据
 // -------------------------------------------
-func (DMongo *DossMongo) GetAllVersionMetas(name string) (metas []*ObjectMeta, err error) {
+func (DMongo *DossMongo) GetAllVersionMetas(bucket string, name string) (metas []*ObjectMeta, err error) {
 	var (
 		filter     *NameFilter
 		findOption *options.FindOptions
@@ -157,9 +223,13 @@ func (DMongo *DossMongo) GetAllVersionMetas(name string) (metas []*ObjectMeta, e
 		meta       *ObjectMeta
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 过滤条件和排序条件（按照version升序）
 	filter = &NameFilter{
-		Name: name,
+		Bucket: bucket,
+		Name:   name,
 	}
 	sortOption = &SortMetaByVersion{
 		SortOrder: 1,
@@ -167,22 +237,163 @@ func (DMongo *DossMongo) GetAllVersionMetas(name string) (metas []*ObjectMeta, e
 	findOption = options.Find().SetSort(sortOption)
 
 	// Find最新版本的对象元数据
-	if cursor, err = DMongo.Collection.Find(context.TODO(), filter, findOption); err != nil {
+	if cursor, err = DMongo.Collection.Find(ctx, filter, findOption); err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	// 解码BSON文档
+	for cursor.Next(ctx) {
+		meta = &ObjectMeta{}
+		if err = cursor.Decode(meta); err != nil {
+			continue
+		}
+		metas = append(metas, meta)
+	}
+	return
+}
+
+// -------------------------------------------
+// 按照对象名顺序遍历存储桶中的对象元数据
+// Param:
+//   bucket: 存储桶名；prefix: 对象名前缀；marker: 从该对象名之后开始遍历（不包含marker）；
+//   limit: 最多返回多少个对象名的元数据；latestOnly: 是否只返回每个对象最新的版本
+// NOTE: 同一对象名的所有版本按照版本号倒序排列，遍历到第limit+1个对象名时即停止，不会扫描整个集合
+// -------------------------------------------
+func (DMongo *DossMongo) listMetas(bucket string, prefix string, marker string, limit int, latestOnly bool) (
+	metas []*ObjectMeta, err error) {
+
+	var (
+		filter     *NameRangeFilter
+		findOption *options.FindOptions
+		cursor     *mongo.Cursor
+		meta       *ObjectMeta
+		lastName   string
+		nameCount  int
+	)
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	// 过滤条件（对象名前缀、起始对象名）和排序条件（对象名升序、版本号倒序）
+	filter = &NameRangeFilter{Bucket: bucket, Name: NameRange{Gt: marker}}
+	if prefix != "" {
+		filter.Name.Regex = "^" + regexp.QuoteMeta(prefix)
+	}
+	findOption = options.Find().SetSort(&SortMetaByNameVersion{Name: 1, Version: -1})
+
+	if cursor, err = DMongo.Collection.Find(ctx, filter, findOption); err != nil {
 		return
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	// 解码BSON文档
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		meta = &ObjectMeta{}
 		if err = cursor.Decode(meta); err != nil {
 			continue
 		}
+		if meta.Name != lastName {
+			if nameCount == limit {
+				break
+			}
+			lastName = meta.Name
+			nameCount++
+		} else if latestOnly {
+			continue
+		}
 		metas = append(metas, meta)
 	}
 	return
 }
 
+// 按照对象名顺序获取每个对象最新版本的元数据（包含删除标记，即hash为空字符串的元数据）
+func (DMongo *DossMongo) ListLatestMetas(bucket string, prefix string, marker string, limit int) (
+	metas []*ObjectMeta, err error) {
+	return DMongo.listMetas(bucket, prefix, marker, limit, true)
+}
+
+// 按照对象名顺序获取对象所有版本的元数据（同一对象的版本按照版本号倒序）
+func (DMongo *DossMongo) ListVersionMetas(bucket string, prefix string, marker string, limit int) (
+	metas []*ObjectMeta, err error) {
+	return DMongo.listMetas(bucket, prefix, marker, limit, false)
+}
+
+// -------------------------------------------
+// 列举存储桶中的对象（只返回每个对象未被删除的最新版本），并按照delimiter汇总公共前缀
+// Param:
+//   prefix: 对象名前缀；delimiter: 分隔符（为空则不汇总公共前缀）；
+//   marker: 从该位置之后开始列举（即上一次列举返回的nextMarker，首次列举为空字符串）；
+//   limit: 返回的对象数与公共前缀数之和的上限
+// Return:
+//   nextMarker: 下一次列举的起始位置；truncated: 是否还有后续结果
+// NOTE:
+//   1) 依赖{bucket: 1, name: 1, version: -1}索引，查询条件为name的范围扫描（前缀正则以^开头时同样可以利用索引）；
+//   2) 遇到公共前缀时，以"公共前缀+最大字符"作为marker重新查询，跳过该公共前缀下的所有对象而不逐个扫描
+// -------------------------------------------
+func (DMongo *DossMongo) ListObjects(bucket, prefix, delimiter, marker string, limit int) (
+	metas []*ObjectMeta, prefixes []string, nextMarker string, truncated bool, err error) {
+	return listObjects(DMongo, bucket, prefix, delimiter, marker, limit)
+}
+
+// 列举对象的实现（各元数据存储后端共用，只依赖ListLatestMetas）
+func listObjects(store Store, bucket, prefix, delimiter, marker string, limit int) (
+	metas []*ObjectMeta, prefixes []string, nextMarker string, truncated bool, err error) {
+
+	var (
+		page    []*ObjectMeta
+		meta    *ObjectMeta
+		count   int
+		index   int
+		cp      string
+		skipped bool
+	)
+
+	for {
+		if page, err = store.ListLatestMetas(bucket, prefix, marker, listBatchSize); err != nil || len(page) == 0 {
+			return
+		}
+
+		skipped = false
+		for _, meta = range page {
+			marker = meta.Name
+			if meta.Hash == "" {
+				continue
+			}
+
+			// 汇总公共前缀，并跳过该公共前缀下的所有对象
+			if delimiter != "" {
+				if index = strings.Index(meta.Name[len(prefix):], delimiter); index >= 0 {
+					if count == limit {
+						truncated = true
+						return
+					}
+					cp = meta.Name[:len(prefix)+index+len(delimiter)]
+					prefixes = append(prefixes, cp)
+					count++
+					marker = cp + maxNameChar
+					nextMarker = marker
+					skipped = true
+					break
+				}
+			}
+
+			if count == limit {
+				truncated = true
+				return
+			}
+			metas = append(metas, meta)
+			count++
+			nextMarker = meta.Name
+		}
+
+		// 本批读取的对象数量不足一批，说明已经没有后续的对象
+		if !skipped && len(page) < listBatchSize {
+			return
+		}
+	}
+}
+
 // -------------------------------------------
 // 根据对象hash值获取对象最新版本的元数据
 // -------------------------------------------
@@ -195,6 +406,9 @@ func getAllMetasByHash(DMongo *DossMongo, hash string) (metas []*ObjectMeta, err
 		meta       *ObjectMeta
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 过滤条件
 	filter = &HashFilter{
 		Hash: hash,
@@ -207,13 +421,13 @@ func getAllMetasByHash(DMongo *DossMongo, hash string) (metas []*ObjectMeta, err
 	findOption = options.Find().SetSort(sortOption).SetLimit(1)
 
 	// Find最新版本的对象元数据
-	if cursor, err = DMongo.Collection.Find(context.TODO(), filter, findOption); err != nil {
+	if cursor, err = DMongo.Collection.Find(ctx, filter, findOption); err != nil {
 		return
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	// 解码BSON文档
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		meta = &ObjectMeta{}
 		if err = cursor.Decode(meta); err != nil {
 			continue
@@ -240,6 +454,39 @@ func (DMongo *DossMongo) GetMetaByHash(hash string) (meta *ObjectMeta, err error
 	return
 }
 
+// -------------------------------------------
+// 按照hash值升序列举hash值大于marker的对象元数据（最多limit条，用于数据迁移时遍历所有对象数据）
+// NOTE: 删除标记的hash值为空字符串，不会被列举；相同hash值的元数据可能有多条，由调用方去重
+// -------------------------------------------
+func (DMongo *DossMongo) ListHashMetas(marker string, limit int) (metas []*ObjectMeta, err error) {
+	var (
+		filter     *HashRangeFilter
+		findOption *options.FindOptions
+		cursor     *mongo.Cursor
+		meta       *ObjectMeta
+	)
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	filter = &HashRangeFilter{Hash: StringGreater{Gt: marker}}
+	findOption = options.Find().SetSort(&SortMetaByHash{Hash: 1}).SetLimit(int64(limit))
+	if cursor, err = DMongo.Collection.Find(ctx, filter, findOption); err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	// 解码BSON文档
+	for cursor.Next(ctx) {
+		meta = &ObjectMeta{}
+		if err = cursor.Decode(meta); err != nil {
+			continue
+		}
+		metas = append(metas, meta)
+	}
+	return
+}
+
 // -------------------------------------------
 // 获取所有的对象版本数量超过count的元数据
 // -------------------------------------------
@@ -251,19 +498,22 @@ func (DMongo *DossMongo) GetALLTooMuchVersionMeta(count int) (metas []*ObjectMet
 		meta       *ObjectMeta
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 过滤条件
 	filter = &VersionFilter{
 		Version: count + 1,
 	}
 
 	// Find最新版本的对象元数据
-	if cursor, err = DMongo.Collection.Find(context.TODO(), filter, findOption); err != nil {
+	if cursor, err = DMongo.Collection.Find(ctx, filter, findOption); err != nil {
 		return
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	// 解码BSON文档
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		meta = &ObjectMeta{}
 		if err = cursor.Decode(meta); err != nil {
 			continue
@@ -276,10 +526,10 @@ func (DMongo *DossMongo) GetALLTooMuchVersionMeta(count int) (metas []*ObjectMet
 // -------------------------------------------
 // 删除对象元数据
 // call方式：
-//   1) DeleteObjectMeta(name): 删除该对象所有版本的元数据
-//   2) DeleteObjectMeta(name, MetaOptVersion(version)): 删除该对象版本号为version的元数据
+//   1) DeleteObjectMeta(bucket, name): 删除该对象所有版本的元数据
+//   2) DeleteObjectMeta(bucket, name, MetaOptVersion(version)): 删除该对象版本号为version的元数据
 // -------------------------------------------
-func (DMongo *DossMongo) DeleteObjectMeta(name string, paramFunc ...funcParams.MetaParamFunc) (
+func (DMongo *DossMongo) DeleteObjectMeta(bucket string, name string, paramFunc ...funcParams.MetaParamFunc) (
 	deleteCount int64, err error) {
 
 	var (
@@ -289,6 +539,9 @@ func (DMongo *DossMongo) DeleteObjectMeta(name string, paramFunc ...funcParams.M
 		result     *mongo.DeleteResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 获取选项参数（版本号version，默认值为-1）
 	metaParams = funcParams.NewMetaParams(paramFunc)
 	version = metaParams.Version
@@ -296,17 +549,19 @@ func (DMongo *DossMongo) DeleteObjectMeta(name string, paramFunc ...funcParams.M
 	// 若得出的版本号为-1，则删除所有版本，若不为-1则删除给定版本的元数据
 	if version == -1 {
 		filter = &NameFilter{
-			Name: name,
+			Bucket: bucket,
+			Name:   name,
 		}
 	} else {
 		filter = &NameVersionFilter{
+			Bucket:  bucket,
 			Name:    name,
 			Version: version,
 		}
 	}
 
 	// 执行删除操作
-	if result, err = DMongo.Collection.DeleteMany(context.TODO(), filter); err != nil || result == nil {
+	if result, err = DMongo.Collection.DeleteMany(ctx, filter); err != nil || result == nil {
 		return
 	}
 	deleteCount = result.DeletedCount
@@ -319,7 +574,10 @@ func (DMongo *DossMongo) DeleteObjectMeta(name string, paramFunc ...funcParams.M
 func (DMongo *DossMongo) IsMetaCollectionEmpty() (empty bool, err error) {
 	var count int64
 
-	if count, err = DMongo.Collection.CountDocuments(context.TODO(), &bsonx.Doc{}); err != nil {
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if count, err = DMongo.Collection.CountDocuments(ctx, &bsonx.Doc{}); err != nil {
 		return
 	}
 	if count == 0 {
@@ -330,6 +588,152 @@ func (DMongo *DossMongo) IsMetaCollectionEmpty() (empty bool, err error) {
 	return
 }
 
+// -------------------------------------------
+// 查看存储桶是否为空（存储桶中所有对象的最新版本均为删除标记时视为空）
+// -------------------------------------------
+func (DMongo *DossMongo) IsBucketEmpty(bucket string) (empty bool, err error) {
+	return isBucketEmpty(DMongo, bucket)
+}
+
+// 查看存储桶是否为空的实现（各元数据存储后端共用，只依赖ListLatestMetas）
+func isBucketEmpty(store Store, bucket string) (empty bool, err error) {
+	var (
+		metas  []*ObjectMeta
+		meta   *ObjectMeta
+		marker string
+	)
+
+	for {
+		if metas, err = store.ListLatestMetas(bucket, "", marker, 1000); err != nil {
+			return
+		}
+		if len(metas) == 0 {
+			empty = true
+			return
+		}
+		for _, meta = range metas {
+			if meta.Hash != "" {
+				return
+			}
+			marker = meta.Name
+		}
+	}
+}
+
+// -------------------------------------------
+// 删除存储桶中所有对象的元数据（包括删除标记和历史版本）
+// -------------------------------------------
+func (DMongo *DossMongo) DeleteBucketObjectMetas(bucket string) (deleteCount int64, err error) {
+	var result *mongo.DeleteResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if result, err = DMongo.Collection.DeleteMany(ctx, &BucketFilter{Bucket: bucket}); err != nil || result == nil {
+		return
+	}
+	deleteCount = result.DeletedCount
+	return
+}
+
+// ===========================================
+// 存储桶元数据操作定义
+// ===========================================
+// -------------------------------------------
+// 创建存储桶元数据
+// NOTE: 使用FindOneAndUpdate的upsert + $setOnInsert保证并发创建同名存储桶时只有一个成功，
+//       若存储桶已存在则created为false
+// -------------------------------------------
+func (DMongo *DossMongo) CreateBucket(name string, paramFunc ...funcParams.MetaParamFunc) (created bool, err error) {
+	var (
+		filter *BucketNameFilter
+		update *BucketUpsert
+		result *mongo.SingleResult
+	)
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	filter = &BucketNameFilter{Name: name}
+	update = &BucketUpsert{
+		SetOnInsert: BucketMeta{Name: name, EC: funcParams.NewMetaParams(paramFunc).EC, Created: time.Now().UTC()},
+	}
+
+	// 返回的是更新之前的文档：若文档不存在，说明本次操作插入了新的存储桶
+	result = DMongo.Collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetUpsert(true))
+	if err = result.Err(); err == mongo.ErrNoDocuments {
+		created = true
+		err = nil
+	}
+	return
+}
+
+// -------------------------------------------
+// 获取存储桶元数据（若不存在则返回的meta.Name为空字符串）
+// -------------------------------------------
+func (DMongo *DossMongo) GetBucketMeta(name string) (meta *BucketMeta, err error) {
+	var result *mongo.SingleResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	meta = &BucketMeta{}
+	if result = DMongo.Collection.FindOne(ctx, &BucketNameFilter{Name: name}); result.Err() != nil {
+		if err = result.Err(); err == mongo.ErrNoDocuments {
+			err = nil
+		}
+		return
+	}
+	err = result.Decode(&meta)
+	return
+}
+
+// -------------------------------------------
+// 获取所有存储桶元数据（按照存储桶名升序）
+// -------------------------------------------
+func (DMongo *DossMongo) ListBucketMetas() (metas []*BucketMeta, err error) {
+	var (
+		findOption *options.FindOptions
+		cursor     *mongo.Cursor
+		meta       *BucketMeta
+	)
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	findOption = options.Find().SetSort(&SortBucketByName{Name: 1})
+	if cursor, err = DMongo.Collection.Find(ctx, &bsonx.Doc{}, findOption); err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	// 解码BSON文档
+	for cursor.Next(ctx) {
+		meta = &BucketMeta{}
+		if err = cursor.Decode(meta); err != nil {
+			continue
+		}
+		metas = append(metas, meta)
+	}
+	return
+}
+
+// -------------------------------------------
+// 删除存储桶元数据
+// -------------------------------------------
+func (DMongo *DossMongo) DeleteBucketMeta(name string) (deleteCount int64, err error) {
+	var result *mongo.DeleteResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if result, err = DMongo.Collection.DeleteOne(ctx, &BucketNameFilter{Name: name}); err != nil || result == nil {
+		return
+	}
+	deleteCount = result.DeletedCount
+	return
+}
+
 // ===========================================
 // 聚合对象元数据操作定义
 // ===========================================
@@ -343,6 +747,9 @@ func (DMongo *DossMongo) NewAggregateMeta() (insertedID primitive.ObjectID, err
 		result   *mongo.InsertOneResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 构造待上传的BSON文档并进行插入
 	objectId = primitive.NewObjectID()
 	doc = &AggregateMeta{
@@ -352,7 +759,7 @@ func (DMongo *DossMongo) NewAggregateMeta() (insertedID primitive.ObjectID, err
 		RefCount: 0,
 		RefBy:    []string{},
 	}
-	if result, err = DMongo.Collection.InsertOne(context.TODO(), doc); err != nil {
+	if result, err = DMongo.Collection.InsertOne(ctx, doc); err != nil {
 		return
 	}
 
@@ -370,9 +777,12 @@ func (DMongo *DossMongo) GetAggregateMeta(name string) (meta *AggregateMeta, err
 		filter *AggregateNameFilter
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	filter = &AggregateNameFilter{Name: name}
 	meta = &AggregateMeta{}
-	if result = DMongo.Collection.FindOne(context.TODO(), filter); result.Err() != nil {
+	if result = DMongo.Collection.FindOne(ctx, filter); result.Err() != nil {
 		if err = result.Err(); err == mongo.ErrNoDocuments {
 			err = nil
 		}
@@ -391,42 +801,31 @@ func (DMongo *DossMongo) GetAggregateMeta(name string) (meta *AggregateMeta, err
 // -------------------------------------------
 func (DMongo *DossMongo) UpdateAggregateMeta(name string, size int64, RefCount int, RefBy string) (err error) {
 	var (
-		filter   *AggregateNameFilter
-		update   *AggregateUpdate
-		meta     *AggregateMeta
-		refCount int
-		newRefBy []string
-		result   *mongo.SingleResult
+		filter *AggregateNameFilter
+		update *AggregateUpdate
+		meta   *AggregateMeta
+		result *mongo.SingleResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 过滤条件
 	filter = &AggregateNameFilter{
 		Name: name,
 	}
 
 	// 更新size、ref_count属性
-	if meta, err = DMongo.GetAggregateMeta(name); err == nil && meta.Name != "" {
-		refCount = RefCount + meta.RefCount
-		if RefCount == 1 {
-			newRefBy = append(newRefBy, meta.RefBy...)
-			newRefBy = append(newRefBy, RefBy)
-		} else if RefCount == -1 {
-			newRefBy = append(newRefBy, meta.RefBy[:len(RefBy)]...)
-		}
-	}
-	if size < 0 && meta != nil {
-		size = meta.Size
-	}
-	if RefBy == "" && meta != nil {
-		newRefBy = meta.RefBy
+	if meta, err = DMongo.GetAggregateMeta(name); err != nil || meta.Name == "" {
+		meta = nil
 	}
 	update = &AggregateUpdate{
-		Set: AggregateSet{Size: size, RefCount: refCount, RefBy: newRefBy},
+		Set: newAggregateSet(meta, size, RefCount, RefBy),
 	}
 
 	// 执行FindOneAndUpdate更新操作（若文档不存在则将err置为nil）
 	// NOTE: FindOneAndUpdate可以保证更新操作的原子性
-	if result = DMongo.Collection.FindOneAndUpdate(context.TODO(), filter, update); result.Err() != nil {
+	if result = DMongo.Collection.FindOneAndUpdate(ctx, filter, update); result.Err() != nil {
 		if err = result.Err(); err == mongo.ErrNoDocuments {
 			err = nil
 		}
@@ -434,6 +833,31 @@ func (DMongo *DossMongo) UpdateAggregateMeta(name string, size int64, RefCount i
 	return
 }
 
+// 根据聚合对象当前的元数据（不存在时为nil）计算更新后的size、ref_count、ref_by属性（各元数据存储后端共用）
+func newAggregateSet(meta *AggregateMeta, size int64, RefCount int, RefBy string) AggregateSet {
+	var (
+		refCount int
+		newRefBy []string
+	)
+
+	if meta != nil {
+		refCount = RefCount + meta.RefCount
+		if RefCount == 1 {
+			newRefBy = append(newRefBy, meta.RefBy...)
+			newRefBy = append(newRefBy, RefBy)
+		} else if RefCount == -1 {
+			newRefBy = append(newRefBy, meta.RefBy[:len(RefBy)]...)
+		}
+		if size < 0 {
+			size = meta.Size
+		}
+		if RefBy == "" {
+			newRefBy = meta.RefBy
+		}
+	}
+	return AggregateSet{Size: size, RefCount: refCount, RefBy: newRefBy}
+}
+
 // -------------------------------------------
 // 删除聚合对象元数据
 // -------------------------------------------
@@ -443,10 +867,13 @@ func (DMongo *DossMongo) DeleteAggregateMeta(name string) (deleteCount int64, er
 		result *mongo.DeleteResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	filter = &AggregateNameFilter{
 		Name: name,
 	}
-	if result, err = DMongo.Collection.DeleteMany(context.TODO(), filter); err != nil || result == nil {
+	if result, err = DMongo.Collection.DeleteMany(ctx, filter); err != nil || result == nil {
 		return
 	}
 	deleteCount = result.DeletedCount
@@ -463,14 +890,17 @@ func (DMongo *DossMongo) DeleteUnRefAggregates() (names []string, err error) {
 		meta   *AggregateMeta
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	filter = &AggregateRefCountFilter{RefCount: 0}
-	if cursor, err = DMongo.Collection.Find(context.TODO(), filter); err != nil {
+	if cursor, err = DMongo.Collection.Find(ctx, filter); err != nil {
 		return
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	// 解码BSON文档
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		meta = &AggregateMeta{}
 		if err = cursor.Decode(meta); err != nil {
 			continue
@@ -496,6 +926,9 @@ func (DMongo *DossMongo) PutObjectShardMeta(object string, index int, size int64
 		result *mongo.InsertOneResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 构造待上传的BSON文档并进行插入
 	doc = &ObjectShardMeta{
 		Object:    object,
@@ -504,7 +937,7 @@ func (DMongo *DossMongo) PutObjectShardMeta(object string, index int, size int64
 		Hash:      hash,
 		Aggregate: aggObjects,
 	}
-	if result, err = DMongo.Collection.InsertOne(context.TODO(), doc); err != nil {
+	if result, err = DMongo.Collection.InsertOne(ctx, doc); err != nil {
 		return
 	}
 
@@ -522,9 +955,12 @@ func (DMongo *DossMongo) GetShardMetaByIndex(object string, index int) (meta *Ob
 		filter *ShardIndexFilter
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	filter = &ShardIndexFilter{Object: object, Index: index}
 	meta = &ObjectShardMeta{}
-	if result = DMongo.Collection.FindOne(context.TODO(), filter); result.Err() != nil {
+	if result = DMongo.Collection.FindOne(ctx, filter); result.Err() != nil {
 		if err = result.Err(); err == mongo.ErrNoDocuments {
 			err = nil
 		}
@@ -544,17 +980,48 @@ func (DMongo *DossMongo) GetShardMetaByHash(hash string) (metas []*ObjectShardMe
 		meta   *ObjectShardMeta
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 过滤条件
 	filter = &ShardHashFilter{Hash: hash}
 
 	// Find最新版本的对象元数据
-	if cursor, err = DMongo.Collection.Find(context.TODO(), filter); err != nil {
+	if cursor, err = DMongo.Collection.Find(ctx, filter); err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	// 解码BSON文档
+	for cursor.Next(ctx) {
+		meta = &ObjectShardMeta{}
+		if err = cursor.Decode(meta); err != nil {
+			continue
+		}
+		metas = append(metas, meta)
+	}
+	return
+}
+
+// -------------------------------------------
+// 获取对象的所有分片元数据（按照对象hash值）
+// -------------------------------------------
+func (DMongo *DossMongo) GetShardMetasByObject(object string) (metas []*ObjectShardMeta, err error) {
+	var (
+		cursor *mongo.Cursor
+		meta   *ObjectShardMeta
+	)
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if cursor, err = DMongo.Collection.Find(ctx, &ShardObjectFilter{Object: object}); err != nil {
 		return
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	// 解码BSON文档
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		meta = &ObjectShardMeta{}
 		if err = cursor.Decode(meta); err != nil {
 			continue
@@ -574,13 +1041,16 @@ func (DMongo *DossMongo) DeleteShardMetaByObjHash(objHash string) (count int64,
 		result *mongo.UpdateResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	filter = &ShardObjectFilter{
 		Object: objHash,
 	}
 	update = &ShardHashUpdate{
 		Set: ShardHashFilter{Hash: ""},
 	}
-	if result, err = DMongo.Collection.UpdateMany(context.TODO(), filter, update); err != nil {
+	if result, err = DMongo.Collection.UpdateMany(ctx, filter, update); err != nil {
 		return
 	}
 	count = result.ModifiedCount
@@ -596,10 +1066,13 @@ func (DMongo *DossMongo) DeleteShardMeta(hash string) (deleteCount int64, err er
 		result *mongo.DeleteResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	filter = &ShardHashFilter{
 		Hash: hash,
 	}
-	if result, err = DMongo.Collection.DeleteOne(context.TODO(), filter); err != nil || result == nil {
+	if result, err = DMongo.Collection.DeleteOne(ctx, filter); err != nil || result == nil {
 		return
 	}
 	deleteCount = result.DeletedCount
@@ -611,17 +1084,52 @@ func (DMongo *DossMongo) DeleteShardMetaByIndex(object string, index int) (delet
 		result *mongo.DeleteResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	filter = &ShardIndexFilter{
 		Object: object,
 		Index:  index,
 	}
-	if result, err = DMongo.Collection.DeleteOne(context.TODO(), filter); err != nil || result == nil {
+	if result, err = DMongo.Collection.DeleteOne(ctx, filter); err != nil || result == nil {
 		return
 	}
 	deleteCount = result.DeletedCount
 	return
 }
 
+// -------------------------------------------
+// 更新分片所在的聚合对象（用于聚合对象整理）
+// NOTE: 只有分片hash值和所在的聚合对象仍为oldAggs时才更新（比较并交换），分片在此期间被删除、修复或者迁移时不更新
+// -------------------------------------------
+func (DMongo *DossMongo) SwapShardAggregate(object string, index int, hash string, oldAggs []*AggObject,
+	newAggs []*AggObject) (swapped bool, err error) {
+
+	var (
+		filter *ShardSwapFilter
+		update *ShardAggregateUpdate
+		result *mongo.UpdateResult
+	)
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	filter = &ShardSwapFilter{
+		Object:    object,
+		Index:     index,
+		Hash:      hash,
+		Aggregate: oldAggs,
+	}
+	update = &ShardAggregateUpdate{
+		Set: ShardAggregateSet{Aggregate: newAggs},
+	}
+	if result, err = DMongo.Collection.UpdateOne(ctx, filter, update); err != nil || result == nil {
+		return
+	}
+	swapped = result.ModifiedCount == 1
+	return
+}
+
 // ===========================================
 // 待修复对象分片元数据操作定义
 // ===========================================
@@ -636,13 +1144,16 @@ func (DMongo *DossMongo) PutRepairShardMeta(objHash string, shardIndex string, s
 		result *mongo.InsertOneResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 构造待上传的BSON文档并进行插入
 	doc = &RepairShard{
 		ObjHash:    objHash,
 		ShardIndex: shardIndex,
 		ShardHash:  shardHash,
 	}
-	if result, err = DMongo.Collection.InsertOne(context.TODO(), doc); err != nil {
+	if result, err = DMongo.Collection.InsertOne(ctx, doc); err != nil {
 		return
 	}
 
@@ -651,14 +1162,52 @@ func (DMongo *DossMongo) PutRepairShardMeta(objHash string, shardIndex string, s
 	return
 }
 
+// -------------------------------------------
+// 上传丢失分片的修复任务：shardHash为LostShardKey(objHash)，shardIndex为逗号分隔的丢失分片下标
+// NOTE: 分片文件已不存在，dataServer无法感知修复完成，由修复的apiServer重新检测分片后删除该修复任务
+// -------------------------------------------
+func (DMongo *DossMongo) PutLostShardMeta(objHash string, lostShards []int) (
+	insertedID primitive.ObjectID, err error) {
+
+	var result *mongo.InsertOneResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if result, err = DMongo.Collection.InsertOne(ctx, newLostShardMeta(objHash, lostShards)); err != nil {
+		return
+	}
+	insertedID = result.InsertedID.(primitive.ObjectID)
+	return
+}
+
+// 构造丢失分片的修复任务（各元数据存储后端共用）
+func newLostShardMeta(objHash string, lostShards []int) *RepairShard {
+	var indexes = make([]string, 0, len(lostShards))
+
+	for _, index := range lostShards {
+		indexes = append(indexes, strconv.Itoa(index))
+	}
+	return &RepairShard{
+		ObjHash:    objHash,
+		ShardIndex: strings.Join(indexes, ","),
+		ShardHash:  LostShardKey(objHash),
+		Lost:       len(lostShards),
+	}
+}
+
 // -------------------------------------------
 // 获取待修复对象分片元数据
 // -------------------------------------------
 func (DMongo *DossMongo) getRepairMetaByFilter(filter interface{}) (shardMeta *RepairShard, err error) {
 	var result *mongo.SingleResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
 	shardMeta = &RepairShard{}
 
-	if result = DMongo.Collection.FindOne(context.TODO(), filter); result.Err() != nil {
+	if result = DMongo.Collection.FindOne(ctx, filter); result.Err() != nil {
 		if err = result.Err(); err == mongo.ErrNoDocuments {
 			err = nil
 		}
@@ -684,19 +1233,22 @@ func (DMongo *DossMongo) GetRepairShardMetaByLocker(locker string) (metas []*Rep
 		meta   *RepairShard
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 过滤条件和排序条件（按照version升序）
 	filter = &RepairLockerFilter{
 		Locker: locker,
 	}
 
 	// Find最新版本的对象元数据
-	if cursor, err = DMongo.Collection.Find(context.TODO(), filter); err != nil {
+	if cursor, err = DMongo.Collection.Find(ctx, filter); err != nil {
 		return
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	// 解码BSON文档
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		meta = &RepairShard{}
 		if err = cursor.Decode(meta); err != nil {
 			continue
@@ -707,32 +1259,101 @@ func (DMongo *DossMongo) GetRepairShardMetaByLocker(locker string) (metas []*Rep
 }
 
 // -------------------------------------------
-// 获取待修复对象分片元数据
+// 获取修复租约未被加锁或者已过期的待修复对象分片元数据（用于接管宕机apiServer的修复任务）
 // -------------------------------------------
-func (DMongo *DossMongo) UpdateRepairShardMeta(shardHash string, locker string) (err error) {
+func (DMongo *DossMongo) GetExpiredRepairShardMetas() (metas []*RepairShard, err error) {
 	var (
-		filter *RepairShardFilter
+		filter *RepairExpiredFilter
+		cursor *mongo.Cursor
+		meta   *RepairShard
+	)
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	filter = &RepairExpiredFilter{
+		Or: []interface{}{
+			&RepairLockerFilter{Locker: ""},
+			&RepairLockExpire{LockExpire: TimeLess{Lt: time.Now().UTC()}},
+			&RepairLockExpireMissing{LockExpire: FieldExists{Exists: false}},
+		},
+	}
+	if cursor, err = DMongo.Collection.Find(ctx, filter); err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	// 解码BSON文档
+	for cursor.Next(ctx) {
+		meta = &RepairShard{}
+		if err = cursor.Decode(meta); err != nil {
+			continue
+		}
+		metas = append(metas, meta)
+	}
+	return
+}
+
+// -------------------------------------------
+// 获取待修复对象分片的修复租约（租约的过期时间为当前时间加expire）
+// NOTE: 1) 未被加锁、已被自己加锁或者租约已过期时才能加锁成功，否则locked为false；
+//       2) FindOneAndUpdate保证多个apiServer同时加锁时只有一个成功
+// -------------------------------------------
+func (DMongo *DossMongo) LockRepairShardMeta(shardHash string, locker string, expire time.Duration) (
+	locked bool, err error) {
+
+	var (
+		now    = time.Now().UTC()
+		filter *RepairLockFilter
 		update *RepairShardUpdate
 		result *mongo.SingleResult
 	)
 
-	// 过滤条件
-	filter = &RepairShardFilter{
+	ctx, cancel := opContext()
+	defer cancel()
+
+	filter = &RepairLockFilter{
 		ShardHash: shardHash,
+		Or: []interface{}{
+			&RepairLockerFilter{Locker: ""},
+			&RepairLockerFilter{Locker: locker},
+			&RepairLockExpire{LockExpire: TimeLess{Lt: now}},
+			&RepairLockExpireMissing{LockExpire: FieldExists{Exists: false}},
+		},
 	}
-
-	// 更新locker属性
 	update = &RepairShardUpdate{
-		Set: RepairShardLocker{Locker: locker},
+		Set: RepairShardLocker{Locker: locker, LockExpire: now.Add(expire)},
 	}
-
-	// 执行FindOneAndUpdate更新操作（若文档不存在则将err置为nil）
-	// NOTE: FindOneAndUpdate可以保证更新操作的原子性
-	if result = DMongo.Collection.FindOneAndUpdate(context.TODO(), filter, update); result.Err() != nil {
+	if result = DMongo.Collection.FindOneAndUpdate(ctx, filter, update); result.Err() != nil {
 		if err = result.Err(); err == mongo.ErrNoDocuments {
 			err = nil
 		}
+		return
+	}
+	locked = true
+	return
+}
+
+// -------------------------------------------
+// 续期修复租约：只有租约仍由locker持有时才能续期成功，否则renewed为false（租约已被其他apiServer接管）
+// -------------------------------------------
+func (DMongo *DossMongo) RenewRepairShardLock(shardHash string, locker string, expire time.Duration) (
+	renewed bool, err error) {
+
+	var result *mongo.UpdateResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if result, err = DMongo.Collection.UpdateOne(ctx, &RepairLeaseFilter{
+		ShardHash: shardHash,
+		Locker:    locker,
+	}, &RepairLeaseUpdate{
+		Set: RepairLeaseSet{LockExpire: time.Now().UTC().Add(expire)},
+	}); err != nil {
+		return
 	}
+	renewed = result.MatchedCount > 0
 	return
 }
 
@@ -745,12 +1366,54 @@ func (DMongo *DossMongo) DeleteRepairObjectMeta(shardHash string) (deleteCount i
 		result *mongo.DeleteResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	filter = &RepairShardFilter{
 		ShardHash: shardHash,
 	}
-	if result, err = DMongo.Collection.DeleteMany(context.TODO(), filter); err != nil || result == nil {
+	if result, err = DMongo.Collection.DeleteMany(ctx, filter); err != nil || result == nil {
 		return
 	}
 	deleteCount = result.DeletedCount
 	return
 }
+
+// ===========================================
+// 集合操作定义
+// ===========================================
+// -------------------------------------------
+// 监听集合的changeStream，将文档的变化事件发送到events通道
+// NOTE: 监听协程在changeStream出错之前一直运行，与apiServer进程的生命周期一致
+// -------------------------------------------
+func (DMongo *DossMongo) Watch() (events <-chan *ChangeEvent, err error) {
+	var (
+		CStream *mongo.ChangeStream
+		eventCh chan *ChangeEvent
+	)
+
+	if CStream, err = DMongo.Collection.Watch(context.Background(), mongo.Pipeline{}); err != nil {
+		return
+	}
+	eventCh = make(chan *ChangeEvent)
+	go func() {
+		defer CStream.Close(context.Background())
+		defer close(eventCh)
+		for CStream.Next(context.Background()) {
+			event := &ChangeEvent{}
+			if err := CStream.Decode(event); err != nil {
+				continue
+			}
+			eventCh <- event
+		}
+	}()
+	events = eventCh
+	return
+}
+
+// -------------------------------------------
+// 删除集合
+// -------------------------------------------
+func (DMongo *DossMongo) Drop() (err error) {
+	return DMongo.Collection.Drop(context.Background())
+}
@@ -3,7 +3,9 @@ package meta
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"config"
 	"github.com/mongodb/mongo-go-driver/bson/primitive"
@@ -11,6 +13,19 @@ import (
 	"meta/funcParams"
 )
 
+// 创建测试用的DossMongo，连接失败时终止测试
+func newTestDossMongo(t *testing.T, optionFunctions ...funcParams.MongoParamFunc) *DossMongo {
+	var (
+		DMongo *DossMongo
+		err    error
+	)
+
+	if DMongo, err = NewDossMongo(optionFunctions...); err != nil {
+		t.Fatal(err)
+	}
+	return DMongo
+}
+
 func TestDossMongo_PutObjectMeta(t *testing.T) {
 	var (
 		DMongo     *DossMongo
@@ -18,10 +33,10 @@ func TestDossMongo_PutObjectMeta(t *testing.T) {
 		err        error
 	)
 
-	DMongo = NewDossMongo()
+	DMongo = newTestDossMongo(t)
 	_ = DMongo.Collection.Drop(context.TODO())
 
-	if insertedID, err = DMongo.PutObjectMeta("test", 1024, "hash_value_test"); err != nil {
+	if insertedID, err = DMongo.PutObjectMeta("bucket", "test", 1024, "hash_value_test"); err != nil {
 		t.Error(err)
 	}
 	if insertedID.Hex() == "" {
@@ -32,6 +47,41 @@ func TestDossMongo_PutObjectMeta(t *testing.T) {
 	_ = DMongo.Collection.Drop(context.TODO())
 }
 
+// 测试对象元数据的创建时间和修改时间
+func TestDossMongo_PutObjectMeta_Timestamps(t *testing.T) {
+	var (
+		DMongo *DossMongo
+		first  *ObjectMeta
+		meta   *ObjectMeta
+		err    error
+	)
+
+	DMongo = newTestDossMongo(t)
+	_ = DMongo.Collection.Drop(context.TODO())
+
+	_, _ = DMongo.PutObjectMeta("bucket", "test", 1024, "hash_value_test")
+	if first, err = DMongo.GetObjectMeta("bucket", "test"); err != nil {
+		t.Error(err)
+		return
+	}
+	if first.Created.IsZero() || !first.Created.Equal(first.Modified) {
+		t.Error("Got created", first.Created, "modified", first.Modified, ", expect equal and not zero")
+	}
+
+	// 新版本保留创建时间，更新修改时间
+	_, _ = DMongo.PutObjectMeta("bucket", "test", 2048, "hash_value_test2")
+	if meta, err = DMongo.GetObjectMeta("bucket", "test"); err != nil {
+		t.Error(err)
+		return
+	}
+	if !meta.Created.Equal(first.Created) || meta.Modified.Before(first.Modified) {
+		t.Error("Got created", meta.Created, "modified", meta.Modified, ", expect created", first.Created)
+	}
+
+	// 将表drop，恢复环境
+	_ = DMongo.Collection.Drop(context.TODO())
+}
+
 // 测试高并发场景下上传对象元数据的正确性
 func TestDossMongo_PutObjectMeta_Concurrent(t *testing.T) {
 	var (
@@ -44,8 +94,11 @@ func TestDossMongo_PutObjectMeta_Concurrent(t *testing.T) {
 		goNumber = 1000
 	)
 
-	DMongo = NewDossMongo()
+	DMongo = newTestDossMongo(t)
 	_ = DMongo.Collection.Drop(context.TODO())
+	if err = EnsureIndexes(); err != nil {
+		t.Fatal(err)
+	}
 
 	// 并发上传对象元数据
 	wg := new(sync.WaitGroup)
@@ -53,13 +106,13 @@ func TestDossMongo_PutObjectMeta_Concurrent(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			_, _ = DMongo.PutObjectMeta("test", 1024, "hash_value_test")
+			_, _ = DMongo.PutObjectMeta("bucket", "test", 1024, "hash_value_test")
 		}()
 	}
 	wg.Wait()
 
 	// 检查并发插入的对象元数据是否正确
-	if metas, err = DMongo.GetAllVersionMetas("test"); err != nil {
+	if metas, err = DMongo.GetAllVersionMetas("bucket", "test"); err != nil {
 		t.Error(err)
 	}
 	if len(metas) != goNumber {
@@ -75,6 +128,67 @@ func TestDossMongo_PutObjectMeta_Concurrent(t *testing.T) {
 	_ = DMongo.Collection.Drop(context.TODO())
 }
 
+// 测试多个apiServer并发上传同名对象：每个apiServer使用各自的DossMongo和进程内的原子锁，
+// 版本号由唯一索引保证不重复
+func TestDossMongo_PutObjectMeta_MultiServer(t *testing.T) {
+	var (
+		DMongo        *DossMongo
+		meta          *ObjectMeta
+		metas         []*ObjectMeta
+		err           error
+		index         int
+		serverIndex   int
+		serverNumber  = 4
+		writerNumber  = 50
+		failedWriters int32
+	)
+
+	DMongo = newTestDossMongo(t)
+	_ = DMongo.Collection.Drop(context.TODO())
+	if err = EnsureIndexes(); err != nil {
+		t.Fatal(err)
+	}
+
+	wg := new(sync.WaitGroup)
+	for serverIndex = 0; serverIndex < serverNumber; serverIndex++ {
+		var (
+			server = newTestDossMongo(t)
+			mutex  = new(sync.Mutex)
+		)
+		for index = 0; index < writerNumber; index++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				mutex.Lock()
+				defer mutex.Unlock()
+				if _, err := server.insertObjectMeta("bucket", "test", 1024, "hash_value_test"); err != nil {
+					atomic.AddInt32(&failedWriters, 1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	// 所有写入均成功，且版本号从1开始连续递增
+	if failedWriters > 0 {
+		t.Errorf("%d writers failed", failedWriters)
+	}
+	if metas, err = DMongo.GetAllVersionMetas("bucket", "test"); err != nil {
+		t.Error(err)
+	}
+	if len(metas) != serverNumber*writerNumber {
+		t.Errorf("Got meta numbers is %d, expect: %d", len(metas), serverNumber*writerNumber)
+	}
+	for index, meta = range metas {
+		if index != meta.Version-1 {
+			t.Errorf("Got meta version is %d, expect: %d", meta.Version, index+1)
+		}
+	}
+
+	// 将表drop，恢复环境
+	_ = DMongo.Collection.Drop(context.TODO())
+}
+
 func TestDossMongo_GetObjectMeta(t *testing.T) {
 	var (
 		DMongo *DossMongo
@@ -82,15 +196,15 @@ func TestDossMongo_GetObjectMeta(t *testing.T) {
 		err    error
 	)
 
-	DMongo = NewDossMongo()
+	DMongo = newTestDossMongo(t)
 	_ = DMongo.Collection.Drop(context.TODO())
 
 	// 生成两个版本
-	_, _ = DMongo.PutObjectMeta("test", 1024, "hash_value_test")
-	_, _ = DMongo.PutObjectMeta("test", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "test", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "test", 1024, "hash_value_test")
 
 	// 获取最新版本的元数据
-	meta, err = DMongo.GetObjectMeta("test")
+	meta, err = DMongo.GetObjectMeta("bucket", "test")
 	if err != nil {
 		t.Error(err)
 	}
@@ -102,7 +216,7 @@ func TestDossMongo_GetObjectMeta(t *testing.T) {
 	}
 
 	// 获取给定版本的元数据
-	if meta, err = DMongo.GetObjectMeta("test", funcParams.MetaParamVersion(1)); err != nil {
+	if meta, err = DMongo.GetObjectMeta("bucket", "test", funcParams.MetaParamVersion(1)); err != nil {
 		t.Error(err)
 	}
 	if meta == nil {
@@ -123,14 +237,14 @@ func TestDossMongo_GetAllVersionMetas(t *testing.T) {
 		err    error
 	)
 
-	DMongo = NewDossMongo()
+	DMongo = newTestDossMongo(t)
 	_ = DMongo.Collection.Drop(context.TODO())
 
 	// 生成两个版本
-	_, _ = DMongo.PutObjectMeta("test", 1024, "hash_value_test")
-	_, _ = DMongo.PutObjectMeta("test", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "test", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "test", 1024, "hash_value_test")
 
-	if metas, err = DMongo.GetAllVersionMetas("test"); err != nil {
+	if metas, err = DMongo.GetAllVersionMetas("bucket", "test"); err != nil {
 		t.Error(err)
 	}
 	if len(metas) != 2 {
@@ -148,12 +262,12 @@ func TestDossMongo_GetMetaByHash(t *testing.T) {
 		err    error
 	)
 
-	DMongo = NewDossMongo(funcParams.MongoParamCollection("object_test"))
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection("object_test"))
 	_ = DMongo.Collection.Drop(context.TODO())
 
 	// 生成两个版本
-	_, _ = DMongo.PutObjectMeta("test", 1024, "hash_value_test")
-	_, _ = DMongo.PutObjectMeta("test", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "test", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "test", 1024, "hash_value_test")
 
 	if meta, err = DMongo.GetMetaByHash("hash_value_test"); err != nil {
 		t.Error(err)
@@ -174,14 +288,14 @@ func TestDossMongo_GetALLTooMuchVersionMeta(t *testing.T) {
 		err    error
 	)
 
-	DMongo = NewDossMongo(funcParams.MongoParamCollection("object_test"))
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection("object_test"))
 	_ = DMongo.Collection.Drop(context.TODO())
 
 	for i := 0; i < 5; i++ {
-		_, _ = DMongo.PutObjectMeta("test", 35, "gI6PB7nGboZQ0+m642uF1lBhxy7OLBIy+7jMZZ2zh2U=")
-		_, _ = DMongo.PutObjectMeta("test2", 35, "ZI33h+hn+u%2FZIXLAtfIsJUN+cYN7HfJ50HT6QqWGz9s=")
+		_, _ = DMongo.PutObjectMeta("bucket", "test", 35, "gI6PB7nGboZQ0+m642uF1lBhxy7OLBIy+7jMZZ2zh2U=")
+		_, _ = DMongo.PutObjectMeta("bucket", "test2", 35, "ZI33h+hn+u%2FZIXLAtfIsJUN+cYN7HfJ50HT6QqWGz9s=")
 	}
-	_, _ = DMongo.PutObjectMeta("test3", 35, "6nNluthEXVxf5+AKT%2Fs88+a5oysuwqKyGuFi6DGc8PA=")
+	_, _ = DMongo.PutObjectMeta("bucket", "test3", 35, "6nNluthEXVxf5+AKT%2Fs88+a5oysuwqKyGuFi6DGc8PA=")
 
 	if metas, err = DMongo.GetALLTooMuchVersionMeta(4); err != nil {
 		t.Error(err)
@@ -204,16 +318,16 @@ func TestDossMongo_DeleteObjectMeta(t *testing.T) {
 		err         error
 	)
 
-	DMongo = NewDossMongo()
+	DMongo = newTestDossMongo(t)
 	_ = DMongo.Collection.Drop(context.TODO())
 
 	// 生成三个版本
-	_, _ = DMongo.PutObjectMeta("test", 1024, "hash_value_test")
-	_, _ = DMongo.PutObjectMeta("test", 1024, "hash_value_test")
-	_, _ = DMongo.PutObjectMeta("test", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "test", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "test", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "test", 1024, "hash_value_test")
 
 	// 删除版本号为1的元数据
-	if deleteCount, err = DMongo.DeleteObjectMeta("test", funcParams.MetaParamVersion(1)); err != nil {
+	if deleteCount, err = DMongo.DeleteObjectMeta("bucket", "test", funcParams.MetaParamVersion(1)); err != nil {
 		t.Error(err)
 	}
 	if deleteCount != 1 {
@@ -221,7 +335,7 @@ func TestDossMongo_DeleteObjectMeta(t *testing.T) {
 	}
 
 	// 删除剩余的两条元数据
-	if deleteCount, err = DMongo.DeleteObjectMeta("test"); err != nil {
+	if deleteCount, err = DMongo.DeleteObjectMeta("bucket", "test"); err != nil {
 		t.Error(err)
 	}
 	if deleteCount != 2 {
@@ -238,7 +352,7 @@ func TestNewDossMongo(t *testing.T) {
 		DMongo *DossMongo
 	)
 
-	DMongo = NewDossMongo()
+	DMongo = newTestDossMongo(t)
 	if DMongo.Database.Name() != config.GConfig.DatabaseName {
 		t.Error("DatabaseName: expected", config.GConfig.DatabaseName, ", but got", DMongo.Database.Name())
 	}
@@ -252,7 +366,7 @@ func TestNewDossMongo2(t *testing.T) {
 		DMongo *DossMongo
 	)
 
-	DMongo = NewDossMongo(
+	DMongo = newTestDossMongo(t,
 		funcParams.MongoParamDatabase("local"),
 		funcParams.MongoParamCollection("startup_log"),
 	)
@@ -264,6 +378,20 @@ func TestNewDossMongo2(t *testing.T) {
 	}
 }
 
+// 测试进程内的DossMongo共用同一个MongoDB客户端
+func TestNewDossMongo_SharedClient(t *testing.T) {
+	var (
+		DMongo  *DossMongo
+		DMongo2 *DossMongo
+	)
+
+	DMongo = newTestDossMongo(t)
+	DMongo2 = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.NodeColName))
+	if DMongo.Database.Client() != DMongo2.Database.Client() {
+		t.Error("DossMongo should share one mongo client")
+	}
+}
+
 func TestDossMongo_IsMetaCollectionEmpty(t *testing.T) {
 	var (
 		DMongo *DossMongo
@@ -271,8 +399,8 @@ func TestDossMongo_IsMetaCollectionEmpty(t *testing.T) {
 		err    error
 	)
 
-	DMongo = NewDossMongo()
-	if _, err = DMongo.PutObjectMeta("test", 1024, "hash_value_test"); err != nil {
+	DMongo = newTestDossMongo(t)
+	if _, err = DMongo.PutObjectMeta("bucket", "test", 1024, "hash_value_test"); err != nil {
 		t.Error("PutObjectMeta failed:", err)
 		return
 	}
@@ -294,6 +422,222 @@ func TestDossMongo_IsMetaCollectionEmpty(t *testing.T) {
 	}
 }
 
+// 测试不同存储桶中的同名对象互不影响，以及存储桶是否为空的判断
+func TestDossMongo_BucketScopedObjectMeta(t *testing.T) {
+	var (
+		DMongo *DossMongo
+		meta   *ObjectMeta
+		empty  bool
+		err    error
+	)
+
+	DMongo = newTestDossMongo(t)
+	_ = DMongo.Collection.Drop(context.TODO())
+
+	_, _ = DMongo.PutObjectMeta("bucket1", "a/b/c.txt", 1024, "hash_value_test1")
+	_, _ = DMongo.PutObjectMeta("bucket1", "a/b/c.txt", 1024, "hash_value_test1")
+	_, _ = DMongo.PutObjectMeta("bucket2", "a/b/c.txt", 2048, "hash_value_test2")
+
+	if meta, err = DMongo.GetObjectMeta("bucket2", "a/b/c.txt"); err != nil {
+		t.Error(err)
+	}
+	if meta.Version != 1 || meta.Size != 2048 || meta.Bucket != "bucket2" {
+		t.Errorf("Got meta is %v, expect: version 1, size 2048 in bucket2", meta)
+	}
+
+	// 删除bucket2中的对象（添加删除标记）后bucket2为空，bucket1不为空
+	_, _ = DMongo.PutObjectMeta("bucket2", "a/b/c.txt", 0, "")
+	if empty, err = DMongo.IsBucketEmpty("bucket2"); err != nil || !empty {
+		t.Error("Expect bucket2 empty, got:", empty, err)
+	}
+	if empty, err = DMongo.IsBucketEmpty("bucket1"); err != nil || empty {
+		t.Error("Expect bucket1 not empty, got:", empty, err)
+	}
+
+	// 将表drop，恢复环境
+	_ = DMongo.Collection.Drop(context.TODO())
+}
+
+// 测试按照前缀、分隔符分页列举对象
+func TestDossMongo_ListObjects(t *testing.T) {
+	var (
+		DMongo     *DossMongo
+		metas      []*ObjectMeta
+		prefixes   []string
+		nextMarker string
+		truncated  bool
+		err        error
+	)
+
+	DMongo = newTestDossMongo(t)
+	_ = DMongo.Collection.Drop(context.TODO())
+
+	_, _ = DMongo.PutObjectMeta("bucket", "a.txt", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "dir/b.txt", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "dir/c.txt", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "dir2/d.txt", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "e.txt", 1024, "hash_value_test")
+	_, _ = DMongo.PutObjectMeta("bucket", "e.txt", 0, "")
+
+	// 汇总公共前缀：a.txt、dir/、dir2/（e.txt已被删除）
+	if metas, prefixes, _, truncated, err = DMongo.ListObjects("bucket", "", "/", "", 1000); err != nil {
+		t.Error(err)
+	}
+	if len(metas) != 1 || len(prefixes) != 2 || truncated {
+		t.Errorf("Got %d objects, prefixes %v, truncated %v, expect: 1 object, 2 prefixes", len(metas), prefixes, truncated)
+	}
+
+	// 分页列举：每页2个
+	if metas, prefixes, nextMarker, truncated, err = DMongo.ListObjects("bucket", "", "/", "", 2); err != nil {
+		t.Error(err)
+	}
+	if len(metas)+len(prefixes) != 2 || !truncated {
+		t.Errorf("Got %d results, truncated %v, expect: 2 results and truncated", len(metas)+len(prefixes), truncated)
+	}
+	if metas, prefixes, _, truncated, err = DMongo.ListObjects("bucket", "", "/", nextMarker, 2); err != nil {
+		t.Error(err)
+	}
+	if len(metas) != 0 || len(prefixes) != 1 || prefixes[0] != "dir2/" || truncated {
+		t.Errorf("Got %d objects, prefixes %v, truncated %v, expect: prefix dir2/", len(metas), prefixes, truncated)
+	}
+
+	// 按照前缀列举
+	if metas, _, _, _, err = DMongo.ListObjects("bucket", "dir/", "/", "", 1000); err != nil {
+		t.Error(err)
+	}
+	if len(metas) != 2 {
+		t.Errorf("Got %d objects with prefix dir/, expect: 2", len(metas))
+	}
+
+	// 将表drop，恢复环境
+	_ = DMongo.Collection.Drop(context.TODO())
+}
+
+// 测试存储桶元数据的创建、获取、删除
+func TestDossMongo_CreateBucket(t *testing.T) {
+	var (
+		DMongo  *DossMongo
+		created bool
+		meta    *BucketMeta
+		metas   []*BucketMeta
+		err     error
+	)
+
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.BucketColName))
+	_ = DMongo.Collection.Drop(context.TODO())
+
+	if created, err = DMongo.CreateBucket("bucket1"); err != nil || !created {
+		t.Error("Create bucket1 failed:", created, err)
+	}
+	if created, err = DMongo.CreateBucket("bucket1"); err != nil || created {
+		t.Error("Create bucket1 again, expect not created, got:", created, err)
+	}
+	_, _ = DMongo.CreateBucket("bucket0")
+
+	if metas, err = DMongo.ListBucketMetas(); err != nil {
+		t.Error(err)
+	}
+	if len(metas) != 2 || metas[0].Name != "bucket0" {
+		t.Error("List buckets error, got:", metas)
+	}
+
+	if _, err = DMongo.DeleteBucketMeta("bucket1"); err != nil {
+		t.Error(err)
+	}
+	if meta, err = DMongo.GetBucketMeta("bucket1"); err != nil || meta.Name != "" {
+		t.Error("Expect bucket1 deleted, got:", meta, err)
+	}
+
+	// 将表drop，恢复环境
+	_ = DMongo.Collection.Drop(context.TODO())
+}
+
+func TestDossMongo_MultipartUpload(t *testing.T) {
+	var (
+		DMongo   *DossMongo
+		uploadId string
+		upload   *UploadMeta
+		uploads  []*UploadMeta
+		parts    []*UploadPartMeta
+		finished bool
+		err      error
+	)
+
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.UploadColName))
+	_ = DMongo.Collection.Drop(context.TODO())
+	_ = DMongo.partCollection().Drop(context.TODO())
+
+	if uploadId, err = DMongo.NewUpload("bucket", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if upload, err = DMongo.GetUpload(uploadId); err != nil || upload == nil || upload.State != UploadStateUploading {
+		t.Fatal("Get upload failed:", upload, err)
+	}
+
+	// 同一part重复上传时覆盖之前的记录，列举时按照part编号升序
+	_ = DMongo.PutUploadPart(uploadId, 2, 5, "hash2")
+	_ = DMongo.PutUploadPart(uploadId, 1, 10, "hash1")
+	_ = DMongo.PutUploadPart(uploadId, 2, 6, "hash2_new")
+	if parts, err = DMongo.GetUploadParts(uploadId); err != nil {
+		t.Error(err)
+	}
+	if len(parts) != 2 || parts[0].Number != 1 || parts[1].Hash != "hash2_new" || parts[1].Size != 6 {
+		t.Error("Get upload parts error, got:", parts)
+	}
+	if parts, err = DMongo.GetUploadPartsByHash("hash1"); err != nil || len(parts) != 1 {
+		t.Error("Get upload parts by hash error, got:", parts, err)
+	}
+
+	// 只有一个请求可以开始合并，合并中的上传未结束；合并失败后恢复为上传中并记录失败原因
+	if finished, err = DMongo.BeginCompleteUpload(uploadId, "object_hash"); err != nil || !finished {
+		t.Error("Begin complete upload failed:", finished, err)
+	}
+	if finished, err = DMongo.BeginCompleteUpload(uploadId, "object_hash"); err != nil || finished {
+		t.Error("Begin complete upload again, expect not begun, got:", finished, err)
+	}
+	if uploads, err = DMongo.GetFinishedUploads(); err != nil || len(uploads) != 0 {
+		t.Error("Expect completing upload unfinished, got:", uploads, err)
+	}
+	if finished, err = DMongo.FailCompleteUpload(uploadId, "merge failed"); err != nil || !finished {
+		t.Error("Fail complete upload failed:", finished, err)
+	}
+	if upload, err = DMongo.GetUpload(uploadId); err != nil || upload.State != UploadStateUploading || upload.Error != "merge failed" {
+		t.Error("Expect uploading with error, got:", upload, err)
+	}
+	if finished, err = DMongo.BeginCompleteUpload(uploadId, "object_hash"); err != nil || !finished {
+		t.Error("Begin complete upload after failure failed:", finished, err)
+	}
+	if upload, err = DMongo.GetUpload(uploadId); err != nil || upload.State != UploadStateCompleting ||
+		upload.Hash != "object_hash" || upload.Error != "" {
+		t.Error("Expect completing upload, got:", upload, err)
+	}
+
+	// 只有一个请求可以结束上传（合并中的上传同样可以结束）
+	if finished, err = DMongo.FinishUpload(uploadId, UploadStateCompleted); err != nil || !finished {
+		t.Error("Finish upload failed:", finished, err)
+	}
+	if finished, err = DMongo.FinishUpload(uploadId, UploadStateAborted); err != nil || finished {
+		t.Error("Finish upload again, expect not finished, got:", finished, err)
+	}
+	if uploads, err = DMongo.GetFinishedUploads(); err != nil || len(uploads) != 1 || uploads[0].State != UploadStateCompleted {
+		t.Error("Get finished uploads error, got:", uploads, err)
+	}
+
+	if err = DMongo.DeleteUpload(uploadId); err != nil {
+		t.Error(err)
+	}
+	if upload, err = DMongo.GetUpload(uploadId); err != nil || upload != nil {
+		t.Error("Expect upload deleted, got:", upload, err)
+	}
+	if parts, err = DMongo.GetUploadParts(uploadId); err != nil || len(parts) != 0 {
+		t.Error("Expect upload parts deleted, got:", parts, err)
+	}
+
+	// 将表drop，恢复环境
+	_ = DMongo.Collection.Drop(context.TODO())
+	_ = DMongo.partCollection().Drop(context.TODO())
+}
+
 // -------------------------------
 // 测试聚合对象元数据的操作
 // -------------------------------
@@ -304,7 +648,7 @@ func TestDossMongo_NewAggregateMeta(t *testing.T) {
 		err        error
 	)
 
-	DMongo = NewDossMongo(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName))
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.AggregateObjColName))
 	_ = DMongo.Collection.Drop(context.TODO())
 
 	if insertedID, err = DMongo.NewAggregateMeta(); err != nil {
@@ -329,7 +673,7 @@ func TestDossMongo_UpdateAggregateMetaAndDelete(t *testing.T) {
 		err         error
 	)
 
-	DMongo = NewDossMongo(funcParams.MongoParamCollection(config.GConfig.AggregateObjColName))
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.AggregateObjColName))
 	_ = DMongo.Collection.Drop(context.TODO())
 
 	if objectId, err = DMongo.NewAggregateMeta(); err != nil {
@@ -378,7 +722,7 @@ func TestDossMongo_PutObjectShardMetaAndDelete(t *testing.T) {
 		err         error
 	)
 
-	DMongo = NewDossMongo(funcParams.MongoParamCollection(config.GConfig.ObjShardColName))
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.ObjShardColName))
 	_ = DMongo.Collection.Drop(context.TODO())
 
 	aggregate = append(aggregate, &AggObject{"test_aggregate_name", 0, 16})
@@ -410,6 +754,46 @@ func TestDossMongo_PutObjectShardMetaAndDelete(t *testing.T) {
 	_ = DMongo.Collection.Drop(context.TODO())
 }
 
+// -------------------------------
+// 测试聚合对象整理时更新分片所在的聚合对象
+// -------------------------------
+func TestDossMongo_SwapShardAggregate(t *testing.T) {
+	var (
+		DMongo    *DossMongo
+		shardMeta *ObjectShardMeta
+		oldAggs   = []*AggObject{{"test_aggregate_name", 0, 16}}
+		newAggs   = []*AggObject{{"test_aggregate_name2", 32, 16}}
+		swapped   bool
+		err       error
+	)
+
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.ObjShardColName))
+	_ = DMongo.Collection.Drop(context.TODO())
+
+	if _, err = DMongo.PutObjectShardMeta("test_object", 0, 16, "test_shard_hash", oldAggs); err != nil {
+		t.Error("PutObjectShardMeta failed:", err)
+		return
+	}
+
+	// 分片hash值已改变（对象已被删除）时不更新
+	if swapped, err = DMongo.SwapShardAggregate("test_object", 0, "", oldAggs, newAggs); err != nil || swapped {
+		t.Error("Expect deleted shard not swapped, got:", swapped, err)
+	}
+	if swapped, err = DMongo.SwapShardAggregate("test_object", 0, "test_shard_hash", oldAggs, newAggs); err != nil || !swapped {
+		t.Error("Expect aggregate swapped, got:", swapped, err)
+	}
+	if shardMeta, err = DMongo.GetShardMetaByIndex("test_object", 0); err != nil ||
+		len(shardMeta.Aggregate) != 1 || *shardMeta.Aggregate[0] != *newAggs[0] {
+		t.Error("Expect shard moved to test_aggregate_name2, got:", shardMeta, err)
+	}
+
+	// 已经更新过的分片不再按照旧的聚合对象更新
+	if swapped, _ = DMongo.SwapShardAggregate("test_object", 0, "test_shard_hash", oldAggs, newAggs); swapped {
+		t.Error("Expect stale swap rejected")
+	}
+	_ = DMongo.Collection.Drop(context.TODO())
+}
+
 // -------------------------------
 // 测试待修复对象元数据的操作
 // -------------------------------
@@ -420,7 +804,7 @@ func TestDossMongo_PutRepairShardMeta(t *testing.T) {
 		err        error
 	)
 
-	DMongo = NewDossMongo(funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
 	_ = DMongo.Collection.Drop(context.TODO())
 	if insertedID, err = DMongo.PutRepairShardMeta(
 		"test_object_hash", "2", "test_shard_hash",
@@ -436,6 +820,28 @@ func TestDossMongo_PutRepairShardMeta(t *testing.T) {
 	_ = DMongo.Collection.Drop(context.TODO())
 }
 
+func TestDossMongo_PutLostShardMeta(t *testing.T) {
+	var (
+		DMongo     *DossMongo
+		repairMeta *RepairShard
+		err        error
+	)
+
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
+	_ = DMongo.Collection.Drop(context.TODO())
+	if _, err = DMongo.PutLostShardMeta("test_object_hash", []int{1, 4}); err != nil {
+		t.Error("PutLostShardMeta failed:", err)
+		return
+	}
+	if repairMeta, err = DMongo.GetRepairShardMeta(LostShardKey("test_object_hash")); err != nil ||
+		repairMeta.ShardIndex != "1,4" || repairMeta.Lost != 2 {
+		t.Error("GetRepairShardMeta of lost shards:", repairMeta, err)
+	}
+
+	// 将表drop，恢复环境
+	_ = DMongo.Collection.Drop(context.TODO())
+}
+
 func TestDossMongo_UpdateRepairShardMeta(t *testing.T) {
 	var (
 		DMongo    *DossMongo
@@ -443,7 +849,7 @@ func TestDossMongo_UpdateRepairShardMeta(t *testing.T) {
 		err       error
 	)
 
-	DMongo = NewDossMongo(funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
 	_ = DMongo.Collection.Drop(context.TODO())
 
 	// 插入一条记录
@@ -452,10 +858,9 @@ func TestDossMongo_UpdateRepairShardMeta(t *testing.T) {
 		t.Error(err)
 	}
 
-	// 修改记录（加locker属性）
-	err = DMongo.UpdateRepairShardMeta("test_shard_hash", "192.168.1.51:32000")
-	if err != nil {
-		t.Error(err)
+	// 修改记录（获取修复租约）
+	if locked, err := DMongo.LockRepairShardMeta("test_shard_hash", "192.168.1.51:32000", time.Minute); err != nil || !locked {
+		t.Error("Lock repair shard meta error:", locked, err)
 	}
 
 	// 获取记录
@@ -479,7 +884,7 @@ func TestDossMongo_GetRepairShardMetaByOId(t *testing.T) {
 		err       error
 	)
 
-	DMongo = NewDossMongo(funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
 	_ = DMongo.Collection.Drop(context.TODO())
 
 	// 插入一条记录
@@ -507,7 +912,7 @@ func TestDossMongo_GetRepairShardMetaByLocker(t *testing.T) {
 		err    error
 	)
 
-	DMongo = NewDossMongo(funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
 	_ = DMongo.Collection.Drop(context.TODO())
 
 	// 生成两个待修复分片元数据
@@ -515,8 +920,8 @@ func TestDossMongo_GetRepairShardMetaByLocker(t *testing.T) {
 	_, _ = DMongo.PutRepairShardMeta("test_object_hash", "2", "test_shard_hash_2")
 
 	// 更新locker属性（加锁）
-	_ = DMongo.UpdateRepairShardMeta("test_shard_hash_1", "192.168.1.51:32000")
-	_ = DMongo.UpdateRepairShardMeta("test_shard_hash_2", "192.168.1.51:32000")
+	_, _ = DMongo.LockRepairShardMeta("test_shard_hash_1", "192.168.1.51:32000", time.Minute)
+	_, _ = DMongo.LockRepairShardMeta("test_shard_hash_2", "192.168.1.51:32000", time.Minute)
 
 	if metas, err = DMongo.GetRepairShardMetaByLocker("192.168.1.51:32000"); err != nil {
 		t.Error(err)
@@ -529,6 +934,48 @@ func TestDossMongo_GetRepairShardMetaByLocker(t *testing.T) {
 	_ = DMongo.Collection.Drop(context.TODO())
 }
 
+// 模拟apiServer在修复过程中宕机：租约过期前其他apiServer无法获取，过期后被接管，宕机的apiServer无法再续期
+func TestDossMongo_RepairLease(t *testing.T) {
+	var (
+		DMongo *DossMongo
+		expire = time.Second
+		leaseA *RepairLease
+		leaseB *RepairLease
+		metas  []*RepairShard
+		locked bool
+		err    error
+	)
+
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
+	_ = DMongo.Collection.Drop(context.TODO())
+	_, _ = DMongo.PutRepairShardMeta("test_object_hash", "1", "test_shard_hash")
+
+	if leaseA, err = AcquireRepairLease(DMongo, "test_shard_hash", "192.168.1.51:32000", expire); err != nil || leaseA == nil {
+		t.Fatal("Acquire lease error:", err)
+	}
+	time.Sleep(2 * expire)
+	if leaseB, err = AcquireRepairLease(DMongo, "test_shard_hash", "192.168.1.52:32000", expire); err != nil || leaseB != nil {
+		t.Fatal("Expect lease held by 192.168.1.51, got:", leaseB, err)
+	}
+
+	// 192.168.1.51宕机，不再续期
+	leaseA.Stop()
+	time.Sleep(expire + expire/2)
+	if metas, err = DMongo.GetExpiredRepairShardMetas(); err != nil || len(metas) != 1 {
+		t.Fatal("Expect expired lease, got:", metas, err)
+	}
+	if leaseB, err = AcquireRepairLease(DMongo, "test_shard_hash", "192.168.1.52:32000", expire); err != nil || leaseB == nil {
+		t.Fatal("Expect lease taken over by 192.168.1.52:", err)
+	}
+	leaseB.Stop()
+	if locked, _ = DMongo.RenewRepairShardLock("test_shard_hash", "192.168.1.51:32000", expire); locked {
+		t.Error("Expect renew of 192.168.1.51 failed")
+	}
+
+	// 将表drop，恢复环境
+	_ = DMongo.Collection.Drop(context.TODO())
+}
+
 func TestDossMongo_DeleteRepairObjectMeta(t *testing.T) {
 	var (
 		DMongo      *DossMongo
@@ -537,7 +984,7 @@ func TestDossMongo_DeleteRepairObjectMeta(t *testing.T) {
 		err         error
 	)
 
-	DMongo = NewDossMongo(funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
+	DMongo = newTestDossMongo(t, funcParams.MongoParamCollection(config.GConfig.RepairObjColName))
 	_ = DMongo.Collection.Drop(context.TODO())
 
 	// 插入一条记录
@@ -1,8 +1,7 @@
 package meta
 
 import (
-	"context"
-
+	"common"
 	"github.com/mongodb/mongo-go-driver/bson/primitive"
 	"github.com/mongodb/mongo-go-driver/mongo"
 	"github.com/mongodb/mongo-go-driver/x/bsonx"
@@ -17,6 +16,9 @@ func (DMongo *DossMongo) AddDsNode(ip string, weight int) (insertedID primitive.
 		result *mongo.InsertOneResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 若文档记录已存在，则直接返回
 	if doc, _ = DMongo.GetNodeByIp(ip); doc != nil {
 		return
@@ -27,8 +29,9 @@ func (DMongo *DossMongo) AddDsNode(ip string, weight int) (insertedID primitive.
 		OId:    primitive.NewObjectID(),
 		Ip:     ip,
 		Weight: weight,
+		State:  NodeStateActive,
 	}
-	if result, err = DMongo.Collection.InsertOne(context.TODO(), doc); err != nil {
+	if result, err = DMongo.Collection.InsertOne(ctx, doc); err != nil {
 		return
 	}
 	// result.InsertedID类型为interface{}，故需进行类型断言转换为primitive.ObjectID类型
@@ -45,14 +48,17 @@ func (DMongo *DossMongo) GetAllNodes() (nodes []*DsNode, err error) {
 		node   *DsNode
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 执行Find查询操作
-	if cursor, err = DMongo.Collection.Find(context.TODO(), &bsonx.Doc{}); err != nil {
+	if cursor, err = DMongo.Collection.Find(ctx, &bsonx.Doc{}); err != nil {
 		return
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	// 解码BSON文档
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		node = &DsNode{}
 		if err = cursor.Decode(node); err != nil {
 			continue
@@ -71,13 +77,16 @@ func (DMongo *DossMongo) GetNodeByOId(oid primitive.ObjectID) (node *DsNode, err
 		result *mongo.SingleResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 过滤条件
 	filter = &OIdFilter{
 		ObjectId: oid,
 	}
 
 	// 执行FindOne查询操作
-	if result = DMongo.Collection.FindOne(context.TODO(), filter); result.Err() != nil {
+	if result = DMongo.Collection.FindOne(ctx, filter); result.Err() != nil {
 		err = result.Err()
 		return
 	}
@@ -86,7 +95,7 @@ func (DMongo *DossMongo) GetNodeByOId(oid primitive.ObjectID) (node *DsNode, err
 }
 
 // ------------------------
-// 根据ip名查找Ds节点
+// 根据ip名查找Ds节点（不存在则返回ErrNodeNotFound，与嵌入式存储一致）
 // ------------------------
 func (DMongo *DossMongo) GetNodeByIp(ip string) (node *DsNode, err error) {
 	var (
@@ -94,20 +103,101 @@ func (DMongo *DossMongo) GetNodeByIp(ip string) (node *DsNode, err error) {
 		result *mongo.SingleResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 过滤条件
 	filter = &NodeIpFilter{
 		Ip: ip,
 	}
 
 	// 执行FindOne查询操作
-	if result = DMongo.Collection.FindOne(context.TODO(), filter); result.Err() != nil {
-		err = result.Err()
+	if result = DMongo.Collection.FindOne(ctx, filter); result.Err() != nil {
+		if err = result.Err(); err == mongo.ErrNoDocuments {
+			err = common.ErrNodeNotFound
+		}
 		return
 	}
 	err = result.Decode(&node)
 	return
 }
 
+// ------------------------
+// 设置Ds节点的状态（节点不存在时matched为false）
+// NOTE: 状态变化会产生update事件，apiServer据此将下线中的节点移出哈希环
+// ------------------------
+func (DMongo *DossMongo) SetDsNodeState(ip string, state string) (matched bool, err error) {
+	var result *mongo.UpdateResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if result, err = DMongo.Collection.UpdateOne(ctx, &NodeIpFilter{Ip: ip}, &NodeStateUpdate{
+		Set: NodeStateSet{State: state},
+	}); err != nil {
+		return
+	}
+	matched = result.MatchedCount == 1
+	return
+}
+
+// ------------------------
+// 设置Ds节点所在的可用区和机架（节点不存在时matched为false）
+// NOTE: 数据节点每次启动时设置，标签变化会产生update事件，apiServer据此更新哈希环上节点的故障域
+// ------------------------
+func (DMongo *DossMongo) SetDsNodeDomain(ip string, zone string, rack string) (matched bool, err error) {
+	var result *mongo.UpdateResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if result, err = DMongo.Collection.UpdateOne(ctx, &NodeIpFilter{Ip: ip}, &NodeDomainUpdate{
+		Set: NodeDomainSet{Zone: zone, Rack: rack},
+	}); err != nil {
+		return
+	}
+	matched = result.MatchedCount == 1
+	return
+}
+
+// ------------------------
+// 设置Ds节点的权重以及权重是否由dataServer的weight参数指定（节点不存在时matched为false）
+// NOTE: 权重变化会产生update事件，apiServer据此按照新的权重重建该节点在哈希环上的cube并迁移分片
+// ------------------------
+func (DMongo *DossMongo) SetDsNodeWeight(ip string, weight int, fixed bool) (matched bool, err error) {
+	var result *mongo.UpdateResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if result, err = DMongo.Collection.UpdateOne(ctx, &NodeIpFilter{Ip: ip}, &NodeWeightUpdate{
+		Set: NodeWeightSet{Weight: weight, FixedWeight: fixed},
+	}); err != nil {
+		return
+	}
+	matched = result.MatchedCount == 1
+	return
+}
+
+// ------------------------
+// 设置Ds节点是否已满（节点不存在时matched为false）
+// NOTE: 变化会产生update事件，apiServer据此标记哈希环上的节点已满（不再写入新的分片）或者恢复写入
+// ------------------------
+func (DMongo *DossMongo) SetDsNodeFull(ip string, full bool) (matched bool, err error) {
+	var result *mongo.UpdateResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if result, err = DMongo.Collection.UpdateOne(ctx, &NodeIpFilter{Ip: ip}, &NodeFullUpdate{
+		Set: NodeFullSet{Full: full},
+	}); err != nil {
+		return
+	}
+	matched = result.MatchedCount == 1
+	return
+}
+
 // ------------------------
 // 从集合中删除Ds节点
 // ------------------------
@@ -117,13 +207,16 @@ func (DMongo *DossMongo) DeleteDsNodeByIp(ip string) (deleteCount int64, err err
 		result *mongo.DeleteResult
 	)
 
+	ctx, cancel := opContext()
+	defer cancel()
+
 	// 过滤条件
 	filter = &NodeIpFilter{
 		Ip: ip,
 	}
 
 	// 执行删除操作
-	result, err = DMongo.Collection.DeleteOne(context.TODO(), filter)
+	result, err = DMongo.Collection.DeleteOne(ctx, filter)
 	if err != nil || result == nil {
 		deleteCount = 0
 		return
@@ -25,7 +25,7 @@ func TestDossMongo_GetAllNodes(t *testing.T) {
 		err      error
 	)
 
-	DMongo = NewDossMongo(
+	DMongo = newTestDossMongo(t,
 		funcParams.MongoParamCollection(config.GConfig.NodeColName),
 	)
 	_ = DMongo.Collection.Drop(context.TODO())
@@ -75,7 +75,7 @@ func TestDossMongo_AddNodeRecord(t *testing.T) {
 		oidAfter   primitive.ObjectID
 	)
 
-	DMongo = NewDossMongo(
+	DMongo = newTestDossMongo(t,
 		funcParams.MongoParamCollection(config.GConfig.NodeColName),
 	)
 	_ = DMongo.Collection.Drop(context.TODO())
@@ -111,6 +111,44 @@ func TestDossMongo_AddNodeRecord(t *testing.T) {
 	_ = DMongo.Collection.Drop(context.TODO())
 }
 
+func TestDossMongo_SetDsNodeWeight(t *testing.T) {
+	var (
+		DMongo  *DossMongo
+		node    *DsNode
+		matched bool
+		err     error
+	)
+
+	DMongo = newTestDossMongo(t,
+		funcParams.MongoParamCollection(config.GConfig.NodeColName),
+	)
+	_ = DMongo.Collection.Drop(context.TODO())
+	_, _ = DMongo.AddDsNode("192.168.1.210", 1)
+
+	// 设置权重和已满标记
+	if matched, err = DMongo.SetDsNodeWeight("192.168.1.210", 4, true); err != nil || !matched {
+		t.Error("Set node weight error:", matched, err)
+	}
+	if matched, err = DMongo.SetDsNodeFull("192.168.1.210", true); err != nil || !matched {
+		t.Error("Set node full error:", matched, err)
+	}
+	if node, err = DMongo.GetNodeByIp("192.168.1.210"); err != nil ||
+		node.Weight != 4 || !node.FixedWeight || !node.Full {
+		t.Error("Expect fixed weight 4 and full node, got:", node, err)
+	}
+
+	// 节点不存在
+	if matched, err = DMongo.SetDsNodeWeight("192.168.1.211", 4, false); err != nil || matched {
+		t.Error("Expect node not found, got:", matched, err)
+	}
+	if matched, err = DMongo.SetDsNodeFull("192.168.1.211", true); err != nil || matched {
+		t.Error("Expect node not found, got:", matched, err)
+	}
+
+	// 将表drop，恢复环境
+	_ = DMongo.Collection.Drop(context.TODO())
+}
+
 func TestDossMongo_DeleteDsNode(t *testing.T) {
 	var (
 		DMongo      *DossMongo
@@ -119,7 +157,7 @@ func TestDossMongo_DeleteDsNode(t *testing.T) {
 		err         error
 	)
 
-	DMongo = NewDossMongo(
+	DMongo = newTestDossMongo(t,
 		funcParams.MongoParamCollection(config.GConfig.NodeColName),
 	)
 	_ = DMongo.Collection.Drop(context.TODO())
@@ -153,7 +191,7 @@ func TestDossMongo_Watch(t *testing.T) {
 		watchFinish  = make(chan bool)
 	)
 
-	DMongo = NewDossMongo(
+	DMongo = newTestDossMongo(t,
 		funcParams.MongoParamCollection(config.GConfig.NodeColName),
 	)
 	_ = DMongo.Collection.Drop(context.TODO())
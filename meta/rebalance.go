@@ -0,0 +1,339 @@
+package meta
+
+import (
+	"time"
+
+	"common"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+)
+
+// 创建或更新迁移任务时并发冲突的最大重试次数
+const maxRebalanceRetry = 16
+
+// -------------------------------------------
+// 获取数据迁移任务（不存在则返回nil）
+// -------------------------------------------
+func (DMongo *DossMongo) GetRebalanceJob() (job *RebalanceJob, err error) {
+	var result *mongo.SingleResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if result = DMongo.Collection.FindOne(ctx, &RebalanceNameFilter{Name: RebalanceJobName}); result.Err() != nil {
+		if err = result.Err(); err == mongo.ErrNoDocuments {
+			err = nil
+		}
+		return
+	}
+	job = &RebalanceJob{}
+	if err = result.Decode(job); err != nil {
+		job = nil
+	}
+	return
+}
+
+// -------------------------------------------
+// 哈希环由before变为after时创建（或更新）数据迁移任务，返回当前的迁移任务
+// NOTE: 每个apiServer都会监听到哈希环的变化并调用此方法，目标哈希环相同时不重复创建
+// -------------------------------------------
+func (DMongo *DossMongo) StartRebalanceJob(before []*RingNode, after []*RingNode) (job *RebalanceJob, err error) {
+	return DMongo.applyRebalanceJob(func(current *RebalanceJob) *RebalanceJob {
+		return nextRebalanceJob(current, before, after, time.Now().UTC())
+	})
+}
+
+// -------------------------------------------
+// 重新执行有失败对象的已完成迁移任务（如数据节点下线时部分对象迁移失败），返回当前的迁移任务
+// -------------------------------------------
+func (DMongo *DossMongo) RetryRebalanceJob() (job *RebalanceJob, err error) {
+	return DMongo.applyRebalanceJob(func(current *RebalanceJob) *RebalanceJob {
+		return retryRebalanceJob(current, time.Now().UTC())
+	})
+}
+
+// -------------------------------------------
+// 读取迁移任务，并替换为next计算出的任务（next返回nil时不修改），返回当前的迁移任务
+// NOTE: 通过任务代数generation实现乐观锁：替换文档时若代数已被其他apiServer修改，则重新读取后重试
+// -------------------------------------------
+func (DMongo *DossMongo) applyRebalanceJob(next func(current *RebalanceJob) *RebalanceJob) (
+	job *RebalanceJob, err error) {
+
+	var (
+		current *RebalanceJob
+		nextJob *RebalanceJob
+		result  *mongo.UpdateResult
+		retry   int
+	)
+
+	for retry = 0; retry < maxRebalanceRetry; retry++ {
+		if current, err = DMongo.GetRebalanceJob(); err != nil {
+			return
+		}
+		if nextJob = next(current); nextJob == nil {
+			job = current
+			return
+		}
+
+		ctx, cancel := opContext()
+		if current == nil {
+			_, err = DMongo.Collection.InsertOne(ctx, nextJob)
+		} else {
+			result, err = DMongo.Collection.ReplaceOne(ctx, &RebalanceGenerationFilter{
+				Name:       RebalanceJobName,
+				Generation: current.Generation,
+			}, nextJob)
+		}
+		cancel()
+
+		// 任务已被其他apiServer创建或修改，重新读取后重试
+		if isDuplicateKeyError(err) || (err == nil && result != nil && result.MatchedCount == 0) {
+			result = nil
+			continue
+		}
+		if err == nil {
+			job = nextJob
+		}
+		return
+	}
+	err = common.ErrRebalanceConflict
+	return
+}
+
+// -------------------------------------------
+// 对迁移中的任务加锁（锁的过期时间为当前时间加expire），返回加锁后的任务
+// NOTE: 任务未被加锁、已被自己加锁或者锁已过期时才能加锁成功，否则返回nil
+// -------------------------------------------
+func (DMongo *DossMongo) LockRebalanceJob(locker string, expire time.Duration) (job *RebalanceJob, err error) {
+	var (
+		now    = time.Now().UTC()
+		filter *RebalanceLockFilter
+		update *RebalanceLockUpdate
+		result *mongo.SingleResult
+	)
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	filter = &RebalanceLockFilter{
+		Name:  RebalanceJobName,
+		State: RebalanceStateRunning,
+		Or: []interface{}{
+			&RebalanceLocker{Locker: ""},
+			&RebalanceLocker{Locker: locker},
+			&RebalanceLockExpire{LockExpire: TimeLess{Lt: now}},
+		},
+	}
+	update = &RebalanceLockUpdate{
+		Set: RebalanceLockSet{Locker: locker, LockExpire: now.Add(expire)},
+	}
+
+	// NOTE: FindOneAndUpdate保证多个apiServer同时加锁时只有一个成功
+	result = DMongo.Collection.FindOneAndUpdate(
+		ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if err = result.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			err = nil
+		}
+		return
+	}
+	job = &RebalanceJob{}
+	if err = result.Decode(job); err != nil {
+		job = nil
+	}
+	return
+}
+
+// -------------------------------------------
+// 保存迁移任务的进度（整个文档替换为job）
+// NOTE: 只有任务代数未变化且仍由job.Locker加锁时才能保存成功，否则updated为false，
+//       说明目标哈希环已变化或者锁已被其他apiServer接管，调用方应停止本次迁移
+// -------------------------------------------
+func (DMongo *DossMongo) UpdateRebalanceJob(job *RebalanceJob) (updated bool, err error) {
+	var result *mongo.UpdateResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if result, err = DMongo.Collection.ReplaceOne(ctx, &RebalanceLockerFilter{
+		Name:       RebalanceJobName,
+		Generation: job.Generation,
+		Locker:     job.Locker,
+	}, job); err != nil {
+		return
+	}
+	updated = result.MatchedCount == 1
+	return
+}
+
+// -------------------------------------------
+// 对丢失分片检测任务加锁（锁的过期时间为当前时间加expire），返回加锁后的任务
+// NOTE: 1) 任务不存在时先创建（任务名唯一，多个apiServer同时创建时只有一个成功）；
+//       2) 任务未被加锁、已被自己加锁或者锁已过期时才能加锁成功，否则返回nil
+// -------------------------------------------
+func (DMongo *DossMongo) LockScanJob(name string, locker string, expire time.Duration) (job *ScanJob, err error) {
+	var (
+		now    = time.Now().UTC()
+		result *mongo.SingleResult
+	)
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if result = DMongo.Collection.FindOne(ctx, &ScanNameFilter{Name: name}); result.Err() == mongo.ErrNoDocuments {
+		if _, err = DMongo.Collection.InsertOne(ctx, newScanJob(name, now)); err != nil && !isDuplicateKeyError(err) {
+			return
+		}
+	}
+
+	result = DMongo.Collection.FindOneAndUpdate(ctx, &ScanLockFilter{
+		Name: name,
+		Or: []interface{}{
+			&RebalanceLocker{Locker: ""},
+			&RebalanceLocker{Locker: locker},
+			&RebalanceLockExpire{LockExpire: TimeLess{Lt: now}},
+		},
+	}, &ScanLockUpdate{
+		Set: RebalanceLockSet{Locker: locker, LockExpire: now.Add(expire)},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	if err = result.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			err = nil
+		}
+		return
+	}
+	job = &ScanJob{}
+	if err = result.Decode(job); err != nil {
+		job = nil
+	}
+	return
+}
+
+// -------------------------------------------
+// 保存丢失分片检测任务的进度（整个文档替换为job）
+// NOTE: 只有仍由job.Locker加锁时才能保存成功，否则updated为false，说明锁已被其他apiServer接管
+// -------------------------------------------
+func (DMongo *DossMongo) UpdateScanJob(job *ScanJob) (updated bool, err error) {
+	var result *mongo.UpdateResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if result, err = DMongo.Collection.ReplaceOne(ctx, &ScanLockerFilter{
+		Name:   job.Name,
+		Locker: job.Locker,
+	}, job); err != nil {
+		return
+	}
+	updated = result.MatchedCount == 1
+	return
+}
+
+// 创建新的检测任务（各元数据存储后端共用）
+func newScanJob(name string, now time.Time) *ScanJob {
+	return &ScanJob{Name: name, Round: 1, Started: now, Updated: now}
+}
+
+// ---------------------------------
+// 根据当前的迁移任务和哈希环的变化计算新的迁移任务（各元数据存储后端共用），无需修改时返回nil：
+// 1) 任务迁移中：目标哈希环不变则无需修改，否则将原目标哈希环加入Sources（部分对象已迁移至该哈希环），
+//    更新目标哈希环并从头开始遍历；
+// 2) 任务不存在或已完成：若哈希环有变化（且不是已完成任务的目标哈希环），则创建新的任务，
+//    已完成的任务有迁移失败的对象时，新任务同样从其源哈希环上查找分片
+// ---------------------------------
+func nextRebalanceJob(current *RebalanceJob, before []*RingNode, after []*RingNode, now time.Time) (next *RebalanceJob) {
+	var (
+		source     []*RingNode
+		found      bool
+		generation = 1
+	)
+
+	if current != nil && current.State == RebalanceStateRunning {
+		if SameRing(current.Target, after) {
+			return
+		}
+		next = &RebalanceJob{}
+		*next = *current
+		next.Sources = append([][]*RingNode{}, current.Sources...)
+		for _, source = range current.Sources {
+			if found = SameRing(source, current.Target); found {
+				break
+			}
+		}
+		if !found {
+			next.Sources = append(next.Sources, current.Target)
+		}
+		next.Generation++
+		next.Target = after
+		next.Marker = ""
+		next.Updated = now
+		return
+	}
+
+	if SameRing(before, after) || (current != nil && SameRing(current.Target, after)) {
+		return
+	}
+	next = &RebalanceJob{
+		Name:       RebalanceJobName,
+		State:      RebalanceStateRunning,
+		Generation: generation,
+		Sources:    [][]*RingNode{before},
+		Target:     after,
+		Started:    now,
+		Updated:    now,
+	}
+	if current == nil {
+		return
+	}
+
+	// NOTE: 已完成的任务有迁移失败的对象时，其分片可能仍位于原来的源哈希环上，故保留原来的源哈希环
+	next.Generation = current.Generation + 1
+	if current.Failed > 0 {
+		for _, source = range current.Sources {
+			if !SameRing(source, before) {
+				next.Sources = append(next.Sources, source)
+			}
+		}
+	}
+	return
+}
+
+// 根据已完成的迁移任务计算重新执行的任务（各元数据存储后端共用）：
+// 只有任务已完成且存在失败的对象时才重新执行，源哈希环和目标哈希环不变，从头开始遍历，否则返回nil
+func retryRebalanceJob(current *RebalanceJob, now time.Time) (next *RebalanceJob) {
+	if current == nil || current.State != RebalanceStateFinished || current.Failed == 0 {
+		return
+	}
+	return &RebalanceJob{
+		Name:       RebalanceJobName,
+		State:      RebalanceStateRunning,
+		Generation: current.Generation + 1,
+		Sources:    current.Sources,
+		Target:     current.Target,
+		Started:    now,
+		Updated:    now,
+	}
+}
+
+// 判断两个哈希环的节点及其权重、故障域、已满标记是否相同
+func SameRing(a []*RingNode, b []*RingNode) bool {
+	var (
+		nodes = make(map[string]*RingNode)
+		node  *RingNode
+	)
+
+	if len(a) != len(b) {
+		return false
+	}
+	for _, node = range a {
+		nodes[node.Ip] = node
+	}
+	for _, node = range b {
+		if other, ok := nodes[node.Ip]; !ok || other.Weight != node.Weight || other.Domain != node.Domain ||
+			other.Full != node.Full {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package meta
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// ---------------------------------
+// 待修复对象分片的修复租约：获取租约后在后台每隔expire/3续期一次，直到调用Stop或者续期失败
+// NOTE: 1) 持有租约的apiServer宕机后不再续期，租约过期后由其他apiServer接管修复任务；
+//       2) 续期失败（租约已被其他apiServer接管）后Held返回false，持有者应放弃修复的数据；
+//          续期出错（如无法访问元数据服务）时租约可能已在元数据中过期并被接管，
+//          故距离上一次成功续期超过expire-leaseRenewMargin后Held同样返回false；
+//       3) 修复完成后调用Stop只停止续期，不释放租约：dataServer确认分片已修复后删除待修复分片元数据，
+//          若修复未成功，则租约过期后重新修复
+// ---------------------------------
+type RepairLease struct {
+	store     Store
+	shardHash string
+	locker    string
+	expire    time.Duration
+	held      bool
+	lastRenew time.Time // 上一次成功获取或续期的时间（发起请求的时间）
+	mutex     sync.Mutex
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// 获取待修复分片的修复租约并开始续期（租约被其他apiServer持有且未过期时返回nil）
+func AcquireRepairLease(store Store, shardHash string, locker string, expire time.Duration) (
+	lease *RepairLease, err error) {
+
+	var (
+		start  = time.Now()
+		locked bool
+	)
+
+	if locked, err = store.LockRepairShardMeta(shardHash, locker, expire); err != nil || !locked {
+		return
+	}
+	lease = &RepairLease{
+		store:     store,
+		shardHash: shardHash,
+		locker:    locker,
+		expire:    expire,
+		held:      true,
+		lastRenew: start,
+		stop:      make(chan struct{}),
+	}
+	go lease.keepAlive()
+	return
+}
+
+// 定期续期租约（续期出错时下一次继续续期，由Held根据上一次成功续期的时间判断租约是否仍有效；租约已被接管时停止续期）
+func (lease *RepairLease) keepAlive() {
+	var (
+		ticker  = time.NewTicker(lease.expire / 3)
+		start   time.Time
+		renewed bool
+		err     error
+	)
+
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lease.stop:
+			return
+		case <-ticker.C:
+		}
+		start = time.Now()
+		if renewed, err = lease.store.RenewRepairShardLock(lease.shardHash, lease.locker, lease.expire); err != nil {
+			log.Println(err)
+			continue
+		}
+		lease.mutex.Lock()
+		if lease.held = renewed; renewed {
+			lease.lastRenew = start
+		}
+		lease.mutex.Unlock()
+		if !renewed {
+			return
+		}
+	}
+}
+
+// 租约是否仍由自己持有：未被接管，且距离上一次成功续期未超过expire-leaseRenewMargin
+// NOTE: 预留leaseRenewMargin（expire/3），保证Held返回true后提交修复的数据时租约仍未在元数据中过期
+func (lease *RepairLease) Held() bool {
+	lease.mutex.Lock()
+	defer lease.mutex.Unlock()
+	return lease.held && time.Since(lease.lastRenew) < lease.expire-lease.leaseRenewMargin()
+}
+
+// 租约有效期的预留时间（与续期间隔一致）
+func (lease *RepairLease) leaseRenewMargin() time.Duration {
+	return lease.expire / 3
+}
+
+// 停止续期（租约在过期之前仍由自己持有，Held在距离上一次成功续期expire-leaseRenewMargin之内返回true）
+func (lease *RepairLease) Stop() {
+	lease.stopOnce.Do(func() {
+		close(lease.stop)
+	})
+}
@@ -0,0 +1,152 @@
+package meta
+
+import (
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+
+	"config"
+	"meta/funcParams"
+)
+
+// 元数据存储后端
+const (
+	BackendMongo = "mongo" // MongoDB（须采用ReplicaSet方式部署，默认）
+	BackendBolt  = "bolt"  // 嵌入式存储（bbolt），多进程部署时由一个apiServer提供元数据服务（见ServeBolt）
+)
+
+// ================================
+// 元数据存储接口：
+// 对象、存储桶、分片上传、聚合对象、对象分片、待修复分片、数据节点以及数据迁移任务元数据的操作，
+// 由DossMongo（MongoDB）、boltStore（bbolt）以及访问嵌入式存储元数据服务的remoteStore实现
+// NOTE: 与DossMongo一致，每个Store绑定一个集合，调用时须使用对应集合创建的Store
+// ================================
+type Store interface {
+	// 对象元数据
+	PutObjectMeta(bucket string, name string, size int64, hash string, paramFunc ...funcParams.MetaParamFunc) (
+		insertedID primitive.ObjectID, err error)
+	GetObjectMeta(bucket string, name string, paramFunc ...funcParams.MetaParamFunc) (meta *ObjectMeta, err error)
+	GetLastVersionMeta(bucket string, name string) (meta *ObjectMeta, err error)
+	GetAllVersionMetas(bucket string, name string) (metas []*ObjectMeta, err error)
+	ListLatestMetas(bucket string, prefix string, marker string, limit int) (metas []*ObjectMeta, err error)
+	ListVersionMetas(bucket string, prefix string, marker string, limit int) (metas []*ObjectMeta, err error)
+	ListObjects(bucket, prefix, delimiter, marker string, limit int) (
+		metas []*ObjectMeta, prefixes []string, nextMarker string, truncated bool, err error)
+	GetAllMetasByHash(hash string) (meta []*ObjectMeta, err error)
+	GetMetaByHash(hash string) (meta *ObjectMeta, err error)
+	GetALLTooMuchVersionMeta(count int) (metas []*ObjectMeta, err error)
+	ListHashMetas(marker string, limit int) (metas []*ObjectMeta, err error)
+	DeleteObjectMeta(bucket string, name string, paramFunc ...funcParams.MetaParamFunc) (deleteCount int64, err error)
+	IsMetaCollectionEmpty() (empty bool, err error)
+	IsBucketEmpty(bucket string) (empty bool, err error)
+	DeleteBucketObjectMetas(bucket string) (deleteCount int64, err error)
+
+	// 存储桶元数据
+	CreateBucket(name string, paramFunc ...funcParams.MetaParamFunc) (created bool, err error)
+	GetBucketMeta(name string) (meta *BucketMeta, err error)
+	ListBucketMetas() (metas []*BucketMeta, err error)
+	DeleteBucketMeta(name string) (deleteCount int64, err error)
+
+	// 分片上传元数据
+	NewUpload(bucket string, name string, paramFunc ...funcParams.MetaParamFunc) (uploadId string, err error)
+	GetUpload(uploadId string) (upload *UploadMeta, err error)
+	FinishUpload(uploadId string, state string) (finished bool, err error)
+	BeginCompleteUpload(uploadId string, hash string) (begun bool, err error)
+	FailCompleteUpload(uploadId string, reason string) (failed bool, err error)
+	GetExpiredUploads(before time.Time) (uploads []*UploadMeta, err error)
+	GetFinishedUploads() (uploads []*UploadMeta, err error)
+	DeleteUpload(uploadId string) (err error)
+	PutUploadPart(uploadId string, number int, size int64, hash string, paramFunc ...funcParams.MetaParamFunc) (
+		err error)
+	GetUploadParts(uploadId string) (parts []*UploadPartMeta, err error)
+	GetUploadPartsByHash(hash string) (parts []*UploadPartMeta, err error)
+
+	// 聚合对象元数据
+	NewAggregateMeta() (insertedID primitive.ObjectID, err error)
+	GetAggregateMeta(name string) (meta *AggregateMeta, err error)
+	UpdateAggregateMeta(name string, size int64, RefCount int, RefBy string) (err error)
+	DeleteAggregateMeta(name string) (deleteCount int64, err error)
+	DeleteUnRefAggregates() (names []string, err error)
+
+	// 对象分片元数据
+	PutObjectShardMeta(object string, index int, size int64, hash string, aggObjects []*AggObject) (
+		insertedID primitive.ObjectID, err error)
+	GetShardMetaByIndex(object string, index int) (meta *ObjectShardMeta, err error)
+	GetShardMetaByHash(hash string) (metas []*ObjectShardMeta, err error)
+	GetShardMetasByObject(object string) (metas []*ObjectShardMeta, err error)
+	DeleteShardMetaByObjHash(objHash string) (count int64, err error)
+	DeleteShardMeta(hash string) (deleteCount int64, err error)
+	DeleteShardMetaByIndex(object string, index int) (deleteCount int64, err error)
+	SwapShardAggregate(object string, index int, hash string, oldAggs []*AggObject, newAggs []*AggObject) (
+		swapped bool, err error)
+
+	// 待修复对象分片元数据
+	PutRepairShardMeta(objHash string, shardIndex string, shardHash string) (insertedID primitive.ObjectID, err error)
+	GetRepairShardMeta(shardHash string) (shardMeta *RepairShard, err error)
+	GetRepairShardMetaByOId(oid primitive.ObjectID) (shardMeta *RepairShard, err error)
+	GetRepairShardMetaByLocker(locker string) (metas []*RepairShard, err error)
+	GetExpiredRepairShardMetas() (metas []*RepairShard, err error)
+	LockRepairShardMeta(shardHash string, locker string, expire time.Duration) (locked bool, err error)
+	RenewRepairShardLock(shardHash string, locker string, expire time.Duration) (renewed bool, err error)
+	DeleteRepairObjectMeta(shardHash string) (deleteCount int64, err error)
+	PutLostShardMeta(objHash string, lostShards []int) (insertedID primitive.ObjectID, err error)
+
+	// 数据节点元数据
+	AddDsNode(ip string, weight int) (insertedID primitive.ObjectID, err error)
+	GetAllNodes() (nodes []*DsNode, err error)
+	GetNodeByOId(oid primitive.ObjectID) (node *DsNode, err error)
+	GetNodeByIp(ip string) (node *DsNode, err error)
+	SetDsNodeState(ip string, state string) (matched bool, err error)
+	SetDsNodeDomain(ip string, zone string, rack string) (matched bool, err error)
+	SetDsNodeWeight(ip string, weight int, fixed bool) (matched bool, err error)
+	SetDsNodeFull(ip string, full bool) (matched bool, err error)
+	DeleteDsNodeByIp(ip string) (deleteCount int64, err error)
+
+	// 数据迁移任务元数据
+	GetRebalanceJob() (job *RebalanceJob, err error)
+	StartRebalanceJob(before []*RingNode, after []*RingNode) (job *RebalanceJob, err error)
+	LockRebalanceJob(locker string, expire time.Duration) (job *RebalanceJob, err error)
+	UpdateRebalanceJob(job *RebalanceJob) (updated bool, err error)
+	RetryRebalanceJob() (job *RebalanceJob, err error)
+
+	// 丢失分片检测任务元数据
+	LockScanJob(name string, locker string, expire time.Duration) (job *ScanJob, err error)
+	UpdateScanJob(job *ScanJob) (updated bool, err error)
+
+	// 监听集合中文档的插入、更新和删除（MongoDB的changeStream，嵌入式存储为进程内的本地通知或者由元数据服务推送）
+	Watch() (events <-chan *ChangeEvent, err error)
+
+	// 删除集合中的所有元数据（用于测试恢复环境）
+	Drop() (err error)
+}
+
+// ---------------------------------
+// 创建元数据存储：根据配置项metaBackend选择MongoDB或嵌入式存储
+// NOTE:
+//   1) 参数与NewDossMongo一致，如：NewStore(funcParams.MongoParamCollection(config.GConfig.NodeColName))；
+//   2) 各后端在进程内共用同一个连接（数据库文件），创建Store的开销很小；连接失败时返回错误；
+//   3) 嵌入式存储的数据库文件同一时间只能被一个进程打开：未设置boltServer（如单元测试）或者本进程提供元数据服务时
+//      直接打开数据库文件，否则通过元数据服务访问（remoteStore）
+// ---------------------------------
+func NewStore(optionFunctions ...funcParams.MongoParamFunc) (store Store, err error) {
+	var (
+		bStore *boltStore
+		DMongo *DossMongo
+	)
+
+	// NOTE: 出错时须返回nil接口，而不是包含nil指针的接口
+	if config.GConfig.MetaBackend == BackendBolt {
+		if config.GConfig.BoltServer != "" && !boltOwner {
+			store = newRemoteStore(funcParams.NewMongoParams(optionFunctions).CollectionName)
+			return
+		}
+		if bStore, err = newBoltStore(funcParams.NewMongoParams(optionFunctions).CollectionName); err == nil {
+			store = bStore
+		}
+		return
+	}
+	if DMongo, err = NewDossMongo(optionFunctions...); err == nil {
+		store = DMongo
+	}
+	return
+}
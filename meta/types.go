@@ -1,15 +1,13 @@
 package meta
 
 import (
-	"context"
 	"time"
 
+	"common"
 	"config"
 	"github.com/mongodb/mongo-go-driver/bson/primitive"
 	"github.com/mongodb/mongo-go-driver/mongo"
-	"github.com/mongodb/mongo-go-driver/mongo/options"
 	"meta/funcParams"
-	"utils"
 )
 
 type OIdFilter struct {
@@ -20,19 +18,39 @@ type OIdFilter struct {
 // 系统对象元数据类型定义
 // ================================
 type ObjectMeta struct {
-	Name    string `bson:"name"`    // 对象名
-	Version int    `bson:"version"` // 对象版本号
-	Size    int64  `bson:"size"`    // 对象大小
-	Hash    string `bson:"hash"`    // 对象hash值
+	Bucket   string          `bson:"bucket"`                  // 对象所属的存储桶
+	Name     string          `bson:"name"`                    // 对象名（存储桶内唯一，可以包含"/"）
+	Version  int             `bson:"version"`                 // 对象版本号
+	Size     int64           `bson:"size"`                    // 对象大小
+	Hash     string          `bson:"hash"`                    // 对象hash值
+	EC       common.ECScheme `bson:"ec"`                      // 对象数据的纠删码方案（为空表示旧版本写入的对象）
+	Inline   bool            `bson:"inline"`                  // 对象数据是否内联存储在元数据中（不写入数据节点）
+	Data     []byte          `bson:"data,omitempty" json:"-"` // 内联存储的对象数据
+	Created  time.Time       `bson:"created"`                 // 对象创建时间（对象第一个版本的上传时间，删除后重新上传则重新计算）
+	Modified time.Time       `bson:"modified"`                // 对象修改时间（该版本的上传时间）
+}
+
+// 获取对象数据的纠删码方案：旧版本写入的对象没有记录方案，使用配置文件中的dataShards、parityShards
+func (meta *ObjectMeta) Scheme() common.ECScheme {
+	if meta.EC.IsZero() {
+		return config.GConfig.LegacyScheme
+	}
+	return meta.EC
 }
 
 type NameVersionFilter struct {
+	Bucket  string `bson:"bucket"`
 	Name    string `bson:"name"`
 	Version int    `bson:"version"`
 }
 
 type NameFilter struct {
-	Name string `bson:"name"`
+	Bucket string `bson:"bucket"`
+	Name   string `bson:"name"`
+}
+
+type BucketFilter struct {
+	Bucket string `bson:"bucket"`
 }
 
 type VersionFilter struct {
@@ -47,6 +65,219 @@ type SortMetaByVersion struct {
 	SortOrder int `bson:"version"`
 }
 
+// 按照存储桶、对象名前缀、起始对象名（不包含）查询的过滤条件
+type NameRangeFilter struct {
+	Bucket string    `bson:"bucket"`
+	Name   NameRange `bson:"name"`
+}
+
+type NameRange struct {
+	Gt    string `bson:"$gt"`
+	Regex string `bson:"$regex,omitempty"`
+}
+
+// 按照对象名升序、版本号降序排序
+type SortMetaByNameVersion struct {
+	Name    int `bson:"name"`
+	Version int `bson:"version"`
+}
+
+// 按照hash值查询大于Gt的对象元数据（用于按照hash值顺序遍历所有对象数据）
+type HashRangeFilter struct {
+	Hash StringGreater `bson:"hash"`
+}
+
+type StringGreater struct {
+	Gt string `bson:"$gt"`
+}
+
+type SortMetaByHash struct {
+	Hash int `bson:"hash"`
+}
+
+// 对象元数据索引：按照存储桶、对象名、版本号（倒序），用于对象元数据的查询和按照对象名顺序的列举
+type ObjectNameIndex struct {
+	Bucket  int `bson:"bucket"`
+	Name    int `bson:"name"`
+	Version int `bson:"version"`
+}
+
+// 对象元数据索引：按照对象hash值，用于数据去重和数据维护时根据hash查询元数据
+type ObjectHashIndex struct {
+	Hash int `bson:"hash"`
+}
+
+// ================================
+// 存储桶元数据类型定义
+// ================================
+type BucketMeta struct {
+	Name    string          `bson:"name"`    // 存储桶名
+	EC      common.ECScheme `bson:"ec"`      // 存储桶内新写入对象的纠删码方案（为空则使用配置文件中的defaultEC）
+	Created time.Time       `bson:"created"` // 存储桶创建时间
+}
+
+// 获取存储桶内新写入对象的纠删码方案
+func (meta *BucketMeta) Scheme() common.ECScheme {
+	if meta.EC.IsZero() {
+		return config.GConfig.DefaultScheme
+	}
+	return meta.EC
+}
+
+type BucketNameFilter struct {
+	Name string `bson:"name"`
+}
+
+// 存储桶不存在时才插入（$setOnInsert）
+type BucketUpsert struct {
+	SetOnInsert BucketMeta `bson:"$setOnInsert"`
+}
+
+type SortBucketByName struct {
+	Name int `bson:"name"`
+}
+
+// 存储桶元数据索引：存储桶名唯一
+type BucketNameIndex struct {
+	Name int `bson:"name"`
+}
+
+// ================================
+// 分片上传（multipart upload）元数据类型定义
+// ================================
+const (
+	UploadStateUploading  = "uploading"  // 上传中
+	UploadStateCompleting = "completing" // 合并中（各part正在后台合并为正式对象，不能再上传part）
+	UploadStateCompleted  = "completed"  // 已完成（各part已合并为正式对象）
+	UploadStateAborted    = "aborted"    // 已取消（客户端取消或超期未完成）
+)
+
+type UploadMeta struct {
+	UploadId  string          `bson:"upload_id"` // 上传id
+	Bucket    string          `bson:"bucket"`    // 对象所属的存储桶
+	Name      string          `bson:"name"`      // 对象名
+	State     string          `bson:"state"`     // 上传状态
+	EC        common.ECScheme `bson:"ec"`        // 各part以及合并后对象的纠删码方案（创建上传时确定）
+	Hash      string          `bson:"hash"`      // 合并后对象的hash值（开始合并时记录）
+	Error     string          `bson:"error"`     // 上一次合并失败的原因（合并失败后恢复为uploading，可以重新合并）
+	Initiated time.Time       `bson:"initiated"` // 上传的创建时间
+	Finished  time.Time       `bson:"finished"`  // 上传的结束时间（完成或取消）
+}
+
+// 上传是否未结束（上传中或者合并中），未结束的上传引用的part数据不能清除
+func (meta *UploadMeta) Unfinished() bool {
+	return meta.State == UploadStateUploading || meta.State == UploadStateCompleting
+}
+
+// 获取分片上传的纠删码方案（旧版本创建的上传没有记录方案，使用旧方案）
+func (meta *UploadMeta) Scheme() common.ECScheme {
+	if meta.EC.IsZero() {
+		return config.GConfig.LegacyScheme
+	}
+	return meta.EC
+}
+
+type UploadIdFilter struct {
+	UploadId string `bson:"upload_id"`
+}
+
+type UploadIdStateFilter struct {
+	UploadId string `bson:"upload_id"`
+	State    string `bson:"state"`
+}
+
+// 上传状态为多个状态之一的过滤条件
+type UploadIdStatesFilter struct {
+	UploadId string        `bson:"upload_id"`
+	State    UploadStateIn `bson:"state"`
+}
+
+// 按照上传状态查询的过滤条件（状态为In中的一个）
+type UploadStatesFilter struct {
+	State UploadStateIn `bson:"state"`
+}
+
+type UploadStateIn struct {
+	In []string `bson:"$in"`
+}
+
+// 按照上传状态、创建时间（早于Lt）查询的过滤条件
+type UploadExpireFilter struct {
+	State     UploadStateIn `bson:"state"`
+	Initiated TimeLess      `bson:"initiated"`
+}
+
+type TimeLess struct {
+	Lt time.Time `bson:"$lt"`
+}
+
+type UploadFinishUpdate struct {
+	Set UploadFinishSet `bson:"$set"`
+}
+
+type UploadFinishSet struct {
+	State    string    `bson:"state"`
+	Finished time.Time `bson:"finished"`
+}
+
+type UploadCompleteUpdate struct {
+	Set UploadCompleteSet `bson:"$set"`
+}
+
+// 开始合并时记录对象hash并清除上一次合并失败的原因，合并失败时记录失败原因
+type UploadCompleteSet struct {
+	State string `bson:"state"`
+	Hash  string `bson:"hash"`
+	Error string `bson:"error"`
+}
+
+// 分片上传中的part元数据：part数据作为独立的对象存储（按照part的hash值定位）
+type UploadPartMeta struct {
+	UploadId string          `bson:"upload_id"`   // 所属的上传id
+	Number   int             `bson:"part_number"` // part编号
+	Size     int64           `bson:"size"`        // part大小
+	Hash     string          `bson:"hash"`        // part的hash值
+	EC       common.ECScheme `bson:"ec"`          // part数据的纠删码方案
+	Modified time.Time       `bson:"modified"`    // part的上传时间
+}
+
+// 获取part数据的纠删码方案（为空表示旧版本写入的part）
+func (meta *UploadPartMeta) Scheme() common.ECScheme {
+	if meta.EC.IsZero() {
+		return config.GConfig.LegacyScheme
+	}
+	return meta.EC
+}
+
+type UploadPartFilter struct {
+	UploadId string `bson:"upload_id"`
+	Number   int    `bson:"part_number"`
+}
+
+// 同一part重复上传时覆盖之前的记录
+type UploadPartUpsert struct {
+	Set UploadPartMeta `bson:"$set"`
+}
+
+type SortPartByNumber struct {
+	Number int `bson:"part_number"`
+}
+
+// 分片上传元数据索引：上传id唯一
+type UploadIdIndex struct {
+	UploadId int `bson:"upload_id"`
+}
+
+// part元数据索引：上传id + part编号唯一；按照hash值查询part引用
+type UploadPartIndex struct {
+	UploadId int `bson:"upload_id"`
+	Number   int `bson:"part_number"`
+}
+
+type UploadPartHashIndex struct {
+	Hash int `bson:"hash"`
+}
+
 // 关于MongoDB操作的结构体
 type DossMongo struct {
 	Database   *mongo.Database
@@ -58,51 +289,103 @@ type DossMongo struct {
 // NOTE：
 //   1) 若使用types.go中默认的数据库名、集合名，则直接调用NewDossMongo()
 //   2) 若获取自定义的集合，则可调用如下形式：
-//          NewDossMeta(OptionDatabase("dbName"))
-//          NewDossMeta(OptionCollection("colName"))
-//          NewDossMeta(OptionDatabase("dbName"), OptionCollection("colName"))
-//   3) 若只创建mongo.Database变量，则调用NewMongoClient().Database("dbName")
+//          NewDossMongo(MongoParamDatabase("dbName"))
+//          NewDossMongo(MongoParamCollection("colName"))
+//          NewDossMongo(MongoParamDatabase("dbName"), MongoParamCollection("colName"))
+//   3) 所有DossMongo共用进程内的MongoDB客户端（见client.go），创建DossMongo不会建立新的连接，
+//      因此可以在每次请求时创建；客户端创建失败时返回错误
 // ---------------------------------
-func NewDossMongo(optionFunctions ...funcParams.MongoParamFunc) *DossMongo {
+func NewDossMongo(optionFunctions ...funcParams.MongoParamFunc) (DMongo *DossMongo, err error) {
 	var (
 		Options *funcParams.MongoParams
 		client  *mongo.Client
-		ctx     context.Context
-		err     error
 	)
 
 	// 生成默认参数
 	Options = funcParams.NewMongoParams(optionFunctions)
 
 	// 生成Mongo结构体
-	ctx, _ = context.WithTimeout(context.Background(), config.GConfig.MongoConnectTimeout*time.Second)
-	client, err = mongo.Connect(ctx, options.Client().ApplyURI(utils.GetMongodbUrl()))
-	if err != nil {
-		panic(err)
+	if client, err = getMongoClient(); err != nil {
+		return
 	}
-	return &DossMongo{
+	DMongo = &DossMongo{
 		Database:   client.Database(Options.DatabaseName),
 		Collection: client.Database(Options.DatabaseName).Collection(Options.CollectionName),
 	}
+	return
 }
 
 // ================================
 // 数据节点元数据类型定义
 // ================================
+// 数据节点的状态
+const (
+	NodeStateActive   = "active"   // 正常（未设置状态的历史文档同样视为正常）
+	NodeStateDraining = "draining" // 下线中：已移出哈希环，分片迁移完成后删除该节点
+)
+
+// 故障域的级别（配置项failureDomain）
+const (
+	FailureDomainRack = "rack" // 机架（默认）
+	FailureDomainZone = "zone" // 可用区
+)
+
 type DsNode struct {
-	OId    primitive.ObjectID `bson:"_id"`    // objectID
-	Ip     string             `bson:"ip"`     // 节点ip
-	Weight int                `bson:"weight"` // 节点权重
+	OId         primitive.ObjectID `bson:"_id"`          // objectID
+	Ip          string             `bson:"ip"`           // 节点ip
+	Weight      int                `bson:"weight"`       // 节点权重
+	FixedWeight bool               `bson:"fixed_weight"` // 权重由dataServer的weight参数指定（apiServer不按照容量调整）
+	Full        bool               `bson:"full"`         // 磁盘使用率超过水位线：仍在哈希环上，但不再写入新的分片
+	State       string             `bson:"state"`        // 节点状态
+	Zone        string             `bson:"zone"`         // 节点所在的可用区
+	Rack        string             `bson:"rack"`         // 节点所在的机架（可用区内唯一）
+}
+
+// 获取数据节点所在的故障域：故障域级别为zone时为可用区，否则为可用区内的机架
+// NOTE: 未设置标签的节点都属于同一个故障域（空字符串）
+func (node *DsNode) FailureDomain() string {
+	if config.GConfig.FailureDomain == FailureDomainZone || node.Rack == "" {
+		return node.Zone
+	}
+	return node.Zone + "/" + node.Rack
 }
 
 type NodeIpFilter struct {
 	Ip string `bson:"ip"`
 }
 
-// 关于node表changeStream的定义
-type NodeStream struct {
-	Type   string    `bson:"operationType"`
-	DocKey OIdFilter `bson:"documentKey"`
+type NodeStateUpdate struct {
+	Set NodeStateSet `bson:"$set"`
+}
+
+type NodeStateSet struct {
+	State string `bson:"state"`
+}
+
+type NodeDomainUpdate struct {
+	Set NodeDomainSet `bson:"$set"`
+}
+
+type NodeDomainSet struct {
+	Zone string `bson:"zone"`
+	Rack string `bson:"rack"`
+}
+
+type NodeWeightUpdate struct {
+	Set NodeWeightSet `bson:"$set"`
+}
+
+type NodeWeightSet struct {
+	Weight      int  `bson:"weight"`
+	FixedWeight bool `bson:"fixed_weight"`
+}
+
+type NodeFullUpdate struct {
+	Set NodeFullSet `bson:"$set"`
+}
+
+type NodeFullSet struct {
+	Full bool `bson:"full"`
 }
 
 // ================================
@@ -170,14 +453,43 @@ type ShardHashFilter struct {
 	Hash string `bson:"hash"`
 }
 
+// 聚合对象整理时更新分片所在的聚合对象：只有分片hash值和所在的聚合对象均未改变时才更新
+type ShardSwapFilter struct {
+	Object    string       `bson:"object"`
+	Index     int          `bson:"index"`
+	Hash      string       `bson:"hash"`
+	Aggregate []*AggObject `bson:"aggregate"`
+}
+
+type ShardAggregateUpdate struct {
+	Set ShardAggregateSet `bson:"$set"`
+}
+
+type ShardAggregateSet struct {
+	Aggregate []*AggObject `bson:"aggregate"`
+}
+
 // ================================
 // 待修复对象分片元数据类型定义
 // ================================
 type RepairShard struct {
-	ObjHash    string `bson:"objHash"`
-	ShardIndex string `bson:"shardIndex"`
-	ShardHash  string `bson:"shardHash"`
-	Locker     string `bson:"locker"`
+	ObjHash    string    `bson:"objHash"`
+	ShardIndex string    `bson:"shardIndex"`
+	ShardHash  string    `bson:"shardHash"`
+	Lost       int       `bson:"lost"`        // 丢失的分片数（只用于丢失分片的修复任务，分片损坏的修复任务为0）
+	Locker     string    `bson:"locker"`      // 修复租约的持有者（apiServer的ip:port）
+	LockExpire time.Time `bson:"lock_expire"` // 修复租约的过期时间：持有者修复期间定期续期，过期后可由其他apiServer接管
+}
+
+// 丢失分片的修复任务使用的shardHash（分片文件已不存在，无法得到分片hash值，故按照对象hash值构造）
+// NOTE: 分片hash值为URL转义后的base64编码，不会包含":"，不会与分片损坏的修复任务冲突
+func LostShardKey(objHash string) string {
+	return "lost:" + objHash
+}
+
+// 修复租约是否可以被locker获取：未被加锁、已被自己加锁或者租约已过期
+func (meta *RepairShard) Lockable(locker string, now time.Time) bool {
+	return meta.Locker == "" || meta.Locker == locker || meta.LockExpire.Before(now)
 }
 
 type RepairShardFilter struct {
@@ -188,16 +500,182 @@ type RepairLockerFilter struct {
 	Locker string `bson:"locker"`
 }
 
+// 可加锁的待修复分片：未被加锁、已被自己加锁或者租约已过期（旧版本加锁的文档没有过期时间，视为已过期）
+type RepairLockFilter struct {
+	ShardHash string        `bson:"shardHash"`
+	Or        []interface{} `bson:"$or"`
+}
+
+// 租约未被加锁或已过期的待修复分片
+type RepairExpiredFilter struct {
+	Or []interface{} `bson:"$or"`
+}
+
+// 仍由locker持有租约的待修复分片（用于续期）
+type RepairLeaseFilter struct {
+	ShardHash string `bson:"shardHash"`
+	Locker    string `bson:"locker"`
+}
+
+type RepairLockExpire struct {
+	LockExpire TimeLess `bson:"lock_expire"`
+}
+
+type RepairLockExpireMissing struct {
+	LockExpire FieldExists `bson:"lock_expire"`
+}
+
+type FieldExists struct {
+	Exists bool `bson:"$exists"`
+}
+
 type RepairShardUpdate struct {
 	Set RepairShardLocker `bson:"$set"`
 }
 
 type RepairShardLocker struct {
+	Locker     string    `bson:"locker"`
+	LockExpire time.Time `bson:"lock_expire"`
+}
+
+type RepairLeaseUpdate struct {
+	Set RepairLeaseSet `bson:"$set"`
+}
+
+type RepairLeaseSet struct {
+	LockExpire time.Time `bson:"lock_expire"`
+}
+
+// ================================
+// 数据迁移（rebalance）任务元数据类型定义
+// NOTE: 集群中只有一个迁移任务（按照name唯一），哈希环再次变化时更新该任务的目标哈希环
+// ================================
+const RebalanceJobName = "rebalance"
+
+const (
+	RebalanceStateRunning  = "running"  // 迁移中
+	RebalanceStateFinished = "finished" // 已完成
+)
+
+// 哈希环上的物理节点及其权重、故障域（哈希环的快照由节点列表表示）
+// Full：节点已满，仍在哈希环上（读取以及已有分片的定位不变），但不再写入新的分片
+type RingNode struct {
+	Ip     string `bson:"ip"`
+	Weight int    `bson:"weight"`
+	Domain string `bson:"domain"`
+	Full   bool   `bson:"full"`
+}
+
+type RebalanceJob struct {
+	Name       string        `bson:"name"`        // 任务名（固定为RebalanceJobName）
+	State      string        `bson:"state"`       // 任务状态
+	Generation int           `bson:"generation"`  // 任务代数：每次创建任务或者目标哈希环变化时加1
+	Sources    [][]*RingNode `bson:"sources"`     // 数据可能所在的哈希环（任务创建前的哈希环，以及被替换的目标哈希环）
+	Target     []*RingNode   `bson:"target"`      // 目标哈希环
+	Marker     string        `bson:"marker"`      // 迁移进度：已处理完成的最后一个对象hash值
+	Objects    int64         `bson:"objects"`     // 已处理的对象数
+	Shards     int64         `bson:"shards"`      // 已迁移的分片数
+	Bytes      int64         `bson:"bytes"`       // 已迁移的数据量（字节）
+	Failed     int64         `bson:"failed"`      // 迁移失败的对象数
+	Locker     string        `bson:"locker"`      // 执行迁移的apiServer（ip:port）
+	LockExpire time.Time     `bson:"lock_expire"` // 执行者的锁过期时间（过期后其他apiServer可接管任务）
+	Started    time.Time     `bson:"started"`     // 任务创建时间
+	Updated    time.Time     `bson:"updated"`     // 最近一次保存进度的时间
+	Finished   time.Time     `bson:"finished"`    // 任务完成时间
+}
+
+type RebalanceNameFilter struct {
+	Name string `bson:"name"`
+}
+
+type RebalanceGenerationFilter struct {
+	Name       string `bson:"name"`
+	Generation int    `bson:"generation"`
+}
+
+type RebalanceLockerFilter struct {
+	Name       string `bson:"name"`
+	Generation int    `bson:"generation"`
+	Locker     string `bson:"locker"`
+}
+
+// 可加锁的迁移任务：任务迁移中，且未被加锁、已被自己加锁或者锁已过期
+type RebalanceLockFilter struct {
+	Name  string        `bson:"name"`
+	State string        `bson:"state"`
+	Or    []interface{} `bson:"$or"`
+}
+
+type RebalanceLocker struct {
+	Locker string `bson:"locker"`
+}
+
+type RebalanceLockExpire struct {
+	LockExpire TimeLess `bson:"lock_expire"`
+}
+
+type RebalanceLockUpdate struct {
+	Set RebalanceLockSet `bson:"$set"`
+}
+
+type RebalanceLockSet struct {
+	Locker     string    `bson:"locker"`
+	LockExpire time.Time `bson:"lock_expire"`
+}
+
+// 迁移任务元数据索引：任务名唯一
+type RebalanceNameIndex struct {
+	Name int `bson:"name"`
+}
+
+// ================================
+// 丢失分片检测任务元数据类型定义
+// NOTE: 集群中只有一个检测任务（保存在数据迁移任务集合中，按照name唯一），由加锁成功的apiServer执行，
+//       按照对象hash值的顺序分批检测，每批检测完成后保存进度并续期锁
+// ================================
+const LostShardScanName = "lost_shard_scan"
+
+type ScanJob struct {
+	Name       string    `bson:"name"`        // 任务名（固定为LostShardScanName）
+	Round      int       `bson:"round"`       // 检测轮次：每遍历完所有对象加1
+	Marker     string    `bson:"marker"`      // 检测进度：本轮已检测完成的最后一个对象hash值
+	Objects    int64     `bson:"objects"`     // 本轮已检测的对象数
+	Degraded   int64     `bson:"degraded"`    // 本轮发现的有分片丢失的对象数
+	Locker     string    `bson:"locker"`      // 执行检测的apiServer（ip:port）
+	LockExpire time.Time `bson:"lock_expire"` // 执行者的锁过期时间（过期后其他apiServer可接管任务）
+	Started    time.Time `bson:"started"`     // 本轮检测开始时间
+	Updated    time.Time `bson:"updated"`     // 最近一次保存进度的时间
+	Finished   time.Time `bson:"finished"`    // 上一轮检测完成时间
+}
+
+type ScanNameFilter struct {
+	Name string `bson:"name"`
+}
+
+type ScanLockerFilter struct {
+	Name   string `bson:"name"`
 	Locker string `bson:"locker"`
 }
 
-// 关于待修复对象分片元数据表changeStream的定义
-type RepairStream struct {
-	Type   string    `bson:"operationType"`
-	DocKey OIdFilter `bson:"documentKey"`
+// 可加锁的检测任务：未被加锁、已被自己加锁或者锁已过期
+type ScanLockFilter struct {
+	Name string        `bson:"name"`
+	Or   []interface{} `bson:"$or"`
+}
+
+type ScanLockUpdate struct {
+	Set RebalanceLockSet `bson:"$set"`
+}
+
+// 检测任务加锁（任务未被加锁、已被自己加锁或者锁已过期时才能加锁成功）
+func (job *ScanJob) Lockable(locker string, now time.Time) bool {
+	return job.Locker == "" || job.Locker == locker || job.LockExpire.Before(now)
+}
+
+// ================================
+// 元数据变化事件（node表、待修复对象分片元数据表的changeStream）
+// ================================
+type ChangeEvent struct {
+	Type   string    `bson:"operationType"` // 变化类型：insert、delete等
+	DocKey OIdFilter `bson:"documentKey"`   // 发生变化的文档的objectId
 }
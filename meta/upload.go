@@ -0,0 +1,275 @@
+package meta
+
+import (
+	"time"
+
+	"config"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+	"meta/funcParams"
+)
+
+// NOTE: 分片上传元数据的操作须使用上传集合创建的DossMongo：
+//       NewDossMongo(funcParams.MongoParamCollection(config.GConfig.UploadColName))，
+//       part元数据位于同一数据库的UploadPartColName集合中
+
+// part元数据集合
+func (DMongo *DossMongo) partCollection() *mongo.Collection {
+	return DMongo.Database.Collection(config.GConfig.UploadPartColName)
+}
+
+// -------------------------------------------
+// 创建分片上传（返回上传id）
+// -------------------------------------------
+func (DMongo *DossMongo) NewUpload(bucket string, name string, paramFunc ...funcParams.MetaParamFunc) (
+	uploadId string, err error) {
+
+	var doc *UploadMeta
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	doc = &UploadMeta{
+		UploadId:  primitive.NewObjectID().Hex(),
+		Bucket:    bucket,
+		Name:      name,
+		State:     UploadStateUploading,
+		EC:        funcParams.NewMetaParams(paramFunc).EC,
+		Initiated: time.Now().UTC(),
+	}
+	if _, err = DMongo.Collection.InsertOne(ctx, doc); err != nil {
+		return
+	}
+	uploadId = doc.UploadId
+	return
+}
+
+// -------------------------------------------
+// 获取分片上传元数据（若不存在则返回nil）
+// -------------------------------------------
+func (DMongo *DossMongo) GetUpload(uploadId string) (upload *UploadMeta, err error) {
+	var result *mongo.SingleResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if result = DMongo.Collection.FindOne(ctx, &UploadIdFilter{UploadId: uploadId}); result.Err() != nil {
+		if err = result.Err(); err == mongo.ErrNoDocuments {
+			err = nil
+		}
+		return
+	}
+	upload = &UploadMeta{}
+	if err = result.Decode(upload); err != nil {
+		upload = nil
+	}
+	return
+}
+
+// -------------------------------------------
+// 结束分片上传：将上传状态由uploading或completing修改为state（completed或aborted）
+// NOTE: 通过FindOneAndUpdate保证只有一个请求可以结束该上传，若上传已结束或不存在则finished为false
+// -------------------------------------------
+func (DMongo *DossMongo) FinishUpload(uploadId string, state string) (finished bool, err error) {
+	var (
+		filter *UploadIdStatesFilter
+		update *UploadFinishUpdate
+		result *mongo.SingleResult
+	)
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	filter = &UploadIdStatesFilter{
+		UploadId: uploadId,
+		State:    UploadStateIn{In: []string{UploadStateUploading, UploadStateCompleting}},
+	}
+	update = &UploadFinishUpdate{
+		Set: UploadFinishSet{State: state, Finished: time.Now().UTC()},
+	}
+	result = DMongo.Collection.FindOneAndUpdate(ctx, filter, update)
+	if err = result.Err(); err == mongo.ErrNoDocuments {
+		err = nil
+		return
+	}
+	finished = err == nil
+	return
+}
+
+// -------------------------------------------
+// 开始合并分片上传：将上传状态由uploading修改为completing，并记录合并后对象的hash值
+// NOTE: 只有一个合并请求可以开始合并，若上传不是uploading状态或不存在则begun为false
+// -------------------------------------------
+func (DMongo *DossMongo) BeginCompleteUpload(uploadId string, hash string) (begun bool, err error) {
+	return DMongo.setCompleteState(uploadId, UploadStateUploading, &UploadCompleteSet{
+		State: UploadStateCompleting,
+		Hash:  hash,
+	})
+}
+
+// -------------------------------------------
+// 合并分片上传失败：将上传状态由completing恢复为uploading并记录失败原因（客户端可以重新合并）
+// -------------------------------------------
+func (DMongo *DossMongo) FailCompleteUpload(uploadId string, reason string) (failed bool, err error) {
+	return DMongo.setCompleteState(uploadId, UploadStateCompleting, &UploadCompleteSet{
+		State: UploadStateUploading,
+		Error: reason,
+	})
+}
+
+// 将上传状态由from修改为set中的状态（上传不是from状态或不存在时updated为false）
+func (DMongo *DossMongo) setCompleteState(uploadId string, from string, set *UploadCompleteSet) (
+	updated bool, err error) {
+
+	var result *mongo.SingleResult
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	result = DMongo.Collection.FindOneAndUpdate(
+		ctx, &UploadIdStateFilter{UploadId: uploadId, State: from}, &UploadCompleteUpdate{Set: *set},
+	)
+	if err = result.Err(); err == mongo.ErrNoDocuments {
+		err = nil
+		return
+	}
+	updated = err == nil
+	return
+}
+
+// 根据过滤条件获取分片上传元数据
+func (DMongo *DossMongo) getUploadsByFilter(filter interface{}) (uploads []*UploadMeta, err error) {
+	var (
+		cursor *mongo.Cursor
+		upload *UploadMeta
+	)
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if cursor, err = DMongo.Collection.Find(ctx, filter); err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	// 解码BSON文档
+	for cursor.Next(ctx) {
+		upload = &UploadMeta{}
+		if err = cursor.Decode(upload); err != nil {
+			continue
+		}
+		uploads = append(uploads, upload)
+	}
+	return
+}
+
+// -------------------------------------------
+// 获取创建时间早于before且仍未结束（上传中或者合并中）的分片上传
+// -------------------------------------------
+func (DMongo *DossMongo) GetExpiredUploads(before time.Time) (uploads []*UploadMeta, err error) {
+	return DMongo.getUploadsByFilter(&UploadExpireFilter{
+		State:     UploadStateIn{In: []string{UploadStateUploading, UploadStateCompleting}},
+		Initiated: TimeLess{Lt: before},
+	})
+}
+
+// -------------------------------------------
+// 获取所有已结束（完成或取消）的分片上传
+// -------------------------------------------
+func (DMongo *DossMongo) GetFinishedUploads() (uploads []*UploadMeta, err error) {
+	return DMongo.getUploadsByFilter(&UploadStatesFilter{
+		State: UploadStateIn{In: []string{UploadStateCompleted, UploadStateAborted}},
+	})
+}
+
+// -------------------------------------------
+// 删除分片上传元数据及其所有part元数据
+// -------------------------------------------
+func (DMongo *DossMongo) DeleteUpload(uploadId string) (err error) {
+	ctx, cancel := opContext()
+	defer cancel()
+
+	if _, err = DMongo.partCollection().DeleteMany(ctx, &UploadIdFilter{UploadId: uploadId}); err != nil {
+		return
+	}
+	_, err = DMongo.Collection.DeleteOne(ctx, &UploadIdFilter{UploadId: uploadId})
+	return
+}
+
+// -------------------------------------------
+// 添加part元数据（同一part重复上传时覆盖之前的记录，各part之间互不影响，可以并行上传）
+// -------------------------------------------
+func (DMongo *DossMongo) PutUploadPart(uploadId string, number int, size int64, hash string,
+	paramFunc ...funcParams.MetaParamFunc) (err error) {
+
+	var (
+		filter *UploadPartFilter
+		update *UploadPartUpsert
+		result *mongo.SingleResult
+	)
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	filter = &UploadPartFilter{UploadId: uploadId, Number: number}
+	update = &UploadPartUpsert{
+		Set: UploadPartMeta{
+			UploadId: uploadId,
+			Number:   number,
+			Size:     size,
+			Hash:     hash,
+			EC:       funcParams.NewMetaParams(paramFunc).EC,
+			Modified: time.Now().UTC(),
+		},
+	}
+	result = DMongo.partCollection().FindOneAndUpdate(
+		ctx, filter, update, options.FindOneAndUpdate().SetUpsert(true),
+	)
+	if err = result.Err(); err == mongo.ErrNoDocuments {
+		err = nil
+	}
+	return
+}
+
+// 根据过滤条件获取part元数据（按照part编号升序）
+func (DMongo *DossMongo) getPartsByFilter(filter interface{}) (parts []*UploadPartMeta, err error) {
+	var (
+		findOption *options.FindOptions
+		cursor     *mongo.Cursor
+		part       *UploadPartMeta
+	)
+
+	ctx, cancel := opContext()
+	defer cancel()
+
+	findOption = options.Find().SetSort(&SortPartByNumber{Number: 1})
+	if cursor, err = DMongo.partCollection().Find(ctx, filter, findOption); err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	// 解码BSON文档
+	for cursor.Next(ctx) {
+		part = &UploadPartMeta{}
+		if err = cursor.Decode(part); err != nil {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return
+}
+
+// -------------------------------------------
+// 获取分片上传的所有part元数据（按照part编号升序）
+// -------------------------------------------
+func (DMongo *DossMongo) GetUploadParts(uploadId string) (parts []*UploadPartMeta, err error) {
+	return DMongo.getPartsByFilter(&UploadIdFilter{UploadId: uploadId})
+}
+
+// -------------------------------------------
+// 获取引用了该hash值的所有part元数据（用于判断part数据是否仍被其他上传引用）
+// -------------------------------------------
+func (DMongo *DossMongo) GetUploadPartsByHash(hash string) (parts []*UploadPartMeta, err error) {
+	return DMongo.getPartsByFilter(&HashFilter{Hash: hash})
+}
@@ -10,18 +10,15 @@ import (
 // --------------------------------
 // Producer方法定义
 // --------------------------------
-func (pro *Producer) Publish(exchange string, body interface{}) {
-	var (
-		strBytes []byte
-		err      error
-	)
+func (pro *Producer) Publish(exchange string, body interface{}) (err error) {
+	var strBytes []byte
 
 	strBytes, err = json.Marshal(body)
 	if err != nil {
 		panic(err)
 	}
 
-	err = pro.Channel.Publish(
+	return pro.Channel.Publish(
 		exchange,
 		"",
 		false,
@@ -31,9 +28,6 @@ func (pro *Producer) Publish(exchange string, body interface{}) {
 			Body:        strBytes,
 		},
 	)
-	// if err != nil {
-	// 	panic(err)
-	// }
 }
 
 func (pro *Producer) Close() {
@@ -8,26 +8,41 @@ import (
 )
 
 type GetStream struct {
-	reader io.Reader
+	reader io.ReadCloser
 }
 
 // 创建对象读取流
 // param: server: 服务器地址 (ip:port); object: 对象名（若为纠删码下载流，则object应为：对象名.分片下标）
 func NewGetStream(server, object string) (getStream *GetStream, err error) {
+	return NewRangeGetStream(server, object, 0)
+}
+
+// 创建从offset处开始读取的对象读取流（offset为0时dataServer会校验整个分片的hash值）
+func NewRangeGetStream(server, object string, offset int64) (getStream *GetStream, err error) {
 	if server == "" || object == "" {
 		err = common.ErrGetStreamUrl
 		return
 	}
-	getStream, err = newGetStream("http://" + server + "/objects/" + object)
+	getStream, err = newGetStream("http://"+server+"/objects/"+object, offset)
 	return
 }
 
-func newGetStream(url string) (stream *GetStream, err error) {
-	var response *http.Response
-	if response, err = http.Get(url); err != nil {
+func newGetStream(url string, offset int64) (stream *GetStream, err error) {
+	var (
+		request  *http.Request
+		response *http.Response
+	)
+	if request, err = http.NewRequest(http.MethodGet, url, nil); err != nil {
 		return
 	}
-	if response.StatusCode != http.StatusOK {
+	if offset > 0 {
+		request.Header.Set("range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	if response, err = http.DefaultClient.Do(request); err != nil {
+		return
+	}
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusPartialContent {
+		response.Body.Close()
 		stream = nil
 		err = fmt.Errorf("%s: %d", common.ErrGetStreamResponse.Error(), response.StatusCode)
 		return
@@ -40,3 +55,8 @@ func newGetStream(url string) (stream *GetStream, err error) {
 func (r *GetStream) Read(p []byte) (n int, err error) {
 	return r.reader.Read(p)
 }
+
+// 关闭读取流（释放HTTP连接）
+func (r *GetStream) Close() error {
+	return r.reader.Close()
+}
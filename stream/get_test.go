@@ -1,10 +1,19 @@
 package stream
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"common"
+	"config"
+	"utils"
 )
 
 func getHandler(w http.ResponseWriter, r *http.Request) {
@@ -30,3 +39,171 @@ func TestGet(t *testing.T) {
 		t.Errorf("read body failed, read %s, expect hello_world", body)
 	}
 }
+
+func rangeGetHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		data   = []byte("hello_world")
+		offset = utils.GetOffsetFromHeader(r.Header)
+	)
+	if offset > 0 {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	w.Write(data[offset:])
+}
+
+func TestRangeGet(t *testing.T) {
+	var (
+		server    *httptest.Server
+		getStream *GetStream
+		body      []byte
+		err       error
+	)
+
+	server = httptest.NewServer(http.HandlerFunc(rangeGetHandler))
+	defer server.Close()
+
+	if getStream, err = NewRangeGetStream(server.URL[7:], "test_object", 6); err != nil {
+		t.Fatal(err)
+	}
+	defer getStream.Close()
+	body, _ = ioutil.ReadAll(getStream)
+	if string(body) != "world" {
+		t.Errorf("read body failed, read %s, expect world", body)
+	}
+}
+
+func TestInlineGet(t *testing.T) {
+	var (
+		getStream *InlineGetStream
+		body      = make([]byte, 3)
+		position  int64
+		err       error
+	)
+
+	if getStream, err = NewInlineGetStream([]byte("hello_world"), 2); err != nil {
+		t.Fatal(err)
+	}
+	defer getStream.Close()
+	getStream.Read(body)
+	if position, err = getStream.Seek(1, io.SeekCurrent); err != nil || position != 6 {
+		t.Error("seek failed:", position, err)
+	}
+	if _, err = getStream.Seek(-1, io.SeekCurrent); err == nil {
+		t.Error("expected backward seek to fail")
+	}
+	body, _ = ioutil.ReadAll(getStream)
+	if string(body) != "world" {
+		t.Errorf("read body failed, read %s, expect world", body)
+	}
+}
+
+// 模拟存储纠删码分片的dataServer：aborted中的分片每次响应只返回limit字节后中断连接（模拟块校验失败）
+func newShardServer(shards map[string][]byte, aborted map[string]bool, limit int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			name   = strings.TrimPrefix(r.URL.Path, "/objects/")
+			offset = utils.GetOffsetFromHeader(r.Header)
+			data   []byte
+			ok     bool
+		)
+		if data, ok = shards[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if offset > 0 {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		data = data[offset:]
+		if aborted[name] && len(data) > limit {
+			w.Write(data[:limit])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Write(data)
+	}))
+}
+
+// 按照纠删码方案ec将data编码为各分片，返回所有分片位于server上的定位信息
+func encodeShards(data []byte, hash string, ec common.ECScheme, server string) (
+	shards map[string][]byte, locateInfo map[int]string) {
+
+	var (
+		buffers = make([]*bytes.Buffer, ec.AllShards())
+		writers = make([]io.Writer, ec.AllShards())
+		encoder *putEncoder
+		i       int
+	)
+
+	for i = range buffers {
+		buffers[i] = new(bytes.Buffer)
+		writers[i] = buffers[i]
+	}
+	encoder = NewPutEncoder(writers, ec)
+	encoder.Write(data)
+	encoder.Flush()
+
+	shards, locateInfo = make(map[string][]byte), make(map[int]string)
+	for i = range buffers {
+		shards[fmt.Sprintf("%s.%d", hash, i)] = buffers[i].Bytes()
+		locateInfo[i] = server
+	}
+	return
+}
+
+func TestRSRangeGetAbortedShard(t *testing.T) {
+	var (
+		ec         = common.ECScheme{DataShards: 2, ParityShards: 1, Mode: common.StorageModeEC}
+		blockSize  = int64(BlockSize(ec))
+		data       = make([]byte, 3*blockSize+1234)
+		shards     = make(map[string][]byte)
+		aborted    = make(map[string]bool)
+		server     *httptest.Server
+		encoded    map[string][]byte
+		locateInfo map[int]string
+		getStream  *RSGetStream
+		body       []byte
+		offset     int64
+		position   int64
+		err        error
+	)
+
+	rand.Read(data)
+	server = newShardServer(shards, aborted, config.GConfig.BlockPerShard+50)
+	defer server.Close()
+	encoded, locateInfo = encodeShards(data, "test_object", ec, server.URL[7:])
+	for name := range encoded {
+		shards[name] = encoded[name]
+	}
+
+	// 数据分片在第二个条带中途中断：由其他分片解码出该分片之后的数据
+	aborted["test_object.0"] = true
+	for _, offset = range []int64{0, 100, blockSize + 100} {
+		if getStream, err = NewRSRangeGetStream(locateInfo, "test_object", int64(len(data)), offset, ec); err != nil {
+			t.Fatal(err)
+		}
+		body, err = ioutil.ReadAll(getStream)
+		getStream.Close()
+		if err != nil || !bytes.Equal(body, data[offset:]) {
+			t.Errorf("range get from %d failed: read %d bytes, expect %d, err %v",
+				offset, len(body), len(data)-int(offset), err)
+		}
+	}
+
+	// 跳转到之后的条带时重新打开各分片：中断的分片在最后一个（不完整的）条带中途再次中断
+	if getStream, err = NewRSRangeGetStream(locateInfo, "test_object", int64(len(data)), 10, ec); err != nil {
+		t.Fatal(err)
+	}
+	defer getStream.Close()
+	body = make([]byte, 100)
+	if _, err = io.ReadFull(getStream, body); err != nil || !bytes.Equal(body, data[10:110]) {
+		t.Fatal("read before seek failed:", err)
+	}
+	offset = 110 + 2*blockSize
+	if position, err = getStream.Seek(2*blockSize, io.SeekCurrent); err != nil || position != offset {
+		t.Fatal("seek failed:", position, err)
+	}
+	body, err = ioutil.ReadAll(getStream)
+	if err != nil || !bytes.Equal(body, data[offset:]) {
+		t.Errorf("read after seek failed: read %d bytes, expect %d, err %v", len(body), len(data)-int(offset), err)
+	}
+}
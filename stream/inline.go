@@ -0,0 +1,45 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+
+	"common"
+)
+
+// 内联对象下载流：对象数据保存在元数据中，直接从内存读取
+type InlineGetStream struct {
+	reader *bytes.Reader
+}
+
+// 生成从对象offset处开始读取的内联对象下载流
+func NewInlineGetStream(data []byte, offset int64) (stream *InlineGetStream, err error) {
+	stream = &InlineGetStream{bytes.NewReader(data)}
+	if offset > 0 {
+		_, err = stream.Seek(offset, io.SeekCurrent)
+	}
+	return
+}
+
+func (s *InlineGetStream) Read(p []byte) (n int, err error) {
+	return s.reader.Read(p)
+}
+
+// 移动读取指针（与其他下载流一致，只支持io.SeekCurrent且只支持向后偏移），返回移动后的读取位置
+func (s *InlineGetStream) Seek(offset int64, whence int) (position int64, err error) {
+	position = s.reader.Size() - int64(s.reader.Len())
+	if whence != io.SeekCurrent {
+		err = common.ErrOnlySeekCurrent
+		return
+	}
+	if offset < 0 {
+		err = common.ErrOnlyForwardSeek
+		return
+	}
+	return s.reader.Seek(offset, io.SeekCurrent)
+}
+
+// 内联对象没有需要提交或放弃的修复数据
+func (s *InlineGetStream) Close() {}
+
+func (s *InlineGetStream) Abort() {}
@@ -0,0 +1,24 @@
+package stream
+
+import "io"
+
+// -------------------------------------------
+// 对象上传流：纠删码上传流RSPutStream或多副本上传流ReplicaPutStream
+// NOTE: 调用Commit(true)将各数据节点上的临时对象转正，Commit(false)删除临时对象
+// -------------------------------------------
+type ObjectPutStream interface {
+	io.Writer
+	Commit(success bool)
+}
+
+// -------------------------------------------
+// 对象下载流：纠删码下载流RSGetStream或多副本下载流ReplicaGetStream
+// NOTE: 读取完成后调用Close提交修复的分片，读取出错时调用Abort放弃修复的分片；
+//       Seek只支持io.SeekCurrent且只支持向后偏移
+// -------------------------------------------
+type ObjectGetStream interface {
+	io.Reader
+	io.Seeker
+	Close()
+	Abort()
+}
@@ -0,0 +1,250 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+
+	"common"
+	"config"
+)
+
+type ReplicaGetStream struct {
+	reader     *GetStream
+	current    int            // 当前读取的副本下标
+	writers    []io.Writer    // 需要修复的副本的写入流（下标为副本下标，不需要修复的为nil）
+	failed     map[int]bool   // 读取失败的副本，不再从其读取
+	locateInfo map[int]string // 各副本所在的数据节点
+	hash       string
+	size       int64
+	total      int64  // 已读取的字节数（即下一次读取的位置）
+	repair     []byte // 副本小于聚合对象大小时，修复数据缓存至Close时一次写入（dataServer须一次写入整个副本）
+	whole      bool
+}
+
+// -------------------------------------------
+// 生成多副本下载流：按照副本下标依次打开副本，从第一个可以读取的副本读取对象数据
+// NOTE: 在其之前无法读取的副本（所在节点在线，副本丢失或损坏）在读取的同时写入修复流，Close时提交
+// -------------------------------------------
+func NewReplicaGetStream(locateInfo map[int]string, hash string, size int64, ec common.ECScheme) (
+	*ReplicaGetStream, error) {
+
+	return newReplicaGetStream(locateInfo, nil, hash, size, ec, false)
+}
+
+// 生成多副本修复流：检查所有副本，无法读取的副本均在读取的同时写入修复流（用于数据修复）
+func NewReplicaRepairStream(locateInfo map[int]string, hash string, size int64, ec common.ECScheme) (
+	*ReplicaGetStream, error) {
+
+	return newReplicaGetStream(locateInfo, nil, hash, size, ec, true)
+}
+
+// -------------------------------------------
+// 生成多副本重建流：从locateInfo中可以读取的副本读取对象数据，
+// 同时写入targets中的副本（key为副本下标，value为目标数据节点）（用于数据迁移）
+// NOTE: targets中的副本不从locateInfo读取；读取完成后调用Close提交重建的副本，读取出错时调用Abort放弃
+// -------------------------------------------
+func NewReplicaRebuildStream(locateInfo map[int]string, targets map[int]string, hash string, size int64,
+	ec common.ECScheme) (*ReplicaGetStream, error) {
+
+	return newReplicaGetStream(locateInfo, targets, hash, size, ec, false)
+}
+
+// -------------------------------------------
+// 生成从对象offset处开始读取的多副本下载流（用于Range请求）
+// NOTE: 只读取了副本的一部分，dataServer不校验整个副本的hash，该下载流也不进行副本修复
+// -------------------------------------------
+func NewReplicaRangeGetStream(locateInfo map[int]string, hash string, size int64, offset int64,
+	ec common.ECScheme) (stream *ReplicaGetStream, err error) {
+
+	stream = &ReplicaGetStream{
+		writers:    make([]io.Writer, ec.AllShards()),
+		failed:     make(map[int]bool),
+		locateInfo: locateInfo,
+		hash:       hash,
+		size:       size,
+		total:      offset,
+	}
+	if offset < size {
+		err = stream.reopen()
+	}
+	return
+}
+
+// checkAll为false时找到可以读取的副本后不再检查之后的副本
+func newReplicaGetStream(locateInfo map[int]string, targets map[int]string, hash string, size int64,
+	ec common.ECScheme, checkAll bool) (stream *ReplicaGetStream, err error) {
+
+	var (
+		reader *GetStream
+		writer *TempPutStream
+		server string
+		ok     bool
+		i      int
+	)
+
+	stream = &ReplicaGetStream{
+		writers:    make([]io.Writer, ec.AllShards()),
+		failed:     make(map[int]bool),
+		locateInfo: locateInfo,
+		hash:       hash,
+		size:       size,
+		whole:      size < config.GConfig.AggregateObjSize*common.MB,
+	}
+	for i = 0; i < ec.AllShards(); i++ {
+		if server, ok = targets[i]; !ok && stream.reader != nil && !checkAll {
+			continue
+		}
+		if !ok {
+			if reader, err = NewGetStream(locateInfo[i], stream.name(i)); err == nil {
+				if stream.reader == nil {
+					stream.reader, stream.current = reader, i
+				} else {
+					reader.Close()
+				}
+				continue
+			}
+			// 副本无法读取：所在节点在线时修复该副本
+			stream.failed[i] = true
+			if server = locateInfo[i]; server == "" {
+				continue
+			}
+		}
+		if writer, err = NewTempPutStream(server, stream.name(i), size); err != nil {
+			stream.Abort()
+			return nil, err
+		}
+		stream.writers[i] = writer
+	}
+	if stream.reader == nil && size > 0 {
+		stream.Abort()
+		return nil, common.ErrNoReplicaAvailable
+	}
+	return stream, nil
+}
+
+// 第i个副本的对象名
+func (s *ReplicaGetStream) name(i int) string {
+	return fmt.Sprintf("%s.%d", s.hash, i)
+}
+
+// 从其他可以读取的副本的当前位置继续读取
+func (s *ReplicaGetStream) reopen() (err error) {
+	var (
+		reader *GetStream
+		i      int
+	)
+
+	for i = range s.writers {
+		if s.failed[i] || s.writers[i] != nil {
+			continue
+		}
+		if reader, err = NewRangeGetStream(s.locateInfo[i], s.name(i), s.total); err == nil {
+			s.reader, s.current = reader, i
+			return
+		}
+		s.failed[i] = true
+	}
+	return common.ErrNoReplicaAvailable
+}
+
+// -------------------------------------------
+// 实现io.Reader接口：读取到的数据同时写入需要修复的副本
+// NOTE: 读取中途出错（如数据节点宕机）时，从其他副本的当前位置继续读取
+// -------------------------------------------
+func (s *ReplicaGetStream) Read(p []byte) (n int, err error) {
+	if s.total >= s.size {
+		return 0, io.EOF
+	}
+	if s.reader == nil {
+		if err = s.reopen(); err != nil {
+			return
+		}
+	}
+	if n, err = s.reader.Read(p); int64(n) > s.size-s.total {
+		n = int(s.size - s.total)
+	}
+	s.writeRepair(p[:n])
+	s.total += int64(n)
+
+	// 副本读取出错或者提前结束：关闭该副本，下一次读取时切换至其他副本
+	if err != nil && s.total < s.size {
+		s.closeReader()
+		s.failed[s.current] = true
+	}
+	err = nil
+	if n == 0 && s.total >= s.size {
+		err = io.EOF
+	}
+	return
+}
+
+// 将读取到的数据写入需要修复的副本（小副本先缓存）
+func (s *ReplicaGetStream) writeRepair(p []byte) {
+	var i int
+
+	if len(p) == 0 {
+		return
+	}
+	if s.whole {
+		for i = range s.writers {
+			if s.writers[i] != nil {
+				s.repair = append(s.repair, p...)
+				break
+			}
+		}
+		return
+	}
+	for i = range s.writers {
+		if s.writers[i] != nil {
+			s.writers[i].Write(p)
+		}
+	}
+}
+
+// 关闭多副本下载流：提交修复的副本（dataServer将临时对象转为正式对象）
+func (s *ReplicaGetStream) Close() {
+	var i int
+
+	for i = range s.writers {
+		if s.writers[i] == nil {
+			continue
+		}
+		if s.whole && len(s.repair) > 0 {
+			s.writers[i].Write(s.repair)
+		}
+		s.writers[i].(*TempPutStream).Commit(true)
+	}
+	s.closeReader()
+}
+
+// 放弃多副本下载流：删除所有修复副本的临时对象
+func (s *ReplicaGetStream) Abort() {
+	abortWriters(s.writers)
+	s.closeReader()
+}
+
+func (s *ReplicaGetStream) closeReader() {
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+}
+
+// 移动多副本下载流的读取指针（只支持io.SeekCurrent且只支持向后偏移），返回移动后的读取位置
+// NOTE: 只读取了部分副本数据，无法完整修复副本，故放弃已有的副本修复写入流
+func (s *ReplicaGetStream) Seek(offset int64, whence int) (position int64, err error) {
+	if whence != io.SeekCurrent {
+		return s.total, common.ErrOnlySeekCurrent
+	}
+	if offset < 0 {
+		return s.total, common.ErrOnlyForwardSeek
+	}
+	abortWriters(s.writers)
+	for i := range s.writers {
+		s.writers[i] = nil
+	}
+	s.repair = nil
+	s.closeReader()
+	s.total += offset
+	return s.total, nil
+}
@@ -0,0 +1,98 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+
+	"common"
+	"config"
+)
+
+// 多副本上传流每批写入数据节点的数据量
+const replicaBufferSize = common.MB
+
+type ReplicaPutStream struct {
+	writers []io.Writer
+	buffer  []byte
+	whole   bool // 副本小于聚合对象大小时，dataServer须一次写入整个副本，数据全部缓存至Commit时写入
+}
+
+// -------------------------------------------
+// 创建多副本上传流：将对象数据原样写入每个副本所在数据节点的临时对象（第i个副本的对象名为hash.i）
+// NOTE: 与纠删码上传流一致，dataServers中离线的节点为空字符串，不写入该副本（由数据修复补齐）
+// -------------------------------------------
+func NewReplicaPutStream(dataServers []string, hash string, size int64, ec common.ECScheme) (
+	stream *ReplicaPutStream, err error) {
+
+	var (
+		writers []io.Writer
+		i       int
+	)
+
+	if len(dataServers) != ec.AllShards() {
+		err = common.ErrNotEnoughDS
+		return
+	}
+	writers = make([]io.Writer, ec.AllShards())
+	for i = range writers {
+		if dataServers[i] != "" {
+			if writers[i], err = NewTempPutStream(
+				dataServers[i], fmt.Sprintf("%s.%d", hash, i), size,
+			); err != nil {
+				return
+			}
+		}
+	}
+	stream = &ReplicaPutStream{writers: writers, whole: size < config.GConfig.AggregateObjSize*common.MB}
+	return
+}
+
+// 实现io.Writer接口：数据先缓存在buffer中，满replicaBufferSize字节后写入所有副本
+func (s *ReplicaPutStream) Write(p []byte) (n int, err error) {
+	var next int
+
+	if s.whole {
+		s.buffer = append(s.buffer, p...)
+		return len(p), nil
+	}
+	for n < len(p) {
+		if next = replicaBufferSize - len(s.buffer); next > len(p)-n {
+			next = len(p) - n
+		}
+		s.buffer = append(s.buffer, p[n:n+next]...)
+		if len(s.buffer) == replicaBufferSize {
+			s.Flush()
+		}
+		n += next
+	}
+	return
+}
+
+// 将buffer中的数据写入所有副本
+func (s *ReplicaPutStream) Flush() {
+	var i int
+
+	if len(s.buffer) == 0 {
+		return
+	}
+	for i = range s.writers {
+		if s.writers[i] != nil {
+			s.writers[i].Write(s.buffer)
+		}
+	}
+	s.buffer = []byte{}
+}
+
+// 提交上传数据流（先将最后一批数据写入所有副本）
+func (s *ReplicaPutStream) Commit(success bool) {
+	var i int
+
+	if success {
+		s.Flush()
+	}
+	for i = range s.writers {
+		if s.writers[i] != nil {
+			s.writers[i].(*TempPutStream).Commit(success)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package stream
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 
 	"common"
 	"config"
@@ -10,10 +11,15 @@ import (
 
 type RSGetStream struct {
 	*getEncoder
+	locateInfo map[int]string // 各分片所在的数据节点（用于Seek时重新打开分片读取流）
+	hash       string
 }
 
-// 生成纠删码下载流
-func NewRSGetStream(locateInfo map[int]string, hash string, size int64) (stream *RSGetStream, err error) {
+// 生成纠删码下载流（ec为对象写入时的纠删码方案）
+func NewRSGetStream(locateInfo map[int]string, hash string, size int64, ec common.ECScheme) (
+	stream *RSGetStream, err error) {
+
+
 	var (
 		readers   []io.Reader
 		reader    io.Reader
@@ -37,7 +43,7 @@ func NewRSGetStream(locateInfo map[int]string, hash string, size int64) (stream
 	// 那么该reader对应的创建一个分片写入流，用于修复分片，
 	// 此时readers数组和writers数组形成互补的关系
 	writers = make([]io.Writer, len(locateInfo))
-	shardSize = (size + int64(config.GConfig.DataShards) - 1) / int64(config.GConfig.DataShards)
+	shardSize = ec.ShardSize(size)
 	for i = range readers {
 		if readers[i] == nil {
 			if writers[i], err = NewTempPutStream(
@@ -50,8 +56,60 @@ func NewRSGetStream(locateInfo map[int]string, hash string, size int64) (stream
 	}
 
 	// 将readers数组和writers数组生成纠删码的编码器，用于获取正确的数据流
-	encoder = NewGetEncoder(readers, writers, size)
-	return &RSGetStream{encoder}, nil
+	encoder = NewGetEncoder(readers, writers, size, ec)
+	return &RSGetStream{encoder, locateInfo, hash}, nil
+}
+
+// -------------------------------------------
+// 生成纠删码重建流：从locateInfo中的数据节点读取分片，
+// 将targets中的分片（key为分片下标，value为目标数据节点）由纠删码恢复后写入目标数据节点（用于数据迁移）
+// NOTE: targets中的分片不从locateInfo读取；读取完成后调用Close提交重建的分片，读取出错时调用Abort放弃
+// -------------------------------------------
+func NewRSRebuildStream(locateInfo map[int]string, targets map[int]string, hash string, size int64,
+	ec common.ECScheme) (stream *RSGetStream, err error) {
+
+	var (
+		readers   = make([]io.Reader, ec.AllShards())
+		writers   = make([]io.Writer, ec.AllShards())
+		reader    io.Reader
+		shardSize int64
+		target    string
+		ok        bool
+		i         int
+	)
+
+	shardSize = ec.ShardSize(size)
+	for i = 0; i < ec.AllShards(); i++ {
+		if target, ok = targets[i]; ok {
+			if writers[i], err = NewTempPutStream(target, fmt.Sprintf("%s.%d", hash, i), shardSize); err != nil {
+				abortWriters(writers)
+				return
+			}
+			continue
+		}
+		if reader, err = NewGetStream(locateInfo[i], fmt.Sprintf("%s.%d", hash, i)); err == nil {
+			readers[i] = reader
+		}
+	}
+	return &RSGetStream{NewGetEncoder(readers, writers, size, ec), locateInfo, hash}, nil
+}
+
+// -------------------------------------------
+// 生成从对象offset处开始读取的纠删码下载流（用于Range请求）
+// NOTE: 只从各分片读取offset所在条带及之后的数据，不会下载offset之前的数据；
+//       dataServer按块校验返回的数据，校验失败的分片返回404或者中断读取，由其他分片解码出该分片的数据，
+//       该下载流不进行分片修复（校验失败的分片由dataServer加入待修复集合）
+// -------------------------------------------
+func NewRSRangeGetStream(locateInfo map[int]string, hash string, size int64, offset int64, ec common.ECScheme) (
+	stream *RSGetStream, err error) {
+
+	stream = &RSGetStream{
+		NewGetEncoder(make([]io.Reader, ec.AllShards()), make([]io.Writer, ec.AllShards()), size, ec),
+		locateInfo,
+		hash,
+	}
+	err = stream.seekTo(offset, false)
+	return
 }
 
 // 关闭纠删码下载流
@@ -64,32 +122,107 @@ func (s *RSGetStream) Close() {
 			s.writers[i].(*TempPutStream).Commit(true)
 		}
 	}
+	s.closeReaders()
 }
 
-// 移动纠删码下载流的读取指针（用于断点续传）
-func (s *RSGetStream) Seek(offset int64, whence int) (err error) {
-	var (
-		length int64
-		buffer []byte
-	)
+// 放弃纠删码下载流：删除所有修复分片的临时对象（用于读取出错、修复的数据不完整时）
+func (s *RSGetStream) Abort() {
+	abortWriters(s.writers)
+	s.closeReaders()
+}
 
+// 删除修复分片的临时对象
+func abortWriters(writers []io.Writer) {
+	var i int
+	for i = range writers {
+		if writers[i] != nil {
+			writers[i].(*TempPutStream).Commit(false)
+		}
+	}
+}
+
+// 关闭所有分片读取流
+func (s *RSGetStream) closeReaders() {
+	var i int
+	for i = range s.readers {
+		if closer, ok := s.readers[i].(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+// 移动纠删码下载流的读取指针（用于断点续传和Range请求），返回移动后的读取位置
+// NOTE: 若目标位置在当前已解码的buffer内，则直接丢弃buffer中的数据；
+//       否则按照目标位置所在的条带重新打开各分片的读取流，只需丢弃条带内offset之前的数据
+func (s *RSGetStream) Seek(offset int64, whence int) (position int64, err error) {
 	// 参数检查：起跳点whence只支持io.SeekCurrent，且只支持向后偏移
+	position = s.total - int64(s.bufferSize)
 	if whence != io.SeekCurrent {
 		err = common.ErrOnlySeekCurrent
+		return
 	}
 	if offset < 0 {
 		err = common.ErrOnlyForwardSeek
+		return
 	}
 
-	// 读取offset字节内容并丢弃
-	// 调用io.ReadFull读取，每次读取config.GConfig.BlockSize字节到buffer
-	for offset != 0 {
-		if length = int64(config.GConfig.BlockSize); offset < length {
-			length = offset
+	if offset <= int64(s.bufferSize) {
+		s.buffer = s.buffer[offset:]
+		s.bufferSize -= int(offset)
+	} else {
+		err = s.seekTo(position+offset, true)
+	}
+	position = s.total - int64(s.bufferSize)
+	return
+}
+
+// -------------------------------------------
+// 将下载流定位到对象的position处
+// 1) 每个条带（stripe）由各数据分片的BlockPerShard字节组成，解码后为对象的BlockSize字节，
+//    故position所在条带为position/BlockSize，各分片从stripe*BlockPerShard处开始读取；
+// 2) skipBroken为true时，之前已经无法读取的分片不再重新打开，仍由纠删码进行数据恢复；
+// 3) 只读取了部分分片数据，无法完整修复分片，故放弃已有的分片修复写入流
+// -------------------------------------------
+func (s *RSGetStream) seekTo(position int64, skipBroken bool) (err error) {
+	var (
+		stripe      int64
+		shardOffset int64
+		reader      *GetStream
+		broken      bool
+		i           int
+	)
+
+	if position >= s.size {
+		s.closeReaders()
+		s.total, s.buffer, s.bufferSize = s.size, nil, 0
+		return
+	}
+	stripe = position / int64(BlockSize(s.ec))
+	shardOffset = stripe * int64(config.GConfig.BlockPerShard)
+
+	s.closeReaders()
+	for i = range s.readers {
+		broken = s.readers[i] == nil
+		s.readers[i] = nil
+		if s.writers[i] != nil {
+			s.writers[i].(*TempPutStream).Commit(false)
+			s.writers[i] = nil
+		}
+		if broken && skipBroken {
+			continue
+		}
+		if reader, err = NewRangeGetStream(
+			s.locateInfo[i], fmt.Sprintf("%s.%d", s.hash, i), shardOffset,
+		); err == nil {
+			s.readers[i] = reader
 		}
-		buffer = make([]byte, length)
-		io.ReadFull(s, buffer)
-		offset -= length
+	}
+	err = nil
+
+	// 丢弃条带内position之前的数据
+	s.total, s.buffer, s.bufferSize = stripe*int64(BlockSize(s.ec)), nil, 0
+	if position > s.total {
+		_, err = io.CopyN(ioutil.Discard, s, position-s.total)
 	}
 	return
 }
@@ -4,6 +4,7 @@ import (
 	"github.com/klauspost/reedsolomon"
 	"io"
 
+	"common"
 	"config"
 )
 
@@ -11,19 +12,21 @@ type getEncoder struct {
 	readers    []io.Reader
 	writers    []io.Writer
 	enc        reedsolomon.Encoder
+	ec         common.ECScheme
 	size       int64
 	buffer     []byte
 	bufferSize int
 	total      int64
 }
 
-// 生成纠删码读取数据流的编码器
-func NewGetEncoder(readers []io.Reader, writers []io.Writer, size int64) *getEncoder {
-	enc, _ := reedsolomon.New(int(config.GConfig.DataShards), int(config.GConfig.ParityShards))
+// 生成纠删码读取数据流的编码器（按照对象写入时的纠删码方案ec进行解码）
+func NewGetEncoder(readers []io.Reader, writers []io.Writer, size int64, ec common.ECScheme) *getEncoder {
+	enc, _ := reedsolomon.New(ec.DataShards, ec.ParityShards)
 	return &getEncoder{
 		readers,
 		writers,
 		enc,
+		ec,
 		size,
 		nil,
 		0,
@@ -59,6 +62,7 @@ func (encoder *getEncoder) readData() (err error) {
 		shards     [][]byte
 		repairIds  []int
 		shardSize  int64
+		stripeSize int
 		needRepair bool
 		i          int
 		n          int
@@ -70,39 +74,46 @@ func (encoder *getEncoder) readData() (err error) {
 	}
 
 	// 预处理readers数组：
-	// 1) reader不为nil：将config.GConfig.BlockPerShard读入内存buffer，作为后面修复的源数据
+	// 1) reader不为nil：将本条带中每个分片的数据（stripeSize字节）读入内存buffer，作为后面修复的源数据
 	//    纠删码的Reconstruct修复因为在内存中计算，故需开辟buffer，一批一批数据进行修复
-	// 2) reader为nil：将下标收集到repairIds数组中
-	shards = make([][]byte, config.GConfig.AllShards)
+	// 2) reader为nil、读取出错或读取的数据不足stripeSize（dataServer中断了响应）：将下标收集到repairIds数组中，
+	//    并关闭该reader，之后的条带不再从该分片读取
+	shards = make([][]byte, encoder.ec.AllShards())
 	repairIds = make([]int, 0)
 	needRepair = false
+	stripeSize = encoder.stripeShardSize()
 	for i = range encoder.readers {
-		if encoder.readers[i] == nil {
-			repairIds = append(repairIds, i)
-			needRepair = true
-		} else {
-			shards[i] = make([]byte, config.GConfig.BlockPerShard)
-			n, err = io.ReadFull(encoder.readers[i], shards[i])
-			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		if encoder.readers[i] != nil {
+			shards[i] = make([]byte, stripeSize)
+			if n, err = io.ReadFull(encoder.readers[i], shards[i]); n < stripeSize {
 				shards[i] = nil
-			} else if n != config.GConfig.BlockPerShard {
-				shards[i] = shards[i][:n]
+				if closer, ok := encoder.readers[i].(io.Closer); ok {
+					closer.Close()
+				}
+				encoder.readers[i] = nil
 			}
 		}
+		if shards[i] == nil {
+			repairIds = append(repairIds, i)
+			needRepair = true
+		}
 	}
 
-	// 修复出正确的数据返回给调用者，并将需要修复写入的分片写入此temp数据流
+	// 修复出正确的数据返回给调用者，并将需要修复写入的分片写入此temp数据流（没有修复写入流的分片只恢复数据）
+	err = nil
 	if needRepair {
 		if err = encoder.enc.Reconstruct(shards); err != nil {
 			return
 		}
 		for i = range repairIds {
-			encoder.writers[repairIds[i]].Write(shards[repairIds[i]])
+			if encoder.writers[repairIds[i]] != nil {
+				encoder.writers[repairIds[i]].Write(shards[repairIds[i]])
+			}
 		}
 	}
 
 	// 累加编码器中的cache、cacheSize、total值
-	for i = 0; i < int(config.GConfig.DataShards); i++ {
+	for i = 0; i < encoder.ec.DataShards; i++ {
 		shardSize = int64(len(shards[i]))
 		if encoder.total+shardSize > encoder.size {
 			shardSize -= encoder.total + shardSize - encoder.size
@@ -113,3 +124,16 @@ func (encoder *getEncoder) readData() (err error) {
 	}
 	return
 }
+
+// 当前条带中每个分片的数据量：分片按BlockPerShard字节划分条带，最后一个条带为分片剩余的数据
+// NOTE: 每次读取一个完整的条带，故已读取的条带数为total/BlockSize
+func (encoder *getEncoder) stripeShardSize() int {
+	var remain int64
+
+	remain = encoder.ec.ShardSize(encoder.size) -
+		encoder.total/int64(BlockSize(encoder.ec))*int64(config.GConfig.BlockPerShard)
+	if remain > int64(config.GConfig.BlockPerShard) {
+		return config.GConfig.BlockPerShard
+	}
+	return int(remain)
+}
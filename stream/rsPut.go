@@ -4,30 +4,31 @@ import (
 	"common"
 	"fmt"
 	"io"
-
-	"config"
 )
 
 type RSPutStream struct {
 	*putEncoder
 }
 
-// 创建用于纠删码读写的put数据流
-func NewRSPutStream(dataServers []string, hash string, size int64) (stream *RSPutStream, err error) {
+// 创建用于纠删码读写的put数据流（按照纠删码方案ec将对象编码为ec.AllShards()个分片）
+func NewRSPutStream(dataServers []string, hash string, size int64, ec common.ECScheme) (
+	stream *RSPutStream, err error) {
+
+
 	var (
 		perShard int64
 		writers  []io.Writer
 		encoder  *putEncoder
 		i        int
 	)
-	if len(dataServers) != int(config.GConfig.AllShards) {
+	if len(dataServers) != ec.AllShards() {
 		err = common.ErrNotEnoughDS
 		return
 	}
 
-	// 生成纠删码编码器（config.GConfig.AllShards个writer）
-	perShard = (size + int64(config.GConfig.DataShards) - 1) / int64(config.GConfig.DataShards)
-	writers = make([]io.Writer, config.GConfig.AllShards)
+	// 生成纠删码编码器（ec.AllShards()个writer）
+	perShard = ec.ShardSize(size)
+	writers = make([]io.Writer, ec.AllShards())
 	for i = range writers {
 		if dataServers[i] != "" {
 			if writers[i], err = NewTempPutStream(
@@ -37,7 +38,7 @@ func NewRSPutStream(dataServers []string, hash string, size int64) (stream *RSPu
 			}
 		}
 	}
-	encoder = NewPutEncoder(writers)
+	encoder = NewPutEncoder(writers, ec)
 
 	// 生成纠删码下载流
 	stream = &RSPutStream{encoder}
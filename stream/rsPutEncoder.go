@@ -4,19 +4,26 @@ import (
 	"github.com/klauspost/reedsolomon"
 	"io"
 
+	"common"
 	"config"
 )
 
 type putEncoder struct {
-	writers []io.Writer
-	enc     reedsolomon.Encoder
-	buffer  []byte
+	writers   []io.Writer
+	enc       reedsolomon.Encoder
+	buffer    []byte
+	blockSize int
 }
 
-// 生成纠删码上传数据流的编码器
-func NewPutEncoder(writers []io.Writer) *putEncoder {
-	enc, _ := reedsolomon.New(int(config.GConfig.DataShards), int(config.GConfig.ParityShards))
-	return &putEncoder{writers, enc, nil}
+// 生成纠删码上传数据流的编码器（按照对象的纠删码方案ec进行编码）
+func NewPutEncoder(writers []io.Writer, ec common.ECScheme) *putEncoder {
+	enc, _ := reedsolomon.New(ec.DataShards, ec.ParityShards)
+	return &putEncoder{writers, enc, nil, BlockSize(ec)}
+}
+
+// 纠删码方案ec每批编码的数据量：每个数据分片BlockPerShard字节
+func BlockSize(ec common.ECScheme) int {
+	return config.GConfig.BlockPerShard * ec.DataShards
 }
 
 // 实现io.Writer接口
@@ -30,13 +37,13 @@ func (encoder *putEncoder) Write(p []byte) (n int, err error) {
 	remain = len(p)
 	curOffset = 0
 
-	// 循环读取，最大读取config.GConfig.BlockSize字节到buffer中，之后执行Flush阶段
+	// 循环读取，最大读取blockSize字节到buffer中，之后执行Flush阶段
 	for remain != 0 {
-		if next = int(config.GConfig.BlockSize) - len(encoder.buffer); next > remain {
+		if next = encoder.blockSize - len(encoder.buffer); next > remain {
 			next = remain
 		}
 		encoder.buffer = append(encoder.buffer, p[curOffset:curOffset+next]...)
-		if len(encoder.buffer) == int(config.GConfig.BlockSize) {
+		if len(encoder.buffer) == encoder.blockSize {
 			encoder.Flush()
 		}
 		curOffset += next
@@ -1,9 +1,8 @@
 package stream
 
 import (
+	"common"
 	"io"
-
-	"config"
 )
 
 type RSRecoverableGetStream struct {
@@ -11,7 +10,7 @@ type RSRecoverableGetStream struct {
 }
 
 // 生成可恢复的下载数据流
-func NewRSRecoverableGetStream(dataServers []string, UUIDs []string, size int64) (
+func NewRSRecoverableGetStream(dataServers []string, UUIDs []string, size int64, ec common.ECScheme) (
 	stream *RSRecoverableGetStream, err error) {
 	var (
 		readers []io.Reader
@@ -21,14 +20,14 @@ func NewRSRecoverableGetStream(dataServers []string, UUIDs []string, size int64)
 	)
 
 	// 生成纠删码编码器（同样数量的reader和writer，形成互补的关系）
-	readers = make([]io.Reader, config.GConfig.AllShards)
-	for i = 0; i < config.GConfig.AllShards; i++ {
+	readers = make([]io.Reader, ec.AllShards())
+	for i = 0; i < ec.AllShards(); i++ {
 		if readers[i], err = NewTempGetStream(dataServers[i], UUIDs[i]); err != nil {
 			return
 		}
 	}
-	writers = make([]io.Writer, config.GConfig.AllShards)
-	encoder = NewGetEncoder(readers, writers, size)
+	writers = make([]io.Writer, ec.AllShards())
+	encoder = NewGetEncoder(readers, writers, size, ec)
 
 	// 生成可恢复的下载流（经过纠删码编码的）
 	stream = &RSRecoverableGetStream{encoder}
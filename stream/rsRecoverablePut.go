@@ -17,11 +17,13 @@ import (
 )
 
 type recoverableToken struct {
+	Bucket  string
 	Name    string
 	Size    int64
 	Hash    string
 	Servers []string
 	UUIDs   []string
+	EC      common.ECScheme
 }
 
 type RSRecoverablePutStream struct {
@@ -30,7 +32,7 @@ type RSRecoverablePutStream struct {
 }
 
 // 生成可恢复的上传数据流（经过纠删码编码器处理的数据流）
-func NewRSRecoverablePutStream(dataServers []string, name, hash string, size int64) (
+func NewRSRecoverablePutStream(dataServers []string, bucket, name, hash string, size int64, ec common.ECScheme) (
 	stream *RSRecoverablePutStream, err error) {
 
 	var (
@@ -41,18 +43,18 @@ func NewRSRecoverablePutStream(dataServers []string, name, hash string, size int
 	)
 
 	// 生成纠删码下载流
-	if putStream, err = NewRSPutStream(dataServers, hash, size); err != nil {
+	if putStream, err = NewRSPutStream(dataServers, hash, size, ec); err != nil {
 		return
 	}
 
 	// 获取所有TempPutStream中的uuid，并生成用于恢复的token
-	uuidSlice = make([]string, config.GConfig.AllShards)
+	uuidSlice = make([]string, ec.AllShards())
 	for i = range uuidSlice {
 		if putStream.writers[i] != nil {
 			uuidSlice[i] = putStream.writers[i].(*TempPutStream).Uuid
 		}
 	}
-	token = &recoverableToken{name, size, hash, dataServers, uuidSlice}
+	token = &recoverableToken{bucket, name, size, hash, dataServers, uuidSlice, ec}
 
 	// 组合成可恢复的纠删码下载流
 	stream = &RSRecoverablePutStream{putStream, token}
@@ -95,8 +97,13 @@ func RecoverPutStream(r *http.Request) (stream *RSRecoverablePutStream, err erro
 	}
 	json.Unmarshal(streamBytes, &Token)
 
+	// 旧版本生成的token中没有纠删码方案，使用旧方案
+	if Token.EC.IsZero() {
+		Token.EC = config.GConfig.LegacyScheme
+	}
+
 	// 构造所有的io.Writer变量：TempPutStream流
-	writers = make([]io.Writer, config.GConfig.AllShards)
+	writers = make([]io.Writer, Token.EC.AllShards())
 	for i = range writers {
 		if Token.Servers[i] != "" {
 			writers[i] = &TempPutStream{Server: Token.Servers[i], Uuid: Token.UUIDs[i]}
@@ -106,7 +113,7 @@ func RecoverPutStream(r *http.Request) (stream *RSRecoverablePutStream, err erro
 	}
 
 	// 构造纠删码编码器
-	encoder = NewPutEncoder(writers)
+	encoder = NewPutEncoder(writers, Token.EC)
 	stream = &RSRecoverablePutStream{
 		RSPutStream:      &RSPutStream{encoder},
 		recoverableToken: &Token,
@@ -166,7 +173,7 @@ func (s *RSRecoverablePutStream) CurrentSize() (currentSize int64) {
 	}
 
 	// 从响应头部解析出当前的size
-	currentSize = utils.GetSizeFromHeader(response.Header) * int64(config.GConfig.AllShards)
+	currentSize = utils.GetSizeFromHeader(response.Header) * int64(s.EC.AllShards())
 	if int64(currentSize) > s.Size {
 		currentSize = s.Size
 	}
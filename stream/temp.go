@@ -16,7 +16,7 @@ type TempPutStream struct {
 // 生成temp上传流：调用dataServer的temp接口进行hash验证，
 // 若dataServer验证hash通过，则返回数据流，否则返回404，由apiServer生成修复数据流
 func NewTempGetStream(server, uuid string) (*GetStream, error) {
-	return newGetStream("http://" + server + "/temp/" + uuid)
+	return newGetStream("http://"+server+"/temp/"+uuid, 0)
 }
 
 func NewTempPutStream(server, object string, size int64) (putStream *TempPutStream, err error) {
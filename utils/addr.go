@@ -18,6 +18,22 @@ func GetRabbitMqUrl() (rabbitMQUrl string) {
 	return
 }
 
+// 获取接收心跳推送的apiServer地址列表（心跳传输方式为http时使用）
+func GetHeartbeatApiServers() (servers []string) {
+	var server string
+
+	if os.Getenv("DOSS_HEARTBEAT_API_SERVERS") == "" {
+		servers = config.GConfig.HeartbeatApiServers
+		return
+	}
+	for _, server = range strings.Split(os.Getenv("DOSS_HEARTBEAT_API_SERVERS"), ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			servers = append(servers, server)
+		}
+	}
+	return
+}
+
 // 获取MongoDB的连接地址
 func GetMongodbUrl() (mongodbUrl string) {
 	if os.Getenv("DOSS_MONGO_URL") != "" {
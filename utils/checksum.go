@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"common"
+)
+
+// 按块校验和使用的CRC-32C表
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// -------------------------------------------
+// 按块校验和：将数据按blockSize字节分块，每块计算CRC-32C校验和（实现io.Writer，写入时流式计算）
+// 校验和文件格式：4字节块大小 + 每块4字节校验和（均为大端序），最后一块可以不满blockSize
+// NOTE: 用于区间读取大文件分片：只需读取并校验区间所在的块，不必读取整个分片计算hash值
+// -------------------------------------------
+type BlockChecksum struct {
+	blockSize int
+	filled    int
+	crc       hash.Hash32
+	sums      []byte
+}
+
+func NewBlockChecksum(blockSize int) *BlockChecksum {
+	return &BlockChecksum{blockSize: blockSize, crc: crc32.New(castagnoli)}
+}
+
+func (c *BlockChecksum) Write(p []byte) (n int, err error) {
+	var size int
+
+	n = len(p)
+	for len(p) > 0 {
+		if size = c.blockSize - c.filled; size > len(p) {
+			size = len(p)
+		}
+		c.crc.Write(p[:size])
+		c.filled += size
+		p = p[size:]
+		if c.filled == c.blockSize {
+			c.finishBlock()
+		}
+	}
+	return
+}
+
+// 记录当前块的校验和，开始下一块
+func (c *BlockChecksum) finishBlock() {
+	var sum [4]byte
+
+	binary.BigEndian.PutUint32(sum[:], c.crc.Sum32())
+	c.sums = append(c.sums, sum[:]...)
+	c.crc.Reset()
+	c.filled = 0
+}
+
+// 将校验和写入文件（先写入临时文件再重命名，避免读取到不完整的校验和文件）
+func (c *BlockChecksum) Save(path string) (err error) {
+	var data []byte
+
+	if c.filled > 0 {
+		c.finishBlock()
+	}
+	data = make([]byte, 4, 4+len(c.sums))
+	binary.BigEndian.PutUint32(data, uint32(c.blockSize))
+	data = append(data, c.sums...)
+	if err = ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// -------------------------------------------
+// 按块校验地将文件从offset处拷贝至writer（sumPath为校验和文件路径），返回写入的字节数
+// 1) 从offset所在的块开始读取，每块校验通过后才写入该块（块内offset之前的数据不写入）；
+// 2) 校验和文件不存在、格式错误或者与文件大小不一致时返回ErrNoChecksum，此时没有写入任何数据；
+// 3) 某块校验失败时返回ErrBlockChecksum，written为之前已校验并写入的字节数
+// -------------------------------------------
+func VerifyBlockCopy(filePath, sumPath string, writer io.Writer, offset int64) (written int64, err error) {
+	var (
+		data      []byte
+		sums      []byte
+		blockSize int64
+		file      *os.File
+		fileInfo  os.FileInfo
+		block     []byte
+		index     int64
+		skip      int64
+		n         int
+	)
+
+	if data, err = ioutil.ReadFile(sumPath); err != nil || len(data) < 4 {
+		err = common.ErrNoChecksum
+		return
+	}
+	blockSize, sums = int64(binary.BigEndian.Uint32(data)), data[4:]
+	if file, err = os.Open(filePath); err != nil {
+		return
+	}
+	defer file.Close()
+	if fileInfo, err = file.Stat(); err != nil {
+		return
+	}
+	if blockSize <= 0 || int64(len(sums)) != (fileInfo.Size()+blockSize-1)/blockSize*4 {
+		err = common.ErrNoChecksum
+		return
+	}
+
+	index, skip = offset/blockSize, offset%blockSize
+	if _, err = file.Seek(index*blockSize, io.SeekStart); err != nil {
+		return
+	}
+	block = make([]byte, blockSize)
+	for ; index*4 < int64(len(sums)); index++ {
+		if n, err = io.ReadFull(file, block); err != nil && err != io.ErrUnexpectedEOF {
+			return
+		}
+		if crc32.Checksum(block[:n], castagnoli) != binary.BigEndian.Uint32(sums[index*4:]) {
+			err = common.ErrBlockChecksum
+			return
+		}
+		if n, err = writer.Write(block[skip:n]); err != nil {
+			written += int64(n)
+			return
+		}
+		written += int64(n)
+		skip = 0
+	}
+	return
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"common"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -39,3 +41,101 @@ func GetSizeFromHeader(header http.Header) (size int64) {
 	size, _ = strconv.ParseInt(header.Get("content-length"), 0, 64)
 	return
 }
+
+// 从请求头部解析出存储方案（x-doss-ec: k+m或Nx），请求头为空时返回空方案
+func GetECFromHeader(header http.Header) (ec common.ECScheme, err error) {
+	var value string
+
+	if value = header.Get("x-doss-ec"); value == "" {
+		return
+	}
+	return common.ParseECScheme(value)
+}
+
+// 字节区间：Start为区间的起始偏移量，Length为区间长度
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// 生成该区间的Content-Range响应头
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// -------------------------------------------
+// 从Range请求头中解析出对象的字节区间（size为对象大小）
+// 支持的形式：
+//   1) bytes=100-199：起止区间（结束位置超过对象大小时截断至对象末尾）；
+//   2) bytes=100-：从100到对象末尾；
+//   3) bytes=-500：对象的最后500个字节；
+//   4) bytes=0-99,200-299：多个区间
+// NOTE: 请求头为空时返回空的ranges；格式错误返回ErrInvalidRange，所有区间都不可满足时返回ErrRangeNotSatisfiable；
+//       按照RFC 7233，调用者应忽略格式错误的Range请求头（返回整个对象），只对ErrRangeNotSatisfiable返回416
+// -------------------------------------------
+func ParseRangeHeader(header string, size int64) (ranges []ByteRange, err error) {
+	var (
+		spec     string
+		index    int
+		startStr string
+		endStr   string
+		start    int64
+		end      int64
+	)
+
+	if header == "" {
+		return
+	}
+	if !strings.HasPrefix(header, "bytes=") {
+		err = common.ErrInvalidRange
+		return
+	}
+	for _, spec = range strings.Split(header[6:], ",") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		if index = strings.Index(spec, "-"); index < 0 {
+			err = common.ErrInvalidRange
+			return
+		}
+		startStr, endStr = strings.TrimSpace(spec[:index]), strings.TrimSpace(spec[index+1:])
+
+		// 后缀区间：对象的最后end个字节
+		if startStr == "" {
+			if end, err = strconv.ParseInt(endStr, 10, 64); err != nil || end < 0 {
+				err = common.ErrInvalidRange
+				return
+			}
+			if end > size {
+				end = size
+			}
+			if end > 0 {
+				ranges = append(ranges, ByteRange{Start: size - end, Length: end})
+			}
+			continue
+		}
+
+		// 起止区间（起始位置超出对象大小的区间不可满足，忽略该区间）
+		if start, err = strconv.ParseInt(startStr, 10, 64); err != nil || start < 0 {
+			err = common.ErrInvalidRange
+			return
+		}
+		end = size - 1
+		if endStr != "" {
+			if end, err = strconv.ParseInt(endStr, 10, 64); err != nil || end < start {
+				err = common.ErrInvalidRange
+				return
+			}
+			if end >= size {
+				end = size - 1
+			}
+		}
+		if start < size {
+			ranges = append(ranges, ByteRange{Start: start, Length: end - start + 1})
+		}
+	}
+	if len(ranges) == 0 {
+		err = common.ErrRangeNotSatisfiable
+	}
+	return
+}
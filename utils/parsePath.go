@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// 存储桶名规则（与S3一致）：3~63个字符，只能包含小写字母、数字、"-"和"."，且以字母或数字开头和结尾
+var bucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.\-]{1,61}[a-z0-9]$`)
+
+// 判断存储桶名是否合法
+func IsValidBucketName(bucket string) bool {
+	return bucketNameRegexp.MatchString(bucket)
+}
+
+// -------------------------------------------
+// 从请求路径中解析出存储桶名和对象名
+// 路径形式：/<接口名>/<bucket>/<object_name>，对象名中可以包含"/"（如：/objects/bucket/a/b/c.txt）
+// NOTE: 传入的应为r.URL.EscapedPath()，返回的对象名为规范的转义形式（见CanonicalObjectName），
+//       同一对象名的不同转义形式（如"a%2Fb"和"a/b"）对应同一个对象，并与S3接口的对象名一致
+// -------------------------------------------
+func GetBucketObjectFromPath(escapedPath string) (bucket string, name string) {
+	var parts []string
+
+	parts = strings.SplitN(strings.TrimPrefix(escapedPath, "/"), "/", 3)
+	if len(parts) > 1 {
+		bucket = parts[1]
+	}
+	if len(parts) > 2 {
+		name = CanonicalObjectName(parts[2])
+	}
+	return
+}
+
+// 将请求路径中转义的对象名规范化：先反转义，再按照EscapeObjectName转义（反转义失败时保持原样）
+func CanonicalObjectName(escapedName string) string {
+	var (
+		name string
+		err  error
+	)
+
+	if name, err = url.PathUnescape(escapedName); err != nil {
+		return escapedName
+	}
+	return EscapeObjectName(name)
+}
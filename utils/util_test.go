@@ -1,10 +1,13 @@
 package utils
 
 import (
+	"bytes"
+	"common"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -43,6 +46,106 @@ func TestCalculateHash(t *testing.T) {
 	fmt.Println(url.PathEscape(expect))
 }
 
+func TestGetBucketObjectFromPath(t *testing.T) {
+	var cases = []struct {
+		path   string
+		bucket string
+		name   string
+	}{
+		{"/objects/bucket/test.txt", "bucket", "test.txt"},
+		{"/objects/bucket/a/b/c.txt", "bucket", "a/b/c.txt"},
+		{"/objects/bucket/a%2Fb%20c", "bucket", "a/b%20c"},
+		{"/objects/bucket/a%41%25", "bucket", "aA%25"},
+		{"/objects/bucket", "bucket", ""},
+		{"/objects/", "", ""},
+	}
+	for _, c := range cases {
+		bucket, name := GetBucketObjectFromPath(c.path)
+		if bucket != c.bucket || name != c.name {
+			t.Errorf("path %s: expect (%s, %s), but got (%s, %s)", c.path, c.bucket, c.name, bucket, name)
+		}
+	}
+
+	if !IsValidBucketName("doss-test.01") || IsValidBucketName("Doss") || IsValidBucketName("ab") {
+		t.Error("IsValidBucketName error.")
+	}
+}
+
+func TestParseRangeHeader(t *testing.T) {
+	var cases = []struct {
+		header string
+		ranges []ByteRange
+		err    error
+	}{
+		{"", nil, nil},
+		{"bytes=100-199", []ByteRange{{100, 100}}, nil},
+		{"bytes=100-", []ByteRange{{100, 900}}, nil},
+		{"bytes=-500", []ByteRange{{500, 500}}, nil},
+		{"bytes=-2000", []ByteRange{{0, 1000}}, nil},
+		{"bytes=900-2000", []ByteRange{{900, 100}}, nil},
+		{"bytes=0-99, 200-299", []ByteRange{{0, 100}, {200, 100}}, nil},
+		{"bytes=0-99,1000-1099", []ByteRange{{0, 100}}, nil},
+		{"bytes=1000-", nil, common.ErrRangeNotSatisfiable},
+		{"bytes=-0", nil, common.ErrRangeNotSatisfiable},
+		{"bytes=200-100", nil, common.ErrInvalidRange},
+		{"bytes=abc", nil, common.ErrInvalidRange},
+		{"items=0-1", nil, common.ErrInvalidRange},
+	}
+	for _, c := range cases {
+		ranges, err := ParseRangeHeader(c.header, 1000)
+		if err != c.err {
+			t.Errorf("header %q: expect err %v, but got %v", c.header, c.err, err)
+			continue
+		}
+		if c.err == nil && fmt.Sprint(ranges) != fmt.Sprint(c.ranges) {
+			t.Errorf("header %q: expect %v, but got %v", c.header, c.ranges, ranges)
+		}
+	}
+	if r := (ByteRange{100, 100}); r.ContentRange(1000) != "bytes 100-199/1000" {
+		t.Error("ContentRange error:", r.ContentRange(1000))
+	}
+}
+
+func TestGetECFromHeader(t *testing.T) {
+	var cases = []struct {
+		value string
+		ec    common.ECScheme
+		err   error
+	}{
+		{"", common.ECScheme{}, nil},
+		{"4+2", common.ECScheme{DataShards: 4, ParityShards: 2, Mode: common.StorageModeEC}, nil},
+		{" 10 + 4 ", common.ECScheme{DataShards: 10, ParityShards: 4, Mode: common.StorageModeEC}, nil},
+		{"3x", common.NewReplicaScheme(3), nil},
+		{"4", common.ECScheme{}, common.ErrInvalidECScheme},
+		{"4+0", common.ECScheme{}, common.ErrInvalidECScheme},
+		{"0+2", common.ECScheme{}, common.ErrInvalidECScheme},
+		{"200+100", common.ECScheme{}, common.ErrInvalidECScheme},
+		{"a+b", common.ECScheme{}, common.ErrInvalidECScheme},
+		{"1x", common.ECScheme{}, common.ErrInvalidECScheme},
+		{"ax", common.ECScheme{}, common.ErrInvalidECScheme},
+	}
+	for _, c := range cases {
+		header := http.Header{}
+		if c.value != "" {
+			header.Set("x-doss-ec", c.value)
+		}
+		ec, err := GetECFromHeader(header)
+		if err != c.err {
+			t.Errorf("value %q: expect err %v, but got %v", c.value, c.err, err)
+			continue
+		}
+		if c.err == nil && ec != c.ec {
+			t.Errorf("value %q: expect %v, but got %v", c.value, c.ec, ec)
+		}
+	}
+	if ec := (common.ECScheme{DataShards: 10, ParityShards: 4}); ec.String() != "10+4" || ec.ShardSize(21) != 3 {
+		t.Error("ECScheme error:", ec.String(), ec.ShardSize(21))
+	}
+	if ec := common.NewReplicaScheme(3); ec.String() != "3x" || ec.AllShards() != 3 || ec.ShardSize(21) != 21 {
+		t.Error("replica scheme error:", ec.String(), ec.AllShards(), ec.ShardSize(21))
+	}
+}
+
 func TestWatchObjects(t *testing.T) {
 	var (
 		path = "/var/lib/Doss/6/objects"
@@ -221,6 +324,71 @@ func TestSeekCopy(t *testing.T) {
 	}
 }
 
+func TestVerifyBlockCopy(t *testing.T) {
+	var (
+		dir       string
+		filePath  string
+		sumPath   string
+		data      = []byte(strings.Repeat("0123456789", 10)) // 100字节，块大小16时最后一块为4字节
+		checksums *BlockChecksum
+		buffer    bytes.Buffer
+		written   int64
+		err       error
+	)
+
+	if dir, err = ioutil.TempDir("", "doss_checksum"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath, sumPath = dir+"/shard", dir+"/shard.sum"
+	if err = ioutil.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有校验和文件
+	if _, err = VerifyBlockCopy(filePath, sumPath, &buffer, 0); err != common.ErrNoChecksum {
+		t.Error("expected ErrNoChecksum, got", err)
+	}
+
+	// 分多次写入计算校验和，从块内的任意位置开始读取
+	checksums = NewBlockChecksum(16)
+	_, _ = checksums.Write(data[:7])
+	_, _ = checksums.Write(data[7:])
+	if err = checksums.Save(sumPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, offset := range []int64{0, 5, 16, 97, 100} {
+		buffer.Reset()
+		if written, err = VerifyBlockCopy(filePath, sumPath, &buffer, offset); err != nil {
+			t.Error("offset", offset, "err:", err)
+		}
+		if written != int64(len(data))-offset || !bytes.Equal(buffer.Bytes(), data[offset:]) {
+			t.Errorf("offset %d: copied %q", offset, buffer.String())
+		}
+	}
+
+	// 第三块损坏：之前的块正常返回，损坏的块及之后的数据不返回
+	data[40] = 'x'
+	if err = ioutil.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	buffer.Reset()
+	if written, err = VerifyBlockCopy(filePath, sumPath, &buffer, 10); err != common.ErrBlockChecksum || written != 22 {
+		t.Error("expected ErrBlockChecksum after 22 bytes, got", written, err)
+	}
+	if _, err = VerifyBlockCopy(filePath, sumPath, &buffer, 64); err != nil {
+		t.Error("blocks after the corrupted one should pass, got", err)
+	}
+
+	// 文件大小与校验和不一致
+	if err = ioutil.WriteFile(filePath, data[:50], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VerifyBlockCopy(filePath, sumPath, &buffer, 0); err != common.ErrNoChecksum {
+		t.Error("expected ErrNoChecksum for truncated file, got", err)
+	}
+}
+
 func TestJWT(t *testing.T) {
 	// const (
 	// 	JwtSecretKey = "welcome to wangshubo's blog"
@@ -21,6 +21,19 @@ func SliceHasMember(slice []string, member string) bool {
 	return false
 }
 
+// 判断两个slice的元素（及其顺序）是否相同
+func SliceEqual(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // slice元素去重
 func SliceRemoveReplica(slice []string) (outSlice []string) {
 	var (
@@ -48,6 +61,11 @@ func SliceIndexOfMember(slice []string, member string) int {
 	return -1
 }
 
+// 将对象名转义为URL路径形式（与r.URL.EscapedPath()保持一致，"/"不转义）
+func EscapeObjectName(name string) string {
+	return (&url.URL{Path: name}).EscapedPath()
+}
+
 // io.Reader计算sha256散列值
 func CalculateHash(r io.Reader) string {
 	var Hash = sha256.New()